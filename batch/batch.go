@@ -0,0 +1,434 @@
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+
+	"github.com/dan-lugg/go-commands/commands"
+	"github.com/dan-lugg/go-commands/util"
+)
+
+var (
+	ErrBatchStopped = errors.New("batch stopped")
+)
+
+const (
+	// DefaultConcurrency is the number of records a Runner dispatches at once unless overridden
+	// with WithConcurrency.
+	DefaultConcurrency = 8
+
+	// DefaultCheckpointInterval is the number of records between two saves of a Checkpoint unless
+	// overridden with WithCheckpoint.
+	DefaultCheckpointInterval = 100
+
+	// ReorderWindowFactor bounds the records an OutputOrdered Runner holds ahead of the first
+	// result it has not written yet, as a multiple of its concurrency.
+	ReorderWindowFactor = 4
+)
+
+// OutputMode determines the order in which a Runner writes its results.
+type OutputMode int
+
+const (
+	// OutputOrdered writes the results in the order of the records. At most
+	// ReorderWindowFactor times the concurrency records are read ahead of the first result
+	// not written yet, so a slow record pauses reading rather than buffering results.
+	OutputOrdered OutputMode = iota
+	// OutputUnordered writes each result as soon as its record completes.
+	OutputUnordered
+)
+
+// String returns the name of the OutputMode.
+func (m OutputMode) String() string {
+	switch m {
+	case OutputOrdered:
+		return "ordered"
+	case OutputUnordered:
+		return "unordered"
+	default:
+		return "unknown"
+	}
+}
+
+// ErrorMode determines what a Runner does when a record fails.
+type ErrorMode int
+
+const (
+	// ContinueOnError reports the failure in the output and carries on with the next records.
+	ContinueOnError ErrorMode = iota
+	// StopOnError reports the failure in the output, stops reading records and lets the
+	// records already dispatched complete.
+	StopOnError
+)
+
+// String returns the name of the ErrorMode.
+func (m ErrorMode) String() string {
+	switch m {
+	case ContinueOnError:
+		return "continue"
+	case StopOnError:
+		return "stop"
+	default:
+		return "unknown"
+	}
+}
+
+// Result is the outcome of one record, written as one line of the output.
+//
+// Fields:
+//   - ID: The ID of the record, or its line number if it has none.
+//   - Result: The JSON encoded result, if the command succeeded.
+//   - Error: A human-readable description of the failure, if the command failed.
+type Result struct {
+	ID     string          `json:"id"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// Summary describes a completed batch.
+//
+// Fields:
+//   - Succeeded: The number of records that succeeded.
+//   - Failed: The number of records that failed.
+//   - Checkpoint: The number of input lines handled, counting from the start of the input,
+//     including the lines skipped when resuming.
+type Summary struct {
+	Succeeded  int
+	Failed     int
+	Checkpoint int
+}
+
+// Runner dispatches newline-delimited commands.Envelope records from a reader through a
+// commands.Dispatcher, writing a newline-delimited Result for each.
+//
+// Blank lines are ignored. A line that is not a valid Envelope fails with an error wrapping
+// commands.ErrInvalidEnvelope.
+//
+// Fields:
+//   - dispatcher: The commands.Dispatcher the records are dispatched through.
+//   - concurrency: The number of records dispatched at once.
+//   - outputMode: The OutputMode of the Runner.
+//   - errorMode: The ErrorMode of the Runner.
+//   - checkpoint: An optional Checkpoint the progress is saved to and resumed from.
+//   - checkpointInterval: The number of records between two saves of the Checkpoint.
+type Runner struct {
+	dispatcher         *commands.Dispatcher
+	concurrency        int
+	outputMode         OutputMode
+	errorMode          ErrorMode
+	checkpoint         Checkpoint
+	checkpointInterval int
+}
+
+type RunnerOption = util.Option[*Runner]
+
+// WithConcurrency returns an option that sets the number of records a Runner dispatches at once.
+//
+// Parameters:
+//   - concurrency: The number of records dispatched at once; values below 1 are treated as 1.
+func WithConcurrency(concurrency int) RunnerOption {
+	return func(r *Runner) {
+		r.concurrency = max(concurrency, 1)
+	}
+}
+
+// WithOutputMode returns an option that sets the OutputMode of a Runner.
+//
+// Parameters:
+//   - outputMode: The OutputMode of the Runner.
+func WithOutputMode(outputMode OutputMode) RunnerOption {
+	return func(r *Runner) {
+		r.outputMode = outputMode
+	}
+}
+
+// WithErrorMode returns an option that sets the ErrorMode of a Runner.
+//
+// Parameters:
+//   - errorMode: The ErrorMode of the Runner.
+func WithErrorMode(errorMode ErrorMode) RunnerOption {
+	return func(r *Runner) {
+		r.errorMode = errorMode
+	}
+}
+
+// WithCheckpoint returns an option that sets the Checkpoint a Runner saves its progress to and resumes from.
+//
+// Parameters:
+//   - checkpoint: The Checkpoint of the Runner.
+//   - interval: The number of records between two saves; values below 1 use DefaultCheckpointInterval.
+func WithCheckpoint(checkpoint Checkpoint, interval int) RunnerOption {
+	return func(r *Runner) {
+		r.checkpoint = checkpoint
+		r.checkpointInterval = interval
+		if interval < 1 {
+			r.checkpointInterval = DefaultCheckpointInterval
+		}
+	}
+}
+
+// NewRunner creates and returns a new instance of Runner.
+//
+// By default the Runner uses DefaultConcurrency, OutputOrdered and ContinueOnError, and has no Checkpoint.
+//
+// Parameters:
+//   - dispatcher: The commands.Dispatcher the records are dispatched through.
+//   - options: Options applied to the Runner.
+//
+// Returns:
+//   - A pointer to a Runner instance.
+func NewRunner(dispatcher *commands.Dispatcher, options ...RunnerOption) (runner *Runner) {
+	runner = &Runner{
+		dispatcher:         dispatcher,
+		concurrency:        DefaultConcurrency,
+		outputMode:         OutputOrdered,
+		errorMode:          ContinueOnError,
+		checkpoint:         nil,
+		checkpointInterval: DefaultCheckpointInterval,
+	}
+	for _, option := range options {
+		option(runner)
+	}
+	return runner
+}
+
+// record is one line of the input.
+type record struct {
+	line     int
+	envelope commands.Envelope
+	err      error
+	blank    bool
+}
+
+// outcome is the Result of a record.
+type outcome struct {
+	line   int
+	result Result
+	failed bool
+	blank  bool
+}
+
+// Run reads the records of reader, dispatches them and writes their results to writer.
+//
+// With a Checkpoint, the lines handled by a previous run are skipped, and the progress is saved
+// as records complete and once the batch ends. With StopOnError, the failed record is not counted
+// as handled, so resuming retries it.
+//
+// Parameters:
+//   - ctx: A context.Context providing context for the dispatches; when it ends, no more records are read.
+//   - reader: The newline-delimited records.
+//   - writer: The writer the newline-delimited results are written to.
+//
+// Returns:
+//   - summary: The Summary of the batch.
+//   - err: An error wrapping ErrBatchStopped if a record failed with StopOnError, or an error if
+//     the input cannot be read, the output cannot be written, the Checkpoint fails or ctx ends.
+func (r *Runner) Run(ctx context.Context, reader io.Reader, writer io.Writer) (summary Summary, err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if r.checkpoint != nil {
+		if summary.Checkpoint, err = r.checkpoint.Load(); err != nil {
+			return summary, fmt.Errorf("failed to load checkpoint: %w", err)
+		}
+	}
+
+	stop := make(chan struct{})
+	stopOnce := sync.Once{}
+	halt := func() { stopOnce.Do(func() { close(stop) }) }
+	defer halt()
+
+	// window holds a slot for each record read and not yet written, bounding the results
+	// held back in pending; it is nil, and unbounded, unless the output is ordered.
+	var window chan struct{}
+	if r.outputMode == OutputOrdered {
+		window = make(chan struct{}, r.concurrency*ReorderWindowFactor)
+	}
+	records := make(chan record)
+	readErr, skip := error(nil), summary.Checkpoint
+	go func() {
+		defer close(records)
+		readErr = r.read(ctx, reader, skip, records, window, stop)
+	}()
+
+	outcomes := make(chan outcome)
+	workers := sync.WaitGroup{}
+	for i := 0; i < r.concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for rec := range records {
+				outcomes <- r.dispatch(ctx, rec)
+			}
+		}()
+	}
+	go func() {
+		workers.Wait()
+		close(outcomes)
+	}()
+
+	output := bufio.NewWriter(writer)
+	pending := make(map[int]outcome)
+	handled := make(map[int]bool)
+	next, saved := summary.Checkpoint+1, summary.Checkpoint
+	stopErr, fatalErr := error(nil), error(nil)
+	for o := range outcomes {
+		if fatalErr != nil {
+			continue
+		}
+		if o.failed && r.errorMode == StopOnError {
+			if stopErr == nil {
+				halt()
+				stopErr = fmt.Errorf("%w: record %s: %s", ErrBatchStopped, o.result.ID, o.result.Error)
+			}
+		} else {
+			handled[o.line] = true
+		}
+		ready := []outcome{o}
+		if r.outputMode == OutputOrdered {
+			pending[o.line] = o
+			for ready = nil; ; next++ {
+				p, found := pending[next]
+				if !found {
+					break
+				}
+				delete(pending, next)
+				ready = append(ready, p)
+			}
+		}
+		for _, p := range ready {
+			if window != nil {
+				<-window
+			}
+			if p.blank {
+				continue
+			}
+			if fatalErr = writeResult(output, p.result); fatalErr != nil {
+				halt()
+				break
+			}
+			if p.failed {
+				summary.Failed++
+			} else {
+				summary.Succeeded++
+			}
+		}
+		if fatalErr != nil {
+			continue
+		}
+		for handled[summary.Checkpoint+1] {
+			delete(handled, summary.Checkpoint+1)
+			summary.Checkpoint++
+		}
+		if r.checkpoint != nil && summary.Checkpoint-saved >= r.checkpointInterval {
+			if fatalErr = r.save(output, summary.Checkpoint); fatalErr != nil {
+				halt()
+			}
+			saved = summary.Checkpoint
+		}
+	}
+	if fatalErr == nil && summary.Checkpoint != saved {
+		fatalErr = r.save(output, summary.Checkpoint)
+	} else if flushErr := output.Flush(); flushErr != nil && fatalErr == nil {
+		fatalErr = fmt.Errorf("failed to write results: %w", flushErr)
+	}
+	return summary, errors.Join(fatalErr, stopErr, readErr)
+}
+
+// read sends the records of reader, skipping the first skip lines, until reader is exhausted,
+// stop is closed or ctx ends. Unless window is nil, a slot of window is taken for each record
+// before it is sent, and the result of the record releases it once written.
+func (r *Runner) read(ctx context.Context, reader io.Reader, skip int, records chan<- record, window chan<- struct{}, stop <-chan struct{}) error {
+	buffered := bufio.NewReader(reader)
+	for line := 1; ; line++ {
+		data, err := buffered.ReadBytes('\n')
+		if len(data) == 0 && errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to read records: %w", err)
+		}
+		if line > skip {
+			rec := record{line: line}
+			data = bytes.TrimSpace(data)
+			if len(data) == 0 {
+				rec.blank = true
+			} else if decodeErr := json.Unmarshal(data, &rec.envelope); decodeErr != nil {
+				rec.err = fmt.Errorf("%w: line %d: %w", commands.ErrInvalidEnvelope, line, decodeErr)
+			} else if rec.envelope.Name == "" {
+				rec.err = fmt.Errorf("%w: line %d: name is empty", commands.ErrInvalidEnvelope, line)
+			}
+			if window != nil {
+				select {
+				case window <- struct{}{}:
+				case <-stop:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			select {
+			case records <- rec:
+			case <-stop:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if err != nil {
+			return nil
+		}
+	}
+}
+
+// dispatch dispatches a record and returns its outcome.
+func (r *Runner) dispatch(ctx context.Context, rec record) outcome {
+	if rec.blank {
+		return outcome{line: rec.line, blank: true}
+	}
+	id := rec.envelope.ID
+	if id == "" {
+		id = strconv.Itoa(rec.line)
+	}
+	if rec.err != nil {
+		return outcome{line: rec.line, result: Result{ID: id, Error: rec.err.Error()}, failed: true}
+	}
+	resultEnvelope := r.dispatcher.Dispatch(ctx, rec.envelope)
+	return outcome{
+		line:   rec.line,
+		result: Result{ID: id, Result: resultEnvelope.Result, Error: resultEnvelope.Error},
+		failed: resultEnvelope.Err != nil,
+	}
+}
+
+// save flushes the results written so far and saves the checkpoint, if any, so it never runs ahead of the output.
+func (r *Runner) save(output *bufio.Writer, checkpoint int) error {
+	if err := output.Flush(); err != nil {
+		return fmt.Errorf("failed to write results: %w", err)
+	}
+	if r.checkpoint == nil {
+		return nil
+	}
+	if err := r.checkpoint.Save(checkpoint); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	return nil
+}
+
+func writeResult(output *bufio.Writer, result Result) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to encode result: %w", err)
+	}
+	if _, err = output.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write results: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package batch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dan-lugg/go-commands/commands"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_OutputMode_String(t *testing.T) {
+	assert.Equal(t, "ordered", OutputOrdered.String())
+	assert.Equal(t, "unordered", OutputUnordered.String())
+	assert.Equal(t, "unknown", OutputMode(-1).String())
+}
+
+func Test_ErrorMode_String(t *testing.T) {
+	assert.Equal(t, "continue", ContinueOnError.String())
+	assert.Equal(t, "stop", StopOnError.String())
+	assert.Equal(t, "unknown", ErrorMode(-1).String())
+}
+
+func Test_NewRunner(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		runner := NewRunner(newDispatcher())
+		assert.Equal(t, DefaultConcurrency, runner.concurrency)
+		assert.Equal(t, OutputOrdered, runner.outputMode)
+		assert.Equal(t, ContinueOnError, runner.errorMode)
+		assert.Nil(t, runner.checkpoint)
+	})
+
+	t.Run("with options", func(t *testing.T) {
+		checkpoint := &memoryCheckpoint{}
+		runner := NewRunner(newDispatcher(), WithConcurrency(0), WithOutputMode(OutputUnordered), WithErrorMode(StopOnError), WithCheckpoint(checkpoint, 0))
+		assert.Equal(t, 1, runner.concurrency)
+		assert.Equal(t, OutputUnordered, runner.outputMode)
+		assert.Equal(t, StopOnError, runner.errorMode)
+		assert.Equal(t, checkpoint, runner.checkpoint)
+		assert.Equal(t, DefaultCheckpointInterval, runner.checkpointInterval)
+	})
+}
+
+func Test_Runner_Run(t *testing.T) {
+	results := func(t *testing.T, output *bytes.Buffer) []Result {
+		decoded := make([]Result, 0)
+		for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+			if line == "" {
+				continue
+			}
+			result := Result{}
+			assert.NoError(t, json.Unmarshal([]byte(line), &result))
+			decoded = append(decoded, result)
+		}
+		return decoded
+	}
+
+	ids := func(results []Result) []string {
+		values := make([]string, 0, len(results))
+		for _, result := range results {
+			values = append(values, result.ID)
+		}
+		return values
+	}
+
+	input := strings.Join([]string{
+		`{"id":"a","name":"add","payload":{"argX":1,"argY":2,"delay":30}}`,
+		`{"id":"b","name":"add","payload":{"argX":-1,"argY":2}}`,
+		``,
+		`{"name":"add","payload":{"argX":3,"argY":4}}`,
+		`{"id":"d","name":"missing","payload":{}}`,
+		`not json`,
+	}, "\n")
+
+	t.Run("ordered", func(t *testing.T) {
+		output := &bytes.Buffer{}
+		summary, err := NewRunner(newDispatcher()).Run(context.Background(), strings.NewReader(input), output)
+		assert.NoError(t, err)
+		assert.Equal(t, Summary{Succeeded: 2, Failed: 3, Checkpoint: 6}, summary)
+
+		decoded := results(t, output)
+		assert.Equal(t, []string{"a", "b", "4", "d", "6"}, ids(decoded))
+		assert.JSONEq(t, `{"result":3}`, string(decoded[0].Result))
+		assert.Equal(t, "negative", decoded[1].Error)
+		assert.JSONEq(t, `{"result":7}`, string(decoded[2].Result))
+		assert.Contains(t, decoded[3].Error, commands.ErrMappingMissing.Error())
+		assert.Contains(t, decoded[4].Error, commands.ErrInvalidEnvelope.Error())
+	})
+
+	t.Run("unordered", func(t *testing.T) {
+		output := &bytes.Buffer{}
+		summary, err := NewRunner(newDispatcher(), WithOutputMode(OutputUnordered)).Run(context.Background(), strings.NewReader(input), output)
+		assert.NoError(t, err)
+		assert.Equal(t, Summary{Succeeded: 2, Failed: 3, Checkpoint: 6}, summary)
+		decoded := ids(results(t, output))
+		assert.ElementsMatch(t, []string{"a", "b", "4", "d", "6"}, decoded)
+		assert.Equal(t, "a", decoded[len(decoded)-1])
+	})
+
+	t.Run("stop on error", func(t *testing.T) {
+		output := &bytes.Buffer{}
+		runner := NewRunner(newDispatcher(), WithConcurrency(1), WithErrorMode(StopOnError))
+		summary, err := runner.Run(context.Background(), strings.NewReader(input), output)
+		assert.ErrorIs(t, err, ErrBatchStopped)
+		assert.Equal(t, 1, summary.Checkpoint)
+		assert.Equal(t, 1, summary.Failed)
+		decoded := ids(results(t, output))
+		assert.Equal(t, []string{"a", "b"}, decoded[:2])
+	})
+
+	t.Run("checkpoint", func(t *testing.T) {
+		checkpoint := &memoryCheckpoint{}
+		runner := NewRunner(newDispatcher(), WithConcurrency(1), WithErrorMode(StopOnError), WithCheckpoint(checkpoint, 1))
+		_, err := runner.Run(context.Background(), strings.NewReader(input), &bytes.Buffer{})
+		assert.ErrorIs(t, err, ErrBatchStopped)
+		assert.Equal(t, 1, checkpoint.line)
+
+		// Fix the failing record and resume after the handled lines
+		fixed := strings.Replace(input, `"argX":-1`, `"argX":1`, 1)
+		fixed = strings.Replace(fixed, `"name":"missing"`, `"name":"add"`, 1)
+		fixed = strings.Replace(fixed, `not json`, `{"id":"f","name":"add","payload":{}}`, 1)
+		output := &bytes.Buffer{}
+		summary, err := runner.Run(context.Background(), strings.NewReader(fixed), output)
+		assert.NoError(t, err)
+		assert.Equal(t, Summary{Succeeded: 4, Failed: 0, Checkpoint: 6}, summary)
+		assert.Equal(t, []string{"b", "4", "d", "f"}, ids(results(t, output)))
+		assert.Equal(t, 6, checkpoint.line)
+		assert.Equal(t, []int{1, 2, 3, 4, 5, 6}, checkpoint.saves)
+	})
+
+	t.Run("file checkpoint", func(t *testing.T) {
+		checkpoint := FileCheckpoint(filepath.Join(t.TempDir(), "checkpoint"))
+		runner := NewRunner(newDispatcher(), WithCheckpoint(checkpoint, 0))
+		_, err := runner.Run(context.Background(), strings.NewReader(input), &bytes.Buffer{})
+		assert.NoError(t, err)
+		line, err := checkpoint.Load()
+		assert.NoError(t, err)
+		assert.Equal(t, 6, line)
+
+		output := &bytes.Buffer{}
+		summary, err := runner.Run(context.Background(), strings.NewReader(input), output)
+		assert.NoError(t, err)
+		assert.Equal(t, Summary{Checkpoint: 6}, summary)
+		assert.Empty(t, output.String())
+	})
+
+	t.Run("encoder catalog", func(t *testing.T) {
+		encoderCatalog := commands.NewDefaultEncoderCatalog()
+		commands.InsertEncoder[AddCommandRes](encoderCatalog, func(res commands.CommandRes) ([]byte, error) {
+			return json.Marshal(res.(AddCommandRes).Result)
+		})
+		output := &bytes.Buffer{}
+		_, err := NewRunner(newDispatcher(commands.WithEncoderCatalog(encoderCatalog))).Run(context.Background(), strings.NewReader(input), output)
+		assert.NoError(t, err)
+		decoded := results(t, output)
+		assert.JSONEq(t, `3`, string(decoded[0].Result))
+		assert.JSONEq(t, `7`, string(decoded[2].Result))
+	})
+
+	t.Run("ordered window", func(t *testing.T) {
+		reader, writer := io.Pipe()
+		written := atomic.Int32{}
+		go func() {
+			defer writer.Close()
+			for i := 0; i < 100; i++ {
+				delay := 0
+				if i == 0 {
+					delay = 200
+				}
+				line := fmt.Sprintf(`{"id":"%d","name":"add","payload":{"argX":%d,"delay":%d}}`+"\n", i, i, delay)
+				if _, err := writer.Write([]byte(line)); err != nil {
+					return
+				}
+				written.Add(1)
+			}
+		}()
+
+		done := make(chan struct{})
+		output := &bytes.Buffer{}
+		go func() {
+			defer close(done)
+			summary, err := NewRunner(newDispatcher(), WithConcurrency(2)).Run(context.Background(), reader, output)
+			assert.NoError(t, err)
+			assert.Equal(t, 100, summary.Succeeded)
+		}()
+		time.Sleep(100 * time.Millisecond)
+		// Line 1 is still running: only the window, and the line waiting for a slot, were read.
+		assert.LessOrEqual(t, int(written.Load()), 2*ReorderWindowFactor+1)
+		<-done
+		decoded := ids(results(t, output))
+		assert.Len(t, decoded, 100)
+		assert.Equal(t, "0", decoded[0])
+		assert.Equal(t, "99", decoded[99])
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := NewRunner(newDispatcher(), WithConcurrency(1)).Run(ctx, strings.NewReader(input), &bytes.Buffer{})
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("write failure", func(t *testing.T) {
+		_, err := NewRunner(newDispatcher()).Run(context.Background(), strings.NewReader(input), failingWriter{})
+		assert.ErrorIs(t, err, errWrite)
+	})
+}
+
+var errWrite = errors.New("write failed")
+
+type failingWriter struct{}
+
+func (failingWriter) Write(data []byte) (int, error) {
+	return 0, errWrite
+}
@@ -0,0 +1,68 @@
+package batch
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Checkpoint persists the progress of a Runner, as the number of input lines handled, so an
+// interrupted batch can be resumed.
+//
+// Methods:
+//   - Load(): Returns the number of lines handled, or 0 if nothing was saved yet.
+//   - Save(line int): Saves the number of lines handled.
+type Checkpoint interface {
+	Load() (line int, err error)
+	Save(line int) error
+}
+
+// FileCheckpoint is a Checkpoint kept as a decimal number in a file, rewritten atomically on each save.
+type FileCheckpoint string
+
+// Load reads the number of lines handled from the file.
+//
+// Returns:
+//   - line: The number of lines handled, or 0 if the file does not exist.
+//   - err: An error if the file cannot be read or does not hold a number.
+func (c FileCheckpoint) Load() (line int, err error) {
+	data, err := os.ReadFile(string(c))
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if line, err = strconv.Atoi(strings.TrimSpace(string(data))); err != nil || line < 0 {
+		return 0, fmt.Errorf("invalid checkpoint %q", strings.TrimSpace(string(data)))
+	}
+	return line, nil
+}
+
+// Save writes the number of lines handled to the file.
+//
+// Parameters:
+//   - line: The number of lines handled.
+//
+// Returns:
+//   - An error if the file cannot be written.
+func (c FileCheckpoint) Save(line int) error {
+	path := string(c)
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteString(strconv.Itoa(line) + "\n")
+	err = errors.Join(err, file.Close())
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+	}
+	return err
+}
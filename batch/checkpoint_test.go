@@ -0,0 +1,35 @@
+package batch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_FileCheckpoint(t *testing.T) {
+	t.Run("save and load", func(t *testing.T) {
+		checkpoint := FileCheckpoint(filepath.Join(t.TempDir(), "checkpoint"))
+		line, err := checkpoint.Load()
+		assert.NoError(t, err)
+		assert.Equal(t, 0, line)
+
+		assert.NoError(t, checkpoint.Save(42))
+		line, err = checkpoint.Load()
+		assert.NoError(t, err)
+		assert.Equal(t, 42, line)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "checkpoint")
+		assert.NoError(t, os.WriteFile(path, []byte("nope"), 0o644))
+		_, err := FileCheckpoint(path).Load()
+		assert.Error(t, err)
+	})
+
+	t.Run("unwritable", func(t *testing.T) {
+		checkpoint := FileCheckpoint(filepath.Join(t.TempDir(), "missing", "checkpoint"))
+		assert.Error(t, checkpoint.Save(1))
+	})
+}
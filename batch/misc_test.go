@@ -0,0 +1,68 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dan-lugg/go-commands/commands"
+)
+
+const (
+	AddReqName = "add"
+)
+
+var ErrNegative = errors.New("negative")
+
+type AddCommandRes struct {
+	Result int `json:"result"`
+}
+
+type AddCommandReq struct {
+	ArgX  int `json:"argX"`
+	ArgY  int `json:"argY"`
+	Delay int `json:"delay"`
+}
+
+// AddHandler adds its arguments after sleeping for Delay milliseconds, failing on a negative ArgX.
+type AddHandler struct {
+	commands.Handler[AddCommandReq, AddCommandRes]
+}
+
+func (h *AddHandler) Handle(ctx context.Context, req AddCommandReq) (res AddCommandRes, err error) {
+	time.Sleep(time.Duration(req.Delay) * time.Millisecond)
+	if req.ArgX < 0 {
+		return AddCommandRes{}, ErrNegative
+	}
+	return AddCommandRes{Result: req.ArgX + req.ArgY}, nil
+}
+
+func newDispatcher(options ...commands.DispatcherOption) *commands.Dispatcher {
+	mappingCatalog := commands.NewMappingCatalog()
+	commands.InsertMapping[AddCommandReq](mappingCatalog, AddReqName)
+
+	decoderCatalog := commands.NewDefaultDecoderCatalog()
+	commands.InsertDecoder[AddCommandReq](decoderCatalog, commands.DefaultDecoder[AddCommandReq]())
+
+	handlerCatalog := commands.NewDefaultHandlerCatalog(commands.WithMappingCatalog(mappingCatalog))
+	commands.InsertHandler[AddCommandReq, AddCommandRes](handlerCatalog, func() commands.Handler[AddCommandReq, AddCommandRes] {
+		return &AddHandler{}
+	})
+	return commands.NewDispatcher(mappingCatalog, decoderCatalog, handlerCatalog, options...)
+}
+
+// memoryCheckpoint is a Checkpoint recording every saved line.
+type memoryCheckpoint struct {
+	line  int
+	saves []int
+}
+
+func (c *memoryCheckpoint) Load() (line int, err error) {
+	return c.line, nil
+}
+
+func (c *memoryCheckpoint) Save(line int) error {
+	c.line = line
+	c.saves = append(c.saves, line)
+	return nil
+}
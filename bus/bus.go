@@ -0,0 +1,328 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dan-lugg/go-commands/commands"
+	"github.com/dan-lugg/go-commands/futures"
+	"github.com/dan-lugg/go-commands/util"
+)
+
+var (
+	ErrQueueFull = errors.New("queue full")
+	ErrDropped   = errors.New("dropped from queue")
+	ErrBusClosed = errors.New("bus closed")
+	ErrPanicked  = errors.New("handler panicked")
+)
+
+const (
+	DefaultQueueSize = 64
+)
+
+// Backpressure determines what a Bus does when a request is submitted to a full queue.
+type Backpressure int
+
+const (
+	// BackpressureBlock waits for room in the queue, or for the context of the request to end.
+	BackpressureBlock Backpressure = iota
+	// BackpressureReject fails the submitted request with ErrQueueFull.
+	BackpressureReject
+	// BackpressureDropOldest fails the oldest queued request with ErrDropped to make room.
+	BackpressureDropOldest
+)
+
+// String returns the name of the Backpressure.
+func (b Backpressure) String() string {
+	switch b {
+	case BackpressureBlock:
+		return "block"
+	case BackpressureReject:
+		return "reject"
+	case BackpressureDropOldest:
+		return "drop-oldest"
+	default:
+		return "unknown"
+	}
+}
+
+// job is a request waiting in the queue of a Bus, along with the Promise of its result.
+type job struct {
+	ctx     context.Context
+	req     commands.CommandReq[commands.CommandRes]
+	promise *futures.Promise[util.Tuple2[commands.CommandRes, error]]
+}
+
+// resolve completes the Promise of the job.
+func (j *job) resolve(res commands.CommandRes, err error) {
+	j.promise.Resolve(util.Tuple2[commands.CommandRes, error]{
+		Val1: res,
+		Val2: err,
+	})
+}
+
+// Bus is a commands.HandlerCatalog that runs requests on a fixed number of workers,
+// fed from a bounded in-memory queue.
+//
+// Requests are dispatched through the wrapped HandlerCatalog, so the generic
+// commands.Handle and commands.Future helpers work unchanged against a Bus.
+//
+// Fields:
+//   - catalog: The HandlerCatalog requests are dispatched through.
+//   - workers: The number of workers running requests.
+//   - queueSize: The number of requests the queue holds before backpressure applies.
+//   - backpressure: The Backpressure applied when the queue is full.
+//   - queue: The channel holding queued requests.
+//   - closed: Whether Drain has been called.
+//   - inFlight: The number of requests currently being run by workers.
+//   - submitting: The calls to Future that may still send to the queue, which is closed once they return.
+//   - closeQueue: Ensures the queue is closed once.
+type Bus struct {
+	mutex        sync.RWMutex
+	catalog      commands.HandlerCatalog
+	workers      int
+	queueSize    int
+	backpressure Backpressure
+	queue        chan *job
+	closed       bool
+	inFlight     atomic.Int64
+	waitGroup    sync.WaitGroup
+	submitting   sync.WaitGroup
+	closeQueue   sync.Once
+}
+
+type BusOption = util.Option[*Bus]
+
+// WithWorkers returns an option that sets the number of workers of a Bus.
+//
+// Parameters:
+//   - workers: The number of workers running requests.
+func WithWorkers(workers int) BusOption {
+	return func(b *Bus) {
+		b.workers = workers
+	}
+}
+
+// WithQueueSize returns an option that sets the size of the queue of a Bus.
+//
+// Parameters:
+//   - queueSize: The number of requests the queue holds before backpressure applies.
+func WithQueueSize(queueSize int) BusOption {
+	return func(b *Bus) {
+		b.queueSize = queueSize
+	}
+}
+
+// WithBackpressure returns an option that sets the Backpressure of a Bus.
+//
+// Parameters:
+//   - backpressure: The Backpressure applied when the queue is full.
+func WithBackpressure(backpressure Backpressure) BusOption {
+	return func(b *Bus) {
+		b.backpressure = backpressure
+	}
+}
+
+// NewBus creates and returns a new instance of Bus, and starts its workers.
+//
+// By default the Bus runs one worker per CPU, holds DefaultQueueSize requests and
+// applies BackpressureBlock.
+//
+// Parameters:
+//   - catalog: The HandlerCatalog requests are dispatched through.
+//   - options: Options applied to the Bus.
+//
+// Returns:
+//   - A pointer to a Bus instance.
+func NewBus(catalog commands.HandlerCatalog, options ...BusOption) (bus *Bus) {
+	bus = &Bus{
+		mutex:        sync.RWMutex{},
+		catalog:      catalog,
+		workers:      runtime.NumCPU(),
+		queueSize:    DefaultQueueSize,
+		backpressure: BackpressureBlock,
+	}
+	for _, option := range options {
+		option(bus)
+	}
+	bus.workers = max(bus.workers, 1)
+	bus.queueSize = max(bus.queueSize, 1)
+	bus.queue = make(chan *job, bus.queueSize)
+	bus.waitGroup.Add(bus.workers)
+	for i := 0; i < bus.workers; i++ {
+		go bus.work()
+	}
+	return bus
+}
+
+// work runs queued requests until the queue is closed and empty.
+func (b *Bus) work() {
+	defer b.waitGroup.Done()
+	for queued := range b.queue {
+		if err := queued.ctx.Err(); err != nil {
+			queued.resolve(nil, err)
+			continue
+		}
+		queued.resolve(b.run(queued))
+	}
+}
+
+// run dispatches a queued request, recovering a panic of its handler as an error wrapping
+// ErrPanicked, so the worker survives and the Promise of the request is resolved.
+func (b *Bus) run(queued *job) (res commands.CommandRes, err error) {
+	b.inFlight.Add(1)
+	defer b.inFlight.Add(-1)
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			res, err = nil, fmt.Errorf("%w for req type: %s: %v", ErrPanicked, reflect.TypeOf(queued.req), recovered)
+		}
+	}()
+	return b.catalog.Handle(queued.ctx, queued.req)
+}
+
+// Insert adds a HandlerAdapter to the wrapped HandlerCatalog.
+//
+// Parameters:
+//   - adapter: The HandlerAdapter instance to catalog.
+func (b *Bus) Insert(adapter commands.HandlerAdapter) {
+	b.catalog.Insert(adapter)
+}
+
+// Handle submits a command request to the queue and waits for its result.
+//
+// Parameters:
+//   - ctx: A context.Context providing context for the request processing.
+//   - req: A CommandReq[CommandRes] representing the command request to be processed.
+//
+// Returns:
+//   - res: A CommandRes representing the result of the command processing.
+//   - err: An error if the request could not be queued or if the handler fails.
+func (b *Bus) Handle(ctx context.Context, req commands.CommandReq[commands.CommandRes]) (res commands.CommandRes, err error) {
+	tup := b.Future(ctx, req).Wait()
+	return tup.Val1, tup.Val2
+}
+
+// Future submits a command request to the queue, applying the Backpressure of the Bus
+// if the queue is full, and returns a futures.Future of its result.
+//
+// Parameters:
+//   - ctx: A context.Context providing context for the request processing.
+//   - req: A CommandReq[CommandRes] representing the command request to be processed.
+//
+// Returns:
+//   - A futures.Future containing a util.Tuple2 where:
+//   - Val1 is the CommandRes representing the result of the command processing.
+//   - Val2 is an error wrapping ErrQueueFull, ErrDropped or ErrBusClosed if the request
+//     was not run, ErrPanicked if the handler panicked, or the error returned by the handler.
+func (b *Bus) Future(ctx context.Context, req commands.CommandReq[commands.CommandRes]) futures.Future[util.Tuple2[commands.CommandRes, error]] {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	queued := &job{
+		ctx:     ctx,
+		req:     req,
+		promise: futures.NewPromise[util.Tuple2[commands.CommandRes, error]](),
+	}
+
+	// The lock is not held while the request waits for room in the queue, so Drain is never
+	// blocked by a full queue; the queue is only closed once every such call has returned.
+	b.mutex.RLock()
+	if b.closed {
+		b.mutex.RUnlock()
+		queued.resolve(nil, fmt.Errorf("%w for req type: %s", ErrBusClosed, reflect.TypeOf(req)))
+		return queued.promise
+	}
+	b.submitting.Add(1)
+	b.mutex.RUnlock()
+	defer b.submitting.Done()
+
+	switch b.backpressure {
+	case BackpressureReject:
+		select {
+		case b.queue <- queued:
+		default:
+			queued.resolve(nil, fmt.Errorf("%w for req type: %s", ErrQueueFull, reflect.TypeOf(req)))
+		}
+	case BackpressureDropOldest:
+		for enqueued := false; !enqueued; {
+			select {
+			case b.queue <- queued:
+				enqueued = true
+			default:
+				select {
+				case oldest := <-b.queue:
+					oldest.resolve(nil, fmt.Errorf("%w for req type: %s", ErrDropped, reflect.TypeOf(oldest.req)))
+				default:
+				}
+			}
+		}
+	default:
+		select {
+		case b.queue <- queued:
+		case <-ctx.Done():
+			queued.resolve(nil, ctx.Err())
+		}
+	}
+	return queued.promise
+}
+
+// TypeMap returns the mapping of request types to response types of the wrapped HandlerCatalog.
+//
+// Returns:
+//   - A map associating request types with their corresponding response types.
+func (b *Bus) TypeMap() map[reflect.Type]reflect.Type {
+	return b.catalog.TypeMap()
+}
+
+// Depth returns the number of requests waiting in the queue.
+//
+// Returns:
+//   - The number of queued requests not yet picked up by a worker.
+func (b *Bus) Depth() int {
+	return len(b.queue)
+}
+
+// InFlight returns the number of requests currently being run by workers.
+//
+// Returns:
+//   - The number of running requests.
+func (b *Bus) InFlight() int {
+	return int(b.inFlight.Load())
+}
+
+// Drain stops the Bus from accepting requests and waits for the queued and running
+// requests to complete. Requests submitted after Drain fail with ErrBusClosed, while
+// requests already waiting for room in the queue are still queued, unless their own
+// context ends first.
+//
+// Parameters:
+//   - ctx: A context.Context bounding how long to wait.
+//
+// Returns:
+//   - An error if ctx ends before the queue is drained. The workers keep draining in the background.
+func (b *Bus) Drain(ctx context.Context) error {
+	b.mutex.Lock()
+	b.closed = true
+	b.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		b.submitting.Wait()
+		b.closeQueue.Do(func() {
+			close(b.queue)
+		})
+		b.waitGroup.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,210 @@
+package bus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dan-lugg/go-commands/commands"
+	"github.com/dan-lugg/go-commands/futures"
+	"github.com/dan-lugg/go-commands/util"
+	"github.com/stretchr/testify/assert"
+)
+
+type WaitCommandRes struct {
+	Name string
+}
+
+type WaitCommandReq struct {
+	Name  string
+	Gate  chan struct{}
+	Panic bool
+}
+
+type WaitHandler struct {
+	commands.Handler[WaitCommandReq, WaitCommandRes]
+}
+
+func (h *WaitHandler) Handle(ctx context.Context, req WaitCommandReq) (res WaitCommandRes, err error) {
+	if req.Panic {
+		panic(req.Name)
+	}
+	if req.Gate != nil {
+		select {
+		case <-req.Gate:
+		case <-ctx.Done():
+			return WaitCommandRes{}, ctx.Err()
+		}
+	}
+	return WaitCommandRes{Name: req.Name}, nil
+}
+
+func newCatalog() *commands.DefaultHandlerCatalog {
+	catalog := commands.NewDefaultHandlerCatalog()
+	commands.InsertHandler[WaitCommandReq, WaitCommandRes](catalog, func() commands.Handler[WaitCommandReq, WaitCommandRes] {
+		return &WaitHandler{}
+	})
+	return catalog
+}
+
+// occupy submits a gated request and waits until a worker has picked it up.
+func occupy(t *testing.T, bus *Bus, gate chan struct{}) futures.Future[util.Tuple2[WaitCommandRes, error]] {
+	fut := commands.Future[WaitCommandReq, WaitCommandRes](nil, bus, WaitCommandReq{Name: "busy", Gate: gate})
+	assert.Eventually(t, func() bool { return bus.InFlight() == 1 }, time.Second, time.Millisecond)
+	return fut
+}
+
+func Test_NewBus(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		bus := NewBus(newCatalog())
+		defer func() { _ = bus.Drain(context.Background()) }()
+		assert.Equal(t, DefaultQueueSize, bus.queueSize)
+		assert.Equal(t, BackpressureBlock, bus.backpressure)
+		assert.GreaterOrEqual(t, bus.workers, 1)
+	})
+
+	t.Run("with options", func(t *testing.T) {
+		bus := NewBus(newCatalog(), WithWorkers(2), WithQueueSize(4), WithBackpressure(BackpressureReject))
+		defer func() { _ = bus.Drain(context.Background()) }()
+		assert.Equal(t, 2, bus.workers)
+		assert.Equal(t, 4, bus.queueSize)
+		assert.Equal(t, BackpressureReject, bus.backpressure)
+	})
+}
+
+func Test_Bus_Handle(t *testing.T) {
+	bus := NewBus(newCatalog(), WithWorkers(2))
+	defer func() { _ = bus.Drain(context.Background()) }()
+
+	t.Run("default", func(t *testing.T) {
+		res, err := commands.Handle[WaitCommandReq, WaitCommandRes](nil, bus, WaitCommandReq{Name: "A"})
+		assert.NoError(t, err)
+		assert.Equal(t, WaitCommandRes{Name: "A"}, res)
+	})
+
+	t.Run("handler missing", func(t *testing.T) {
+		_, err := bus.Handle(nil, struct{}{})
+		assert.ErrorIs(t, err, commands.ErrHandlerMissing)
+	})
+
+	t.Run("handler panics", func(t *testing.T) {
+		for range 3 {
+			_, err := commands.Handle[WaitCommandReq, WaitCommandRes](nil, bus, WaitCommandReq{Name: "boom", Panic: true})
+			assert.ErrorIs(t, err, ErrPanicked)
+			assert.ErrorContains(t, err, "boom")
+		}
+		assert.Equal(t, 0, bus.InFlight())
+		_, err := commands.Handle[WaitCommandReq, WaitCommandRes](nil, bus, WaitCommandReq{Name: "A"})
+		assert.NoError(t, err)
+	})
+}
+
+func Test_Bus_Backpressure(t *testing.T) {
+	t.Run("reject", func(t *testing.T) {
+		bus := NewBus(newCatalog(), WithWorkers(1), WithQueueSize(1), WithBackpressure(BackpressureReject))
+		gate := make(chan struct{})
+		busy := occupy(t, bus, gate)
+		queued := bus.Future(nil, WaitCommandReq{Name: "queued"})
+		assert.Equal(t, 1, bus.Depth())
+
+		_, err := commands.Handle[WaitCommandReq, WaitCommandRes](nil, bus, WaitCommandReq{Name: "rejected"})
+		assert.ErrorIs(t, err, ErrQueueFull)
+
+		close(gate)
+		assert.NoError(t, busy.Wait().Val2)
+		assert.Equal(t, "queued", queued.Wait().Val1.(WaitCommandRes).Name)
+		assert.NoError(t, bus.Drain(context.Background()))
+	})
+
+	t.Run("drop oldest", func(t *testing.T) {
+		bus := NewBus(newCatalog(), WithWorkers(1), WithQueueSize(1), WithBackpressure(BackpressureDropOldest))
+		gate := make(chan struct{})
+		busy := occupy(t, bus, gate)
+		oldest := bus.Future(nil, WaitCommandReq{Name: "oldest"})
+		newest := bus.Future(nil, WaitCommandReq{Name: "newest"})
+
+		assert.ErrorIs(t, oldest.Wait().Val2, ErrDropped)
+		close(gate)
+		assert.NoError(t, busy.Wait().Val2)
+		assert.Equal(t, "newest", newest.Wait().Val1.(WaitCommandRes).Name)
+		assert.NoError(t, bus.Drain(context.Background()))
+	})
+
+	t.Run("block", func(t *testing.T) {
+		bus := NewBus(newCatalog(), WithWorkers(1), WithQueueSize(1), WithBackpressure(BackpressureBlock))
+		gate := make(chan struct{})
+		busy := occupy(t, bus, gate)
+		queued := bus.Future(nil, WaitCommandReq{Name: "queued"})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_, err := commands.Handle[WaitCommandReq, WaitCommandRes](ctx, bus, WaitCommandReq{Name: "blocked"})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		close(gate)
+		assert.NoError(t, busy.Wait().Val2)
+		assert.Equal(t, "queued", queued.Wait().Val1.(WaitCommandRes).Name)
+		assert.NoError(t, bus.Drain(context.Background()))
+	})
+}
+
+func Test_Bus_Drain(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		bus := NewBus(newCatalog(), WithWorkers(1), WithQueueSize(4))
+		gate := make(chan struct{})
+		busy := occupy(t, bus, gate)
+		queued := bus.Future(nil, WaitCommandReq{Name: "queued"})
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			close(gate)
+		}()
+		assert.NoError(t, bus.Drain(context.Background()))
+		assert.NoError(t, busy.Wait().Val2)
+		assert.Equal(t, "queued", queued.Wait().Val1.(WaitCommandRes).Name)
+		assert.Equal(t, 0, bus.Depth())
+
+		_, err := commands.Handle[WaitCommandReq, WaitCommandRes](nil, bus, WaitCommandReq{Name: "late"})
+		assert.ErrorIs(t, err, ErrBusClosed)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		bus := NewBus(newCatalog(), WithWorkers(1))
+		gate := make(chan struct{})
+		defer close(gate)
+		occupy(t, bus, gate)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, bus.Drain(ctx), context.DeadlineExceeded)
+	})
+
+	t.Run("blocked submitter", func(t *testing.T) {
+		bus := NewBus(newCatalog(), WithWorkers(1), WithQueueSize(1), WithBackpressure(BackpressureBlock))
+		gate := make(chan struct{})
+		busy := occupy(t, bus, gate)
+		queued := bus.Future(nil, WaitCommandReq{Name: "queued"})
+		blocked := make(chan futures.Future[util.Tuple2[commands.CommandRes, error]])
+		go func() {
+			blocked <- bus.Future(nil, WaitCommandReq{Name: "blocked"})
+		}()
+		time.Sleep(20 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, bus.Drain(ctx), context.DeadlineExceeded)
+
+		close(gate)
+		assert.NoError(t, bus.Drain(context.Background()))
+		assert.NoError(t, busy.Wait().Val2)
+		assert.Equal(t, "queued", queued.Wait().Val1.(WaitCommandRes).Name)
+		assert.Equal(t, "blocked", (<-blocked).Wait().Val1.(WaitCommandRes).Name)
+	})
+}
+
+func Test_Backpressure_String(t *testing.T) {
+	assert.Equal(t, "block", BackpressureBlock.String())
+	assert.Equal(t, "reject", BackpressureReject.String())
+	assert.Equal(t, "drop-oldest", BackpressureDropOldest.String())
+	assert.Equal(t, "unknown", Backpressure(-1).String())
+}
@@ -0,0 +1,123 @@
+package codecs
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/dan-lugg/go-commands/commands"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	MediaTypeYAML        = "application/yaml"
+	MediaTypeCBOR        = "application/cbor"
+	MediaTypeMessagePack = "application/msgpack"
+)
+
+// NewCodecCatalog creates and returns a commands.DefaultCodecCatalog holding every codec of
+// this package besides commands.JSONCodec, in the order JSON, YAML, CBOR and MessagePack.
+//
+// Returns:
+//   - A pointer to a commands.DefaultCodecCatalog instance.
+func NewCodecCatalog() *commands.DefaultCodecCatalog {
+	return commands.NewDefaultCodecCatalog(YAML{}, CBOR{}, MessagePack{})
+}
+
+// YAML is the commands.Codec of MediaTypeYAML.
+//
+// Values are converted through JSON, so the json struct tags and the json.Marshaler and
+// json.Unmarshaler implementations of requests and results apply to YAML as well, and the
+// fields keep the order they are marshaled in.
+type YAML struct{}
+
+// MediaType returns MediaTypeYAML.
+func (YAML) MediaType() string {
+	return MediaTypeYAML
+}
+
+// Marshal serializes a value as YAML.
+func (YAML) Marshal(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	node := yaml.Node{}
+	if err = yaml.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	blockStyle(&node)
+	return yaml.Marshal(&node)
+}
+
+// Unmarshal deserializes YAML data into the value pointed to by v.
+func (YAML) Unmarshal(data []byte, v any) error {
+	var value any
+	if err := yaml.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// blockStyle clears the flow and quoting styles a node parsed from JSON carries, so it is written
+// in the block style usual for YAML. Strings that would read as another type are still quoted.
+func blockStyle(node *yaml.Node) {
+	node.Style &^= yaml.FlowStyle | yaml.DoubleQuotedStyle
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// CBOR is the commands.Codec of MediaTypeCBOR, backed by github.com/fxamacker/cbor/v2.
+//
+// Struct fields are named by their cbor struct tags, falling back to their json struct tags.
+type CBOR struct{}
+
+// MediaType returns MediaTypeCBOR.
+func (CBOR) MediaType() string {
+	return MediaTypeCBOR
+}
+
+// Marshal serializes a value as CBOR.
+func (CBOR) Marshal(v any) ([]byte, error) {
+	return cbor.Marshal(v)
+}
+
+// Unmarshal deserializes CBOR data into the value pointed to by v.
+func (CBOR) Unmarshal(data []byte, v any) error {
+	return cbor.Unmarshal(data, v)
+}
+
+// MessagePack is the commands.Codec of MediaTypeMessagePack, backed by
+// github.com/vmihailenco/msgpack/v5.
+//
+// Struct fields are named by their json struct tags.
+type MessagePack struct{}
+
+// MediaType returns MediaTypeMessagePack.
+func (MessagePack) MediaType() string {
+	return MediaTypeMessagePack
+}
+
+// Marshal serializes a value as MessagePack.
+func (MessagePack) Marshal(v any) ([]byte, error) {
+	buffer := bytes.Buffer{}
+	encoder := msgpack.NewEncoder(&buffer)
+	encoder.SetCustomStructTag("json")
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// Unmarshal deserializes MessagePack data into the value pointed to by v.
+func (MessagePack) Unmarshal(data []byte, v any) error {
+	decoder := msgpack.NewDecoder(bytes.NewReader(data))
+	decoder.SetCustomStructTag("json")
+	return decoder.Decode(v)
+}
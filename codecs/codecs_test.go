@@ -0,0 +1,162 @@
+package codecs
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/dan-lugg/go-commands/commands"
+	"github.com/stretchr/testify/assert"
+)
+
+type AddCommandReq struct {
+	ArgX int    `json:"argX"`
+	ArgY int    `json:"argY"`
+	Note string `json:"note,omitempty"`
+}
+
+// AccountCommandRes holds a Secret that the encoders cataloged in the tests hide.
+type AccountCommandRes struct {
+	Name   string `json:"name"`
+	Secret string `json:"secret"`
+}
+
+// AccountCommandReq holds an Admin flag that the decoders cataloged in the tests ignore.
+type AccountCommandReq struct {
+	Name  string `json:"name"`
+	Admin bool   `json:"admin"`
+}
+
+func Test_NewCodecCatalog(t *testing.T) {
+	catalog := NewCodecCatalog()
+	assert.Equal(t, []string{commands.MediaTypeJSON, MediaTypeYAML, MediaTypeCBOR, MediaTypeMessagePack}, catalog.MediaTypes())
+
+	codec, err := catalog.Negotiate("application/msgpack, application/json;q=0.9")
+	assert.NoError(t, err)
+	assert.Equal(t, MessagePack{}, codec)
+}
+
+func Test_Codecs(t *testing.T) {
+	tests := []struct {
+		name      string
+		codec     commands.Codec
+		mediaType string
+	}{
+		{name: "yaml", codec: YAML{}, mediaType: MediaTypeYAML},
+		{name: "cbor", codec: CBOR{}, mediaType: MediaTypeCBOR},
+		{name: "msgpack", codec: MessagePack{}, mediaType: MediaTypeMessagePack},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.mediaType, test.codec.MediaType())
+
+			data, err := test.codec.Marshal(AddCommandReq{ArgX: 3, ArgY: 4, Note: "123"})
+			assert.NoError(t, err)
+
+			fields := map[string]any{}
+			assert.NoError(t, test.codec.Unmarshal(data, &fields))
+			assert.Contains(t, fields, "argX")
+			assert.Contains(t, fields, "argY")
+			assert.Equal(t, "123", fields["note"])
+
+			req := AddCommandReq{}
+			assert.NoError(t, test.codec.Unmarshal(data, &req))
+			assert.Equal(t, AddCommandReq{ArgX: 3, ArgY: 4, Note: "123"}, req)
+
+			assert.Error(t, test.codec.Unmarshal([]byte{0xc1, '{', ':'}, &req))
+		})
+	}
+}
+
+func Test_YAML(t *testing.T) {
+	t.Run("marshal", func(t *testing.T) {
+		data, err := YAML{}.Marshal(AddCommandReq{ArgX: 3, ArgY: 4, Note: "123"})
+		assert.NoError(t, err)
+		assert.Equal(t, "argX: 3\nargY: 4\nnote: \"123\"\n", string(data))
+	})
+
+	t.Run("unmarshal", func(t *testing.T) {
+		req := AddCommandReq{}
+		assert.NoError(t, YAML{}.Unmarshal([]byte("argX: 3\nargY: 4\nnote: hello\n"), &req))
+		assert.Equal(t, AddCommandReq{ArgX: 3, ArgY: 4, Note: "hello"}, req)
+	})
+
+	t.Run("marshal failure", func(t *testing.T) {
+		_, err := YAML{}.Marshal(func() {})
+		assert.Error(t, err)
+	})
+}
+
+func Test_DecoderCatalog_DecodeWith(t *testing.T) {
+	decoderCatalog := commands.NewDefaultDecoderCatalog()
+	commands.InsertDecoder[AddCommandReq](decoderCatalog, commands.DefaultDecoder[AddCommandReq]())
+	catalog := NewCodecCatalog()
+
+	for _, mediaType := range catalog.MediaTypes() {
+		t.Run(mediaType, func(t *testing.T) {
+			codec, err := catalog.ByMediaType(mediaType)
+			assert.NoError(t, err)
+			data, err := codec.Marshal(AddCommandReq{ArgX: 3, ArgY: 4})
+			assert.NoError(t, err)
+
+			req, err := decoderCatalog.DecodeWith(reflect.TypeFor[AddCommandReq](), codec, data)
+			assert.NoError(t, err)
+			assert.Equal(t, AddCommandReq{ArgX: 3, ArgY: 4}, req)
+		})
+	}
+}
+
+func Test_EncoderCatalog_EncodeWith(t *testing.T) {
+	encoderCatalog := commands.NewDefaultEncoderCatalog()
+	commands.InsertEncoder[AccountCommandRes](encoderCatalog, func(res commands.CommandRes) ([]byte, error) {
+		return json.Marshal(map[string]any{"name": res.(AccountCommandRes).Name, "count": 2})
+	})
+	catalog := NewCodecCatalog()
+
+	for _, mediaType := range catalog.MediaTypes() {
+		t.Run(mediaType, func(t *testing.T) {
+			codec, err := catalog.ByMediaType(mediaType)
+			assert.NoError(t, err)
+			data, err := encoderCatalog.EncodeWith(AccountCommandRes{Name: "alice", Secret: "hunter2"}, codec)
+			assert.NoError(t, err)
+			assert.NotContains(t, string(data), "hunter2")
+
+			res := AccountCommandRes{}
+			assert.NoError(t, codec.Unmarshal(data, &res))
+			assert.Equal(t, AccountCommandRes{Name: "alice"}, res)
+			counted := struct {
+				Count int `json:"count"`
+			}{}
+			assert.NoError(t, codec.Unmarshal(data, &counted))
+			assert.Equal(t, 2, counted.Count)
+
+			_, err = encoderCatalog.EncodeWith(AddCommandReq{}, codec)
+			assert.ErrorIs(t, err, commands.ErrEncoderMissing)
+		})
+	}
+}
+
+func Test_DecoderCatalog_DecodeWith_Decoder(t *testing.T) {
+	decoderCatalog := commands.NewDefaultDecoderCatalog()
+	commands.InsertDecoder[AccountCommandReq](decoderCatalog, func(data []byte) (commands.CommandReq[commands.CommandRes], error) {
+		req := AccountCommandReq{}
+		if err := json.Unmarshal(data, &req); err != nil {
+			return nil, err
+		}
+		return AccountCommandReq{Name: req.Name}, nil
+	})
+	catalog := NewCodecCatalog()
+
+	for _, mediaType := range catalog.MediaTypes() {
+		t.Run(mediaType, func(t *testing.T) {
+			codec, err := catalog.ByMediaType(mediaType)
+			assert.NoError(t, err)
+			data, err := codec.Marshal(AccountCommandReq{Name: "alice", Admin: true})
+			assert.NoError(t, err)
+
+			req, err := decoderCatalog.DecodeWith(reflect.TypeFor[AccountCommandReq](), codec, data)
+			assert.NoError(t, err)
+			assert.Equal(t, AccountCommandReq{Name: "alice"}, req)
+		})
+	}
+}
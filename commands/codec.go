@@ -0,0 +1,382 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrCodecMissing       = errors.New("codec missing")
+	ErrCodecNotAcceptable = errors.New("codec not acceptable")
+)
+
+// MediaTypeJSON is the media type of JSONCodec, the default codec of every CodecCatalog.
+const MediaTypeJSON = "application/json"
+
+// Codec serializes requests and results in the format of a single media type.
+//
+// Methods:
+//   - MediaType: Returns the media type of the format, such as "application/json".
+//   - Marshal: Serializes a value.
+//   - Unmarshal: Deserializes data into the value pointed to by v.
+type Codec interface {
+	MediaType() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// JSONCodec is the Codec of MediaTypeJSON, backed by encoding/json.
+type JSONCodec struct{}
+
+// MediaType returns MediaTypeJSON.
+func (JSONCodec) MediaType() string {
+	return MediaTypeJSON
+}
+
+// Marshal serializes a value as JSON.
+func (JSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal deserializes JSON data into the value pointed to by v.
+func (JSONCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// CodecDecoder returns a Decoder function for decoding serialized command request data
+// into a specific command request type with a Codec.
+//
+// Parameters:
+//   - codec: The Codec the data is deserialized with.
+func CodecDecoder[TReq CommandReq[CommandRes]](codec Codec) Decoder {
+	return func(data []byte) (CommandReq[CommandRes], error) {
+		var commandReq TReq
+		if err := codec.Unmarshal(data, &commandReq); err != nil {
+			return nil, err
+		}
+		return commandReq, nil
+	}
+}
+
+// CodecEncoder returns an Encoder function for encoding the results of a specific command
+// result type with a Codec. A result of another type returns an error wrapping ErrInvalidResType.
+//
+// Parameters:
+//   - codec: The Codec the results are serialized with.
+func CodecEncoder[TRes CommandRes](codec Codec) Encoder {
+	return func(res CommandRes) ([]byte, error) {
+		commandRes, ok := res.(TRes)
+		if !ok {
+			return nil, fmt.Errorf("%w: expected %s, got %T", ErrInvalidResType, reflect.TypeFor[TRes](), res)
+		}
+		return codec.Marshal(commandRes)
+	}
+}
+
+// marshalJSONWith converts JSON data, such as the output of an Encoder, into the format of a
+// Codec, so that the fields chosen by the Encoder are kept in every media type.
+//
+// Parameters:
+//   - codec: The Codec the data is converted to.
+//   - data: The JSON data to convert.
+//
+// Returns:
+//   - The data serialized with codec.
+//   - An error if the data is not valid JSON, or cannot be marshaled by codec.
+func marshalJSONWith(codec Codec, data []byte) ([]byte, error) {
+	var value any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return codec.Marshal(fromJSON(value))
+}
+
+// unmarshalJSONWith converts data serialized with a Codec into JSON, such as the input of a
+// Decoder, so that the fields it reads are decoded in every media type.
+//
+// Parameters:
+//   - codec: The Codec the data is serialized with.
+//   - data: The data to convert.
+//
+// Returns:
+//   - The data serialized as JSON.
+//   - An error if the data cannot be unmarshaled by codec, or has no JSON representation.
+func unmarshalJSONWith(codec Codec, data []byte) ([]byte, error) {
+	var value any
+	if err := codec.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(toJSON(value))
+}
+
+// fromJSON replaces the json.Number values of a decoded JSON value with integers or floats,
+// which every Codec serializes as numbers.
+func fromJSON(value any) any {
+	switch value := value.(type) {
+	case json.Number:
+		if integer, err := value.Int64(); err == nil {
+			return integer
+		}
+		float, _ := value.Float64()
+		return float
+	case []any:
+		for i, element := range value {
+			value[i] = fromJSON(element)
+		}
+		return value
+	case map[string]any:
+		for key, element := range value {
+			value[key] = fromJSON(element)
+		}
+		return value
+	default:
+		return value
+	}
+}
+
+// toJSON replaces the maps with non-string keys of a value unmarshaled by a Codec, such as
+// those produced by CBOR, with maps keyed by strings, which JSON can represent.
+func toJSON(value any) any {
+	switch value := value.(type) {
+	case map[any]any:
+		object := make(map[string]any, len(value))
+		for key, element := range value {
+			object[fmt.Sprint(key)] = toJSON(element)
+		}
+		return object
+	case map[string]any:
+		for key, element := range value {
+			value[key] = toJSON(element)
+		}
+		return value
+	case []any:
+		for i, element := range value {
+			value[i] = toJSON(element)
+		}
+		return value
+	default:
+		return value
+	}
+}
+
+// CodecDecoderCatalog is implemented by a DecoderCatalog able to decode requests serialized
+// with any Codec, not only as JSON.
+type CodecDecoderCatalog interface {
+	DecodeWith(reqType reflect.Type, codec Codec, data []byte) (CommandReq[CommandRes], error)
+}
+
+// CodecEncoderCatalog is implemented by an EncoderCatalog able to encode results with any
+// Codec, not only as JSON.
+type CodecEncoderCatalog interface {
+	EncodeWith(res CommandRes, codec Codec) ([]byte, error)
+}
+
+// CodecCatalog is an interface for managing the codecs a transport serializes requests and
+// results with.
+//
+// Methods:
+//   - Insert: Catalogs a codec under its media type.
+//   - ByMediaType: Looks up the codec of a media type.
+//   - Negotiate: Picks the codec best matching an Accept header.
+//   - MediaTypes: Returns the cataloged media types, in order of preference.
+type CodecCatalog interface {
+	Insert(codec Codec)
+	ByMediaType(mediaType string) (Codec, error)
+	Negotiate(accept string) (Codec, error)
+	MediaTypes() []string
+}
+
+// DefaultCodecCatalog is a catalog for managing mappings between media types and codecs,
+// used by transports to pick the format of a request from its Content-Type and the format
+// of a result from its Accept header.
+//
+// Fields:
+//   - codecs: A map that associates lowercase media types with their Codec.
+//   - mediaTypes: The cataloged media types, in order of preference.
+type DefaultCodecCatalog struct {
+	mutex      sync.RWMutex
+	codecs     map[string]Codec
+	mediaTypes []string
+}
+
+// NewDefaultCodecCatalog creates and returns a new instance of DefaultCodecCatalog.
+// The catalog always holds JSONCodec, which is preferred when a client accepts any
+// media type, followed by the given codecs in order.
+//
+// Parameters:
+//   - codecs: The codecs to catalog besides JSONCodec.
+func NewDefaultCodecCatalog(codecs ...Codec) (catalog *DefaultCodecCatalog) {
+	catalog = &DefaultCodecCatalog{
+		mutex:      sync.RWMutex{},
+		codecs:     make(map[string]Codec),
+		mediaTypes: make([]string, 0),
+	}
+	catalog.Insert(JSONCodec{})
+	for _, codec := range codecs {
+		catalog.Insert(codec)
+	}
+	return catalog
+}
+
+// Insert catalogs a codec under its media type, replacing any codec already cataloged for it.
+//
+// Parameters:
+//   - codec: The Codec to catalog.
+func (c *DefaultCodecCatalog) Insert(codec Codec) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.codecs == nil {
+		c.codecs = make(map[string]Codec)
+	}
+	mediaType := strings.ToLower(codec.MediaType())
+	if _, found := c.codecs[mediaType]; !found {
+		c.mediaTypes = append(c.mediaTypes, mediaType)
+	}
+	c.codecs[mediaType] = codec
+}
+
+// ByMediaType looks up the codec of a media type, such as the value of a Content-Type header.
+// Parameters of the media type, such as a charset, are ignored.
+//
+// Parameters:
+//   - mediaType: The media type to look up; an empty value selects JSONCodec.
+//
+// Returns:
+//   - The Codec cataloged for the media type.
+//   - An error wrapping ErrCodecMissing if the media type is invalid or has no codec.
+func (c *DefaultCodecCatalog) ByMediaType(mediaType string) (codec Codec, err error) {
+	if strings.TrimSpace(mediaType) == "" {
+		return JSONCodec{}, nil
+	}
+	parsed, _, err := mime.ParseMediaType(mediaType)
+	if err != nil {
+		return nil, fmt.Errorf("%w: media type: %q: %w", ErrCodecMissing, mediaType, err)
+	}
+	c.mutex.RLock()
+	codec, found := c.codecs[parsed]
+	c.mutex.RUnlock()
+	if !found {
+		return nil, fmt.Errorf("%w: media type: %s", ErrCodecMissing, parsed)
+	}
+	return codec, nil
+}
+
+// Negotiate picks the codec best matching an Accept header, as NegotiateMediaType does for
+// the cataloged media types.
+//
+// Parameters:
+//   - accept: The value of the Accept header; an empty value selects JSONCodec.
+//
+// Returns:
+//   - The Codec best matching the header.
+//   - An error wrapping ErrCodecNotAcceptable if no cataloged media type is acceptable.
+func (c *DefaultCodecCatalog) Negotiate(accept string) (codec Codec, err error) {
+	if strings.TrimSpace(accept) == "" {
+		return JSONCodec{}, nil
+	}
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	mediaType, err := NegotiateMediaType(accept, c.mediaTypes...)
+	if err != nil {
+		return nil, err
+	}
+	return c.codecs[mediaType], nil
+}
+
+// MediaTypes returns the cataloged media types, in order of preference.
+func (c *DefaultCodecCatalog) MediaTypes() []string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return append([]string(nil), c.mediaTypes...)
+}
+
+// NegotiateMediaType picks the media type best matching an Accept header. Each media type gets
+// the quality of the most specific media range matching it, and the media type with the highest
+// quality wins, ties going to the order of mediaTypes.
+//
+// Parameters:
+//   - accept: The value of the Accept header; an empty value selects the first media type.
+//   - mediaTypes: The lowercase media types on offer, in order of preference.
+//
+// Returns:
+//   - mediaType: The media type best matching the header.
+//   - err: An error wrapping ErrCodecNotAcceptable if no media type is acceptable.
+func NegotiateMediaType(accept string, mediaTypes ...string) (mediaType string, err error) {
+	if strings.TrimSpace(accept) == "" && len(mediaTypes) > 0 {
+		return mediaTypes[0], nil
+	}
+	ranges := parseAccept(accept)
+	best := 0.0
+	for _, candidate := range mediaTypes {
+		specificity, quality := -1, 0.0
+		for _, r := range ranges {
+			if s := r.match(candidate); s > specificity {
+				specificity, quality = s, r.quality
+			}
+		}
+		if quality > best {
+			mediaType, best = candidate, quality
+		}
+	}
+	if mediaType == "" {
+		return "", fmt.Errorf("%w: accept: %s", ErrCodecNotAcceptable, accept)
+	}
+	return mediaType, nil
+}
+
+// mediaRange is one entry of an Accept header.
+type mediaRange struct {
+	mainType string
+	subType  string
+	quality  float64
+}
+
+// match returns how specifically the mediaRange matches a media type: 2 for an exact match,
+// 1 for a type/* match, 0 for */* and -1 for no match.
+func (r mediaRange) match(mediaType string) int {
+	mainType, subType, _ := strings.Cut(mediaType, "/")
+	switch {
+	case r.mainType == "*" && r.subType == "*":
+		return 0
+	case r.mainType != mainType:
+		return -1
+	case r.subType == "*":
+		return 1
+	case r.subType == subType:
+		return 2
+	default:
+		return -1
+	}
+}
+
+// parseAccept parses the media ranges of an Accept header, skipping malformed entries.
+func parseAccept(accept string) []mediaRange {
+	ranges := make([]mediaRange, 0)
+	for _, entry := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(entry))
+		if err != nil {
+			continue
+		}
+		mainType, subType, found := strings.Cut(mediaType, "/")
+		if !found {
+			continue
+		}
+		quality := 1.0
+		if q, found := params["q"]; found {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, mediaRange{mainType: mainType, subType: subType, quality: quality})
+	}
+	return ranges
+}
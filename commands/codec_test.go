@@ -0,0 +1,160 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_JSONCodec(t *testing.T) {
+	codec := JSONCodec{}
+	assert.Equal(t, MediaTypeJSON, codec.MediaType())
+
+	data, err := codec.Marshal(AddCommandReq{ArgX: 3, ArgY: 4})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"argX": 3, "argY": 4}`, string(data))
+
+	req := AddCommandReq{}
+	assert.NoError(t, codec.Unmarshal(data, &req))
+	assert.Equal(t, AddCommandReq{ArgX: 3, ArgY: 4}, req)
+}
+
+func Test_CodecDecoder(t *testing.T) {
+	decoder := CodecDecoder[AddCommandReq](TextCodec{})
+
+	t.Run("valid input", func(t *testing.T) {
+		req, err := decoder([]byte(`text:{"argX": 3, "argY": 4}`))
+		assert.NoError(t, err)
+		assert.Equal(t, AddCommandReq{ArgX: 3, ArgY: 4}, req)
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		req, err := decoder([]byte(`{"argX": 3, "argY": 4}`))
+		assert.Error(t, err)
+		assert.Nil(t, req)
+	})
+}
+
+func Test_CodecEncoder(t *testing.T) {
+	encoder := CodecEncoder[AddCommandRes](TextCodec{})
+
+	t.Run("valid res", func(t *testing.T) {
+		resData, err := encoder(AddCommandRes{Result: 3})
+		assert.NoError(t, err)
+		assert.Equal(t, `text:{"result":3}`, string(resData))
+	})
+
+	t.Run("invalid res type", func(t *testing.T) {
+		resData, err := encoder(SubCommandRes{Result: 3})
+		assert.ErrorIs(t, err, ErrInvalidResType)
+		assert.Nil(t, resData)
+	})
+}
+
+func Test_NewDefaultCodecCatalog(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		catalog := NewDefaultCodecCatalog()
+		assert.Equal(t, []string{MediaTypeJSON}, catalog.MediaTypes())
+	})
+
+	t.Run("with codecs", func(t *testing.T) {
+		catalog := NewDefaultCodecCatalog(TextCodec{}, TextCodec{})
+		assert.Equal(t, []string{MediaTypeJSON, MediaTypeText}, catalog.MediaTypes())
+	})
+}
+
+func Test_CodecCatalog_Insert(t *testing.T) {
+	catalog := DefaultCodecCatalog{}
+	catalog.Insert(TextCodec{})
+	assert.Equal(t, []string{MediaTypeText}, catalog.MediaTypes())
+	assert.Contains(t, catalog.codecs, MediaTypeText)
+}
+
+func Test_CodecCatalog_ByMediaType(t *testing.T) {
+	catalog := NewDefaultCodecCatalog(TextCodec{})
+
+	tests := []struct {
+		name      string
+		mediaType string
+		expected  Codec
+		err       error
+	}{
+		{name: "empty", mediaType: "", expected: JSONCodec{}},
+		{name: "json", mediaType: "application/json", expected: JSONCodec{}},
+		{name: "parameters", mediaType: "application/json; charset=utf-8", expected: JSONCodec{}},
+		{name: "case insensitive", mediaType: "Text/X-Test", expected: TextCodec{}},
+		{name: "missing", mediaType: "application/xml", err: ErrCodecMissing},
+		{name: "invalid", mediaType: "application/", err: ErrCodecMissing},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			codec, err := catalog.ByMediaType(test.mediaType)
+			if test.err != nil {
+				assert.ErrorIs(t, err, test.err)
+				assert.Nil(t, codec)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, codec)
+		})
+	}
+}
+
+func Test_CodecCatalog_Negotiate(t *testing.T) {
+	catalog := NewDefaultCodecCatalog(TextCodec{})
+
+	tests := []struct {
+		name     string
+		accept   string
+		expected Codec
+		err      error
+	}{
+		{name: "empty", accept: "", expected: JSONCodec{}},
+		{name: "exact", accept: "text/x-test", expected: TextCodec{}},
+		{name: "any", accept: "*/*", expected: JSONCodec{}},
+		{name: "type wildcard", accept: "text/*", expected: TextCodec{}},
+		{name: "quality", accept: "application/json;q=0.5, text/x-test", expected: TextCodec{}},
+		{name: "specific over wildcard", accept: "*/*;q=0.1, text/x-test;q=0.2", expected: TextCodec{}},
+		{name: "excluded", accept: "application/json;q=0, */*", expected: TextCodec{}},
+		{name: "malformed entries", accept: "application/;;, text/x-test", expected: TextCodec{}},
+		{name: "not acceptable", accept: "application/xml", err: ErrCodecNotAcceptable},
+		{name: "all excluded", accept: "*/*;q=0", err: ErrCodecNotAcceptable},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			codec, err := catalog.Negotiate(test.accept)
+			if test.err != nil {
+				assert.ErrorIs(t, err, test.err)
+				assert.Nil(t, codec)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, codec)
+		})
+	}
+}
+
+func Test_NegotiateMediaType(t *testing.T) {
+	t.Run("empty", func(t *testing.T) {
+		mediaType, err := NegotiateMediaType("", "application/x-ndjson", "text/event-stream")
+		assert.NoError(t, err)
+		assert.Equal(t, "application/x-ndjson", mediaType)
+	})
+
+	t.Run("preferred", func(t *testing.T) {
+		mediaType, err := NegotiateMediaType("text/event-stream", "application/x-ndjson", "text/event-stream")
+		assert.NoError(t, err)
+		assert.Equal(t, "text/event-stream", mediaType)
+	})
+
+	t.Run("not acceptable", func(t *testing.T) {
+		mediaType, err := NegotiateMediaType("application/json", "application/x-ndjson", "text/event-stream")
+		assert.ErrorIs(t, err, ErrCodecNotAcceptable)
+		assert.Empty(t, mediaType)
+	})
+
+	t.Run("nothing on offer", func(t *testing.T) {
+		_, err := NegotiateMediaType("")
+		assert.ErrorIs(t, err, ErrCodecNotAcceptable)
+	})
+}
@@ -5,6 +5,7 @@
 	"errors"
 	"fmt"
 	"reflect"
+	"strings"
 	"sync"
 
 	"github.com/dan-lugg/go-commands/util"
@@ -51,20 +52,39 @@ type DecoderCatalog interface {
 //     corresponding reflect.Type.
 //   - decoders: A map that associates reflect.Type with functions that
 //     decode serialized data into CommandReq[CommandRes].
+//   - mediaDecoders: A map that associates reflect.Type with the decoders cataloged
+//     for specific media types, keyed by lowercase media type.
+//   - validator: A Validator run on every decoded request, or nil to skip validation.
 type DefaultDecoderCatalog struct {
-	mutex    sync.RWMutex
-	decoders map[reflect.Type]Decoder
+	mutex         sync.RWMutex
+	decoders      map[reflect.Type]Decoder
+	mediaDecoders map[reflect.Type]map[string]Decoder
+	validator     Validator
 }
 
 type NewDefaultDecoderCatalogOption = util.Option[*DefaultDecoderCatalog]
 
+// WithValidator returns an option that sets the Validator run on every request
+// decoded by a DefaultDecoderCatalog. Passing nil disables validation.
+//
+// Parameters:
+//   - validator: The Validator to run, or nil.
+func WithValidator(validator Validator) NewDefaultDecoderCatalogOption {
+	return func(catalog *DefaultDecoderCatalog) {
+		catalog.validator = validator
+	}
+}
+
 // NewDefaultDecoderCatalog creates and returns a new instance of DecoderCatalog.
 // The catalog is initialized with an empty map for decoders, which associates
-// reflect.Type with functions that decode serialized data into CommandReq[CommandRes].
+// reflect.Type with functions that decode serialized data into CommandReq[CommandRes],
+// and with Validate as the validator run on every decoded request.
 func NewDefaultDecoderCatalog(options ...NewDefaultDecoderCatalogOption) (catalog *DefaultDecoderCatalog) {
 	catalog = &DefaultDecoderCatalog{
-		mutex:    sync.RWMutex{},
-		decoders: make(map[reflect.Type]Decoder),
+		mutex:         sync.RWMutex{},
+		decoders:      make(map[reflect.Type]Decoder),
+		mediaDecoders: make(map[reflect.Type]map[string]Decoder),
+		validator:     Validate,
 	}
 	for _, option := range options {
 		option(catalog)
@@ -98,6 +118,37 @@ func InsertDecoder[TReq CommandReq[CommandRes]](catalog DecoderCatalog, decoder
 	catalog.Insert(reflect.TypeFor[TReq](), decoder)
 }
 
+// InsertFor catalogs a decoder for a specific command request type serialized in a specific
+// media type, used by DecodeWith instead of the decoder cataloged with Insert.
+//
+// Parameters:
+//   - reqType: The reflect.Type of the request type.
+//   - mediaType: The media type of the serialized data, such as "application/yaml".
+//   - decoder: A Decoder function that decodes serialized data
+//     into the specified command request type.
+func (d *DefaultDecoderCatalog) InsertFor(reqType reflect.Type, mediaType string, decoder Decoder) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.mediaDecoders == nil {
+		d.mediaDecoders = make(map[reflect.Type]map[string]Decoder)
+	}
+	if d.mediaDecoders[reqType] == nil {
+		d.mediaDecoders[reqType] = make(map[string]Decoder)
+	}
+	d.mediaDecoders[reqType][strings.ToLower(mediaType)] = decoder
+}
+
+// InsertDecoderFor is a generic function that catalogs a decoder for a specific command request
+// type serialized in a specific media type.
+//
+// Parameters:
+//   - catalog: A pointer to the DefaultDecoderCatalog where the decoder will be cataloged.
+//   - mediaType: The media type of the serialized data.
+//   - decoder: A Decoder function that decodes serialized data into the specified command request type.
+func InsertDecoderFor[TReq CommandReq[CommandRes]](catalog *DefaultDecoderCatalog, mediaType string, decoder Decoder) {
+	catalog.InsertFor(reflect.TypeFor[TReq](), mediaType, decoder)
+}
+
 // Decode attempts to decode serialized command request data into a specific command request type.
 //
 // Parameters:
@@ -106,20 +157,72 @@ func InsertDecoder[TReq CommandReq[CommandRes]](catalog DecoderCatalog, decoder
 //
 // Returns:
 //   - A CommandReq[CommandRes] representing the decoded command request.
-//   - An error if the decoding fails or if no decoder is cataloged for the given request name.
+//   - An error if the decoding fails or if no decoder is cataloged for the given request name,
+//     or an error wrapping ErrValidationFailure if the decoded request is invalid.
 func (d *DefaultDecoderCatalog) Decode(reqType reflect.Type, reqJSON []byte) (req CommandReq[CommandRes], err error) {
 	d.mutex.RLock()
 	decoder, found := d.decoders[reqType]
+	validator := d.validator
 	d.mutex.RUnlock()
 	if !found {
 		return nil, fmt.Errorf("%w: req type: %s", ErrDecoderMissing, reqType)
 	}
-	req, err = decoder(reqJSON)
+	return decode(decoder, validator, reqJSON)
+}
+
+// DecodeWith attempts to decode command request data serialized with a Codec into a specific
+// command request type, implementing CodecDecoderCatalog.
+//
+// A decoder cataloged with InsertFor for the media type of the codec is used first. Otherwise,
+// the data is decoded with Decode, after being converted to JSON by the codec if it is serialized
+// in another media type, so that it goes through the decoder cataloged with Insert.
+//
+// Parameters:
+//   - reqType: The reflect.Type of the request type to decode.
+//   - codec: The Codec the data is serialized with.
+//   - data: A byte slice containing the serialized command request data.
+//
+// Returns:
+//   - A CommandReq[CommandRes] representing the decoded command request.
+//   - An error if the decoding fails or if no decoder is cataloged for the given request type,
+//     or an error wrapping ErrValidationFailure if the decoded request is invalid.
+func (d *DefaultDecoderCatalog) DecodeWith(reqType reflect.Type, codec Codec, data []byte) (req CommandReq[CommandRes], err error) {
+	mediaType := strings.ToLower(codec.MediaType())
+	d.mutex.RLock()
+	decoder, found := d.mediaDecoders[reqType][mediaType]
+	_, known := d.decoders[reqType]
+	validator := d.validator
+	d.mutex.RUnlock()
+	switch {
+	case found:
+		return decode(decoder, validator, data)
+	case mediaType == MediaTypeJSON:
+		return d.Decode(reqType, data)
+	case !known:
+		return nil, fmt.Errorf("%w: req type: %s", ErrDecoderMissing, reqType)
+	}
+	if data, err = unmarshalJSONWith(codec, data); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecoderFailure, err)
+	}
+	return d.Decode(reqType, data)
+}
+
+// decode runs a decoder and validates the decoded request.
+func decode(decoder Decoder, validator Validator, data []byte) (req CommandReq[CommandRes], err error) {
+	req, err = decoder(data)
 	if req == nil {
 		return nil, fmt.Errorf("%w: req is nil", ErrDecoderFailure)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("%w: %w", ErrDecoderFailure, err)
 	}
+	if validator != nil {
+		if err = validator(req); err != nil {
+			if !errors.Is(err, ErrValidationFailure) {
+				err = fmt.Errorf("%w: %w", ErrValidationFailure, err)
+			}
+			return nil, err
+		}
+	}
 	return req, nil
 }
@@ -78,6 +78,61 @@ func Test_DecoderCatalog_Decode(t *testing.T) {
 	})
 }
 
+func Test_InsertDecoderFor(t *testing.T) {
+	catalog := NewDefaultDecoderCatalog()
+	InsertDecoderFor[AddCommandReq](catalog, "Text/X-Test", CodecDecoder[AddCommandReq](TextCodec{}))
+	assert.Contains(t, catalog.mediaDecoders[reflect.TypeFor[AddCommandReq]()], MediaTypeText)
+}
+
+func Test_DecoderCatalog_DecodeWith(t *testing.T) {
+	catalog := NewDefaultDecoderCatalog()
+	InsertDecoder[AddCommandReq](catalog, DefaultDecoder[AddCommandReq]())
+	InsertDecoder[SelfValidCommandReq](catalog, DefaultDecoder[SelfValidCommandReq]())
+	InsertDecoderFor[SubCommandReq](catalog, MediaTypeText, func(data []byte) (CommandReq[CommandRes], error) {
+		return SubCommandReq{ArgX: len(data)}, nil
+	})
+
+	t.Run("json", func(t *testing.T) {
+		req, err := catalog.DecodeWith(reflect.TypeFor[AddCommandReq](), JSONCodec{}, []byte(`{"argX": 3, "argY": 4}`))
+		assert.NoError(t, err)
+		assert.Equal(t, AddCommandReq{ArgX: 3, ArgY: 4}, req)
+	})
+
+	t.Run("codec", func(t *testing.T) {
+		req, err := catalog.DecodeWith(reflect.TypeFor[AddCommandReq](), TextCodec{}, []byte(`text:{"argX": 3, "argY": 4}`))
+		assert.NoError(t, err)
+		assert.Equal(t, AddCommandReq{ArgX: 3, ArgY: 4}, req)
+	})
+
+	t.Run("media decoder", func(t *testing.T) {
+		req, err := catalog.DecodeWith(reflect.TypeFor[SubCommandReq](), TextCodec{}, []byte(`abc`))
+		assert.NoError(t, err)
+		assert.Equal(t, SubCommandReq{ArgX: 3}, req)
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		req, err := catalog.DecodeWith(reflect.TypeFor[AddCommandReq](), TextCodec{}, []byte(`{"argX": 3}`))
+		assert.ErrorIs(t, err, ErrDecoderFailure)
+		assert.Nil(t, req)
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		req, err := catalog.DecodeWith(reflect.TypeFor[SelfValidCommandReq](), TextCodec{}, []byte(`text:{"argX": 2, "argY": 1}`))
+		assert.ErrorIs(t, err, ErrValidationFailure)
+		assert.Nil(t, req)
+	})
+
+	t.Run("decoder missing", func(t *testing.T) {
+		req, err := catalog.DecodeWith(reflect.TypeFor[SlowCommandReq](), TextCodec{}, []byte(`text:{}`))
+		assert.ErrorIs(t, err, ErrDecoderMissing)
+		assert.Nil(t, req)
+
+		req, err = catalog.DecodeWith(reflect.TypeFor[SubCommandReq](), JSONCodec{}, []byte(`{}`))
+		assert.ErrorIs(t, err, ErrDecoderMissing)
+		assert.Nil(t, req)
+	})
+}
+
 func Test_DefaultCommandReqDecoder(t *testing.T) {
 	decoder := DefaultDecoder[AddCommandReq]()
 
@@ -0,0 +1,287 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+
+	"github.com/dan-lugg/go-commands/util"
+)
+
+var (
+	ErrInvalidEnvelope = errors.New("invalid envelope")
+)
+
+// Envelope is a command addressed by name rather than by Go type, as received at the edges of a system.
+//
+// Fields:
+//   - ID: An optional ID chosen by the caller, echoed in the ResultEnvelope.
+//   - Name: The mapped name of the request type.
+//   - Payload: The serialized request.
+type Envelope struct {
+	ID      string          `json:"id,omitempty"`
+	Name    string          `json:"name"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// ResultEnvelope is the outcome of dispatching an Envelope.
+//
+// Fields:
+//   - ID: The ID of the Envelope.
+//   - Name: The name of the Envelope.
+//   - Result: The encoded result, if the command succeeded.
+//   - Error: A human-readable description of the failure, if the command failed.
+//   - Err: The error of the dispatch, for in-process callers; it is not serialized.
+type ResultEnvelope struct {
+	ID     string          `json:"id,omitempty"`
+	Name   string          `json:"name"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+	Err    error           `json:"-"`
+}
+
+// Dispatcher dispatches commands addressed by name, combining the three catalogs into a single
+// entry point for transports.
+//
+// Each name is resolved through the MappingCatalog, the payload is decoded through the
+// DecoderCatalog and the request is dispatched through the HandlerCatalog. Results are
+// encoded through the EncoderCatalog, if any, or as JSON.
+//
+// Fields:
+//   - mappingCatalog: The MappingCatalog used to resolve request names to types.
+//   - decoderCatalog: The DecoderCatalog used to decode payloads.
+//   - handlerCatalog: The HandlerCatalog used to dispatch decoded requests.
+//   - encoderCatalog: The EncoderCatalog used to encode results, or nil to encode them as JSON.
+type Dispatcher struct {
+	mappingCatalog MappingCatalog
+	decoderCatalog DecoderCatalog
+	handlerCatalog HandlerCatalog
+	encoderCatalog EncoderCatalog
+}
+
+type DispatcherOption = util.Option[*Dispatcher]
+
+// WithEncoderCatalog returns an option that sets the EncoderCatalog a Dispatcher encodes results with.
+//
+// Parameters:
+//   - encoderCatalog: The EncoderCatalog used to encode results, or nil to encode them as JSON.
+func WithEncoderCatalog(encoderCatalog EncoderCatalog) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.encoderCatalog = encoderCatalog
+	}
+}
+
+// NewDispatcher creates and returns a new instance of Dispatcher.
+//
+// Parameters:
+//   - mappingCatalog: The MappingCatalog used to resolve request names to types.
+//   - decoderCatalog: The DecoderCatalog used to decode payloads.
+//   - handlerCatalog: The HandlerCatalog used to dispatch decoded requests.
+//   - options: Options applied to the Dispatcher.
+//
+// Returns:
+//   - A pointer to a Dispatcher instance.
+func NewDispatcher(mappingCatalog MappingCatalog, decoderCatalog DecoderCatalog, handlerCatalog HandlerCatalog, options ...DispatcherOption) (dispatcher *Dispatcher) {
+	dispatcher = &Dispatcher{
+		mappingCatalog: mappingCatalog,
+		decoderCatalog: decoderCatalog,
+		handlerCatalog: handlerCatalog,
+		encoderCatalog: nil,
+	}
+	for _, option := range options {
+		option(dispatcher)
+	}
+	return dispatcher
+}
+
+// Decode resolves a request name and decodes a payload into the mapped request type.
+//
+// Parameters:
+//   - reqName: The mapped name of the request type.
+//   - payload: The serialized request.
+//
+// Returns:
+//   - req: The decoded request.
+//   - err: An error wrapping ErrMappingMissing if the name is not mapped, or the error of the DecoderCatalog.
+func (d *Dispatcher) Decode(reqName string, payload []byte) (req CommandReq[CommandRes], err error) {
+	reqType, err := d.mappingCatalog.ByName(reqName)
+	if err != nil {
+		return nil, err
+	}
+	return d.decoderCatalog.Decode(reqType, payload)
+}
+
+// DecodeWith resolves a request name and decodes a payload serialized with a Codec into the
+// mapped request type.
+//
+// Parameters:
+//   - reqName: The mapped name of the request type.
+//   - codec: The Codec the payload is serialized with.
+//   - payload: The serialized request.
+//
+// Returns:
+//   - req: The decoded request.
+//   - err: An error wrapping ErrMappingMissing if the name is not mapped, an error wrapping
+//     ErrCodecMissing if the DecoderCatalog only decodes JSON and the codec is not JSONCodec,
+//     or the error of the DecoderCatalog.
+func (d *Dispatcher) DecodeWith(reqName string, codec Codec, payload []byte) (req CommandReq[CommandRes], err error) {
+	reqType, err := d.mappingCatalog.ByName(reqName)
+	if err != nil {
+		return nil, err
+	}
+	if codecCatalog, ok := d.decoderCatalog.(CodecDecoderCatalog); ok {
+		return codecCatalog.DecodeWith(reqType, codec, payload)
+	}
+	if codec.MediaType() != MediaTypeJSON {
+		return nil, fmt.Errorf("%w: media type %s not supported by the decoder catalog", ErrCodecMissing, codec.MediaType())
+	}
+	return d.decoderCatalog.Decode(reqType, payload)
+}
+
+// Handle decodes a payload into the request type mapped to a name and dispatches it.
+//
+// Parameters:
+//   - ctx: A context.Context providing context for the dispatch.
+//   - reqName: The mapped name of the request type.
+//   - payload: The serialized request.
+//
+// Returns:
+//   - res: The result of the command.
+//   - err: An error if the request cannot be resolved or decoded, or the error of the command.
+func (d *Dispatcher) Handle(ctx context.Context, reqName string, payload []byte) (res CommandRes, err error) {
+	req, err := d.Decode(reqName, payload)
+	if err != nil {
+		return nil, err
+	}
+	return d.handlerCatalog.Handle(ctx, req)
+}
+
+// Stream decodes a payload into the request type mapped to a name and dispatches it to its
+// stream handler.
+//
+// Parameters:
+//   - ctx: A context.Context providing context for the dispatch; ending it stops the stream.
+//   - reqName: The mapped name of the request type.
+//   - payload: The serialized request.
+//
+// Returns:
+//   - A sequence of the items produced, yielding a single error if the request cannot be resolved
+//     or decoded, or an error wrapping ErrHandlerMissing if the HandlerCatalog does not implement
+//     StreamCatalog.
+func (d *Dispatcher) Stream(ctx context.Context, reqName string, payload []byte) iter.Seq2[CommandRes, error] {
+	return func(yield func(CommandRes, error) bool) {
+		req, err := d.Decode(reqName, payload)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		streamCatalog, ok := d.handlerCatalog.(StreamCatalog)
+		if !ok {
+			yield(nil, fmt.Errorf("%w for stream req type: %T", ErrHandlerMissing, req))
+			return
+		}
+		for item, err := range streamCatalog.Stream(ctx, req) {
+			if !yield(item, err) {
+				return
+			}
+		}
+	}
+}
+
+// Encode encodes a result through the EncoderCatalog, or as JSON if the Dispatcher has none.
+//
+// Parameters:
+//   - res: The result to encode.
+//
+// Returns:
+//   - resData: The encoded result.
+//   - err: An error wrapping ErrEncoderMissing or ErrEncoderFailure if the result cannot be encoded.
+func (d *Dispatcher) Encode(res CommandRes) (resData []byte, err error) {
+	if d.encoderCatalog != nil {
+		return d.encoderCatalog.Encode(res)
+	}
+	if resData, err = json.Marshal(res); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrEncoderFailure, err)
+	}
+	return resData, nil
+}
+
+// EncodeWith encodes a result with a Codec. If the EncoderCatalog implements CodecEncoderCatalog
+// it encodes the result. Otherwise the result is encoded with Encode and, in other media types
+// than JSON, converted by the codec, or marshaled directly by the codec if the Dispatcher has
+// no EncoderCatalog.
+//
+// Parameters:
+//   - res: The result to encode.
+//   - codec: The Codec the result is serialized with.
+//
+// Returns:
+//   - resData: The encoded result.
+//   - err: An error wrapping ErrEncoderMissing or ErrEncoderFailure if the result cannot be encoded.
+func (d *Dispatcher) EncodeWith(res CommandRes, codec Codec) (resData []byte, err error) {
+	if codecCatalog, ok := d.encoderCatalog.(CodecEncoderCatalog); ok {
+		return codecCatalog.EncodeWith(res, codec)
+	}
+	if codec.MediaType() == MediaTypeJSON {
+		return d.Encode(res)
+	}
+	if d.encoderCatalog == nil {
+		resData, err = codec.Marshal(res)
+	} else if resData, err = d.Encode(res); err == nil {
+		resData, err = marshalJSONWith(codec, resData)
+	} else {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrEncoderFailure, err)
+	}
+	return resData, nil
+}
+
+// Dispatch dispatches an Envelope and returns the outcome as a ResultEnvelope. Failures are
+// reported in the ResultEnvelope rather than returned.
+//
+// Parameters:
+//   - ctx: A context.Context providing context for the dispatch.
+//   - envelope: The Envelope to dispatch.
+//
+// Returns:
+//   - The ResultEnvelope of the dispatch.
+func (d *Dispatcher) Dispatch(ctx context.Context, envelope Envelope) (result ResultEnvelope) {
+	result = ResultEnvelope{ID: envelope.ID, Name: envelope.Name}
+	res, err := d.Handle(ctx, envelope.Name, envelope.Payload)
+	if err == nil {
+		result.Result, err = d.Encode(res)
+	}
+	if err != nil {
+		result.Result, result.Error, result.Err = nil, err.Error(), err
+	}
+	return result
+}
+
+// DispatchJSON dispatches a JSON encoded Envelope and returns the JSON encoded ResultEnvelope.
+//
+// Parameters:
+//   - ctx: A context.Context providing context for the dispatch.
+//   - data: The JSON encoded Envelope.
+//
+// Returns:
+//   - resData: The JSON encoded ResultEnvelope, also written when the dispatch fails.
+//   - err: The error reported in the ResultEnvelope, wrapping ErrInvalidEnvelope if data is not a valid Envelope.
+func (d *Dispatcher) DispatchJSON(ctx context.Context, data []byte) (resData []byte, err error) {
+	envelope := Envelope{}
+	result := ResultEnvelope{}
+	if err = json.Unmarshal(data, &envelope); err != nil {
+		err = fmt.Errorf("%w: %w", ErrInvalidEnvelope, err)
+		result = ResultEnvelope{Error: err.Error(), Err: err}
+	} else if envelope.Name == "" {
+		err = fmt.Errorf("%w: name is empty", ErrInvalidEnvelope)
+		result = ResultEnvelope{ID: envelope.ID, Error: err.Error(), Err: err}
+	} else {
+		result = d.Dispatch(ctx, envelope)
+	}
+	resData, _ = json.Marshal(result)
+	return resData, result.Err
+}
@@ -0,0 +1,205 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newDispatcher(options ...DispatcherOption) *Dispatcher {
+	mappingCatalog := NewMappingCatalog()
+	InsertMapping[AddCommandReq](mappingCatalog, AddReqName)
+	InsertMapping[SubCommandReq](mappingCatalog, SubReqName)
+
+	decoderCatalog := NewDefaultDecoderCatalog()
+	InsertDecoder[AddCommandReq](decoderCatalog, DefaultDecoder[AddCommandReq]())
+	InsertDecoder[SubCommandReq](decoderCatalog, DefaultDecoder[SubCommandReq]())
+
+	handlerCatalog := NewDefaultHandlerCatalog()
+	InsertHandler[AddCommandReq, AddCommandRes](handlerCatalog, func() Handler[AddCommandReq, AddCommandRes] {
+		return &AddHandler{}
+	})
+	return NewDispatcher(mappingCatalog, decoderCatalog, handlerCatalog, options...)
+}
+
+func Test_Dispatcher_Decode(t *testing.T) {
+	dispatcher := newDispatcher()
+
+	t.Run("success", func(t *testing.T) {
+		req, err := dispatcher.Decode(AddReqName, []byte(`{"argX":1,"argY":2}`))
+		assert.NoError(t, err)
+		assert.Equal(t, AddCommandReq{ArgX: 1, ArgY: 2}, req)
+	})
+
+	t.Run("mapping missing", func(t *testing.T) {
+		_, err := dispatcher.Decode("missing", []byte(`{}`))
+		assert.ErrorIs(t, err, ErrMappingMissing)
+	})
+
+	t.Run("decoder failure", func(t *testing.T) {
+		_, err := dispatcher.Decode(AddReqName, []byte(`{`))
+		assert.ErrorIs(t, err, ErrDecoderFailure)
+	})
+}
+
+func Test_Dispatcher_DecodeWith(t *testing.T) {
+	dispatcher := newDispatcher()
+
+	t.Run("codec", func(t *testing.T) {
+		req, err := dispatcher.DecodeWith(AddReqName, TextCodec{}, []byte(`text:{"argX":1,"argY":2}`))
+		assert.NoError(t, err)
+		assert.Equal(t, AddCommandReq{ArgX: 1, ArgY: 2}, req)
+	})
+
+	t.Run("mapping missing", func(t *testing.T) {
+		req, err := dispatcher.DecodeWith("missing", TextCodec{}, []byte(`text:{}`))
+		assert.ErrorIs(t, err, ErrMappingMissing)
+		assert.Nil(t, req)
+	})
+
+	t.Run("json only catalog", func(t *testing.T) {
+		mappingCatalog := NewMappingCatalog()
+		InsertMapping[AddCommandReq](mappingCatalog, AddReqName)
+		decoderCatalog := struct{ DecoderCatalog }{NewDefaultDecoderCatalog()}
+		InsertDecoder[AddCommandReq](decoderCatalog, DefaultDecoder[AddCommandReq]())
+		dispatcher := NewDispatcher(mappingCatalog, decoderCatalog, NewDefaultHandlerCatalog())
+
+		req, err := dispatcher.DecodeWith(AddReqName, JSONCodec{}, []byte(`{"argX":1,"argY":2}`))
+		assert.NoError(t, err)
+		assert.Equal(t, AddCommandReq{ArgX: 1, ArgY: 2}, req)
+
+		req, err = dispatcher.DecodeWith(AddReqName, TextCodec{}, []byte(`text:{}`))
+		assert.ErrorIs(t, err, ErrCodecMissing)
+		assert.Nil(t, req)
+	})
+}
+
+func Test_Dispatcher_Handle(t *testing.T) {
+	dispatcher := newDispatcher()
+
+	t.Run("success", func(t *testing.T) {
+		res, err := dispatcher.Handle(context.Background(), AddReqName, []byte(`{"argX":1,"argY":2}`))
+		assert.NoError(t, err)
+		assert.Equal(t, AddCommandRes{Result: 3}, res)
+	})
+
+	t.Run("handler missing", func(t *testing.T) {
+		_, err := dispatcher.Handle(context.Background(), SubReqName, []byte(`{"argX":1,"argY":2}`))
+		assert.ErrorIs(t, err, ErrHandlerMissing)
+	})
+}
+
+func Test_Dispatcher_Dispatch(t *testing.T) {
+	dispatcher := newDispatcher()
+
+	t.Run("success", func(t *testing.T) {
+		result := dispatcher.Dispatch(context.Background(), Envelope{ID: "1", Name: AddReqName, Payload: json.RawMessage(`{"argX":1,"argY":2}`)})
+		assert.NoError(t, result.Err)
+		assert.Equal(t, "1", result.ID)
+		assert.Equal(t, AddReqName, result.Name)
+		assert.JSONEq(t, `{"result":3}`, string(result.Result))
+		assert.Empty(t, result.Error)
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		result := dispatcher.Dispatch(context.Background(), Envelope{ID: "2", Name: "missing"})
+		assert.ErrorIs(t, result.Err, ErrMappingMissing)
+		assert.Equal(t, "2", result.ID)
+		assert.Nil(t, result.Result)
+		assert.Equal(t, result.Err.Error(), result.Error)
+	})
+}
+
+func Test_Dispatcher_DispatchJSON(t *testing.T) {
+	dispatcher := newDispatcher()
+	tests := []struct {
+		name   string
+		data   string
+		resRaw string
+		err    error
+	}{
+		{"success", `{"id":"1","name":"add","payload":{"argX":1,"argY":2}}`, `{"id":"1","name":"add","result":{"result":3}}`, nil},
+		{"handler missing", `{"name":"sub","payload":{}}`, `{"name":"sub","error":"handler missing for req type: commands.SubCommandReq"}`, ErrHandlerMissing},
+		{"empty name", `{"id":"3","payload":{}}`, `{"id":"3","name":"","error":"invalid envelope: name is empty"}`, ErrInvalidEnvelope},
+		{"malformed", `[`, ``, ErrInvalidEnvelope},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resData, err := dispatcher.DispatchJSON(context.Background(), []byte(test.data))
+			if test.err != nil {
+				assert.ErrorIs(t, err, test.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			if test.resRaw != "" {
+				assert.JSONEq(t, test.resRaw, string(resData))
+			}
+			result := ResultEnvelope{}
+			assert.NoError(t, json.Unmarshal(resData, &result))
+		})
+	}
+}
+
+func Test_Dispatcher_Encode(t *testing.T) {
+	t.Run("json", func(t *testing.T) {
+		resData, err := newDispatcher().Encode(AddCommandRes{Result: 3})
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"result":3}`, string(resData))
+	})
+
+	t.Run("json failure", func(t *testing.T) {
+		_, err := newDispatcher().Encode(func() {})
+		assert.ErrorIs(t, err, ErrEncoderFailure)
+	})
+
+	t.Run("encoder catalog", func(t *testing.T) {
+		encoderCatalog := NewDefaultEncoderCatalog()
+		InsertEncoder[AddCommandRes](encoderCatalog, func(res CommandRes) ([]byte, error) {
+			return json.Marshal(res.(AddCommandRes).Result)
+		})
+		dispatcher := newDispatcher(WithEncoderCatalog(encoderCatalog))
+
+		result := dispatcher.Dispatch(context.Background(), Envelope{Name: AddReqName, Payload: json.RawMessage(`{"argX":1,"argY":2}`)})
+		assert.NoError(t, result.Err)
+		assert.JSONEq(t, `3`, string(result.Result))
+
+		_, err := dispatcher.Encode(SubCommandRes{})
+		assert.ErrorIs(t, err, ErrEncoderMissing)
+	})
+}
+
+func Test_Dispatcher_EncodeWith(t *testing.T) {
+	t.Run("json", func(t *testing.T) {
+		resData, err := newDispatcher().EncodeWith(AddCommandRes{Result: 3}, JSONCodec{})
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"result":3}`, string(resData))
+	})
+
+	t.Run("codec", func(t *testing.T) {
+		resData, err := newDispatcher().EncodeWith(AddCommandRes{Result: 3}, TextCodec{})
+		assert.NoError(t, err)
+		assert.Equal(t, `text:{"result":3}`, string(resData))
+	})
+
+	t.Run("codec failure", func(t *testing.T) {
+		_, err := newDispatcher().EncodeWith(func() {}, TextCodec{})
+		assert.ErrorIs(t, err, ErrEncoderFailure)
+	})
+
+	t.Run("encoder catalog", func(t *testing.T) {
+		encoderCatalog := NewDefaultEncoderCatalog()
+		InsertEncoderFor[AddCommandRes](encoderCatalog, MediaTypeText, func(res CommandRes) ([]byte, error) {
+			return []byte(`text:3`), nil
+		})
+		dispatcher := newDispatcher(WithEncoderCatalog(encoderCatalog))
+
+		resData, err := dispatcher.EncodeWith(AddCommandRes{Result: 3}, TextCodec{})
+		assert.NoError(t, err)
+		assert.Equal(t, `text:3`, string(resData))
+
+		_, err = dispatcher.EncodeWith(AddCommandRes{Result: 3}, JSONCodec{})
+		assert.ErrorIs(t, err, ErrEncoderMissing)
+	})
+}
@@ -0,0 +1,213 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/dan-lugg/go-commands/util"
+)
+
+var (
+	ErrEncoderMissing = errors.New("encoder missing")
+	ErrEncoderFailure = errors.New("encoder failure")
+)
+
+// Encoder is a function type that takes a CommandRes as input and returns its
+// serialized form and an error. It is used to encode the results of a specific
+// command result type.
+type Encoder func(CommandRes) ([]byte, error)
+
+// DefaultEncoder returns an Encoder function for encoding the results of a
+// specific command result type as JSON.
+//
+// The returned encoder function asserts that its input is of type TRes and
+// marshals it, returning an error wrapping ErrInvalidResType if it is not.
+func DefaultEncoder[TRes CommandRes]() Encoder {
+	return func(res CommandRes) ([]byte, error) {
+		commandRes, ok := res.(TRes)
+		if !ok {
+			return nil, fmt.Errorf("%w: expected %s, got %T", ErrInvalidResType, reflect.TypeFor[TRes](), res)
+		}
+		return json.Marshal(commandRes)
+	}
+}
+
+type EncoderCatalog interface {
+	Insert(resType reflect.Type, encoder Encoder)
+	Encode(res CommandRes) ([]byte, error)
+}
+
+// DefaultEncoderCatalog is a catalog for managing mappings between result types
+// and encoders. It is the counterpart of DefaultDecoderCatalog, allowing the
+// serialized form of each result type to be customized, for example to hide
+// internal fields or to flatten results.
+//
+// Fields:
+//   - encoders: A map that associates reflect.Type with functions that
+//     encode a CommandRes into serialized data.
+//   - mediaEncoders: A map that associates reflect.Type with the encoders cataloged
+//     for specific media types, keyed by lowercase media type.
+//   - fallback: An Encoder used for result types without a cataloged encoder,
+//     or nil to fail with ErrEncoderMissing.
+type DefaultEncoderCatalog struct {
+	mutex         sync.RWMutex
+	encoders      map[reflect.Type]Encoder
+	mediaEncoders map[reflect.Type]map[string]Encoder
+	fallback      Encoder
+}
+
+type NewDefaultEncoderCatalogOption = util.Option[*DefaultEncoderCatalog]
+
+// WithFallbackEncoder returns an option that sets the Encoder a DefaultEncoderCatalog
+// uses for result types without a cataloged encoder. Passing nil makes those
+// result types fail with ErrEncoderMissing.
+//
+// Parameters:
+//   - fallback: The Encoder to fall back to, or nil.
+func WithFallbackEncoder(fallback Encoder) NewDefaultEncoderCatalogOption {
+	return func(catalog *DefaultEncoderCatalog) {
+		catalog.fallback = fallback
+	}
+}
+
+// JSONEncoder is an Encoder that marshals any result as JSON, suitable as the
+// fallback of a DefaultEncoderCatalog.
+func JSONEncoder(res CommandRes) ([]byte, error) {
+	return json.Marshal(res)
+}
+
+// NewDefaultEncoderCatalog creates and returns a new instance of DefaultEncoderCatalog.
+// The catalog is initialized with an empty map for encoders and no fallback, so
+// encoding a result type without a cataloged encoder fails with ErrEncoderMissing.
+func NewDefaultEncoderCatalog(options ...NewDefaultEncoderCatalogOption) (catalog *DefaultEncoderCatalog) {
+	catalog = &DefaultEncoderCatalog{
+		mutex:         sync.RWMutex{},
+		encoders:      make(map[reflect.Type]Encoder),
+		mediaEncoders: make(map[reflect.Type]map[string]Encoder),
+		fallback:      nil,
+	}
+	for _, option := range options {
+		option(catalog)
+	}
+	return catalog
+}
+
+// Insert catalogs an encoder for a specific command result type.
+//
+// Parameters:
+//   - resType: The reflect.Type of the result type.
+//   - encoder: An Encoder function that encodes results of the specified
+//     command result type into serialized data.
+func (e *DefaultEncoderCatalog) Insert(resType reflect.Type, encoder Encoder) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.encoders == nil {
+		e.encoders = make(map[reflect.Type]Encoder)
+	}
+	e.encoders[resType] = encoder
+}
+
+// InsertEncoder is a generic function that catalogs an encoder for a specific command result type.
+//
+// Parameters:
+//   - catalog: The EncoderCatalog where the encoder will be cataloged.
+//   - encoder: An Encoder function that encodes results of the specified command result type.
+func InsertEncoder[TRes CommandRes](catalog EncoderCatalog, encoder Encoder) {
+	catalog.Insert(reflect.TypeFor[TRes](), encoder)
+}
+
+// InsertFor catalogs an encoder for a specific command result type serialized in a specific
+// media type, used by EncodeWith instead of the codec.
+//
+// Parameters:
+//   - resType: The reflect.Type of the result type.
+//   - mediaType: The media type of the serialized data, such as "application/yaml".
+//   - encoder: An Encoder function that encodes results of the specified
+//     command result type into serialized data.
+func (e *DefaultEncoderCatalog) InsertFor(resType reflect.Type, mediaType string, encoder Encoder) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.mediaEncoders == nil {
+		e.mediaEncoders = make(map[reflect.Type]map[string]Encoder)
+	}
+	if e.mediaEncoders[resType] == nil {
+		e.mediaEncoders[resType] = make(map[string]Encoder)
+	}
+	e.mediaEncoders[resType][strings.ToLower(mediaType)] = encoder
+}
+
+// InsertEncoderFor is a generic function that catalogs an encoder for a specific command result
+// type serialized in a specific media type.
+//
+// Parameters:
+//   - catalog: The DefaultEncoderCatalog where the encoder will be cataloged.
+//   - mediaType: The media type of the serialized data.
+//   - encoder: An Encoder function that encodes results of the specified command result type.
+func InsertEncoderFor[TRes CommandRes](catalog *DefaultEncoderCatalog, mediaType string, encoder Encoder) {
+	catalog.InsertFor(reflect.TypeFor[TRes](), mediaType, encoder)
+}
+
+// Encode attempts to encode a command result with the encoder cataloged for its type.
+//
+// Parameters:
+//   - res: The command result to encode.
+//
+// Returns:
+//   - A byte slice containing the serialized command result.
+//   - An error wrapping ErrEncoderMissing if no encoder is cataloged for the type of res
+//     and there is no fallback, or an error wrapping ErrEncoderFailure if the encoding fails.
+func (e *DefaultEncoderCatalog) Encode(res CommandRes) (resData []byte, err error) {
+	resType := reflect.TypeOf(res)
+	e.mutex.RLock()
+	encoder, found := e.encoders[resType]
+	if !found {
+		encoder, found = e.fallback, e.fallback != nil
+	}
+	e.mutex.RUnlock()
+	if !found {
+		return nil, fmt.Errorf("%w: res type: %s", ErrEncoderMissing, resType)
+	}
+	if resData, err = encoder(res); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrEncoderFailure, err)
+	}
+	return resData, nil
+}
+
+// EncodeWith attempts to encode a command result with a Codec, implementing CodecEncoderCatalog.
+//
+// An encoder cataloged with InsertFor for the media type of the codec is used first. Otherwise,
+// the result is encoded with Encode, and results in other media types than JSON are converted
+// from its output by the codec, so that they hold the same fields.
+//
+// Parameters:
+//   - res: The command result to encode.
+//   - codec: The Codec the result is serialized with.
+//
+// Returns:
+//   - A byte slice containing the serialized command result.
+//   - An error wrapping ErrEncoderMissing or ErrEncoderFailure if the result cannot be encoded.
+func (e *DefaultEncoderCatalog) EncodeWith(res CommandRes, codec Codec) (resData []byte, err error) {
+	mediaType := strings.ToLower(codec.MediaType())
+	e.mutex.RLock()
+	encoder, found := e.mediaEncoders[reflect.TypeOf(res)][mediaType]
+	e.mutex.RUnlock()
+	switch {
+	case found:
+		resData, err = encoder(res)
+	case mediaType == MediaTypeJSON:
+		return e.Encode(res)
+	default:
+		if resData, err = e.Encode(res); err != nil {
+			return nil, err
+		}
+		resData, err = marshalJSONWith(codec, resData)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrEncoderFailure, err)
+	}
+	return resData, nil
+}
@@ -0,0 +1,159 @@
+package commands
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DefaultEncoder(t *testing.T) {
+	encoder := DefaultEncoder[AddCommandRes]()
+
+	t.Run("valid res", func(t *testing.T) {
+		resData, err := encoder(AddCommandRes{Result: 3})
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"result":3}`, string(resData))
+	})
+
+	t.Run("invalid res type", func(t *testing.T) {
+		resData, err := encoder(SubCommandRes{Result: 3})
+		assert.ErrorIs(t, err, ErrInvalidResType)
+		assert.Nil(t, resData)
+	})
+}
+
+func Test_NewEncoderCatalog(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		catalog := NewDefaultEncoderCatalog()
+		assert.NotNil(t, catalog)
+		assert.Empty(t, catalog.encoders)
+		assert.Nil(t, catalog.fallback)
+	})
+
+	t.Run("with options", func(t *testing.T) {
+		catalog := NewDefaultEncoderCatalog(WithFallbackEncoder(JSONEncoder))
+		assert.NotNil(t, catalog)
+		assert.NotNil(t, catalog.fallback)
+	})
+}
+
+func Test_EncoderCatalog_Insert(t *testing.T) {
+	t.Run("empty catalog", func(t *testing.T) {
+		catalog := DefaultEncoderCatalog{}
+		assert.Nil(t, catalog.encoders)
+		catalog.Insert(reflect.TypeFor[AddCommandRes](), DefaultEncoder[AddCommandRes]())
+		assert.Contains(t, catalog.encoders, reflect.TypeFor[AddCommandRes]())
+	})
+
+	t.Run("constructed catalog", func(t *testing.T) {
+		catalog := NewDefaultEncoderCatalog()
+		catalog.Insert(reflect.TypeFor[AddCommandRes](), DefaultEncoder[AddCommandRes]())
+		assert.Contains(t, catalog.encoders, reflect.TypeFor[AddCommandRes]())
+	})
+}
+
+func Test_InsertEncoder(t *testing.T) {
+	catalog := NewDefaultEncoderCatalog()
+	InsertEncoder[AddCommandRes](catalog, DefaultEncoder[AddCommandRes]())
+	assert.Contains(t, catalog.encoders, reflect.TypeFor[AddCommandRes]())
+}
+
+func Test_EncoderCatalog_Encode(t *testing.T) {
+	errBroken := errors.New("broken")
+	catalog := NewDefaultEncoderCatalog()
+	InsertEncoder[AddCommandRes](catalog, DefaultEncoder[AddCommandRes]())
+	InsertEncoder[SlowCommandRes](catalog, func(res CommandRes) ([]byte, error) {
+		return nil, errBroken
+	})
+
+	t.Run("valid res", func(t *testing.T) {
+		resData, err := catalog.Encode(AddCommandRes{Result: 3})
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"result":3}`, string(resData))
+	})
+
+	t.Run("custom encoder", func(t *testing.T) {
+		custom := NewDefaultEncoderCatalog()
+		InsertEncoder[AddCommandRes](custom, func(res CommandRes) ([]byte, error) {
+			return []byte(`3`), nil
+		})
+		resData, err := custom.Encode(AddCommandRes{Result: 3})
+		assert.NoError(t, err)
+		assert.Equal(t, `3`, string(resData))
+	})
+
+	t.Run("encoder failure", func(t *testing.T) {
+		resData, err := catalog.Encode(SlowCommandRes{})
+		assert.ErrorIs(t, err, ErrEncoderFailure)
+		assert.ErrorIs(t, err, errBroken)
+		assert.Nil(t, resData)
+	})
+
+	t.Run("encoder missing", func(t *testing.T) {
+		resData, err := catalog.Encode(SubCommandRes{Result: 1})
+		assert.ErrorIs(t, err, ErrEncoderMissing)
+		assert.Nil(t, resData)
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		fallback := NewDefaultEncoderCatalog(WithFallbackEncoder(JSONEncoder))
+		resData, err := fallback.Encode(SubCommandRes{Result: 1})
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"result":1}`, string(resData))
+	})
+}
+
+func Test_InsertEncoderFor(t *testing.T) {
+	catalog := NewDefaultEncoderCatalog()
+	InsertEncoderFor[AddCommandRes](catalog, "Text/X-Test", CodecEncoder[AddCommandRes](TextCodec{}))
+	assert.Contains(t, catalog.mediaEncoders[reflect.TypeFor[AddCommandRes]()], MediaTypeText)
+}
+
+func Test_EncoderCatalog_EncodeWith(t *testing.T) {
+	errBroken := errors.New("broken")
+	catalog := NewDefaultEncoderCatalog()
+	InsertEncoder[AddCommandRes](catalog, DefaultEncoder[AddCommandRes]())
+	InsertEncoderFor[SubCommandRes](catalog, MediaTypeText, func(res CommandRes) ([]byte, error) {
+		return []byte(`text:sub`), nil
+	})
+	InsertEncoderFor[SlowCommandRes](catalog, MediaTypeText, func(res CommandRes) ([]byte, error) {
+		return nil, errBroken
+	})
+
+	t.Run("json", func(t *testing.T) {
+		resData, err := catalog.EncodeWith(AddCommandRes{Result: 3}, JSONCodec{})
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"result":3}`, string(resData))
+	})
+
+	t.Run("json encoder missing", func(t *testing.T) {
+		resData, err := catalog.EncodeWith(SubCommandRes{Result: 3}, JSONCodec{})
+		assert.ErrorIs(t, err, ErrEncoderMissing)
+		assert.Nil(t, resData)
+	})
+
+	t.Run("codec", func(t *testing.T) {
+		resData, err := catalog.EncodeWith(AddCommandRes{Result: 3}, TextCodec{})
+		assert.NoError(t, err)
+		assert.Equal(t, `text:{"result":3}`, string(resData))
+	})
+
+	t.Run("media encoder", func(t *testing.T) {
+		resData, err := catalog.EncodeWith(SubCommandRes{Result: 3}, TextCodec{})
+		assert.NoError(t, err)
+		assert.Equal(t, `text:sub`, string(resData))
+	})
+
+	t.Run("encoder failure", func(t *testing.T) {
+		resData, err := catalog.EncodeWith(SlowCommandRes{}, TextCodec{})
+		assert.ErrorIs(t, err, ErrEncoderFailure)
+		assert.ErrorIs(t, err, errBroken)
+		assert.Nil(t, resData)
+
+		resData, err = catalog.EncodeWith(func() {}, TextCodec{})
+		assert.ErrorIs(t, err, ErrEncoderMissing)
+		assert.Nil(t, resData)
+	})
+}
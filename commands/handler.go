@@ -6,6 +6,7 @@
 	"fmt"
 	"reflect"
 	"sync"
+	"time"
 
 	"github.com/dan-lugg/go-commands/futures"
 	"github.com/dan-lugg/go-commands/util"
@@ -61,12 +62,14 @@ type HandlerAdapter interface {
 //   - TRes: The type of the command response, which must implement the CommandRes interface.
 //
 // Fields:
-//   - handler: An instance of the Handler that processes the command request.
+//   - handler: An instance of the Handler that processes the command request, cached for singletons.
 //   - handlerFactory: A factory function that creates a new instance of the Handler.
+//   - options: The HandlerOptions the handler was registered with.
 type DefaultHandlerAdapter[TReq CommandReq[TRes], TRes CommandRes] struct {
 	mutex          sync.RWMutex
 	handler        Handler[TReq, TRes]
 	handlerFactory HandlerFactory[TReq, TRes]
+	options        HandlerOptions
 }
 
 // NewDefaultHandlerAdapter creates a new instance of DefaultHandlerAdapter.
@@ -77,19 +80,31 @@ type DefaultHandlerAdapter[TReq CommandReq[TRes], TRes CommandRes] struct {
 //
 // Parameters:
 //   - factory: A function that creates a new instance of a Handler for the specified request and response types.
+//   - options: Options applied to the HandlerOptions of the adapter, such as WithLifetime.
 //
 // Returns:
 //   - A pointer to a DefaultHandlerAdapter instance, initialized with the provided factory function.
-func NewDefaultHandlerAdapter[TReq CommandReq[TRes], TRes CommandRes](factory func() Handler[TReq, TRes]) *DefaultHandlerAdapter[TReq, TRes] {
-	return &DefaultHandlerAdapter[TReq, TRes]{
+func NewDefaultHandlerAdapter[TReq CommandReq[TRes], TRes CommandRes](factory func() Handler[TReq, TRes], options ...HandlerOption) *DefaultHandlerAdapter[TReq, TRes] {
+	adapter := &DefaultHandlerAdapter[TReq, TRes]{
 		mutex:          sync.RWMutex{},
 		handler:        nil,
 		handlerFactory: factory,
+		options: HandlerOptions{
+			Lifetime: LifetimeSingleton,
+		},
 	}
+	for _, option := range options {
+		option(&adapter.options)
+	}
+	return adapter
 }
 
 // Handle processes the given request (req) within the provided context (ctx).
 //
+// The Handler is obtained according to the Lifetime of the adapter: singletons are
+// created once and cached, transients are created for this call and disposed after it,
+// and scoped handlers are created once per Scope carried in ctx.
+//
 // Type Parameters:
 //   - TReq: The type of the command request, which must implement the CommandReq interface.
 //   - TRes: The type of the command response, which must implement the CommandRes interface.
@@ -106,23 +121,66 @@ func (a *DefaultHandlerAdapter[TReq, TRes]) Handle(ctx context.Context, req Comm
 	if !ok {
 		return nil, fmt.Errorf("req type %T does not match %T", req, typedReq)
 	}
+	var handler Handler[TReq, TRes]
+	switch a.options.Lifetime {
+	case LifetimeTransient:
+		handler = a.handlerFactory()
+		if disposer, ok := handler.(Disposer); ok {
+			defer func() {
+				if disposeErr := disposer.Dispose(); disposeErr != nil {
+					err = errors.Join(err, disposeErr)
+				}
+			}()
+		}
+	case LifetimeScoped:
+		scope, found := ScopeFromContext(ctx)
+		if !found {
+			return nil, fmt.Errorf("%w for scoped req type: %s", ErrScopeMissing, a.ReqType())
+		}
+		instance, scopeErr := scope.instance(a, func() any { return a.handlerFactory() })
+		if scopeErr != nil {
+			return nil, fmt.Errorf("%w for scoped req type: %s", scopeErr, a.ReqType())
+		}
+		handler, _ = instance.(Handler[TReq, TRes])
+	default:
+		handler = a.singleton()
+	}
+	if handler == nil {
+		return nil, fmt.Errorf("%w for req type: %s", ErrHandlerMissing, a.ReqType())
+	}
+	return handler.Handle(ctx, typedReq)
+}
+
+// singleton returns the cached Handler, creating it on first use.
+func (a *DefaultHandlerAdapter[TReq, TRes]) singleton() Handler[TReq, TRes] {
 	a.mutex.RLock()
 	handler := a.handler
 	a.mutex.RUnlock()
 	if handler == nil {
-		func() {
-			a.mutex.Lock()
-			defer a.mutex.Unlock()
-			if a.handler == nil {
-				a.handler = a.handlerFactory()
-			}
-		}()
+		a.mutex.Lock()
+		defer a.mutex.Unlock()
+		if a.handler == nil {
+			a.handler = a.handlerFactory()
+		}
 		handler = a.handler
 	}
-	if handler == nil {
-		return nil, fmt.Errorf("%w for req type: %s", ErrHandlerMissing, a.ReqType())
-	}
-	return handler.Handle(ctx, typedReq)
+	return handler
+}
+
+// Lifetime returns the Lifetime of the handlers created by the adapter.
+//
+// Returns:
+//   - The Lifetime the adapter was created with.
+func (a *DefaultHandlerAdapter[TReq, TRes]) Lifetime() Lifetime {
+	return a.options.Lifetime
+}
+
+// Timeout returns the timeout of a single call to the handler.
+//
+// Returns:
+//   - The timeout the adapter was created with, or 0 if none was set.
+func (a *DefaultHandlerAdapter[TReq, TRes]) Timeout() time.Duration {
+	return a.options.Timeout
 }
 
 // ReqType returns the reflect.Type of the request handled by the adapter.
@@ -160,9 +218,21 @@ type HandlerCatalog interface {
 // Fields:
 //   - adapters: A map that associates reflect.Type with HandlerAdapter instances,
 //     enabling the handling of specific request types.
+//   - interceptors: A slice of Interceptor instances wrapping the dispatch of every request type.
+//   - typeInterceptors: A map that associates reflect.Type with Interceptor instances
+//     wrapping the dispatch of that request type only.
+//   - mappingCatalog: An optional MappingCatalog used to resolve request names for interceptors.
+//   - defaultTimeout: The timeout applied to request types whose adapter sets none.
+//   - streamAdapters: A map that associates reflect.Type with StreamAdapter instances,
+//     enabling the streaming of specific request types.
 type DefaultHandlerCatalog struct {
-	mutex    sync.RWMutex
-	adapters map[reflect.Type]HandlerAdapter
+	mutex            sync.RWMutex
+	adapters         map[reflect.Type]HandlerAdapter
+	streamAdapters   map[reflect.Type]StreamAdapter
+	interceptors     []Interceptor
+	typeInterceptors map[reflect.Type][]Interceptor
+	mappingCatalog   MappingCatalog
+	defaultTimeout   time.Duration
 }
 
 type NewDefaultHandlerCatalogOption = util.Option[*DefaultHandlerCatalog]
@@ -176,8 +246,13 @@ type DefaultHandlerCatalog struct {
 //   - A pointer to a DefaultHandlerCatalog instance.
 func NewDefaultHandlerCatalog(options ...NewDefaultHandlerCatalogOption) *DefaultHandlerCatalog {
 	catalog := &DefaultHandlerCatalog{
-		mutex:    sync.RWMutex{},
-		adapters: make(map[reflect.Type]HandlerAdapter),
+		mutex:            sync.RWMutex{},
+		adapters:         make(map[reflect.Type]HandlerAdapter),
+		streamAdapters:   make(map[reflect.Type]StreamAdapter),
+		interceptors:     nil,
+		typeInterceptors: make(map[reflect.Type][]Interceptor),
+		mappingCatalog:   nil,
+		defaultTimeout:   0,
 	}
 	for _, option := range options {
 		option(catalog)
@@ -198,8 +273,68 @@ func (r *DefaultHandlerCatalog) Insert(adapter HandlerAdapter) {
 	r.adapters[adapter.ReqType()] = adapter
 }
 
+// Use registers global interceptors on the DefaultHandlerCatalog.
+//
+// Global interceptors wrap the dispatch of every request type and run outside
+// of any interceptors registered for a specific request type with UseFor.
+//
+// Parameters:
+//   - interceptors: The interceptors to register, outermost first.
+func (r *DefaultHandlerCatalog) Use(interceptors ...Interceptor) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.interceptors = append(r.interceptors, interceptors...)
+}
+
+// UseFor registers interceptors for a specific request type on the DefaultHandlerCatalog.
+//
+// Parameters:
+//   - reqType: The reflect.Type of the request whose dispatch the interceptors wrap.
+//   - interceptors: The interceptors to register, outermost first.
+func (r *DefaultHandlerCatalog) UseFor(reqType reflect.Type, interceptors ...Interceptor) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.typeInterceptors == nil {
+		r.typeInterceptors = make(map[reflect.Type][]Interceptor)
+	}
+	r.typeInterceptors[reqType] = append(r.typeInterceptors[reqType], interceptors...)
+}
+
+// Timeout returns the timeout applied to a single call to the handler of a request type.
+//
+// Parameters:
+//   - reqType: The reflect.Type of the request.
+//
+// Returns:
+//   - The timeout of the cataloged adapter if it sets one, otherwise the default timeout
+//     of the catalog, or 0 if no timeout applies. For a streaming request type, the timeout
+//     of its StreamAdapter, as the default timeout does not apply to streams.
+func (r *DefaultHandlerCatalog) Timeout(reqType reflect.Type) time.Duration {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if adapter, found := r.streamAdapters[reqType]; found {
+		if timeoutAdapter, ok := adapter.(interface{ Timeout() time.Duration }); ok {
+			return timeoutAdapter.Timeout()
+		}
+		return 0
+	}
+	return r.timeout(r.adapters[reqType])
+}
+
+func (r *DefaultHandlerCatalog) timeout(adapter HandlerAdapter) time.Duration {
+	if timeoutAdapter, ok := adapter.(interface{ Timeout() time.Duration }); ok && timeoutAdapter.Timeout() > 0 {
+		return timeoutAdapter.Timeout()
+	}
+	return r.defaultTimeout
+}
+
 // Handle processes a command request using the cataloged handler.
 //
+// The request is passed through the global interceptors, then the interceptors
+// registered for its type, and finally to the cataloged HandlerAdapter. If a timeout
+// applies to the request type, or is set with ContextWithTimeout, the adapter runs
+// with a child context expiring after it.
+//
 // Parameters:
 //   - req: A CommandReq[CommandRes] representing the command request to be processed.
 //   - ctx: A context.Context providing context for the request processing.
@@ -208,14 +343,26 @@ func (r *DefaultHandlerCatalog) Insert(adapter HandlerAdapter) {
 //   - res: A CommandRes representing the result of the command processing.
 //   - err: An error if no handler is cataloged for the request type or if the handler fails.
 func (r *DefaultHandlerCatalog) Handle(ctx context.Context, req CommandReq[CommandRes]) (res CommandRes, err error) {
-	r.mutex.RLock()
-	defer r.mutex.RUnlock()
 	reqType := reflect.TypeOf(req)
+	r.mutex.RLock()
 	adapter, found := r.adapters[reqType]
+	interceptors := make([]Interceptor, 0, len(r.interceptors)+len(r.typeInterceptors[reqType]))
+	interceptors = append(interceptors, r.interceptors...)
+	interceptors = append(interceptors, r.typeInterceptors[reqType]...)
+	mappingCatalog := r.mappingCatalog
+	timeout := r.timeout(adapter)
+	r.mutex.RUnlock()
 	if !found {
 		return nil, fmt.Errorf("%w for req type: %s", ErrHandlerMissing, reqType)
 	}
-	return adapter.Handle(ctx, req)
+	info := InterceptorInfo{
+		ReqType: reqType,
+		ResType: adapter.ResType(),
+	}
+	if mappingCatalog != nil {
+		info.ReqName, _ = mappingCatalog.ByType(reqType)
+	}
+	return chainInvoker(info, interceptors, timeoutInvoker(reqType, timeout, adapter.Handle))(ctx, req)
 }
 
 // Handle processes a command request using the cataloged handler.
@@ -226,15 +373,15 @@ func (r *DefaultHandlerCatalog) Handle(ctx context.Context, req CommandReq[Comma
 //
 // Parameters:
 //   - ctx: A context.Context providing context for the request processing.
-//   - catalog: A pointer to the DefaultHandlerCatalog containing the cataloged handlers.
+//   - catalog: The HandlerCatalog containing the cataloged handlers.
 //   - req: A TReq representing the command request to be processed.
 //
 // Returns:
 //   - res: A TRes representing the result of the command processing.
 //   - err: An error if the request type does not match the expected type or if the handler fails.
-func Handle[TReq CommandReq[TRes], TRes CommandRes](ctx context.Context, catalog *DefaultHandlerCatalog, req TReq) (typedRes TRes, err error) {
+func Handle[TReq CommandReq[TRes], TRes CommandRes](ctx context.Context, catalog HandlerCatalog, req TReq) (typedRes TRes, err error) {
 	res, err := catalog.Handle(ctx, req)
-	if errors.Is(err, ErrHandlerMissing) {
+	if err != nil {
 		return *new(TRes), err
 	}
 	var ok bool
@@ -246,6 +393,9 @@ func Handle[TReq CommandReq[TRes], TRes CommandRes](ctx context.Context, catalog
 
 // Future creates a futures.Future that asynchronously processes a command request.
 //
+// The returned future implements ProgressFuture. The command reports to the ProgressReporter
+// carried by ctx, if any, or otherwise to a new one.
+//
 // Parameters:
 //   - ctx: A context.Context providing context for the request processing.
 //   - req: A CommandReq[CommandRes] representing the command request to be processed.
@@ -255,13 +405,21 @@ func Handle[TReq CommandReq[TRes], TRes CommandRes](ctx context.Context, catalog
 //   - Val1 is the CommandRes representing the result of the command processing.
 //   - Val2 is an error if the processing fails.
 func (r *DefaultHandlerCatalog) Future(ctx context.Context, req CommandReq[CommandRes]) futures.Future[util.Tuple2[CommandRes, error]] {
-	return futures.Start(ctx, func(ctx context.Context) util.Tuple2[CommandRes, error] {
-		res, err := r.Handle(ctx, req)
-		return util.Tuple2[CommandRes, error]{
-			Val1: res,
-			Val2: err,
-		}
-	})
+	progress := ProgressFromContext(ctx)
+	if progress == nil {
+		progress = NewProgressReporter()
+		ctx = ContextWithProgress(ctx, progress)
+	}
+	return &progressFuture{
+		Future: futures.Start(ctx, func(ctx context.Context) util.Tuple2[CommandRes, error] {
+			res, err := r.Handle(ctx, req)
+			return util.Tuple2[CommandRes, error]{
+				Val1: res,
+				Val2: err,
+			}
+		}),
+		progress: progress,
+	}
 }
 
 // Future creates a futures.Future that asynchronously processes a command request.
@@ -272,14 +430,14 @@ func (r *DefaultHandlerCatalog) Future(ctx context.Context, req CommandReq[Comma
 //
 // Parameters:
 //   - ctx: A context.Context providing context for the request processing.
-//   - catalog: A pointer to the DefaultHandlerCatalog containing the cataloged handlers.
+//   - catalog: The HandlerCatalog containing the cataloged handlers.
 //   - req: A TReq representing the command request to be processed.
 //
 // Returns:
 //   - A futures.Future containing a util.Tuple2 where:
 //   - Val1 is the TRes representing the result of the command processing.
 //   - Val2 is an error if the processing fails.
-func Future[TReq CommandReq[TRes], TRes CommandRes](ctx context.Context, catalog *DefaultHandlerCatalog, req TReq) futures.Future[util.Tuple2[TRes, error]] {
+func Future[TReq CommandReq[TRes], TRes CommandRes](ctx context.Context, catalog HandlerCatalog, req TReq) futures.Future[util.Tuple2[TRes, error]] {
 	return futures.Start(ctx, func(ctx context.Context) util.Tuple2[TRes, error] {
 		tup := catalog.Future(ctx, req).Wait()
 		res, err := tup.Val1, tup.Val2
@@ -298,7 +456,7 @@ func Future[TReq CommandReq[TRes], TRes CommandRes](ctx context.Context, catalog
 		}
 		return util.Tuple2[TRes, error]{
 			Val1: typedRes,
-			Val2: err,
+			Val2: nil,
 		}
 	})
 }
@@ -312,8 +470,9 @@ func Future[TReq CommandReq[TRes], TRes CommandRes](ctx context.Context, catalog
 // Parameters:
 //   - catalog: A pointer to the DefaultHandlerCatalog where the handler will be cataloged.
 //   - factory: A HandlerFactory function that creates a new instance of a Handler for the specified request and response types.
-func InsertHandler[TReq CommandReq[TRes], TRes CommandRes](catalog *DefaultHandlerCatalog, factory HandlerFactory[TReq, TRes]) {
-	catalog.Insert(NewDefaultHandlerAdapter(factory))
+//   - options: Options applied to the registration, such as WithLifetime.
+func InsertHandler[TReq CommandReq[TRes], TRes CommandRes](catalog *DefaultHandlerCatalog, factory HandlerFactory[TReq, TRes], options ...HandlerOption) {
+	catalog.Insert(NewDefaultHandlerAdapter(factory, options...))
 }
 
 // TypeMap returns a mapping of request types to their corresponding response types.
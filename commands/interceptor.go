@@ -0,0 +1,106 @@
+package commands
+
+import (
+	"context"
+	"reflect"
+)
+
+// InterceptorInfo describes the dispatch that an Interceptor is wrapping.
+//
+// Fields:
+//   - ReqType: The reflect.Type of the command request being dispatched.
+//   - ResType: The reflect.Type of the command response produced by the cataloged handler.
+//   - ReqName: The name mapped to ReqType, or an empty string if the catalog has no
+//     MappingCatalog or the type is not mapped.
+//   - Stream: Whether the dispatch is a stream, whose items are delivered as it runs. The
+//     Invoker of a stream returns a nil result once the stream completes, and ResType is
+//     the type of its items.
+type InterceptorInfo struct {
+	ReqType reflect.Type
+	ResType reflect.Type
+	ReqName string
+	Stream  bool
+}
+
+// Invoker is a function type that continues a dispatch, either by calling the
+// next Interceptor in the chain or, at the end of the chain, the HandlerAdapter.
+type Invoker func(ctx context.Context, req CommandReq[CommandRes]) (res CommandRes, err error)
+
+// Interceptor is a function type that wraps the dispatch of a command request.
+//
+// An Interceptor may inspect or replace the context and request before calling next,
+// short-circuit the dispatch by returning without calling next, and inspect, replace
+// or wrap the result and error returned by next.
+//
+// Parameters:
+//   - ctx: A context.Context providing context for the request processing.
+//   - info: An InterceptorInfo describing the dispatch.
+//   - req: A CommandReq[CommandRes] representing the command request to be processed.
+//   - next: An Invoker that continues the dispatch.
+//
+// Returns:
+//   - res: A CommandRes representing the result of the command processing.
+//   - err: An error if the interceptor or the remainder of the chain fails.
+type Interceptor func(ctx context.Context, info InterceptorInfo, req CommandReq[CommandRes], next Invoker) (res CommandRes, err error)
+
+// ChainInterceptors combines multiple interceptors into a single Interceptor.
+//
+// The interceptors are applied in the order provided, so the first interceptor
+// is the outermost and sees the request first and the result last.
+//
+// Parameters:
+//   - interceptors: The interceptors to combine.
+//
+// Returns:
+//   - An Interceptor that runs all provided interceptors around next.
+func ChainInterceptors(interceptors ...Interceptor) Interceptor {
+	return func(ctx context.Context, info InterceptorInfo, req CommandReq[CommandRes], next Invoker) (res CommandRes, err error) {
+		return chainInvoker(info, interceptors, next)(ctx, req)
+	}
+}
+
+// chainInvoker builds an Invoker that runs the given interceptors, in order, around final.
+func chainInvoker(info InterceptorInfo, interceptors []Interceptor, final Invoker) Invoker {
+	next := final
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, inner := interceptors[i], next
+		next = func(ctx context.Context, req CommandReq[CommandRes]) (res CommandRes, err error) {
+			return interceptor(ctx, info, req, inner)
+		}
+	}
+	return next
+}
+
+// WithInterceptors returns an option that registers global interceptors on a
+// DefaultHandlerCatalog, wrapping the dispatch of every request type.
+//
+// Parameters:
+//   - interceptors: The interceptors to register, outermost first.
+func WithInterceptors(interceptors ...Interceptor) NewDefaultHandlerCatalogOption {
+	return func(catalog *DefaultHandlerCatalog) {
+		catalog.Use(interceptors...)
+	}
+}
+
+// WithMappingCatalog returns an option that sets the MappingCatalog used by a
+// DefaultHandlerCatalog to resolve the InterceptorInfo.ReqName passed to interceptors.
+//
+// Parameters:
+//   - mappingCatalog: The MappingCatalog used to resolve request names.
+func WithMappingCatalog(mappingCatalog MappingCatalog) NewDefaultHandlerCatalogOption {
+	return func(catalog *DefaultHandlerCatalog) {
+		catalog.mappingCatalog = mappingCatalog
+	}
+}
+
+// InsertInterceptor is a generic function that registers interceptors for a specific command request type.
+//
+// Type Parameters:
+//   - TReq: The type of the command request, which must implement the CommandReq interface.
+//
+// Parameters:
+//   - catalog: A pointer to the DefaultHandlerCatalog where the interceptors will be registered.
+//   - interceptors: The interceptors to register, outermost first.
+func InsertInterceptor[TReq CommandReq[CommandRes]](catalog *DefaultHandlerCatalog, interceptors ...Interceptor) {
+	catalog.UseFor(reflect.TypeFor[TReq](), interceptors...)
+}
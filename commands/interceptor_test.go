@@ -0,0 +1,119 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func recordingInterceptor(label string, calls *[]string) Interceptor {
+	return func(ctx context.Context, info InterceptorInfo, req CommandReq[CommandRes], next Invoker) (res CommandRes, err error) {
+		*calls = append(*calls, label+":before")
+		res, err = next(ctx, req)
+		*calls = append(*calls, label+":after")
+		return res, err
+	}
+}
+
+func Test_ChainInterceptors(t *testing.T) {
+	calls := []string{}
+	chained := ChainInterceptors(recordingInterceptor("a", &calls), recordingInterceptor("b", &calls))
+	res, err := chained(nil, InterceptorInfo{}, AddCommandReq{ArgX: 3, ArgY: 4}, func(ctx context.Context, req CommandReq[CommandRes]) (CommandRes, error) {
+		calls = append(calls, "handler")
+		return AddCommandRes{Result: 7}, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, AddCommandRes{Result: 7}, res)
+	assert.Equal(t, []string{"a:before", "b:before", "handler", "b:after", "a:after"}, calls)
+}
+
+func Test_HandlerCatalog_Use(t *testing.T) {
+	t.Run("order", func(t *testing.T) {
+		calls := []string{}
+		catalog := NewDefaultHandlerCatalog(WithInterceptors(recordingInterceptor("global", &calls)))
+		InsertHandler[AddCommandReq, AddCommandRes](catalog, func() Handler[AddCommandReq, AddCommandRes] {
+			return &AddHandler{}
+		})
+		InsertInterceptor[AddCommandReq](catalog, recordingInterceptor("typed", &calls))
+		res, err := Handle[AddCommandReq, AddCommandRes](nil, catalog, AddCommandReq{ArgX: 3, ArgY: 4})
+		assert.NoError(t, err)
+		assert.Equal(t, AddCommandRes{Result: 7}, res)
+		assert.Equal(t, []string{"global:before", "typed:before", "typed:after", "global:after"}, calls)
+	})
+
+	t.Run("typed only", func(t *testing.T) {
+		calls := []string{}
+		catalog := NewDefaultHandlerCatalog()
+		InsertHandler[AddCommandReq, AddCommandRes](catalog, func() Handler[AddCommandReq, AddCommandRes] {
+			return &AddHandler{}
+		})
+		InsertHandler[SubCommandReq, SubCommandRes](catalog, func() Handler[SubCommandReq, SubCommandRes] {
+			return &SubHandler{}
+		})
+		InsertInterceptor[AddCommandReq](catalog, recordingInterceptor("typed", &calls))
+		_, err := Handle[SubCommandReq, SubCommandRes](nil, catalog, SubCommandReq{ArgX: 3, ArgY: 4})
+		assert.NoError(t, err)
+		assert.Empty(t, calls)
+	})
+
+	t.Run("info", func(t *testing.T) {
+		mappingCatalog := NewMappingCatalog()
+		InsertMapping[AddCommandReq](mappingCatalog, AddReqName)
+		var seen InterceptorInfo
+		catalog := NewDefaultHandlerCatalog(
+			WithMappingCatalog(mappingCatalog),
+			WithInterceptors(func(ctx context.Context, info InterceptorInfo, req CommandReq[CommandRes], next Invoker) (CommandRes, error) {
+				seen = info
+				return next(ctx, req)
+			}),
+		)
+		InsertHandler[AddCommandReq, AddCommandRes](catalog, func() Handler[AddCommandReq, AddCommandRes] {
+			return &AddHandler{}
+		})
+		_, err := Handle[AddCommandReq, AddCommandRes](nil, catalog, AddCommandReq{})
+		assert.NoError(t, err)
+		assert.Equal(t, reflect.TypeFor[AddCommandReq](), seen.ReqType)
+		assert.Equal(t, reflect.TypeFor[AddCommandRes](), seen.ResType)
+		assert.Equal(t, AddReqName, seen.ReqName)
+	})
+
+	t.Run("short circuit", func(t *testing.T) {
+		catalog := NewDefaultHandlerCatalog(WithInterceptors(func(ctx context.Context, info InterceptorInfo, req CommandReq[CommandRes], next Invoker) (CommandRes, error) {
+			return AddCommandRes{Result: 42}, nil
+		}))
+		InsertHandler[AddCommandReq, AddCommandRes](catalog, func() Handler[AddCommandReq, AddCommandRes] {
+			return &AddHandler{}
+		})
+		res, err := Handle[AddCommandReq, AddCommandRes](nil, catalog, AddCommandReq{ArgX: 3, ArgY: 4})
+		assert.NoError(t, err)
+		assert.Equal(t, AddCommandRes{Result: 42}, res)
+	})
+
+	t.Run("wrap error", func(t *testing.T) {
+		errDenied := errors.New("denied")
+		catalog := NewDefaultHandlerCatalog(WithInterceptors(func(ctx context.Context, info InterceptorInfo, req CommandReq[CommandRes], next Invoker) (CommandRes, error) {
+			return nil, errDenied
+		}))
+		InsertHandler[AddCommandReq, AddCommandRes](catalog, func() Handler[AddCommandReq, AddCommandRes] {
+			return &AddHandler{}
+		})
+		res, err := Handle[AddCommandReq, AddCommandRes](nil, catalog, AddCommandReq{ArgX: 3, ArgY: 4})
+		assert.ErrorIs(t, err, errDenied)
+		assert.Zero(t, res)
+	})
+
+	t.Run("future", func(t *testing.T) {
+		calls := []string{}
+		catalog := NewDefaultHandlerCatalog(WithInterceptors(recordingInterceptor("global", &calls)))
+		InsertHandler[AddCommandReq, AddCommandRes](catalog, func() Handler[AddCommandReq, AddCommandRes] {
+			return &AddHandler{}
+		})
+		tup := Future[AddCommandReq, AddCommandRes](nil, catalog, AddCommandReq{ArgX: 3, ArgY: 4}).Wait()
+		assert.NoError(t, tup.Val2)
+		assert.Equal(t, AddCommandRes{Result: 7}, tup.Val1)
+		assert.Equal(t, []string{"global:before", "global:after"}, calls)
+	})
+}
@@ -0,0 +1,200 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/dan-lugg/go-commands/util"
+)
+
+var (
+	ErrScopeMissing = errors.New("scope missing")
+	ErrScopeClosed  = errors.New("scope closed")
+)
+
+// Lifetime determines how often a DefaultHandlerAdapter calls its HandlerFactory.
+type Lifetime int
+
+const (
+	// LifetimeSingleton creates a single handler on first use and reuses it for every call.
+	LifetimeSingleton Lifetime = iota
+	// LifetimeTransient creates a new handler for every call.
+	LifetimeTransient
+	// LifetimeScoped creates one handler per Scope carried in the context.Context.
+	LifetimeScoped
+)
+
+// String returns the name of the Lifetime.
+func (l Lifetime) String() string {
+	switch l {
+	case LifetimeSingleton:
+		return "singleton"
+	case LifetimeTransient:
+		return "transient"
+	case LifetimeScoped:
+		return "scoped"
+	default:
+		return "unknown"
+	}
+}
+
+// Disposer is an optional interface for handlers that hold resources.
+//
+// Transient handlers are disposed after the call they were created for, and scoped
+// handlers are disposed when their Scope is closed.
+type Disposer interface {
+	Dispose() error
+}
+
+// HandlerOptions holds the settings a handler is registered with.
+//
+// Fields:
+//   - Lifetime: The Lifetime of the handlers created by the HandlerFactory.
+//   - Timeout: The maximum duration of a single call to the handler, or 0 to use the catalog default.
+type HandlerOptions struct {
+	Lifetime Lifetime
+	Timeout  time.Duration
+}
+
+type HandlerOption = util.Option[*HandlerOptions]
+
+// WithLifetime returns an option that sets the Lifetime of a registered handler.
+//
+// Parameters:
+//   - lifetime: The Lifetime of the handlers created by the HandlerFactory.
+func WithLifetime(lifetime Lifetime) HandlerOption {
+	return func(options *HandlerOptions) {
+		options.Lifetime = lifetime
+	}
+}
+
+// Scope holds the scoped handlers created while it is carried in a context.Context,
+// along with the disposal hooks to run when it ends.
+//
+// Fields:
+//   - instances: A map that associates adapters with the handlers created for this scope.
+//   - disposers: The disposal hooks registered on this scope, in registration order.
+//   - closed: Whether Close has been called.
+type Scope struct {
+	mutex     sync.Mutex
+	instances map[any]any
+	disposers []func() error
+	closed    bool
+}
+
+type scopeKey struct{}
+
+// NewScope creates a new Scope and returns a context.Context carrying it.
+//
+// Parameters:
+//   - ctx: The parent context.Context.
+//
+// Returns:
+//   - A context.Context carrying the new Scope.
+//   - A pointer to the Scope, which must be closed when it ends.
+func NewScope(ctx context.Context) (context.Context, *Scope) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	scope := &Scope{
+		mutex:     sync.Mutex{},
+		instances: make(map[any]any),
+		disposers: nil,
+		closed:    false,
+	}
+	return context.WithValue(ctx, scopeKey{}, scope), scope
+}
+
+// ScopeFromContext returns the Scope carried by a context.Context.
+//
+// Parameters:
+//   - ctx: The context.Context to inspect.
+//
+// Returns:
+//   - scope: The Scope carried by ctx, or nil.
+//   - ok: Whether ctx carries a Scope.
+func ScopeFromContext(ctx context.Context) (scope *Scope, ok bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	scope, ok = ctx.Value(scopeKey{}).(*Scope)
+	return scope, ok
+}
+
+// OnDispose registers a hook to run when the Scope is closed. Hooks run in the
+// reverse order of their registration.
+//
+// Parameters:
+//   - disposer: The hook to run.
+func (s *Scope) OnDispose(disposer func() error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.disposers = append(s.disposers, disposer)
+}
+
+// Close ends the Scope, running its disposal hooks in the reverse order of their
+// registration. Closing a Scope more than once has no effect.
+//
+// Returns:
+//   - An error joining the errors returned by the disposal hooks, if any.
+func (s *Scope) Close() error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.closed = true
+	disposers := s.disposers
+	s.disposers = nil
+	s.instances = nil
+	s.mutex.Unlock()
+
+	errs := make([]error, 0, len(disposers))
+	for i := len(disposers) - 1; i >= 0; i-- {
+		errs = append(errs, disposers[i]())
+	}
+	return errors.Join(errs...)
+}
+
+// instance returns the value held by the Scope for key, creating it with create on first use.
+//
+// create runs without holding the mutex, so that it may use the Scope, for example to register
+// a disposal hook or to resolve another scoped handler. If another value was stored for key in
+// the meantime, or the Scope was closed, the created value is disposed and discarded.
+func (s *Scope) instance(key any, create func() any) (value any, err error) {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return nil, ErrScopeClosed
+	}
+	if value, found := s.instances[key]; found {
+		s.mutex.Unlock()
+		return value, nil
+	}
+	s.mutex.Unlock()
+
+	created := create()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	disposer, isDisposer := created.(Disposer)
+	if s.closed {
+		if isDisposer {
+			_ = disposer.Dispose()
+		}
+		return nil, ErrScopeClosed
+	}
+	if value, found := s.instances[key]; found {
+		if isDisposer {
+			_ = disposer.Dispose()
+		}
+		return value, nil
+	}
+	s.instances[key] = created
+	if isDisposer {
+		s.disposers = append(s.disposers, disposer.Dispose)
+	}
+	return created, nil
+}
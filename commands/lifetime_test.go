@@ -0,0 +1,196 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type CountCommandRes struct {
+	Instance int64
+	Calls    int64
+}
+
+type CountCommandReq struct{}
+
+type CountHandler struct {
+	Handler[CountCommandReq, CountCommandRes]
+	instance int64
+	calls    int64
+	disposed *atomic.Int64
+}
+
+func (h *CountHandler) Handle(ctx context.Context, req CountCommandReq) (res CountCommandRes, err error) {
+	h.calls++
+	return CountCommandRes{Instance: h.instance, Calls: h.calls}, nil
+}
+
+func (h *CountHandler) Dispose() error {
+	h.disposed.Add(1)
+	return nil
+}
+
+func newCountCatalog(lifetime Lifetime) (*DefaultHandlerCatalog, *atomic.Int64, *atomic.Int64) {
+	created, disposed := &atomic.Int64{}, &atomic.Int64{}
+	catalog := NewDefaultHandlerCatalog()
+	InsertHandler[CountCommandReq, CountCommandRes](catalog, func() Handler[CountCommandReq, CountCommandRes] {
+		return &CountHandler{instance: created.Add(1), disposed: disposed}
+	}, WithLifetime(lifetime))
+	return catalog, created, disposed
+}
+
+func Test_Lifetime_String(t *testing.T) {
+	assert.Equal(t, "singleton", LifetimeSingleton.String())
+	assert.Equal(t, "transient", LifetimeTransient.String())
+	assert.Equal(t, "scoped", LifetimeScoped.String())
+	assert.Equal(t, "unknown", Lifetime(-1).String())
+}
+
+func Test_DefaultHandlerAdapter_Lifetime(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		adapter := NewDefaultHandlerAdapter(func() Handler[AddCommandReq, AddCommandRes] {
+			return &AddHandler{}
+		})
+		assert.Equal(t, LifetimeSingleton, adapter.Lifetime())
+	})
+
+	t.Run("with lifetime", func(t *testing.T) {
+		adapter := NewDefaultHandlerAdapter(func() Handler[AddCommandReq, AddCommandRes] {
+			return &AddHandler{}
+		}, WithLifetime(LifetimeTransient))
+		assert.Equal(t, LifetimeTransient, adapter.Lifetime())
+	})
+}
+
+func Test_HandlerCatalog_Handle_Lifetime(t *testing.T) {
+	t.Run("singleton", func(t *testing.T) {
+		catalog, created, disposed := newCountCatalog(LifetimeSingleton)
+		for i := int64(1); i <= 3; i++ {
+			res, err := Handle[CountCommandReq, CountCommandRes](nil, catalog, CountCommandReq{})
+			assert.NoError(t, err)
+			assert.Equal(t, CountCommandRes{Instance: 1, Calls: i}, res)
+		}
+		assert.Equal(t, int64(1), created.Load())
+		assert.Equal(t, int64(0), disposed.Load())
+	})
+
+	t.Run("transient", func(t *testing.T) {
+		catalog, created, disposed := newCountCatalog(LifetimeTransient)
+		for i := int64(1); i <= 3; i++ {
+			res, err := Handle[CountCommandReq, CountCommandRes](nil, catalog, CountCommandReq{})
+			assert.NoError(t, err)
+			assert.Equal(t, CountCommandRes{Instance: i, Calls: 1}, res)
+		}
+		assert.Equal(t, int64(3), created.Load())
+		assert.Equal(t, int64(3), disposed.Load())
+	})
+
+	t.Run("scoped", func(t *testing.T) {
+		catalog, created, disposed := newCountCatalog(LifetimeScoped)
+
+		ctx1, scope1 := NewScope(context.Background())
+		ctx2, scope2 := NewScope(context.Background())
+		for i := int64(1); i <= 2; i++ {
+			res, err := Handle[CountCommandReq, CountCommandRes](ctx1, catalog, CountCommandReq{})
+			assert.NoError(t, err)
+			assert.Equal(t, CountCommandRes{Instance: 1, Calls: i}, res)
+		}
+		res, err := Handle[CountCommandReq, CountCommandRes](ctx2, catalog, CountCommandReq{})
+		assert.NoError(t, err)
+		assert.Equal(t, CountCommandRes{Instance: 2, Calls: 1}, res)
+
+		assert.NoError(t, scope1.Close())
+		assert.Equal(t, int64(1), disposed.Load())
+		assert.NoError(t, scope2.Close())
+		assert.Equal(t, int64(2), disposed.Load())
+		assert.Equal(t, int64(2), created.Load())
+
+		_, err = Handle[CountCommandReq, CountCommandRes](ctx1, catalog, CountCommandReq{})
+		assert.ErrorIs(t, err, ErrScopeClosed)
+	})
+
+	t.Run("scoped factory uses scope", func(t *testing.T) {
+		ctx, scope := NewScope(context.Background())
+		hooked := &atomic.Int64{}
+		catalog := NewDefaultHandlerCatalog()
+		InsertHandler[CountCommandReq, CountCommandRes](catalog, func() Handler[CountCommandReq, CountCommandRes] {
+			scope.OnDispose(func() error { hooked.Add(1); return nil })
+			return &CountHandler{instance: 1, disposed: &atomic.Int64{}}
+		}, WithLifetime(LifetimeScoped))
+		res, err := Handle[CountCommandReq, CountCommandRes](ctx, catalog, CountCommandReq{})
+		assert.NoError(t, err)
+		assert.Equal(t, CountCommandRes{Instance: 1, Calls: 1}, res)
+		assert.NoError(t, scope.Close())
+		assert.Equal(t, int64(1), hooked.Load())
+	})
+
+	t.Run("scope missing", func(t *testing.T) {
+		catalog, _, _ := newCountCatalog(LifetimeScoped)
+		_, err := Handle[CountCommandReq, CountCommandRes](context.Background(), catalog, CountCommandReq{})
+		assert.ErrorIs(t, err, ErrScopeMissing)
+	})
+}
+
+func Test_Scope_Close(t *testing.T) {
+	t.Run("order", func(t *testing.T) {
+		_, scope := NewScope(nil)
+		calls := []int{}
+		scope.OnDispose(func() error { calls = append(calls, 1); return nil })
+		scope.OnDispose(func() error { calls = append(calls, 2); return nil })
+		assert.NoError(t, scope.Close())
+		assert.Equal(t, []int{2, 1}, calls)
+		assert.NoError(t, scope.Close())
+		assert.Equal(t, []int{2, 1}, calls)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, scope := NewScope(nil)
+		err1, err2 := errors.New("one"), errors.New("two")
+		scope.OnDispose(func() error { return err1 })
+		scope.OnDispose(func() error { return err2 })
+		err := scope.Close()
+		assert.ErrorIs(t, err, err1)
+		assert.ErrorIs(t, err, err2)
+	})
+}
+
+func Test_Scope_instance(t *testing.T) {
+	t.Run("created concurrently", func(t *testing.T) {
+		_, scope := NewScope(nil)
+		disposed := &atomic.Int64{}
+		inner := &CountHandler{instance: 1, disposed: disposed}
+		value, err := scope.instance("key", func() any {
+			_, _ = scope.instance("key", func() any { return inner })
+			return &CountHandler{instance: 2, disposed: disposed}
+		})
+		assert.NoError(t, err)
+		assert.Same(t, inner, value)
+		assert.Equal(t, int64(1), disposed.Load())
+		assert.NoError(t, scope.Close())
+		assert.Equal(t, int64(2), disposed.Load())
+	})
+
+	t.Run("closed while creating", func(t *testing.T) {
+		_, scope := NewScope(nil)
+		disposed := &atomic.Int64{}
+		_, err := scope.instance("key", func() any {
+			_ = scope.Close()
+			return &CountHandler{instance: 1, disposed: disposed}
+		})
+		assert.ErrorIs(t, err, ErrScopeClosed)
+		assert.Equal(t, int64(1), disposed.Load())
+	})
+}
+
+func Test_ScopeFromContext(t *testing.T) {
+	ctx, scope := NewScope(context.Background())
+	found, ok := ScopeFromContext(ctx)
+	assert.True(t, ok)
+	assert.Same(t, scope, found)
+
+	_, ok = ScopeFromContext(context.Background())
+	assert.False(t, ok)
+}
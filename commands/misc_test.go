@@ -1,13 +1,20 @@
 package commands
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
 	"time"
 )
 
 const (
 	AddReqName = "add"
 	SubReqName = "sub"
+
+	MediaTypeText = "text/x-test"
 )
 
 type AddCommandRes struct {
@@ -68,8 +75,88 @@ func (h *SlowHandler) Handle(ctx context.Context, req SlowCommandReq) (res SlowC
 		if ctx.Err() != nil {
 			return SlowCommandRes{}, ctx.Err()
 		}
+		ReportProgress(ctx, float64(i*100/req.Iter), "iterate", fmt.Sprintf("iteration %d of %d", i, req.Iter))
 	}
 	return SlowCommandRes{
 		Name: req.Name,
 	}, nil
 }
+
+type NestedCommandRes struct {
+	Inner SlowCommandRes
+}
+
+type NestedCommandReq struct {
+	Inner SlowCommandReq
+}
+
+// NestedHandler dispatches its inner request through catalog, with the context it was given.
+type NestedHandler struct {
+	Handler[NestedCommandReq, NestedCommandRes]
+	catalog HandlerCatalog
+}
+
+func (h *NestedHandler) Handle(ctx context.Context, req NestedCommandReq) (res NestedCommandRes, err error) {
+	res.Inner, err = Handle[SlowCommandReq, SlowCommandRes](ctx, h.catalog, req.Inner)
+	return res, err
+}
+
+// TextCodec is a Codec of MediaTypeText, which is JSON prefixed with "text:".
+type TextCodec struct{}
+
+func (TextCodec) MediaType() string {
+	return MediaTypeText
+}
+
+func (TextCodec) Marshal(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte("text:"), data...), nil
+}
+
+func (TextCodec) Unmarshal(data []byte, v any) error {
+	data, found := bytes.CutPrefix(data, []byte("text:"))
+	if !found {
+		return errors.New("missing text prefix")
+	}
+	return json.Unmarshal(data, v)
+}
+
+type RangeCommandItem struct {
+	Value int `json:"value"`
+}
+
+type RangeCommandReq struct {
+	To     int `json:"to"`
+	FailAt int `json:"failAt"`
+}
+
+type RangeHandler struct {
+	StreamHandler[RangeCommandReq, RangeCommandItem]
+	disposed int
+}
+
+func (h *RangeHandler) Stream(ctx context.Context, req RangeCommandReq) iter.Seq2[RangeCommandItem, error] {
+	return func(yield func(RangeCommandItem, error) bool) {
+		for i := 1; i <= req.To; i++ {
+			if ctx.Err() != nil {
+				yield(RangeCommandItem{}, ctx.Err())
+				return
+			}
+			if i == req.FailAt {
+				yield(RangeCommandItem{}, errors.New("range failure"))
+				return
+			}
+			if !yield(RangeCommandItem{Value: i}, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (h *RangeHandler) Dispose() error {
+	h.disposed++
+	return nil
+}
@@ -0,0 +1,346 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/dan-lugg/go-commands/util"
+)
+
+var (
+	ErrNotificationFailure = errors.New("notification failure")
+)
+
+// Notification is a type alias for any message published to a NotificationCatalog, such as a domain event.
+type Notification = any
+
+// NotificationHandler is a generic interface for handling notifications.
+//
+// Type Parameters:
+//   - TMsg: The type of the notification.
+//
+// Methods:
+//   - Notify(ctx context.Context, msg TMsg) (err error):
+//     Processes the given notification (msg) within the provided context (ctx).
+//     Returns an error (err) if the handling fails.
+type NotificationHandler[TMsg Notification] interface {
+	Notify(ctx context.Context, msg TMsg) (err error)
+}
+
+// NotificationHandlerFactory is a type alias for a function that creates a new instance of a NotificationHandler.
+//
+// Type Parameters:
+//   - TMsg: The type of the notification.
+//
+// Returns:
+//   - A NotificationHandler instance capable of processing the specified notification.
+type NotificationHandlerFactory[TMsg Notification] func() NotificationHandler[TMsg]
+
+// NotificationAdapter is an interface for adapting notification handlers to a common structure.
+//
+// Methods:
+//   - MsgType(): Returns the reflect.Type of the notification handled by the adapter.
+//   - Notify(ctx context.Context, msg Notification): Processes the given notification (msg) within
+//     the provided context (ctx), returning an error (err) if the handling fails.
+type NotificationAdapter interface {
+	MsgType() reflect.Type
+	Notify(ctx context.Context, msg Notification) (err error)
+}
+
+// DefaultNotificationAdapter is a generic adapter for handling notifications. The handler is
+// created on first use and reused for every notification.
+//
+// Type Parameters:
+//   - TMsg: The type of the notification.
+//
+// Fields:
+//   - handler: An instance of the NotificationHandler, created on first use.
+//   - handlerFactory: A factory function that creates a new instance of the NotificationHandler.
+type DefaultNotificationAdapter[TMsg Notification] struct {
+	mutex          sync.Mutex
+	handler        NotificationHandler[TMsg]
+	handlerFactory NotificationHandlerFactory[TMsg]
+}
+
+// NewDefaultNotificationAdapter creates a new instance of DefaultNotificationAdapter.
+//
+// Type Parameters:
+//   - TMsg: The type of the notification.
+//
+// Parameters:
+//   - factory: A NotificationHandlerFactory function that creates a new instance of the NotificationHandler.
+//
+// Returns:
+//   - A pointer to a DefaultNotificationAdapter instance.
+func NewDefaultNotificationAdapter[TMsg Notification](factory NotificationHandlerFactory[TMsg]) *DefaultNotificationAdapter[TMsg] {
+	return &DefaultNotificationAdapter[TMsg]{
+		mutex:          sync.Mutex{},
+		handler:        nil,
+		handlerFactory: factory,
+	}
+}
+
+// MsgType returns the reflect.Type of the notification handled by the adapter.
+//
+// Returns:
+//   - The reflect.Type of TMsg.
+func (a *DefaultNotificationAdapter[TMsg]) MsgType() reflect.Type {
+	return reflect.TypeFor[TMsg]()
+}
+
+// Notify processes a notification using the adapted NotificationHandler.
+//
+// Parameters:
+//   - ctx: A context.Context providing context for the notification processing.
+//   - msg: The notification to be processed.
+//
+// Returns:
+//   - err: An error wrapping ErrInvalidReqType if msg is not a TMsg, ErrHandlerMissing if the factory
+//     returns a nil handler, or the error returned by the handler.
+func (a *DefaultNotificationAdapter[TMsg]) Notify(ctx context.Context, msg Notification) (err error) {
+	typedMsg, ok := msg.(TMsg)
+	if !ok {
+		return fmt.Errorf("%w for msg type: %s", ErrInvalidReqType, reflect.TypeOf(msg))
+	}
+	a.mutex.Lock()
+	if a.handler == nil {
+		a.handler = a.handlerFactory()
+	}
+	handler := a.handler
+	a.mutex.Unlock()
+	if handler == nil {
+		return fmt.Errorf("%w for msg type: %s", ErrHandlerMissing, a.MsgType())
+	}
+	return handler.Notify(ctx, typedMsg)
+}
+
+// PublishMode determines how a NotificationCatalog runs the handlers of a notification.
+type PublishMode int
+
+const (
+	// PublishSequential runs the handlers one after another, in subscription order.
+	PublishSequential PublishMode = iota
+	// PublishParallel runs the handlers concurrently and waits for all of them.
+	PublishParallel
+	// PublishFireAndForget runs the handlers concurrently in the background and returns immediately.
+	PublishFireAndForget
+)
+
+// String returns the name of the PublishMode.
+func (m PublishMode) String() string {
+	switch m {
+	case PublishSequential:
+		return "sequential"
+	case PublishParallel:
+		return "parallel"
+	case PublishFireAndForget:
+		return "fire-and-forget"
+	default:
+		return "unknown"
+	}
+}
+
+// NotificationCatalog is an interface for managing notification handlers, where any number of
+// handlers may subscribe to a notification type.
+//
+// Methods:
+//   - Insert(adapter NotificationAdapter): Subscribes a NotificationAdapter to its notification type.
+//   - Publish(ctx context.Context, msg Notification): Fans a notification out to every subscribed handler.
+type NotificationCatalog interface {
+	Insert(adapter NotificationAdapter)
+	Publish(ctx context.Context, msg Notification) (err error)
+}
+
+// DefaultNotificationCatalog is the default implementation of NotificationCatalog.
+//
+// Fields:
+//   - adapters: A map that associates notification types with their subscribed adapters, in subscription order.
+//   - mode: The PublishMode used by Publish.
+//   - errorHandler: An optional function receiving the errors of notifications published with PublishFireAndForget.
+type DefaultNotificationCatalog struct {
+	mutex        sync.RWMutex
+	adapters     map[reflect.Type][]NotificationAdapter
+	mode         PublishMode
+	errorHandler func(err error)
+}
+
+type NewDefaultNotificationCatalogOption = util.Option[*DefaultNotificationCatalog]
+
+// WithPublishMode returns an option that sets the PublishMode used by Publish.
+//
+// Parameters:
+//   - mode: The PublishMode used by Publish.
+func WithPublishMode(mode PublishMode) NewDefaultNotificationCatalogOption {
+	return func(catalog *DefaultNotificationCatalog) {
+		catalog.mode = mode
+	}
+}
+
+// WithPublishErrorHandler returns an option that sets the function receiving the errors of
+// notifications published with PublishFireAndForget, which are not returned to the publisher.
+//
+// Parameters:
+//   - errorHandler: The function receiving the errors.
+func WithPublishErrorHandler(errorHandler func(err error)) NewDefaultNotificationCatalogOption {
+	return func(catalog *DefaultNotificationCatalog) {
+		catalog.errorHandler = errorHandler
+	}
+}
+
+// NewDefaultNotificationCatalog creates and returns a new instance of DefaultNotificationCatalog.
+//
+// By default notifications are published with PublishSequential.
+//
+// Parameters:
+//   - options: Options applied to the catalog.
+//
+// Returns:
+//   - A pointer to a DefaultNotificationCatalog instance.
+func NewDefaultNotificationCatalog(options ...NewDefaultNotificationCatalogOption) (catalog *DefaultNotificationCatalog) {
+	catalog = &DefaultNotificationCatalog{
+		mutex:        sync.RWMutex{},
+		adapters:     make(map[reflect.Type][]NotificationAdapter),
+		mode:         PublishSequential,
+		errorHandler: nil,
+	}
+	for _, option := range options {
+		option(catalog)
+	}
+	return catalog
+}
+
+// Insert subscribes a NotificationAdapter to its notification type.
+//
+// Parameters:
+//   - adapter: The NotificationAdapter instance to subscribe.
+func (c *DefaultNotificationCatalog) Insert(adapter NotificationAdapter) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.adapters == nil {
+		c.adapters = make(map[reflect.Type][]NotificationAdapter)
+	}
+	c.adapters[adapter.MsgType()] = append(c.adapters[adapter.MsgType()], adapter)
+}
+
+// Subscribers returns the number of handlers subscribed to a notification type.
+//
+// Parameters:
+//   - msgType: The reflect.Type of the notification.
+//
+// Returns:
+//   - The number of subscribed handlers.
+func (c *DefaultNotificationCatalog) Subscribers(msgType reflect.Type) int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return len(c.adapters[msgType])
+}
+
+// Publish fans a notification out to every handler subscribed to its type, using the
+// PublishMode of the catalog. Publishing a notification without subscribers succeeds.
+//
+// Parameters:
+//   - ctx: A context.Context providing context for the notification processing.
+//   - msg: The notification to publish.
+//
+// Returns:
+//   - err: An error joining the errors of the failed handlers, each wrapping ErrNotificationFailure.
+func (c *DefaultNotificationCatalog) Publish(ctx context.Context, msg Notification) (err error) {
+	return c.PublishWith(ctx, c.mode, msg)
+}
+
+// PublishWith fans a notification out to every handler subscribed to its type, using the given PublishMode.
+//
+// With PublishFireAndForget the handlers run with a context.Context that is not canceled with
+// ctx, and their errors are passed to the error handler of the catalog instead of being returned.
+//
+// Parameters:
+//   - ctx: A context.Context providing context for the notification processing.
+//   - mode: The PublishMode to use.
+//   - msg: The notification to publish.
+//
+// Returns:
+//   - err: An error joining the errors of the failed handlers, each wrapping ErrNotificationFailure.
+func (c *DefaultNotificationCatalog) PublishWith(ctx context.Context, mode PublishMode, msg Notification) (err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	c.mutex.RLock()
+	adapters := c.adapters[reflect.TypeOf(msg)]
+	errorHandler := c.errorHandler
+	c.mutex.RUnlock()
+
+	switch mode {
+	case PublishParallel:
+		return notifyParallel(ctx, adapters, msg)
+	case PublishFireAndForget:
+		go func() {
+			if err := notifyParallel(context.WithoutCancel(ctx), adapters, msg); err != nil && errorHandler != nil {
+				errorHandler(err)
+			}
+		}()
+		return nil
+	default:
+		errs := make([]error, len(adapters))
+		for i, adapter := range adapters {
+			errs[i] = notify(ctx, adapter, msg)
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// notifyParallel runs the adapters concurrently and joins their errors, in subscription order.
+func notifyParallel(ctx context.Context, adapters []NotificationAdapter, msg Notification) error {
+	errs := make([]error, len(adapters))
+	waitGroup := sync.WaitGroup{}
+	waitGroup.Add(len(adapters))
+	for i, adapter := range adapters {
+		go func() {
+			defer waitGroup.Done()
+			errs[i] = notify(ctx, adapter, msg)
+		}()
+	}
+	waitGroup.Wait()
+	return errors.Join(errs...)
+}
+
+// notify runs one adapter, wrapping its error with ErrNotificationFailure.
+func notify(ctx context.Context, adapter NotificationAdapter, msg Notification) error {
+	if err := adapter.Notify(ctx, msg); err != nil {
+		return fmt.Errorf("%w for msg type: %s: %w", ErrNotificationFailure, adapter.MsgType(), err)
+	}
+	return nil
+}
+
+// InsertNotificationHandler is a generic function that subscribes a notification handler to a catalog.
+//
+// Type Parameters:
+//   - TMsg: The type of the notification.
+//
+// Parameters:
+//   - catalog: A pointer to the DefaultNotificationCatalog where the handler will be subscribed.
+//   - factory: A NotificationHandlerFactory function that creates a new instance of the handler.
+func InsertNotificationHandler[TMsg Notification](catalog *DefaultNotificationCatalog, factory NotificationHandlerFactory[TMsg]) {
+	catalog.Insert(NewDefaultNotificationAdapter[TMsg](factory))
+}
+
+// NotificationHandlerFunc is a function type implementing NotificationHandler, allowing plain
+// functions to subscribe to notifications.
+//
+// Type Parameters:
+//   - TMsg: The type of the notification.
+type NotificationHandlerFunc[TMsg Notification] func(ctx context.Context, msg TMsg) (err error)
+
+// Notify calls the function.
+//
+// Parameters:
+//   - ctx: A context.Context providing context for the notification processing.
+//   - msg: The notification to be processed.
+//
+// Returns:
+//   - err: The error returned by the function.
+func (f NotificationHandlerFunc[TMsg]) Notify(ctx context.Context, msg TMsg) (err error) {
+	return f(ctx, msg)
+}
@@ -0,0 +1,138 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type UserCreated struct {
+	Name string
+}
+
+// recorder collects the names of the handlers notified, in the order they ran.
+type recorder struct {
+	mutex sync.Mutex
+	names []string
+}
+
+func (r *recorder) handler(name string, delay time.Duration, err error) NotificationHandlerFactory[UserCreated] {
+	return func() NotificationHandler[UserCreated] {
+		return NotificationHandlerFunc[UserCreated](func(ctx context.Context, msg UserCreated) error {
+			time.Sleep(delay)
+			r.mutex.Lock()
+			defer r.mutex.Unlock()
+			r.names = append(r.names, name)
+			return err
+		})
+	}
+}
+
+func (r *recorder) Names() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]string(nil), r.names...)
+}
+
+func Test_PublishMode_String(t *testing.T) {
+	assert.Equal(t, "sequential", PublishSequential.String())
+	assert.Equal(t, "parallel", PublishParallel.String())
+	assert.Equal(t, "fire-and-forget", PublishFireAndForget.String())
+	assert.Equal(t, "unknown", PublishMode(-1).String())
+}
+
+func Test_DefaultNotificationAdapter_Notify(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		adapter := NewDefaultNotificationAdapter[UserCreated](func() NotificationHandler[UserCreated] {
+			return NotificationHandlerFunc[UserCreated](func(ctx context.Context, msg UserCreated) error {
+				return nil
+			})
+		})
+		assert.Equal(t, reflect.TypeFor[UserCreated](), adapter.MsgType())
+		assert.NoError(t, adapter.Notify(nil, UserCreated{}))
+		assert.ErrorIs(t, adapter.Notify(nil, 42), ErrInvalidReqType)
+	})
+
+	t.Run("nil handler", func(t *testing.T) {
+		adapter := NewDefaultNotificationAdapter[UserCreated](func() NotificationHandler[UserCreated] {
+			return nil
+		})
+		assert.ErrorIs(t, adapter.Notify(nil, UserCreated{}), ErrHandlerMissing)
+	})
+}
+
+func Test_DefaultNotificationCatalog_Insert(t *testing.T) {
+	t.Run("empty catalog", func(t *testing.T) {
+		rec := &recorder{}
+		catalog := &DefaultNotificationCatalog{}
+		assert.Nil(t, catalog.adapters)
+		InsertNotificationHandler(catalog, rec.handler("a", 0, nil))
+		assert.Equal(t, 1, catalog.Subscribers(reflect.TypeFor[UserCreated]()))
+		assert.NoError(t, catalog.Publish(nil, UserCreated{Name: "alice"}))
+		assert.Equal(t, []string{"a"}, rec.Names())
+	})
+}
+
+func Test_DefaultNotificationCatalog_Publish(t *testing.T) {
+	t.Run("no subscribers", func(t *testing.T) {
+		catalog := NewDefaultNotificationCatalog()
+		assert.NoError(t, catalog.Publish(nil, UserCreated{}))
+	})
+
+	t.Run("sequential", func(t *testing.T) {
+		rec := &recorder{}
+		catalog := NewDefaultNotificationCatalog()
+		InsertNotificationHandler(catalog, rec.handler("a", 20*time.Millisecond, nil))
+		InsertNotificationHandler(catalog, rec.handler("b", 0, nil))
+		assert.Equal(t, 2, catalog.Subscribers(reflect.TypeFor[UserCreated]()))
+		assert.NoError(t, catalog.Publish(nil, UserCreated{Name: "alice"}))
+		assert.Equal(t, []string{"a", "b"}, rec.Names())
+	})
+
+	t.Run("parallel", func(t *testing.T) {
+		rec := &recorder{}
+		catalog := NewDefaultNotificationCatalog(WithPublishMode(PublishParallel))
+		InsertNotificationHandler(catalog, rec.handler("a", 20*time.Millisecond, nil))
+		InsertNotificationHandler(catalog, rec.handler("b", 0, nil))
+		assert.NoError(t, catalog.Publish(nil, UserCreated{Name: "alice"}))
+		assert.Equal(t, []string{"b", "a"}, rec.Names())
+	})
+
+	t.Run("joins errors", func(t *testing.T) {
+		errA, errB := errors.New("a failed"), errors.New("b failed")
+		for _, mode := range []PublishMode{PublishSequential, PublishParallel} {
+			rec := &recorder{}
+			catalog := NewDefaultNotificationCatalog()
+			InsertNotificationHandler(catalog, rec.handler("a", 0, errA))
+			InsertNotificationHandler(catalog, rec.handler("b", 0, nil))
+			InsertNotificationHandler(catalog, rec.handler("c", 0, errB))
+			err := catalog.PublishWith(nil, mode, UserCreated{})
+			assert.ErrorIs(t, err, ErrNotificationFailure)
+			assert.ErrorIs(t, err, errA)
+			assert.ErrorIs(t, err, errB)
+			assert.Len(t, rec.Names(), 3)
+		}
+	})
+
+	t.Run("fire and forget", func(t *testing.T) {
+		errA := errors.New("a failed")
+		errs := make(chan error, 1)
+		rec := &recorder{}
+		catalog := NewDefaultNotificationCatalog(WithPublishMode(PublishFireAndForget), WithPublishErrorHandler(func(err error) {
+			errs <- err
+		}))
+		InsertNotificationHandler(catalog, rec.handler("a", 20*time.Millisecond, errA))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		assert.NoError(t, catalog.Publish(ctx, UserCreated{}))
+		cancel()
+		assert.Empty(t, rec.Names())
+		assert.ErrorIs(t, <-errs, errA)
+		assert.Equal(t, []string{"a"}, rec.Names())
+	})
+}
@@ -0,0 +1,254 @@
+package commands
+
+import (
+	"context"
+	"sync"
+
+	"github.com/dan-lugg/go-commands/futures"
+	"github.com/dan-lugg/go-commands/util"
+)
+
+// Progress describes how far along a running command is.
+//
+// Fields:
+//   - Percent: The completed share of the work, from 0 to 100.
+//   - Message: An optional human-readable description of the current step.
+//   - Stage: An optional name of the current phase, such as "download" or "import".
+type Progress struct {
+	Percent float64 `json:"percent"`
+	Message string  `json:"message,omitempty"`
+	Stage   string  `json:"stage,omitempty"`
+}
+
+// ProgressObserver is a function type notified of every Progress reported to a ProgressReporter.
+type ProgressObserver func(progress Progress)
+
+// ProgressReporter receives the Progress reported by a handler and notifies its observers.
+//
+// Handlers get the ProgressReporter of their dispatch with ProgressFromContext. All of its
+// methods are safe to call on a nil *ProgressReporter, which discards the reports, so
+// handlers can report unconditionally.
+//
+// Fields:
+//   - current: The latest Progress reported.
+//   - reported: Whether any Progress has been reported.
+//   - observers: The observers notified of every report, keyed by subscription.
+//   - nextID: The key of the next subscription.
+type ProgressReporter struct {
+	mutex     sync.Mutex
+	current   Progress
+	reported  bool
+	observers map[int]ProgressObserver
+	nextID    int
+}
+
+// NewProgressReporter creates and returns a new instance of ProgressReporter.
+//
+// Parameters:
+//   - observers: Observers notified of every report for the lifetime of the reporter.
+//
+// Returns:
+//   - A pointer to a ProgressReporter instance.
+func NewProgressReporter(observers ...ProgressObserver) (reporter *ProgressReporter) {
+	reporter = &ProgressReporter{
+		mutex:     sync.Mutex{},
+		current:   Progress{},
+		reported:  false,
+		observers: make(map[int]ProgressObserver),
+		nextID:    0,
+	}
+	for _, observer := range observers {
+		reporter.Observe(observer)
+	}
+	return reporter
+}
+
+// Report records a Progress and notifies the observers, in the order of the reports. The percent
+// is clamped to the range 0 to 100. Observers run on the goroutine of the caller and must not
+// report or observe themselves.
+//
+// Parameters:
+//   - progress: The Progress to report.
+func (r *ProgressReporter) Report(progress Progress) {
+	if r == nil {
+		return
+	}
+	progress.Percent = min(max(progress.Percent, 0), 100)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.current, r.reported = progress, true
+	for id := 0; id < r.nextID; id++ {
+		if observer, found := r.observers[id]; found {
+			observer(progress)
+		}
+	}
+}
+
+// Observe subscribes an observer to the reports that follow.
+//
+// Parameters:
+//   - observer: The ProgressObserver to notify.
+//
+// Returns:
+//   - A function that unsubscribes the observer.
+func (r *ProgressReporter) Observe(observer ProgressObserver) (cancel func()) {
+	if r == nil {
+		return func() {}
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.observers == nil {
+		r.observers = make(map[int]ProgressObserver)
+	}
+	id := r.nextID
+	r.nextID++
+	r.observers[id] = observer
+	return func() {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		delete(r.observers, id)
+	}
+}
+
+// Current returns the latest Progress reported.
+//
+// Returns:
+//   - progress: The latest Progress, or the zero Progress if none was reported.
+//   - reported: Whether any Progress has been reported.
+func (r *ProgressReporter) Current() (progress Progress, reported bool) {
+	if r == nil {
+		return Progress{}, false
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.current, r.reported
+}
+
+// QueuedProgressObserver returns a ProgressObserver that hands each Progress to observer on a
+// goroutine of its own, so a slow observer, such as one writing to a connection, never blocks
+// the handler reporting it. Only the latest Progress is queued: a report made while observer is
+// still busy replaces the one waiting, which is dropped as stale.
+//
+// Parameters:
+//   - observer: The ProgressObserver to notify.
+//
+// Returns:
+//   - queued: A ProgressObserver queuing each Progress for observer.
+//   - stop: A function that delivers the Progress still queued, if any, then waits for observer
+//     to return. Progress reported after stop is dropped.
+func QueuedProgressObserver(observer ProgressObserver) (queued ProgressObserver, stop func()) {
+	mutex := sync.Mutex{}
+	latest, pending, stopped := Progress{}, false, false
+	wake, stopping, done := make(chan struct{}, 1), make(chan struct{}), make(chan struct{})
+
+	deliver := func() {
+		mutex.Lock()
+		progress, deliverable := latest, pending
+		pending = false
+		mutex.Unlock()
+		if deliverable {
+			observer(progress)
+		}
+	}
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-wake:
+				deliver()
+			case <-stopping:
+				deliver()
+				return
+			}
+		}
+	}()
+
+	queued = func(progress Progress) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if stopped {
+			return
+		}
+		latest, pending = progress, true
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+	once := sync.Once{}
+	stop = func() {
+		once.Do(func() {
+			mutex.Lock()
+			stopped = true
+			mutex.Unlock()
+			close(stopping)
+		})
+		<-done
+	}
+	return queued, stop
+}
+
+type progressKey struct{}
+
+// ContextWithProgress returns a context.Context carrying a ProgressReporter, to which the
+// handlers dispatched with it report.
+//
+// Parameters:
+//   - ctx: The parent context.Context.
+//   - reporter: The ProgressReporter to carry.
+//
+// Returns:
+//   - A context.Context carrying reporter.
+func ContextWithProgress(ctx context.Context, reporter *ProgressReporter) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, progressKey{}, reporter)
+}
+
+// ProgressFromContext returns the ProgressReporter carried by a context.Context.
+//
+// Parameters:
+//   - ctx: The context.Context to inspect.
+//
+// Returns:
+//   - The ProgressReporter carried by ctx, or nil, which discards the reports.
+func ProgressFromContext(ctx context.Context) *ProgressReporter {
+	if ctx == nil {
+		return nil
+	}
+	reporter, _ := ctx.Value(progressKey{}).(*ProgressReporter)
+	return reporter
+}
+
+// ReportProgress reports a Progress to the ProgressReporter carried by a context.Context, if any.
+//
+// Parameters:
+//   - ctx: The context.Context of the dispatch.
+//   - percent: The completed share of the work, from 0 to 100.
+//   - stage: The name of the current phase, or an empty string.
+//   - message: A description of the current step, or an empty string.
+func ReportProgress(ctx context.Context, percent float64, stage string, message string) {
+	ProgressFromContext(ctx).Report(Progress{Percent: percent, Message: message, Stage: stage})
+}
+
+// ProgressFuture is implemented by the futures.Future returned by DefaultHandlerCatalog.Future,
+// giving callers access to the progress of the command.
+//
+// Methods:
+//   - Progress(): Returns the ProgressReporter the command reports to.
+type ProgressFuture interface {
+	futures.Future[util.Tuple2[CommandRes, error]]
+	Progress() *ProgressReporter
+}
+
+// progressFuture is a futures.Future carrying the ProgressReporter of its command.
+type progressFuture struct {
+	futures.Future[util.Tuple2[CommandRes, error]]
+	progress *ProgressReporter
+}
+
+// Progress returns the ProgressReporter the command reports to.
+func (f *progressFuture) Progress() *ProgressReporter {
+	return f.progress
+}
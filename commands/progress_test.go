@@ -0,0 +1,172 @@
+package commands
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ProgressReporter_Report(t *testing.T) {
+	t.Run("observers", func(t *testing.T) {
+		first, second := make([]Progress, 0), make([]Progress, 0)
+		reporter := NewProgressReporter(func(progress Progress) {
+			first = append(first, progress)
+		})
+		cancel := reporter.Observe(func(progress Progress) {
+			second = append(second, progress)
+		})
+
+		reporter.Report(Progress{Percent: 10, Stage: "load"})
+		cancel()
+		reporter.Report(Progress{Percent: 50, Stage: "load", Message: "halfway"})
+
+		assert.Equal(t, []Progress{{Percent: 10, Stage: "load"}, {Percent: 50, Stage: "load", Message: "halfway"}}, first)
+		assert.Equal(t, []Progress{{Percent: 10, Stage: "load"}}, second)
+	})
+
+	t.Run("clamped", func(t *testing.T) {
+		reporter := NewProgressReporter()
+		reporter.Report(Progress{Percent: 150})
+		progress, _ := reporter.Current()
+		assert.Equal(t, 100.0, progress.Percent)
+		reporter.Report(Progress{Percent: -5})
+		progress, _ = reporter.Current()
+		assert.Equal(t, 0.0, progress.Percent)
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		count := 0
+		reporter := NewProgressReporter(func(progress Progress) {
+			count++
+		})
+		wg := sync.WaitGroup{}
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				reporter.Report(Progress{Percent: float64(i)})
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, 10, count)
+	})
+}
+
+func Test_ProgressReporter_Current(t *testing.T) {
+	reporter := NewProgressReporter()
+	progress, reported := reporter.Current()
+	assert.False(t, reported)
+	assert.Zero(t, progress)
+
+	reporter.Report(Progress{Percent: 25, Message: "started"})
+	progress, reported = reporter.Current()
+	assert.True(t, reported)
+	assert.Equal(t, Progress{Percent: 25, Message: "started"}, progress)
+}
+
+func Test_ProgressReporter_Nil(t *testing.T) {
+	var reporter *ProgressReporter
+	assert.NotPanics(t, func() {
+		reporter.Report(Progress{Percent: 10})
+		reporter.Observe(func(Progress) {})()
+		_, reported := reporter.Current()
+		assert.False(t, reported)
+	})
+}
+
+func Test_ProgressFromContext(t *testing.T) {
+	assert.Nil(t, ProgressFromContext(nil))
+	assert.Nil(t, ProgressFromContext(context.Background()))
+
+	reporter := NewProgressReporter()
+	ctx := ContextWithProgress(nil, reporter)
+	assert.Same(t, reporter, ProgressFromContext(ctx))
+
+	ReportProgress(ctx, 40, "copy", "4 of 10")
+	progress, _ := reporter.Current()
+	assert.Equal(t, Progress{Percent: 40, Stage: "copy", Message: "4 of 10"}, progress)
+
+	assert.NotPanics(t, func() {
+		ReportProgress(context.Background(), 40, "copy", "4 of 10")
+	})
+}
+
+func Test_HandlerCatalog_Future_Progress(t *testing.T) {
+	catalog := NewDefaultHandlerCatalog()
+	InsertHandler[SlowCommandReq, SlowCommandRes](catalog, func() Handler[SlowCommandReq, SlowCommandRes] {
+		return &SlowHandler{}
+	})
+
+	t.Run("progress future", func(t *testing.T) {
+		fut := catalog.Future(context.Background(), SlowCommandReq{Name: "A", Iter: 4})
+		progressFut, ok := fut.(ProgressFuture)
+		assert.True(t, ok)
+
+		mutex := sync.Mutex{}
+		percents := make([]float64, 0)
+		progressFut.Progress().Observe(func(progress Progress) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			percents = append(percents, progress.Percent)
+		})
+		tup := fut.Wait()
+		assert.NoError(t, tup.Val2)
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		assert.Equal(t, []float64{25, 50, 75, 100}, percents)
+		progress, _ := progressFut.Progress().Current()
+		assert.Equal(t, Progress{Percent: 100, Stage: "iterate", Message: "iteration 4 of 4"}, progress)
+	})
+
+	t.Run("observer in context", func(t *testing.T) {
+		progresses := make([]Progress, 0)
+		reporter := NewProgressReporter(func(progress Progress) {
+			progresses = append(progresses, progress)
+		})
+		ctx := ContextWithProgress(context.Background(), reporter)
+
+		tup := Future[SlowCommandReq, SlowCommandRes](ctx, catalog, SlowCommandReq{Name: "A", Iter: 2}).Wait()
+		assert.NoError(t, tup.Val2)
+		assert.Len(t, progresses, 2)
+
+		fut := catalog.Future(ctx, SlowCommandReq{Name: "B", Iter: 1})
+		assert.Same(t, reporter, fut.(ProgressFuture).Progress())
+		fut.Wait()
+		assert.Len(t, progresses, 3)
+	})
+}
+
+func Test_QueuedProgressObserver(t *testing.T) {
+	t.Run("does not block", func(t *testing.T) {
+		release := make(chan struct{})
+		observed := make([]Progress, 0)
+		queued, stop := QueuedProgressObserver(func(progress Progress) {
+			<-release
+			observed = append(observed, progress)
+		})
+		reporter := NewProgressReporter(queued)
+		for i := range 10 {
+			reporter.Report(Progress{Percent: float64(i * 10)})
+		}
+		close(release)
+		stop()
+		assert.NotEmpty(t, observed)
+		assert.LessOrEqual(t, len(observed), 2)
+		assert.Equal(t, Progress{Percent: 90}, observed[len(observed)-1])
+	})
+
+	t.Run("stop delivers the latest", func(t *testing.T) {
+		observed := make([]Progress, 0)
+		queued, stop := QueuedProgressObserver(func(progress Progress) {
+			observed = append(observed, progress)
+		})
+		queued(Progress{Percent: 50})
+		stop()
+		queued(Progress{Percent: 100})
+		stop()
+		assert.Equal(t, []Progress{{Percent: 50}}, observed)
+	})
+}
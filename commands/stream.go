@@ -0,0 +1,432 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/dan-lugg/go-commands/util"
+)
+
+// StreamHandler is a generic interface for handling commands that produce many results,
+// such as exports and searches.
+//
+// Type Parameters:
+//   - TReq: The type of the command request, which must implement the CommandReq interface.
+//   - TItem: The type of the items produced, which must implement the CommandRes interface.
+//
+// Methods:
+//   - Stream(ctx context.Context, req TReq) iter.Seq2[TItem, error]:
+//     Returns the sequence of items produced for the given command request (req). The
+//     sequence runs as it is iterated, should stop once ctx ends, and reports a failure
+//     by yielding a non-nil error, after which it should stop.
+type StreamHandler[TReq CommandReq[TItem], TItem CommandRes] interface {
+	Stream(ctx context.Context, req TReq) iter.Seq2[TItem, error]
+}
+
+// StreamHandlerFactory is a type alias for a function that creates a new instance of a StreamHandler.
+//
+// Type Parameters:
+//   - TReq: The type of the command request, which must implement the CommandReq interface.
+//   - TItem: The type of the items produced, which must implement the CommandRes interface.
+//
+// Returns:
+//   - A StreamHandler instance capable of processing the specified request and producing the items.
+type StreamHandlerFactory[TReq CommandReq[TItem], TItem CommandRes] func() StreamHandler[TReq, TItem]
+
+// StreamAdapter is an interface for adapting stream handlers to a common structure.
+//
+// Methods:
+//   - ReqType(): Returns the reflect.Type of the request handled by the adapter.
+//   - ItemType(): Returns the reflect.Type of the items produced by the adapter.
+//   - Stream(ctx context.Context, req CommandReq[CommandRes]): Returns the sequence of items
+//     produced for the given request (req) within the provided context (ctx).
+type StreamAdapter interface {
+	ReqType() reflect.Type
+	ItemType() reflect.Type
+	Stream(ctx context.Context, req CommandReq[CommandRes]) iter.Seq2[CommandRes, error]
+}
+
+// DefaultStreamAdapter is a generic adapter for handling streaming commands.
+//
+// Type Parameters:
+//   - TReq: The type of the command request, which must implement the CommandReq interface.
+//   - TItem: The type of the items produced, which must implement the CommandRes interface.
+//
+// Fields:
+//   - handler: An instance of the StreamHandler, cached for singletons.
+//   - handlerFactory: A factory function that creates a new instance of the StreamHandler.
+//   - options: The HandlerOptions the handler was registered with.
+type DefaultStreamAdapter[TReq CommandReq[TItem], TItem CommandRes] struct {
+	mutex          sync.RWMutex
+	handler        StreamHandler[TReq, TItem]
+	handlerFactory StreamHandlerFactory[TReq, TItem]
+	options        HandlerOptions
+}
+
+// NewDefaultStreamAdapter creates a new instance of DefaultStreamAdapter.
+//
+// Type Parameters:
+//   - TReq: The type of the command request, which must implement the CommandReq interface.
+//   - TItem: The type of the items produced, which must implement the CommandRes interface.
+//
+// Parameters:
+//   - factory: A function that creates a new instance of a StreamHandler for the specified request and item types.
+//   - options: Options applied to the HandlerOptions of the adapter, such as WithLifetime or WithTimeout.
+//
+// Returns:
+//   - A pointer to a DefaultStreamAdapter instance, initialized with the provided factory function.
+func NewDefaultStreamAdapter[TReq CommandReq[TItem], TItem CommandRes](factory func() StreamHandler[TReq, TItem], options ...HandlerOption) *DefaultStreamAdapter[TReq, TItem] {
+	adapter := &DefaultStreamAdapter[TReq, TItem]{
+		mutex:          sync.RWMutex{},
+		handler:        nil,
+		handlerFactory: factory,
+		options: HandlerOptions{
+			Lifetime: LifetimeSingleton,
+		},
+	}
+	for _, option := range options {
+		option(&adapter.options)
+	}
+	return adapter
+}
+
+// Stream returns the sequence of items produced for the given request (req) within the provided context (ctx).
+//
+// The StreamHandler is obtained according to the Lifetime of the adapter, as for a
+// DefaultHandlerAdapter; a transient handler is disposed once the sequence completes.
+//
+// Parameters:
+//   - ctx: A context.Context providing context for the request processing.
+//   - req: A CommandReq[CommandRes] representing the command request to be processed.
+//
+// Returns:
+//   - A sequence of the items produced, yielding a single error if the request type does not
+//     match the expected type or no handler can be obtained.
+func (a *DefaultStreamAdapter[TReq, TItem]) Stream(ctx context.Context, req CommandReq[CommandRes]) iter.Seq2[CommandRes, error] {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return func(yield func(CommandRes, error) bool) {
+		typedReq, ok := req.(TReq)
+		if !ok {
+			yield(nil, fmt.Errorf("req type %T does not match %T", req, typedReq))
+			return
+		}
+		var handler StreamHandler[TReq, TItem]
+		stopped := false
+		switch a.options.Lifetime {
+		case LifetimeTransient:
+			handler = a.handlerFactory()
+			if disposer, ok := handler.(Disposer); ok {
+				defer func() {
+					if err := disposer.Dispose(); err != nil && !stopped {
+						yield(nil, err)
+					}
+				}()
+			}
+		case LifetimeScoped:
+			scope, found := ScopeFromContext(ctx)
+			if !found {
+				yield(nil, fmt.Errorf("%w for scoped req type: %s", ErrScopeMissing, a.ReqType()))
+				return
+			}
+			instance, scopeErr := scope.instance(a, func() any { return a.handlerFactory() })
+			if scopeErr != nil {
+				yield(nil, fmt.Errorf("%w for scoped req type: %s", scopeErr, a.ReqType()))
+				return
+			}
+			handler, _ = instance.(StreamHandler[TReq, TItem])
+		default:
+			handler = a.singleton()
+		}
+		if handler == nil {
+			yield(nil, fmt.Errorf("%w for req type: %s", ErrHandlerMissing, a.ReqType()))
+			return
+		}
+		for item, err := range handler.Stream(ctx, typedReq) {
+			if !yield(item, err) {
+				stopped = true
+				return
+			}
+		}
+	}
+}
+
+// singleton returns the cached StreamHandler, creating it on first use.
+func (a *DefaultStreamAdapter[TReq, TItem]) singleton() StreamHandler[TReq, TItem] {
+	a.mutex.RLock()
+	handler := a.handler
+	a.mutex.RUnlock()
+	if handler == nil {
+		a.mutex.Lock()
+		defer a.mutex.Unlock()
+		if a.handler == nil {
+			a.handler = a.handlerFactory()
+		}
+		handler = a.handler
+	}
+	return handler
+}
+
+// Lifetime returns the Lifetime of the handlers created by the adapter.
+//
+// Returns:
+//   - The Lifetime the adapter was created with.
+func (a *DefaultStreamAdapter[TReq, TItem]) Lifetime() Lifetime {
+	return a.options.Lifetime
+}
+
+// Timeout returns the timeout of a whole stream.
+//
+// Returns:
+//   - The timeout the adapter was created with, or 0 if none was set.
+func (a *DefaultStreamAdapter[TReq, TItem]) Timeout() time.Duration {
+	return a.options.Timeout
+}
+
+// ReqType returns the reflect.Type of the request handled by the adapter.
+//
+// Returns:
+//   - A reflect.Type representing the type of the request handled by the adapter.
+func (a *DefaultStreamAdapter[TReq, TItem]) ReqType() reflect.Type {
+	return reflect.TypeFor[TReq]()
+}
+
+// ItemType returns the reflect.Type of the items produced by the adapter.
+//
+// Returns:
+//   - A reflect.Type representing the type of the items produced by the adapter.
+func (a *DefaultStreamAdapter[TReq, TItem]) ItemType() reflect.Type {
+	return reflect.TypeFor[TItem]()
+}
+
+// StreamCatalog is an optional interface for catalogs that also dispatch streaming commands,
+// allowing transports to serve them alongside the others.
+type StreamCatalog interface {
+	InsertStream(adapter StreamAdapter)
+	IsStream(reqType reflect.Type) bool
+	Stream(ctx context.Context, req CommandReq[CommandRes]) iter.Seq2[CommandRes, error]
+	StreamTypeMap() map[reflect.Type]reflect.Type
+}
+
+// InsertStream adds a StreamAdapter to the DefaultHandlerCatalog.
+//
+// Parameters:
+//   - adapter: The StreamAdapter instance to catalog.
+func (r *DefaultHandlerCatalog) InsertStream(adapter StreamAdapter) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.streamAdapters == nil {
+		r.streamAdapters = make(map[reflect.Type]StreamAdapter)
+	}
+	r.streamAdapters[adapter.ReqType()] = adapter
+}
+
+// IsStream reports whether a stream handler is cataloged for a request type.
+//
+// Parameters:
+//   - reqType: The reflect.Type of the request.
+//
+// Returns:
+//   - true if the request type is dispatched with Stream rather than Handle.
+func (r *DefaultHandlerCatalog) IsStream(reqType reflect.Type) bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	_, found := r.streamAdapters[reqType]
+	return found
+}
+
+// Stream processes a streaming command request using the cataloged stream handler.
+//
+// The stream runs through the global interceptors, then the interceptors registered for its
+// type, as a dispatch with InterceptorInfo.Stream set: an interceptor may reject the stream
+// by returning an error without calling next, and next returns once the stream completes,
+// with a nil result and the last error yielded, if any. If the stream handler was registered
+// with WithTimeout, or a timeout is set with ContextWithTimeout, the whole stream runs with a
+// child context expiring after it; the default timeout of the catalog does not apply.
+//
+// Parameters:
+//   - ctx: A context.Context providing context for the request processing; ending it stops the stream.
+//   - req: A CommandReq[CommandRes] representing the command request to be processed.
+//
+// Returns:
+//   - A sequence of the items produced, yielding an error wrapping ErrHandlerMissing if no
+//     stream handler is cataloged for the request type, ErrCommandTimeout if the timeout expires,
+//     or the error of an interceptor rejecting the stream.
+func (r *DefaultHandlerCatalog) Stream(ctx context.Context, req CommandReq[CommandRes]) iter.Seq2[CommandRes, error] {
+	reqType := reflect.TypeOf(req)
+	r.mutex.RLock()
+	adapter, found := r.streamAdapters[reqType]
+	interceptors := make([]Interceptor, 0, len(r.interceptors)+len(r.typeInterceptors[reqType]))
+	interceptors = append(interceptors, r.interceptors...)
+	interceptors = append(interceptors, r.typeInterceptors[reqType]...)
+	mappingCatalog := r.mappingCatalog
+	r.mutex.RUnlock()
+	return func(yield func(CommandRes, error) bool) {
+		if !found {
+			yield(nil, fmt.Errorf("%w for stream req type: %s", ErrHandlerMissing, reqType))
+			return
+		}
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		info := InterceptorInfo{
+			ReqType: reqType,
+			ResType: adapter.ItemType(),
+			Stream:  true,
+		}
+		if mappingCatalog != nil {
+			info.ReqName, _ = mappingCatalog.ByType(reqType)
+		}
+		started, stopped := false, false
+		streamErr := error(nil)
+		_, err := chainInvoker(info, interceptors, func(ctx context.Context, req CommandReq[CommandRes]) (CommandRes, error) {
+			// A stream runs once, even if an interceptor calls next again.
+			if started {
+				return nil, streamErr
+			}
+			started = true
+			for item, err := range streamOf(ctx, adapter, req) {
+				if err != nil {
+					streamErr = err
+				}
+				if !yield(item, err) {
+					stopped = true
+					break
+				}
+			}
+			return nil, streamErr
+		})(ctx, req)
+		if err != nil && !stopped && (!started || !errors.Is(err, streamErr)) {
+			yield(nil, err)
+		}
+	}
+}
+
+// streamOf returns the sequence of items produced by a StreamAdapter, running the whole stream
+// with a child context expiring after the timeout of the adapter, or the one set with
+// ContextWithTimeout, if any.
+func streamOf(ctx context.Context, adapter StreamAdapter, req CommandReq[CommandRes]) iter.Seq2[CommandRes, error] {
+	return func(yield func(CommandRes, error) bool) {
+		budget := time.Duration(0)
+		if timeoutAdapter, ok := adapter.(interface{ Timeout() time.Duration }); ok {
+			budget = timeoutAdapter.Timeout()
+		}
+		if override, ok := TimeoutFromContext(ctx); ok {
+			budget = override
+			ctx = contextWithoutTimeout(ctx)
+		}
+		streamCtx := ctx
+		if budget > 0 {
+			var cancel context.CancelFunc
+			streamCtx, cancel = context.WithTimeout(ctx, budget)
+			defer cancel()
+		}
+		for item, err := range adapter.Stream(streamCtx, req) {
+			if err != nil && errors.Is(streamCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+				err = fmt.Errorf("%w after %s for req type: %s: %w", ErrCommandTimeout, budget, adapter.ReqType(), context.DeadlineExceeded)
+			}
+			if !yield(item, err) {
+				return
+			}
+		}
+	}
+}
+
+// StreamTypeMap returns a mapping of streaming request types to the types of their items.
+//
+// Returns:
+//   - typeMap: A map associating streaming request types with their item types.
+func (r *DefaultHandlerCatalog) StreamTypeMap() (typeMap map[reflect.Type]reflect.Type) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	typeMap = make(map[reflect.Type]reflect.Type, len(r.streamAdapters))
+	for reqType, adapter := range r.streamAdapters {
+		typeMap[reqType] = adapter.ItemType()
+	}
+	return typeMap
+}
+
+// InsertStreamHandler is a generic function that catalogs a stream handler for a specific command request type.
+//
+// Type Parameters:
+//   - TReq: The type of the command request, which must implement the CommandReq interface.
+//   - TItem: The type of the items produced, which must implement the CommandRes interface.
+//
+// Parameters:
+//   - catalog: A pointer to the DefaultHandlerCatalog where the stream handler will be cataloged.
+//   - factory: A StreamHandlerFactory function that creates a new instance of a StreamHandler.
+//   - options: Options applied to the registration, such as WithLifetime or WithTimeout.
+func InsertStreamHandler[TReq CommandReq[TItem], TItem CommandRes](catalog *DefaultHandlerCatalog, factory StreamHandlerFactory[TReq, TItem], options ...HandlerOption) {
+	catalog.InsertStream(NewDefaultStreamAdapter(factory, options...))
+}
+
+// Stream processes a streaming command request using the cataloged stream handler.
+//
+// Type Parameters:
+//   - TReq: The type of the command request, which must implement the CommandReq interface.
+//   - TItem: The type of the items produced, which must implement the CommandRes interface.
+//
+// Parameters:
+//   - ctx: A context.Context providing context for the request processing; ending it stops the stream.
+//   - catalog: The StreamCatalog containing the cataloged stream handlers.
+//   - req: A TReq representing the command request to be processed.
+//
+// Returns:
+//   - A sequence of the items produced, yielding an error wrapping ErrInvalidResType for an item
+//     of an unexpected type.
+func Stream[TReq CommandReq[TItem], TItem CommandRes](ctx context.Context, catalog StreamCatalog, req TReq) iter.Seq2[TItem, error] {
+	return func(yield func(TItem, error) bool) {
+		for item, err := range catalog.Stream(ctx, req) {
+			if err != nil {
+				if !yield(*new(TItem), err) {
+					return
+				}
+				continue
+			}
+			typedItem, ok := item.(TItem)
+			if !ok {
+				yield(*new(TItem), fmt.Errorf("%w %T was unexpected for %T", ErrInvalidResType, item, typedItem))
+				return
+			}
+			if !yield(typedItem, nil) {
+				return
+			}
+		}
+	}
+}
+
+// StreamChan runs a sequence in its own goroutine and delivers its items over a channel, for
+// consumers that select over several sources.
+//
+// Type Parameters:
+//   - TItem: The type of the items.
+//
+// Parameters:
+//   - ctx: A context.Context; once it ends, the sequence is stopped and the channel closed.
+//   - seq: The sequence to run, such as one returned by Stream.
+//
+// Returns:
+//   - A channel of util.Tuple2 where Val1 is an item and Val2 an error, closed once the sequence completes.
+func StreamChan[TItem any](ctx context.Context, seq iter.Seq2[TItem, error]) <-chan util.Tuple2[TItem, error] {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	items := make(chan util.Tuple2[TItem, error])
+	go func() {
+		defer close(items)
+		for item, err := range seq {
+			select {
+			case items <- util.Tuple2[TItem, error]{Val1: item, Val2: err}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return items
+}
@@ -0,0 +1,329 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// collect drains a sequence into its items and the first error it yields.
+func collect[TItem any](seq func(yield func(TItem, error) bool)) (items []TItem, err error) {
+	for item, itemErr := range seq {
+		if itemErr != nil {
+			return items, itemErr
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func newStreamCatalog(options ...HandlerOption) (*DefaultHandlerCatalog, *RangeHandler) {
+	handler := &RangeHandler{}
+	catalog := NewDefaultHandlerCatalog()
+	InsertStreamHandler[RangeCommandReq, RangeCommandItem](catalog, func() StreamHandler[RangeCommandReq, RangeCommandItem] {
+		return handler
+	}, options...)
+	return catalog, handler
+}
+
+func Test_DefaultStreamAdapter_Stream(t *testing.T) {
+	adapter := NewDefaultStreamAdapter(func() StreamHandler[RangeCommandReq, RangeCommandItem] {
+		return &RangeHandler{}
+	})
+	assert.Equal(t, reflect.TypeFor[RangeCommandReq](), adapter.ReqType())
+	assert.Equal(t, reflect.TypeFor[RangeCommandItem](), adapter.ItemType())
+	assert.Equal(t, LifetimeSingleton, adapter.Lifetime())
+
+	t.Run("valid req", func(t *testing.T) {
+		items, err := collect(adapter.Stream(nil, RangeCommandReq{To: 3}))
+		assert.NoError(t, err)
+		assert.Equal(t, []CommandRes{RangeCommandItem{Value: 1}, RangeCommandItem{Value: 2}, RangeCommandItem{Value: 3}}, items)
+	})
+
+	t.Run("invalid req", func(t *testing.T) {
+		items, err := collect(adapter.Stream(nil, AddCommandReq{}))
+		assert.Error(t, err)
+		assert.Empty(t, items)
+	})
+
+	t.Run("handler failure", func(t *testing.T) {
+		items, err := collect(adapter.Stream(nil, RangeCommandReq{To: 3, FailAt: 2}))
+		assert.EqualError(t, err, "range failure")
+		assert.Equal(t, []CommandRes{RangeCommandItem{Value: 1}}, items)
+	})
+}
+
+func Test_DefaultStreamAdapter_Lifetime(t *testing.T) {
+	t.Run("transient", func(t *testing.T) {
+		handlers := make([]*RangeHandler, 0)
+		adapter := NewDefaultStreamAdapter(func() StreamHandler[RangeCommandReq, RangeCommandItem] {
+			handler := &RangeHandler{}
+			handlers = append(handlers, handler)
+			return handler
+		}, WithLifetime(LifetimeTransient))
+
+		_, err := collect(adapter.Stream(nil, RangeCommandReq{To: 2}))
+		assert.NoError(t, err)
+		for range adapter.Stream(nil, RangeCommandReq{To: 2}) {
+			break
+		}
+		assert.Len(t, handlers, 2)
+		assert.Equal(t, 1, handlers[0].disposed)
+		assert.Equal(t, 1, handlers[1].disposed)
+	})
+
+	t.Run("scoped", func(t *testing.T) {
+		adapter := NewDefaultStreamAdapter(func() StreamHandler[RangeCommandReq, RangeCommandItem] {
+			return &RangeHandler{}
+		}, WithLifetime(LifetimeScoped))
+
+		_, err := collect(adapter.Stream(nil, RangeCommandReq{To: 1}))
+		assert.ErrorIs(t, err, ErrScopeMissing)
+
+		ctx, scope := NewScope(context.Background())
+		items, err := collect(adapter.Stream(ctx, RangeCommandReq{To: 1}))
+		assert.NoError(t, err)
+		assert.Len(t, items, 1)
+
+		assert.NoError(t, scope.Close())
+		_, err = collect(adapter.Stream(ctx, RangeCommandReq{To: 1}))
+		assert.ErrorIs(t, err, ErrScopeClosed)
+	})
+}
+
+func Test_HandlerCatalog_InsertStream(t *testing.T) {
+	catalog := DefaultHandlerCatalog{}
+	assert.False(t, catalog.IsStream(reflect.TypeFor[RangeCommandReq]()))
+	catalog.InsertStream(NewDefaultStreamAdapter(func() StreamHandler[RangeCommandReq, RangeCommandItem] {
+		return &RangeHandler{}
+	}))
+	assert.True(t, catalog.IsStream(reflect.TypeFor[RangeCommandReq]()))
+	assert.Equal(t, map[reflect.Type]reflect.Type{reflect.TypeFor[RangeCommandReq](): reflect.TypeFor[RangeCommandItem]()}, catalog.StreamTypeMap())
+	assert.Empty(t, catalog.TypeMap())
+}
+
+func Test_HandlerCatalog_Stream(t *testing.T) {
+	t.Run("valid req", func(t *testing.T) {
+		catalog, _ := newStreamCatalog()
+		items, err := collect(catalog.Stream(nil, RangeCommandReq{To: 2}))
+		assert.NoError(t, err)
+		assert.Equal(t, []CommandRes{RangeCommandItem{Value: 1}, RangeCommandItem{Value: 2}}, items)
+	})
+
+	t.Run("handler missing", func(t *testing.T) {
+		catalog, _ := newStreamCatalog()
+		items, err := collect(catalog.Stream(nil, AddCommandReq{}))
+		assert.ErrorIs(t, err, ErrHandlerMissing)
+		assert.Empty(t, items)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		catalog, _ := newStreamCatalog()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		items := make([]CommandRes, 0)
+		var err error
+		for item, itemErr := range catalog.Stream(ctx, RangeCommandReq{To: 5}) {
+			if itemErr != nil {
+				err = itemErr
+				break
+			}
+			items = append(items, item)
+			if len(items) == 2 {
+				cancel()
+			}
+		}
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.NotErrorIs(t, err, ErrCommandTimeout)
+		assert.Len(t, items, 2)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		catalog, _ := newStreamCatalog(WithTimeout(20 * time.Millisecond))
+		assert.Equal(t, 20*time.Millisecond, catalog.Timeout(reflect.TypeFor[RangeCommandReq]()))
+		items := 0
+		var err error
+		for _, itemErr := range catalog.Stream(nil, RangeCommandReq{To: 100}) {
+			if itemErr != nil {
+				err = itemErr
+				break
+			}
+			items++
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.ErrorIs(t, err, ErrCommandTimeout)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, items, 100)
+	})
+
+	t.Run("default timeout does not apply", func(t *testing.T) {
+		catalog := NewDefaultHandlerCatalog(WithDefaultTimeout(time.Nanosecond))
+		InsertStreamHandler[RangeCommandReq, RangeCommandItem](catalog, func() StreamHandler[RangeCommandReq, RangeCommandItem] {
+			return &RangeHandler{}
+		})
+		assert.Zero(t, catalog.Timeout(reflect.TypeFor[RangeCommandReq]()))
+		items, err := collect(catalog.Stream(nil, RangeCommandReq{To: 3}))
+		assert.NoError(t, err)
+		assert.Len(t, items, 3)
+	})
+
+	t.Run("interceptors", func(t *testing.T) {
+		catalog, _ := newStreamCatalog()
+		mappingCatalog := NewMappingCatalog()
+		InsertMapping[RangeCommandReq](mappingCatalog, "range")
+		WithMappingCatalog(mappingCatalog)(catalog)
+		var seen InterceptorInfo
+		outcomes := make([]error, 0)
+		catalog.Use(func(ctx context.Context, info InterceptorInfo, req CommandReq[CommandRes], next Invoker) (CommandRes, error) {
+			seen = info
+			res, err := next(ctx, req)
+			outcomes = append(outcomes, err)
+			return res, err
+		})
+		items, err := collect(catalog.Stream(nil, RangeCommandReq{To: 2}))
+		assert.NoError(t, err)
+		assert.Len(t, items, 2)
+		assert.Equal(t, InterceptorInfo{
+			ReqType: reflect.TypeFor[RangeCommandReq](),
+			ResType: reflect.TypeFor[RangeCommandItem](),
+			ReqName: "range",
+			Stream:  true,
+		}, seen)
+
+		items, err = collect(catalog.Stream(nil, RangeCommandReq{To: 3, FailAt: 2}))
+		assert.EqualError(t, err, "range failure")
+		assert.Len(t, items, 1)
+		assert.Len(t, outcomes, 2)
+		assert.NoError(t, outcomes[0])
+		assert.EqualError(t, outcomes[1], "range failure")
+	})
+
+	t.Run("interceptor rejects", func(t *testing.T) {
+		catalog, handler := newStreamCatalog(WithLifetime(LifetimeTransient))
+		errDenied := errors.New("denied")
+		InsertInterceptor[RangeCommandReq](catalog, func(ctx context.Context, info InterceptorInfo, req CommandReq[CommandRes], next Invoker) (CommandRes, error) {
+			return nil, errDenied
+		})
+		yielded := 0
+		for _, itemErr := range catalog.Stream(nil, RangeCommandReq{To: 3}) {
+			yielded++
+			assert.ErrorIs(t, itemErr, errDenied)
+		}
+		assert.Equal(t, 1, yielded)
+		assert.Zero(t, handler.disposed)
+	})
+
+	t.Run("interceptor wraps failure", func(t *testing.T) {
+		catalog, _ := newStreamCatalog()
+		errWrapped := errors.New("wrapped")
+		catalog.Use(func(ctx context.Context, info InterceptorInfo, req CommandReq[CommandRes], next Invoker) (CommandRes, error) {
+			if _, err := next(ctx, req); err != nil {
+				return nil, fmt.Errorf("%w: %w", errWrapped, err)
+			}
+			return nil, nil
+		})
+		errs := make([]error, 0)
+		for _, itemErr := range catalog.Stream(nil, RangeCommandReq{To: 3, FailAt: 1}) {
+			errs = append(errs, itemErr)
+		}
+		assert.Len(t, errs, 1)
+		assert.EqualError(t, errs[0], "range failure")
+	})
+
+	t.Run("consumer stops", func(t *testing.T) {
+		catalog, _ := newStreamCatalog()
+		var outcome error
+		calls := 0
+		catalog.Use(func(ctx context.Context, info InterceptorInfo, req CommandReq[CommandRes], next Invoker) (CommandRes, error) {
+			calls++
+			_, outcome = next(ctx, req)
+			_, _ = next(ctx, req)
+			return nil, errors.New("after stop")
+		})
+		for range catalog.Stream(nil, RangeCommandReq{To: 5}) {
+			break
+		}
+		assert.Equal(t, 1, calls)
+		assert.NoError(t, outcome)
+	})
+}
+
+func Test_Stream(t *testing.T) {
+	catalog, _ := newStreamCatalog()
+
+	t.Run("valid req", func(t *testing.T) {
+		items, err := collect(Stream[RangeCommandReq, RangeCommandItem](nil, catalog, RangeCommandReq{To: 3}))
+		assert.NoError(t, err)
+		assert.Equal(t, []RangeCommandItem{{Value: 1}, {Value: 2}, {Value: 3}}, items)
+	})
+
+	t.Run("handler failure", func(t *testing.T) {
+		items, err := collect(Stream[RangeCommandReq, RangeCommandItem](nil, catalog, RangeCommandReq{To: 3, FailAt: 3}))
+		assert.EqualError(t, err, "range failure")
+		assert.Equal(t, []RangeCommandItem{{Value: 1}, {Value: 2}}, items)
+	})
+
+	t.Run("invalid item type", func(t *testing.T) {
+		items, err := collect(Stream[RangeCommandReq, AddCommandRes](nil, catalog, RangeCommandReq{To: 3}))
+		assert.ErrorIs(t, err, ErrInvalidResType)
+		assert.Empty(t, items)
+	})
+}
+
+func Test_StreamChan(t *testing.T) {
+	catalog, _ := newStreamCatalog()
+
+	t.Run("drained", func(t *testing.T) {
+		values := make([]int, 0)
+		for tup := range StreamChan(nil, Stream[RangeCommandReq, RangeCommandItem](nil, catalog, RangeCommandReq{To: 3})) {
+			assert.NoError(t, tup.Val2)
+			values = append(values, tup.Val1.Value)
+		}
+		assert.Equal(t, []int{1, 2, 3}, values)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		items := StreamChan(ctx, Stream[RangeCommandReq, RangeCommandItem](ctx, catalog, RangeCommandReq{To: 1000}))
+		<-items
+		cancel()
+		count := 0
+		for range items {
+			count++
+		}
+		assert.Less(t, count, 1000)
+	})
+}
+
+func Test_Dispatcher_Stream(t *testing.T) {
+	catalog, _ := newStreamCatalog()
+	mappingCatalog := NewMappingCatalog()
+	InsertMapping[RangeCommandReq](mappingCatalog, "range")
+	decoderCatalog := NewDefaultDecoderCatalog()
+	InsertDecoder[RangeCommandReq](decoderCatalog, DefaultDecoder[RangeCommandReq]())
+
+	t.Run("valid req", func(t *testing.T) {
+		dispatcher := NewDispatcher(mappingCatalog, decoderCatalog, catalog)
+		items, err := collect(dispatcher.Stream(nil, "range", json.RawMessage(`{"to": 2}`)))
+		assert.NoError(t, err)
+		assert.Equal(t, []CommandRes{RangeCommandItem{Value: 1}, RangeCommandItem{Value: 2}}, items)
+	})
+
+	t.Run("mapping missing", func(t *testing.T) {
+		dispatcher := NewDispatcher(mappingCatalog, decoderCatalog, catalog)
+		_, err := collect(dispatcher.Stream(nil, "missing", nil))
+		assert.ErrorIs(t, err, ErrMappingMissing)
+	})
+
+	t.Run("catalog without streams", func(t *testing.T) {
+		dispatcher := NewDispatcher(mappingCatalog, decoderCatalog, struct{ HandlerCatalog }{catalog})
+		_, err := collect(dispatcher.Stream(nil, "range", json.RawMessage(`{"to": 2}`)))
+		assert.ErrorIs(t, err, ErrHandlerMissing)
+	})
+}
@@ -0,0 +1,112 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+var (
+	ErrCommandTimeout = errors.New("command timeout")
+)
+
+// TimeoutCatalog is an optional interface for catalogs that enforce a timeout per request type,
+// allowing transports to advertise the budget of each command.
+type TimeoutCatalog interface {
+	Timeout(reqType reflect.Type) time.Duration
+}
+
+type timeoutKey struct{}
+
+// ContextWithTimeout returns a context.Context overriding the timeout configured for the
+// command dispatched with it. Transports use it to apply a budget requested by the caller.
+// The override is removed from the context passed to the handler, so the commands the handler
+// dispatches in turn keep their own timeouts, within the deadline of the handler.
+//
+// Parameters:
+//   - ctx: The parent context.Context.
+//   - timeout: The timeout to apply instead of the configured one, or 0 to disable it.
+//
+// Returns:
+//   - A context.Context carrying the override.
+func ContextWithTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, timeoutKey{}, timeout)
+}
+
+// TimeoutFromContext returns the timeout override carried by a context.Context.
+//
+// Parameters:
+//   - ctx: The context.Context to inspect.
+//
+// Returns:
+//   - timeout: The timeout override carried by ctx.
+//   - ok: Whether ctx carries an override.
+func TimeoutFromContext(ctx context.Context) (timeout time.Duration, ok bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	timeout, ok = ctx.Value(timeoutKey{}).(time.Duration)
+	return timeout, ok
+}
+
+// contextWithoutTimeout returns a context.Context that no longer carries a timeout override.
+func contextWithoutTimeout(ctx context.Context) context.Context {
+	if _, ok := TimeoutFromContext(ctx); !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, timeoutKey{}, nil)
+}
+
+// WithTimeout returns an option that sets the timeout of a registered handler,
+// overriding the default timeout of the catalog.
+//
+// Parameters:
+//   - timeout: The maximum duration of a single call to the handler.
+func WithTimeout(timeout time.Duration) HandlerOption {
+	return func(options *HandlerOptions) {
+		options.Timeout = timeout
+	}
+}
+
+// WithDefaultTimeout returns an option that sets the timeout applied by a DefaultHandlerCatalog
+// to request types registered without one.
+//
+// Parameters:
+//   - timeout: The maximum duration of a single call to a handler, or 0 for no timeout.
+func WithDefaultTimeout(timeout time.Duration) NewDefaultHandlerCatalogOption {
+	return func(catalog *DefaultHandlerCatalog) {
+		catalog.defaultTimeout = timeout
+	}
+}
+
+// timeoutInvoker wraps an Invoker so that it runs with a child context expiring after timeout,
+// or after the override set with ContextWithTimeout, which the child context no longer carries.
+// If the handler fails because that child context expired, the error wraps ErrCommandTimeout
+// and context.DeadlineExceeded.
+func timeoutInvoker(reqType reflect.Type, timeout time.Duration, invoker Invoker) Invoker {
+	return func(ctx context.Context, req CommandReq[CommandRes]) (res CommandRes, err error) {
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		budget := timeout
+		if override, ok := TimeoutFromContext(ctx); ok {
+			budget = override
+			ctx = contextWithoutTimeout(ctx)
+		}
+		if budget <= 0 {
+			return invoker(ctx, req)
+		}
+		timeoutCtx, cancel := context.WithTimeout(ctx, budget)
+		defer cancel()
+		res, err = invoker(timeoutCtx, req)
+		if err != nil && errors.Is(timeoutCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+			return res, fmt.Errorf("%w after %s for req type: %s: %w", ErrCommandTimeout, budget, reqType, context.DeadlineExceeded)
+		}
+		return res, err
+	}
+}
@@ -0,0 +1,103 @@
+package commands
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newSlowCatalog(options ...HandlerOption) *DefaultHandlerCatalog {
+	catalog := NewDefaultHandlerCatalog(WithDefaultTimeout(time.Second))
+	InsertHandler[SlowCommandReq, SlowCommandRes](catalog, func() Handler[SlowCommandReq, SlowCommandRes] {
+		return &SlowHandler{}
+	}, options...)
+	return catalog
+}
+
+func Test_ContextWithTimeout(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		timeout, ok := TimeoutFromContext(context.Background())
+		assert.False(t, ok)
+		assert.Zero(t, timeout)
+	})
+
+	t.Run("with timeout", func(t *testing.T) {
+		timeout, ok := TimeoutFromContext(ContextWithTimeout(nil, time.Second))
+		assert.True(t, ok)
+		assert.Equal(t, time.Second, timeout)
+	})
+}
+
+func Test_DefaultHandlerCatalog_Timeout(t *testing.T) {
+	reqType := reflect.TypeFor[SlowCommandReq]()
+
+	t.Run("default", func(t *testing.T) {
+		catalog := NewDefaultHandlerCatalog()
+		assert.Zero(t, catalog.Timeout(reqType))
+	})
+
+	t.Run("catalog default", func(t *testing.T) {
+		catalog := newSlowCatalog()
+		assert.Equal(t, time.Second, catalog.Timeout(reqType))
+	})
+
+	t.Run("handler timeout", func(t *testing.T) {
+		catalog := newSlowCatalog(WithTimeout(150 * time.Millisecond))
+		assert.Equal(t, 150*time.Millisecond, catalog.Timeout(reqType))
+	})
+}
+
+func Test_HandlerCatalog_Handle_Timeout(t *testing.T) {
+	t.Run("within timeout", func(t *testing.T) {
+		catalog := newSlowCatalog(WithTimeout(500 * time.Millisecond))
+		res, err := Handle[SlowCommandReq, SlowCommandRes](nil, catalog, SlowCommandReq{Name: "A", Iter: 1})
+		assert.NoError(t, err)
+		assert.Equal(t, "A", res.Name)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		catalog := newSlowCatalog(WithTimeout(150 * time.Millisecond))
+		_, err := Handle[SlowCommandReq, SlowCommandRes](nil, catalog, SlowCommandReq{Name: "A", Iter: 5})
+		assert.ErrorIs(t, err, ErrCommandTimeout)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("override", func(t *testing.T) {
+		catalog := newSlowCatalog(WithTimeout(150 * time.Millisecond))
+		ctx := ContextWithTimeout(context.Background(), time.Second)
+		_, err := Handle[SlowCommandReq, SlowCommandRes](ctx, catalog, SlowCommandReq{Name: "A", Iter: 3})
+		assert.NoError(t, err)
+	})
+
+	t.Run("override disabled", func(t *testing.T) {
+		catalog := newSlowCatalog(WithTimeout(150 * time.Millisecond))
+		ctx := ContextWithTimeout(context.Background(), 0)
+		_, err := Handle[SlowCommandReq, SlowCommandRes](ctx, catalog, SlowCommandReq{Name: "A", Iter: 3})
+		assert.NoError(t, err)
+	})
+
+	t.Run("override not inherited", func(t *testing.T) {
+		for _, override := range []time.Duration{time.Second, 0} {
+			catalog := newSlowCatalog(WithTimeout(150 * time.Millisecond))
+			InsertHandler[NestedCommandReq, NestedCommandRes](catalog, func() Handler[NestedCommandReq, NestedCommandRes] {
+				return &NestedHandler{catalog: catalog}
+			})
+			ctx := ContextWithTimeout(context.Background(), override)
+			_, err := Handle[NestedCommandReq, NestedCommandRes](ctx, catalog, NestedCommandReq{Inner: SlowCommandReq{Name: "A", Iter: 3}})
+			assert.ErrorIs(t, err, ErrCommandTimeout)
+			assert.Contains(t, err.Error(), "150ms")
+		}
+	})
+
+	t.Run("caller deadline", func(t *testing.T) {
+		catalog := newSlowCatalog()
+		ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+		defer cancel()
+		_, err := Handle[SlowCommandReq, SlowCommandRes](ctx, catalog, SlowCommandReq{Name: "A", Iter: 5})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.NotErrorIs(t, err, ErrCommandTimeout)
+	})
+}
@@ -0,0 +1,355 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrValidationFailure = errors.New("validation failure")
+)
+
+const (
+	// ValidateTag is the struct tag key holding the validation rules of a request field.
+	//
+	// Rules are separated by commas, for example `validate:"required,min=1,max=10"`.
+	// The supported rules are:
+	//   - required: The field must not be the zero value.
+	//   - min=N, max=N: Numbers must be at least or at most N; strings, slices and maps
+	//     must have a length of at least or at most N.
+	//   - len=N: Strings, slices and maps must have a length of exactly N.
+	//   - enum=A|B|C: The field must be formatted as one of the listed values.
+	//   - pattern=RE: Strings must match the regular expression RE. Because RE may contain
+	//     commas, the pattern rule must be the last rule in the tag.
+	//
+	// Any other rule is reported as a violation, so a misspelled rule never passes silently.
+	ValidateTag = "validate"
+
+	RuleRequired = "required"
+	RuleMin      = "min"
+	RuleMax      = "max"
+	RuleLen      = "len"
+	RuleEnum     = "enum"
+	RulePattern  = "pattern"
+)
+
+// ValidationRule is a single rule parsed from a ValidateTag.
+//
+// Fields:
+//   - Name: The name of the rule, such as RuleRequired or RuleMin.
+//   - Value: The argument of the rule, or an empty string if the rule takes none.
+type ValidationRule struct {
+	Name  string
+	Value string
+}
+
+// FieldError describes a single validation rule violated by a request.
+//
+// Fields:
+//   - Field: The dotted JSON path of the violating field, or an empty string if
+//     the violation applies to the request as a whole.
+//   - Rule: The name of the violated rule.
+//   - Message: A human-readable description of the violation.
+type FieldError struct {
+	Field   string `json:"field,omitempty"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Error returns a human-readable description of the FieldError.
+func (e FieldError) Error() string {
+	if e.Field == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// ValidationError is returned when a request violates one or more validation rules.
+// It wraps ErrValidationFailure and lists every violation so transports can report them all.
+//
+// Fields:
+//   - Fields: The violations found on the request.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// Error returns a human-readable description of the ValidationError.
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Error()
+	}
+	return fmt.Sprintf("%s: %s", ErrValidationFailure, strings.Join(messages, "; "))
+}
+
+// Unwrap returns ErrValidationFailure, allowing errors.Is to match a ValidationError.
+func (e *ValidationError) Unwrap() error {
+	return ErrValidationFailure
+}
+
+// Validatable is an optional interface for command requests that validate themselves.
+// Validate is called after the struct tag rules have been checked. Returning a
+// *ValidationError contributes its field errors; any other error is reported as a
+// violation of the request as a whole.
+type Validatable interface {
+	Validate() error
+}
+
+// Validator is a function type that validates a decoded command request.
+type Validator func(req CommandReq[CommandRes]) error
+
+// ValidationRules parses the validation rules held by the ValidateTag of a struct tag.
+//
+// Parameters:
+//   - tag: The reflect.StructTag of a request field.
+//
+// Returns:
+//   - rules: The parsed rules, in the order they appear in the tag.
+func ValidationRules(tag reflect.StructTag) (rules []ValidationRule) {
+	value, ok := tag.Lookup(ValidateTag)
+	if !ok || value == "" {
+		return nil
+	}
+	parts := strings.Split(value, ",")
+	for i := 0; i < len(parts); i++ {
+		name, arg, _ := strings.Cut(parts[i], "=")
+		name = strings.TrimSpace(name)
+		if name == RulePattern {
+			arg = strings.Join(append([]string{arg}, parts[i+1:]...), ",")
+			i = len(parts)
+		}
+		if name != "" {
+			rules = append(rules, ValidationRule{Name: name, Value: arg})
+		}
+	}
+	return rules
+}
+
+// Validate checks a command request against the ValidateTag rules of its fields,
+// including the fields of nested structs and of the structs held by slices and arrays,
+// and then against its Validate method if it implements Validatable. The elements of a
+// slice or array are named by their index in the path, such as "items.0.name".
+//
+// Parameters:
+//   - req: A CommandReq[CommandRes] representing the command request to validate.
+//
+// Returns:
+//   - A *ValidationError listing every violation, or nil if the request is valid.
+func Validate(req CommandReq[CommandRes]) error {
+	value := reflect.ValueOf(req)
+	if !value.IsValid() {
+		return nil
+	}
+	fieldErrors := validateValue(value, "", nil)
+	if validatable, ok := asValidatable(value); ok {
+		if err := validatable.Validate(); err != nil {
+			var validationErr *ValidationError
+			if errors.As(err, &validationErr) {
+				fieldErrors = append(fieldErrors, validationErr.Fields...)
+			} else {
+				fieldErrors = append(fieldErrors, FieldError{Rule: "validate", Message: err.Error()})
+			}
+		}
+	}
+	if len(fieldErrors) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: fieldErrors}
+}
+
+func asValidatable(value reflect.Value) (Validatable, bool) {
+	if validatable, ok := value.Interface().(Validatable); ok {
+		return validatable, true
+	}
+	if value.Kind() != reflect.Pointer {
+		pointer := reflect.New(value.Type())
+		pointer.Elem().Set(value)
+		validatable, ok := pointer.Interface().(Validatable)
+		return validatable, ok
+	}
+	return nil, false
+}
+
+func validateValue(value reflect.Value, path string, fieldErrors []FieldError) []FieldError {
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return fieldErrors
+		}
+		value = value.Elem()
+	}
+	if value.Kind() == reflect.Slice || value.Kind() == reflect.Array {
+		if !holdsStructs(value.Type().Elem()) {
+			return fieldErrors
+		}
+		for i := 0; i < value.Len(); i++ {
+			fieldErrors = validateValue(value.Index(i), joinPath(path, strconv.Itoa(i)), fieldErrors)
+		}
+		return fieldErrors
+	}
+	if value.Kind() != reflect.Struct {
+		return fieldErrors
+	}
+	valueType := value.Type()
+	for i := 0; i < valueType.NumField(); i++ {
+		field := valueType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fieldPath := path
+		if !field.Anonymous {
+			fieldName := FieldName(field)
+			if fieldName == "" {
+				continue
+			}
+			fieldPath = joinPath(path, fieldName)
+		}
+		fieldValue := value.Field(i)
+		for _, rule := range ValidationRules(field.Tag) {
+			if message, ok := checkRule(rule, fieldValue); !ok {
+				fieldErrors = append(fieldErrors, FieldError{Field: fieldPath, Rule: rule.Name, Message: message})
+			}
+		}
+		fieldErrors = validateValue(fieldValue, fieldPath, fieldErrors)
+	}
+	return fieldErrors
+}
+
+// FieldName returns the name a struct field is encoded as in JSON, or an empty
+// string if the field is excluded from encoding.
+//
+// Parameters:
+//   - field: The reflect.StructField to name.
+//
+// Returns:
+//   - The JSON name of the field.
+func FieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return field.Name
+	default:
+		return name
+	}
+}
+
+// holdsStructs reports whether values of elemType may hold a struct to validate, sparing the
+// elements of slices of scalars from being visited.
+func holdsStructs(elemType reflect.Type) bool {
+	for elemType.Kind() == reflect.Pointer {
+		elemType = elemType.Elem()
+	}
+	switch elemType.Kind() {
+	case reflect.Struct, reflect.Interface, reflect.Slice, reflect.Array:
+		return true
+	default:
+		return false
+	}
+}
+
+func joinPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func checkRule(rule ValidationRule, value reflect.Value) (message string, ok bool) {
+	if rule.Name == RuleRequired {
+		return "is required", !value.IsZero()
+	}
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return "", true
+		}
+		value = value.Elem()
+	}
+	switch rule.Name {
+	case RuleMin, RuleMax, RuleLen:
+		limit, err := strconv.ParseFloat(rule.Value, 64)
+		if err != nil {
+			return fmt.Sprintf("has invalid %s rule %q", rule.Name, rule.Value), false
+		}
+		actual, isLength, measurable := measure(value)
+		if !measurable {
+			return "", true
+		}
+		return compareLimit(rule.Name, limit, actual, isLength)
+	case RuleEnum:
+		actual := fmt.Sprint(value.Interface())
+		options := strings.Split(rule.Value, "|")
+		for _, option := range options {
+			if actual == option {
+				return "", true
+			}
+		}
+		return fmt.Sprintf("must be one of %s", strings.Join(options, ", ")), false
+	case RulePattern:
+		if value.Kind() != reflect.String {
+			return "", true
+		}
+		pattern, err := compilePattern(rule.Value)
+		if err != nil {
+			return fmt.Sprintf("has invalid pattern rule %q", rule.Value), false
+		}
+		return fmt.Sprintf("must match pattern %s", rule.Value), pattern.MatchString(value.String())
+	default:
+		return fmt.Sprintf("has unknown rule %q", rule.Name), false
+	}
+}
+
+func measure(value reflect.Value) (actual float64, isLength bool, measurable bool) {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), false, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(value.Uint()), false, true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), false, true
+	case reflect.String:
+		return float64(len([]rune(value.String()))), true, true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(value.Len()), true, true
+	default:
+		return 0, false, false
+	}
+}
+
+func compareLimit(name string, limit float64, actual float64, isLength bool) (message string, ok bool) {
+	subject := "be"
+	if isLength {
+		subject = "have a length of"
+	}
+	formatted := strconv.FormatFloat(limit, 'f', -1, 64)
+	switch name {
+	case RuleMin:
+		return fmt.Sprintf("must %s at least %s", subject, formatted), actual >= limit
+	case RuleMax:
+		return fmt.Sprintf("must %s at most %s", subject, formatted), actual <= limit
+	default:
+		if !isLength {
+			return "", true
+		}
+		return fmt.Sprintf("must %s exactly %s", subject, formatted), actual == limit
+	}
+}
+
+var patternCache sync.Map
+
+func compilePattern(expr string) (*regexp.Regexp, error) {
+	if cached, ok := patternCache.Load(expr); ok {
+		return cached.(*regexp.Regexp), nil
+	}
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	patternCache.Store(expr, pattern)
+	return pattern, nil
+}
@@ -0,0 +1,170 @@
+package commands
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type ValidInnerReq struct {
+	Code string `json:"code" validate:"len=3"`
+}
+
+type ValidListReq struct {
+	Items    []ValidInnerReq   `json:"items"`
+	Pointers []*ValidInnerReq  `json:"pointers"`
+	Fixed    [1]ValidInnerReq  `json:"fixed"`
+	Codes    []string          `json:"codes" validate:"max=1"`
+	Nested   [][]ValidInnerReq `json:"nested"`
+}
+
+type UnknownRuleCommandReq struct {
+	Name string `json:"name" validate:"requierd"`
+}
+
+type ValidCommandReq struct {
+	Name    string         `json:"name" validate:"required,min=2,max=8,pattern=^[a-z,]+$"`
+	Count   int            `json:"count" validate:"min=1,max=10"`
+	Kind    string         `json:"kind" validate:"enum=a|b"`
+	Tags    []string       `json:"tags" validate:"max=2"`
+	Inner   ValidInnerReq  `json:"inner"`
+	Pointer *ValidInnerReq `json:"pointer"`
+	Skipped string         `json:"-" validate:"required"`
+}
+
+type SelfValidCommandReq struct {
+	ArgX int `json:"argX"`
+	ArgY int `json:"argY"`
+}
+
+func (r *SelfValidCommandReq) Validate() error {
+	if r.ArgX > r.ArgY {
+		return &ValidationError{Fields: []FieldError{{Field: "argX", Rule: "lte", Message: "must not exceed argY"}}}
+	}
+	if r.ArgX == r.ArgY {
+		return errors.New("args must differ")
+	}
+	return nil
+}
+
+func Test_ValidationRules(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		rules := ValidationRules(`validate:"required,min=1,enum=a|b"`)
+		assert.Equal(t, []ValidationRule{{Name: "required"}, {Name: "min", Value: "1"}, {Name: "enum", Value: "a|b"}}, rules)
+	})
+
+	t.Run("pattern with commas", func(t *testing.T) {
+		rules := ValidationRules(`validate:"required,pattern=^a{1,3}$"`)
+		assert.Equal(t, []ValidationRule{{Name: "required"}, {Name: "pattern", Value: "^a{1,3}$"}}, rules)
+	})
+
+	t.Run("missing tag", func(t *testing.T) {
+		assert.Empty(t, ValidationRules(`json:"name"`))
+	})
+}
+
+func Test_Validate(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		err := Validate(ValidCommandReq{Name: "ab,c", Count: 1, Kind: "a", Inner: ValidInnerReq{Code: "abc"}})
+		assert.NoError(t, err)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		err := Validate(ValidCommandReq{
+			Count:   11,
+			Kind:    "c",
+			Tags:    []string{"x", "y", "z"},
+			Inner:   ValidInnerReq{Code: "ab"},
+			Pointer: &ValidInnerReq{Code: "abcd"},
+		})
+		assert.ErrorIs(t, err, ErrValidationFailure)
+		validationErr := &ValidationError{}
+		assert.ErrorAs(t, err, &validationErr)
+		fields := map[string]string{}
+		for _, field := range validationErr.Fields {
+			fields[field.Field+"/"+field.Rule] = field.Message
+		}
+		assert.Equal(t, map[string]string{
+			"name/required":    "is required",
+			"name/min":         "must have a length of at least 2",
+			"name/pattern":     "must match pattern ^[a-z,]+$",
+			"count/max":        "must be at most 10",
+			"kind/enum":        "must be one of a, b",
+			"tags/max":         "must have a length of at most 2",
+			"inner.code/len":   "must have a length of exactly 3",
+			"pointer.code/len": "must have a length of exactly 3",
+		}, fields)
+	})
+
+	t.Run("validatable", func(t *testing.T) {
+		assert.NoError(t, Validate(SelfValidCommandReq{ArgX: 1, ArgY: 2}))
+
+		validationErr := &ValidationError{}
+		assert.ErrorAs(t, Validate(SelfValidCommandReq{ArgX: 3, ArgY: 2}), &validationErr)
+		assert.Equal(t, []FieldError{{Field: "argX", Rule: "lte", Message: "must not exceed argY"}}, validationErr.Fields)
+
+		assert.ErrorAs(t, Validate(SelfValidCommandReq{ArgX: 2, ArgY: 2}), &validationErr)
+		assert.Equal(t, []FieldError{{Rule: "validate", Message: "args must differ"}}, validationErr.Fields)
+	})
+
+	t.Run("slices and arrays", func(t *testing.T) {
+		assert.NoError(t, Validate(ValidListReq{Fixed: [1]ValidInnerReq{{Code: "abc"}}}))
+
+		err := Validate(ValidListReq{
+			Items:    []ValidInnerReq{{Code: "abc"}, {Code: "ab"}},
+			Pointers: []*ValidInnerReq{nil, {Code: "abcd"}},
+			Fixed:    [1]ValidInnerReq{{Code: ""}},
+			Codes:    []string{"a", "b"},
+			Nested:   [][]ValidInnerReq{{{Code: "a"}}},
+		})
+		validationErr := &ValidationError{}
+		assert.ErrorAs(t, err, &validationErr)
+		fields := make([]string, 0)
+		for _, field := range validationErr.Fields {
+			fields = append(fields, field.Field+"/"+field.Rule)
+		}
+		assert.Equal(t, []string{"items.1.code/len", "pointers.1.code/len", "fixed.0.code/len", "codes/max", "nested.0.0.code/len"}, fields)
+	})
+
+	t.Run("unknown rule", func(t *testing.T) {
+		validationErr := &ValidationError{}
+		assert.ErrorAs(t, Validate(UnknownRuleCommandReq{Name: "a"}), &validationErr)
+		assert.Equal(t, []FieldError{{Field: "name", Rule: "requierd", Message: `has unknown rule "requierd"`}}, validationErr.Fields)
+	})
+
+	t.Run("untagged", func(t *testing.T) {
+		assert.NoError(t, Validate(AddCommandReq{}))
+	})
+}
+
+func Test_DecoderCatalog_Decode_Validation(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		catalog := NewDefaultDecoderCatalog()
+		InsertDecoder[ValidCommandReq](catalog, DefaultDecoder[ValidCommandReq]())
+		req, err := catalog.Decode(reflect.TypeFor[ValidCommandReq](), []byte(`{"count": 20}`))
+		assert.ErrorIs(t, err, ErrValidationFailure)
+		assert.NotErrorIs(t, err, ErrDecoderFailure)
+		assert.Nil(t, req)
+	})
+
+	t.Run("without validator", func(t *testing.T) {
+		catalog := NewDefaultDecoderCatalog(WithValidator(nil))
+		InsertDecoder[ValidCommandReq](catalog, DefaultDecoder[ValidCommandReq]())
+		req, err := catalog.Decode(reflect.TypeFor[ValidCommandReq](), []byte(`{"count": 20}`))
+		assert.NoError(t, err)
+		assert.Equal(t, ValidCommandReq{Count: 20}, req)
+	})
+
+	t.Run("custom validator", func(t *testing.T) {
+		errCustom := errors.New("custom")
+		catalog := NewDefaultDecoderCatalog(WithValidator(func(req CommandReq[CommandRes]) error {
+			return errCustom
+		}))
+		InsertDecoder[AddCommandReq](catalog, DefaultDecoder[AddCommandReq]())
+		_, err := catalog.Decode(reflect.TypeFor[AddCommandReq](), []byte(`{}`))
+		assert.ErrorIs(t, err, ErrValidationFailure)
+		assert.ErrorIs(t, err, errCustom)
+	})
+}
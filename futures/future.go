@@ -23,6 +23,31 @@ func (f *future[R]) Wait() R {
 	return f.result
 }
 
+// Promise is a Future whose result is provided explicitly by calling Resolve,
+// rather than computed by a function.
+type Promise[R any] struct {
+	future[R]
+	once sync.Once
+}
+
+// NewPromise creates an unresolved Promise. Calls to Wait block until Resolve is called.
+func NewPromise[R any]() *Promise[R] {
+	p := Promise[R]{}
+	p.waitGroup.Add(1)
+	return &p
+}
+
+// Resolve completes the Promise with the provided result, unblocking all calls to Wait.
+// Only the first call to Resolve has an effect; it reports whether it was that call.
+func (p *Promise[R]) Resolve(result R) (resolved bool) {
+	p.once.Do(func() {
+		p.result = result
+		p.waitGroup.Done()
+		resolved = true
+	})
+	return resolved
+}
+
 // Start begins a computation that runs the provided function fn in a separate goroutine.
 // The computation's result of type R can be retrieved by calling the Wait method on the returned Future.
 // The provided ctx is passed to the function fn to support context-aware operations.
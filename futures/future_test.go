@@ -41,6 +41,24 @@ func Test_Future_Wait(t *testing.T) {
 	})
 }
 
+func Test_Promise(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		p := NewPromise[string]()
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			p.Resolve(Result1)
+		}()
+		assert.Equal(t, Result1, p.Wait())
+	})
+
+	t.Run("resolve once", func(t *testing.T) {
+		p := NewPromise[string]()
+		assert.True(t, p.Resolve(Result1))
+		assert.False(t, p.Resolve(Result2))
+		assert.Equal(t, Result1, p.Wait())
+	})
+}
+
 func Test_RaceAll(t *testing.T) {
 	t.Run("default", func(t *testing.T) {
 		start := time.Now()
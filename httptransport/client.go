@@ -0,0 +1,270 @@
+package httptransport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dan-lugg/go-commands/commands"
+	"github.com/dan-lugg/go-commands/futures"
+	"github.com/dan-lugg/go-commands/middleware"
+	"github.com/dan-lugg/go-commands/util"
+)
+
+// RemoteError is returned by a Client when the remote Server responds with a non-2xx status.
+//
+// RemoteError matches the sentinel error of ErrorKinds named by the kind the Server reports,
+// so errors.Is(err, commands.ErrMappingMissing) holds when the remote request name is unknown,
+// but not for every 404 response, such as one written by a proxy.
+//
+// Fields:
+//   - StatusCode: The HTTP status code of the response.
+//   - Message: The error message reported by the remote Server.
+//   - Kind: The kind of the failure reported by the remote Server, if any.
+//   - Fields: The field-level violations reported by the remote Server, if any.
+//   - RetryAfter: The duration the remote Server asked to wait before retrying, if any.
+type RemoteError struct {
+	StatusCode int
+	Message    string
+	Kind       string
+	Fields     []commands.FieldError
+	RetryAfter time.Duration
+}
+
+// Error returns a human-readable description of the RemoteError.
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("remote error: status %d: %s", e.StatusCode, e.Message)
+}
+
+// Is reports whether the RemoteError corresponds to the target sentinel error.
+//
+// Parameters:
+//   - target: The error to compare against.
+//
+// Returns:
+//   - true if target is one of ErrorKinds and the kind of the RemoteError is its kind.
+func (e *RemoteError) Is(target error) bool {
+	if e.Kind == "" {
+		return false
+	}
+	for _, kind := range ErrorKinds {
+		if target == kind {
+			return e.Kind == kind.Error()
+		}
+	}
+	return false
+}
+
+// Client is a commands.HandlerCatalog that dispatches requests to a remote Server over HTTP.
+//
+// Request types are registered on the Client with Insert or InsertRemote, which records the
+// response type used to decode replies. The request path is resolved with the MappingCatalog,
+// so the generic commands.Handle and commands.Future helpers work unchanged against a Client.
+//
+// Fields:
+//   - baseURL: The URL the remote Server is mounted at.
+//   - httpClient: The *http.Client used to send requests.
+//   - mappingCatalog: The MappingCatalog used to resolve request types to names.
+//   - codec: The Codec requests and replies are serialized with.
+//   - resTypes: A map that associates request types with their response types.
+type Client struct {
+	mutex          sync.RWMutex
+	baseURL        string
+	httpClient     *http.Client
+	mappingCatalog commands.MappingCatalog
+	codec          commands.Codec
+	resTypes       map[reflect.Type]reflect.Type
+}
+
+type ClientOption = util.Option[*Client]
+
+// WithHTTPClient returns an option that sets the *http.Client used by a Client.
+//
+// Parameters:
+//   - httpClient: The *http.Client used to send requests.
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithCodec returns an option that sets the Codec a Client serializes requests and replies
+// with. The remote Server must have the codec cataloged. Without one, JSON is used.
+//
+// Parameters:
+//   - codec: The Codec requests and replies are serialized with.
+func WithCodec(codec commands.Codec) ClientOption {
+	return func(c *Client) {
+		c.codec = codec
+	}
+}
+
+// NewClient creates and returns a new instance of Client.
+//
+// Parameters:
+//   - baseURL: The URL the remote Server is mounted at.
+//   - mappingCatalog: The MappingCatalog used to resolve request types to names.
+//   - options: Options applied to the Client.
+//
+// Returns:
+//   - A pointer to a Client instance.
+func NewClient(baseURL string, mappingCatalog commands.MappingCatalog, options ...ClientOption) (client *Client) {
+	client = &Client{
+		mutex:          sync.RWMutex{},
+		baseURL:        strings.TrimRight(baseURL, "/"),
+		httpClient:     http.DefaultClient,
+		mappingCatalog: mappingCatalog,
+		codec:          commands.JSONCodec{},
+		resTypes:       make(map[reflect.Type]reflect.Type),
+	}
+	for _, option := range options {
+		option(client)
+	}
+	return client
+}
+
+// Insert registers the request and response types of a HandlerAdapter with the Client.
+// The adapter itself is never invoked.
+//
+// Parameters:
+//   - adapter: The HandlerAdapter whose types are registered.
+func (c *Client) Insert(adapter commands.HandlerAdapter) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.resTypes == nil {
+		c.resTypes = make(map[reflect.Type]reflect.Type)
+	}
+	c.resTypes[adapter.ReqType()] = adapter.ResType()
+}
+
+// InsertRemote is a generic function that registers a remote command with a Client.
+//
+// Type Parameters:
+//   - TReq: The type of the command request, which must implement the CommandReq interface.
+//   - TRes: The type of the command response, which must implement the CommandRes interface.
+//
+// Parameters:
+//   - client: A pointer to the Client where the command will be registered.
+func InsertRemote[TReq commands.CommandReq[TRes], TRes commands.CommandRes](client *Client) {
+	client.Insert(commands.NewDefaultHandlerAdapter[TReq, TRes](nil))
+}
+
+// Handle sends a command request to the remote Server and decodes the reply into
+// the registered response type. A timeout set on ctx with commands.ContextWithTimeout
+// is sent in the TimeoutHeader, and an idempotency key set with
+// middleware.ContextWithIdempotencyKey in the IdempotencyKeyHeader.
+//
+// Parameters:
+//   - ctx: A context.Context providing context for the request.
+//   - req: A CommandReq[CommandRes] representing the command request to be sent.
+//
+// Returns:
+//   - res: A CommandRes representing the decoded reply.
+//   - err: An error if the request type is not registered or mapped, the request fails,
+//     or the remote Server reports an error.
+func (c *Client) Handle(ctx context.Context, req commands.CommandReq[commands.CommandRes]) (res commands.CommandRes, err error) {
+	reqType := reflect.TypeOf(req)
+	c.mutex.RLock()
+	resType, found := c.resTypes[reqType]
+	c.mutex.RUnlock()
+	if !found {
+		return nil, fmt.Errorf("%w for req type: %s", commands.ErrHandlerMissing, reqType)
+	}
+
+	reqName, err := c.mappingCatalog.ByType(reqType)
+	if err != nil {
+		return nil, err
+	}
+
+	reqData, err := c.codec.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode req: %w", err)
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/%s", c.baseURL, reqName), bytes.NewReader(reqData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	request.Header.Set("Content-Type", c.codec.MediaType())
+	request.Header.Set("Accept", c.codec.MediaType())
+	if timeout, ok := commands.TimeoutFromContext(ctx); ok {
+		request.Header.Set(TimeoutHeader, timeout.String())
+	}
+	if key, ok := middleware.IdempotencyKeyFromContext(ctx); ok {
+		request.Header.Set(IdempotencyKeyHeader, key)
+	}
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer func() { _ = response.Body.Close() }()
+
+	resData, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		body := ErrorBody{}
+		if json.Unmarshal(resData, &body) != nil || body.Error == "" {
+			body.Error = strings.TrimSpace(string(resData))
+		}
+		remoteErr := &RemoteError{StatusCode: response.StatusCode, Message: body.Error, Kind: body.Kind, Fields: body.Fields}
+		if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil {
+			remoteErr.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		return nil, remoteErr
+	}
+
+	resValue := reflect.New(resType)
+	if err = c.codec.Unmarshal(resData, resValue.Interface()); err != nil {
+		return nil, fmt.Errorf("failed to decode res: %w", err)
+	}
+	return resValue.Elem().Interface(), nil
+}
+
+// Future creates a futures.Future that asynchronously sends a command request to the remote Server.
+//
+// Parameters:
+//   - ctx: A context.Context providing context for the request.
+//   - req: A CommandReq[CommandRes] representing the command request to be sent.
+//
+// Returns:
+//   - A futures.Future containing a util.Tuple2 where:
+//   - Val1 is the CommandRes representing the decoded reply.
+//   - Val2 is an error if the request fails.
+func (c *Client) Future(ctx context.Context, req commands.CommandReq[commands.CommandRes]) futures.Future[util.Tuple2[commands.CommandRes, error]] {
+	return futures.Start(ctx, func(ctx context.Context) util.Tuple2[commands.CommandRes, error] {
+		res, err := c.Handle(ctx, req)
+		return util.Tuple2[commands.CommandRes, error]{
+			Val1: res,
+			Val2: err,
+		}
+	})
+}
+
+// TypeMap returns a mapping of registered request types to their corresponding response types.
+//
+// Returns:
+//   - typeMap: A map associating request types with their corresponding response types.
+func (c *Client) TypeMap() (typeMap map[reflect.Type]reflect.Type) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	typeMap = make(map[reflect.Type]reflect.Type, len(c.resTypes))
+	for reqType, resType := range c.resTypes {
+		typeMap[reqType] = resType
+	}
+	return typeMap
+}
@@ -0,0 +1,176 @@
+package httptransport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dan-lugg/go-commands/codecs"
+	"github.com/dan-lugg/go-commands/commands"
+	"github.com/dan-lugg/go-commands/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRemote() (*Client, func()) {
+	mappingCatalog, decoderCatalog, handlerCatalog := newCatalogs()
+	httpServer := httptest.NewServer(NewServer(mappingCatalog, decoderCatalog, handlerCatalog))
+	client := NewClient(httpServer.URL+"/", mappingCatalog, WithHTTPClient(httpServer.Client()))
+	InsertRemote[AddCommandReq, AddCommandRes](client)
+	InsertRemote[SubCommandReq, SubCommandRes](client)
+	InsertRemote[FailCommandReq, FailCommandRes](client)
+	InsertRemote[WaitCommandReq, WaitCommandRes](client)
+	return client, httpServer.Close
+}
+
+func Test_NewClient(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		client := NewClient("http://localhost/", commands.NewMappingCatalog())
+		assert.NotNil(t, client)
+		assert.Equal(t, "http://localhost", client.baseURL)
+		assert.Equal(t, http.DefaultClient, client.httpClient)
+		assert.Equal(t, commands.JSONCodec{}, client.codec)
+	})
+
+	t.Run("with options", func(t *testing.T) {
+		httpClient := &http.Client{}
+		client := NewClient("http://localhost", commands.NewMappingCatalog(), WithHTTPClient(httpClient), WithCodec(codecs.YAML{}))
+		assert.Equal(t, httpClient, client.httpClient)
+		assert.Equal(t, codecs.YAML{}, client.codec)
+	})
+}
+
+func Test_Client_Handle(t *testing.T) {
+	client, closer := newRemote()
+	defer closer()
+
+	t.Run("default", func(t *testing.T) {
+		res, err := commands.Handle[AddCommandReq, AddCommandRes](nil, client, AddCommandReq{ArgX: 3, ArgY: 4})
+		assert.NoError(t, err)
+		assert.Equal(t, AddCommandRes{Result: 7}, res)
+	})
+
+	t.Run("not registered", func(t *testing.T) {
+		res, err := client.Handle(nil, struct{}{})
+		assert.ErrorIs(t, err, commands.ErrHandlerMissing)
+		assert.Nil(t, res)
+	})
+
+	t.Run("remote handler missing", func(t *testing.T) {
+		res, err := commands.Handle[SubCommandReq, SubCommandRes](nil, client, SubCommandReq{ArgX: 3, ArgY: 4})
+		assert.ErrorIs(t, err, commands.ErrHandlerMissing)
+		assert.Zero(t, res)
+		remoteErr := &RemoteError{}
+		assert.ErrorAs(t, err, &remoteErr)
+		assert.Equal(t, http.StatusNotImplemented, remoteErr.StatusCode)
+		assert.Equal(t, commands.ErrHandlerMissing.Error(), remoteErr.Kind)
+	})
+
+	t.Run("status without kind", func(t *testing.T) {
+		proxy := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			http.Error(writer, "no route", http.StatusNotFound)
+		}))
+		defer proxy.Close()
+		proxied := NewClient(proxy.URL, client.mappingCatalog, WithHTTPClient(proxy.Client()))
+		InsertRemote[AddCommandReq, AddCommandRes](proxied)
+
+		_, err := commands.Handle[AddCommandReq, AddCommandRes](nil, proxied, AddCommandReq{ArgX: 3, ArgY: 4})
+		remoteErr := &RemoteError{}
+		assert.ErrorAs(t, err, &remoteErr)
+		assert.Equal(t, http.StatusNotFound, remoteErr.StatusCode)
+		assert.Empty(t, remoteErr.Kind)
+		assert.NotErrorIs(t, err, commands.ErrMappingMissing)
+	})
+
+	t.Run("remote failure", func(t *testing.T) {
+		_, err := commands.Handle[FailCommandReq, FailCommandRes](nil, client, FailCommandReq{})
+		remoteErr := &RemoteError{}
+		assert.ErrorAs(t, err, &remoteErr)
+		assert.Equal(t, http.StatusInternalServerError, remoteErr.StatusCode)
+		assert.Equal(t, ErrFailure.Error(), remoteErr.Message)
+	})
+
+	t.Run("remote timeout", func(t *testing.T) {
+		_, err := commands.Handle[WaitCommandReq, WaitCommandRes](nil, client, WaitCommandReq{Duration: time.Second})
+		assert.ErrorIs(t, err, commands.ErrCommandTimeout)
+		remoteErr := &RemoteError{}
+		assert.ErrorAs(t, err, &remoteErr)
+		assert.Equal(t, http.StatusGatewayTimeout, remoteErr.StatusCode)
+	})
+
+	t.Run("timeout override", func(t *testing.T) {
+		ctx := commands.ContextWithTimeout(context.Background(), 10*time.Millisecond)
+		_, err := commands.Handle[WaitCommandReq, WaitCommandRes](ctx, client, WaitCommandReq{Duration: 30 * time.Millisecond})
+		assert.ErrorIs(t, err, commands.ErrCommandTimeout)
+	})
+}
+
+func Test_Client_Handle_Codec(t *testing.T) {
+	mappingCatalog, decoderCatalog, handlerCatalog := newCatalogs()
+	httpServer := httptest.NewServer(NewServer(mappingCatalog, decoderCatalog, handlerCatalog, WithCodecCatalog(codecs.NewCodecCatalog())))
+	defer httpServer.Close()
+
+	for _, codec := range []commands.Codec{codecs.YAML{}, codecs.CBOR{}, codecs.MessagePack{}} {
+		t.Run(codec.MediaType(), func(t *testing.T) {
+			client := NewClient(httpServer.URL, mappingCatalog, WithHTTPClient(httpServer.Client()), WithCodec(codec))
+			InsertRemote[AddCommandReq, AddCommandRes](client)
+			InsertRemote[FailCommandReq, FailCommandRes](client)
+
+			res, err := commands.Handle[AddCommandReq, AddCommandRes](nil, client, AddCommandReq{ArgX: 3, ArgY: 4})
+			assert.NoError(t, err)
+			assert.Equal(t, AddCommandRes{Result: 7}, res)
+
+			_, err = commands.Handle[FailCommandReq, FailCommandRes](nil, client, FailCommandReq{})
+			remoteErr := &RemoteError{}
+			assert.ErrorAs(t, err, &remoteErr)
+			assert.Equal(t, http.StatusInternalServerError, remoteErr.StatusCode)
+		})
+	}
+
+	t.Run("unsupported by server", func(t *testing.T) {
+		plain := httptest.NewServer(NewServer(mappingCatalog, decoderCatalog, handlerCatalog))
+		defer plain.Close()
+		client := NewClient(plain.URL, mappingCatalog, WithHTTPClient(plain.Client()), WithCodec(codecs.YAML{}))
+		InsertRemote[AddCommandReq, AddCommandRes](client)
+
+		_, err := commands.Handle[AddCommandReq, AddCommandRes](nil, client, AddCommandReq{ArgX: 3, ArgY: 4})
+		remoteErr := &RemoteError{}
+		assert.ErrorAs(t, err, &remoteErr)
+		assert.Equal(t, http.StatusUnsupportedMediaType, remoteErr.StatusCode)
+		assert.ErrorIs(t, err, commands.ErrCodecMissing)
+	})
+}
+
+func Test_Client_Future(t *testing.T) {
+	client, closer := newRemote()
+	defer closer()
+
+	tup := commands.Future[AddCommandReq, AddCommandRes](nil, client, AddCommandReq{ArgX: 3, ArgY: 4}).Wait()
+	assert.NoError(t, tup.Val2)
+	assert.Equal(t, AddCommandRes{Result: 7}, tup.Val1)
+}
+
+func Test_Client_TypeMap(t *testing.T) {
+	client, closer := newRemote()
+	defer closer()
+
+	typeMap := client.TypeMap()
+	assert.Len(t, typeMap, 4)
+	assert.Equal(t, reflect.TypeFor[AddCommandRes](), typeMap[reflect.TypeFor[AddCommandReq]()])
+}
+
+func Test_RemoteError_Is(t *testing.T) {
+	for _, kind := range ErrorKinds {
+		remoteErr := &RemoteError{StatusCode: StatusCode(kind), Kind: ErrorKind(kind)}
+		assert.ErrorIs(t, remoteErr, kind)
+		for _, other := range ErrorKinds {
+			if other != kind {
+				assert.NotErrorIs(t, remoteErr, other)
+			}
+		}
+	}
+	assert.NotErrorIs(t, &RemoteError{StatusCode: http.StatusTooManyRequests}, middleware.ErrRateLimited)
+	assert.NotErrorIs(t, &RemoteError{Kind: "unknown"}, commands.ErrMappingMissing)
+}
@@ -0,0 +1,172 @@
+package httptransport
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"time"
+
+	"github.com/dan-lugg/go-commands/commands"
+)
+
+const (
+	AddReqName   = "add"
+	SubReqName   = "sub"
+	FailReqName  = "fail"
+	ValidReqName = "valid"
+	WaitReqName  = "wait"
+	RangeReqName = "range"
+	StepReqName  = "step"
+)
+
+var ErrFailure = errors.New("failure")
+
+type AddCommandRes struct {
+	Result int `json:"result"`
+}
+
+type AddCommandReq struct {
+	ArgX int `json:"argX"`
+	ArgY int `json:"argY"`
+}
+
+type AddHandler struct {
+	commands.Handler[AddCommandReq, AddCommandRes]
+}
+
+func (h *AddHandler) Handle(ctx context.Context, req AddCommandReq) (res AddCommandRes, err error) {
+	return AddCommandRes{Result: req.ArgX + req.ArgY}, nil
+}
+
+type ValidCommandReq struct {
+	Name string `json:"name" validate:"required"`
+}
+
+type SubCommandRes struct {
+	Result int `json:"result"`
+}
+
+type SubCommandReq struct {
+	ArgX int `json:"argX"`
+	ArgY int `json:"argY"`
+}
+
+type FailCommandRes struct{}
+
+type FailCommandReq struct{}
+
+type FailHandler struct {
+	commands.Handler[FailCommandReq, FailCommandRes]
+}
+
+func (h *FailHandler) Handle(ctx context.Context, req FailCommandReq) (res FailCommandRes, err error) {
+	return FailCommandRes{}, ErrFailure
+}
+
+type WaitCommandRes struct{}
+
+type WaitCommandReq struct {
+	Duration time.Duration `json:"duration"`
+}
+
+type WaitHandler struct {
+	commands.Handler[WaitCommandReq, WaitCommandRes]
+}
+
+func (h *WaitHandler) Handle(ctx context.Context, req WaitCommandReq) (res WaitCommandRes, err error) {
+	select {
+	case <-time.After(req.Duration):
+		return WaitCommandRes{}, nil
+	case <-ctx.Done():
+		return WaitCommandRes{}, ctx.Err()
+	}
+}
+
+type RangeCommandItem struct {
+	Value int `json:"value"`
+}
+
+type RangeCommandReq struct {
+	To     int `json:"to"`
+	FailAt int `json:"failAt"`
+}
+
+type RangeHandler struct {
+	commands.StreamHandler[RangeCommandReq, RangeCommandItem]
+}
+
+func (h *RangeHandler) Stream(ctx context.Context, req RangeCommandReq) iter.Seq2[RangeCommandItem, error] {
+	return func(yield func(RangeCommandItem, error) bool) {
+		for i := 1; i <= req.To; i++ {
+			if i == req.FailAt {
+				yield(RangeCommandItem{}, ErrFailure)
+				return
+			}
+			if !yield(RangeCommandItem{Value: i}, nil) {
+				return
+			}
+		}
+	}
+}
+
+type StepCommandRes struct {
+	Done int `json:"done"`
+}
+
+type StepCommandReq struct {
+	Steps  int `json:"steps"`
+	FailAt int `json:"failAt"`
+}
+
+type StepHandler struct {
+	commands.Handler[StepCommandReq, StepCommandRes]
+}
+
+func (h *StepHandler) Handle(ctx context.Context, req StepCommandReq) (res StepCommandRes, err error) {
+	for i := 1; i <= req.Steps; i++ {
+		if i == req.FailAt {
+			return StepCommandRes{}, ErrFailure
+		}
+		commands.ReportProgress(ctx, float64(i*100/req.Steps), "step", "")
+	}
+	return StepCommandRes{Done: req.Steps}, nil
+}
+
+func newCatalogs() (*commands.DefaultMappingCatalog, *commands.DefaultDecoderCatalog, *commands.DefaultHandlerCatalog) {
+	mappingCatalog := commands.NewMappingCatalog()
+	commands.InsertMapping[AddCommandReq](mappingCatalog, AddReqName)
+	commands.InsertMapping[SubCommandReq](mappingCatalog, SubReqName)
+	commands.InsertMapping[FailCommandReq](mappingCatalog, FailReqName)
+	commands.InsertMapping[ValidCommandReq](mappingCatalog, ValidReqName)
+	commands.InsertMapping[WaitCommandReq](mappingCatalog, WaitReqName)
+	commands.InsertMapping[RangeCommandReq](mappingCatalog, RangeReqName)
+	commands.InsertMapping[StepCommandReq](mappingCatalog, StepReqName)
+
+	decoderCatalog := commands.NewDefaultDecoderCatalog()
+	commands.InsertDecoder[AddCommandReq](decoderCatalog, commands.DefaultDecoder[AddCommandReq]())
+	commands.InsertDecoder[SubCommandReq](decoderCatalog, commands.DefaultDecoder[SubCommandReq]())
+	commands.InsertDecoder[FailCommandReq](decoderCatalog, commands.DefaultDecoder[FailCommandReq]())
+	commands.InsertDecoder[ValidCommandReq](decoderCatalog, commands.DefaultDecoder[ValidCommandReq]())
+	commands.InsertDecoder[WaitCommandReq](decoderCatalog, commands.DefaultDecoder[WaitCommandReq]())
+	commands.InsertDecoder[RangeCommandReq](decoderCatalog, commands.DefaultDecoder[RangeCommandReq]())
+	commands.InsertDecoder[StepCommandReq](decoderCatalog, commands.DefaultDecoder[StepCommandReq]())
+
+	handlerCatalog := commands.NewDefaultHandlerCatalog()
+	commands.InsertHandler[AddCommandReq, AddCommandRes](handlerCatalog, func() commands.Handler[AddCommandReq, AddCommandRes] {
+		return &AddHandler{}
+	})
+	commands.InsertHandler[FailCommandReq, FailCommandRes](handlerCatalog, func() commands.Handler[FailCommandReq, FailCommandRes] {
+		return &FailHandler{}
+	})
+	commands.InsertHandler[WaitCommandReq, WaitCommandRes](handlerCatalog, func() commands.Handler[WaitCommandReq, WaitCommandRes] {
+		return &WaitHandler{}
+	}, commands.WithTimeout(50*time.Millisecond))
+	commands.InsertHandler[StepCommandReq, StepCommandRes](handlerCatalog, func() commands.Handler[StepCommandReq, StepCommandRes] {
+		return &StepHandler{}
+	})
+	commands.InsertStreamHandler[RangeCommandReq, RangeCommandItem](handlerCatalog, func() commands.StreamHandler[RangeCommandReq, RangeCommandItem] {
+		return &RangeHandler{}
+	})
+
+	return mappingCatalog, decoderCatalog, handlerCatalog
+}
@@ -0,0 +1,558 @@
+package httptransport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dan-lugg/go-commands/commands"
+	"github.com/dan-lugg/go-commands/middleware"
+	"github.com/dan-lugg/go-commands/util"
+)
+
+const (
+	// DefaultMaxBodySize is the maximum size, in bytes, of a request body accepted by a Server
+	// unless overridden with WithMaxBodySize.
+	DefaultMaxBodySize int64 = 1 << 20
+
+	// DefaultMaxTimeout is the longest timeout a TimeoutHeader may request for a command without
+	// a configured timeout, unless overridden with WithMaxTimeout.
+	DefaultMaxTimeout = time.Minute
+
+	// TimeoutHeader is the header carrying the timeout of a command, as a Go duration string.
+	// On a request it shortens the configured timeout; on a response it advertises the
+	// timeout the command ran with.
+	TimeoutHeader = "X-Command-Timeout"
+
+	// IdempotencyKeyHeader is the header carrying the idempotency key of a request, applied
+	// with middleware.ContextWithIdempotencyKey.
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	// MediaTypeNDJSON is the media type of a stream written as newline-delimited JSON.
+	MediaTypeNDJSON = "application/x-ndjson"
+
+	// MediaTypeEventStream is the media type of a stream written as Server-Sent Events.
+	MediaTypeEventStream = "text/event-stream"
+
+	contentTypeJSON = "application/json"
+)
+
+// ErrorBody is the JSON body written by a Server when a request fails.
+//
+// Fields:
+//   - Error: A human-readable description of the failure.
+//   - Kind: The machine-readable kind of the failure, as returned by ErrorKind, if any.
+//   - Fields: The field-level violations, if the failure is a commands.ValidationError.
+type ErrorBody struct {
+	Error  string                `json:"error"`
+	Kind   string                `json:"kind,omitempty"`
+	Fields []commands.FieldError `json:"fields,omitempty"`
+}
+
+// ErrorKinds are the sentinel errors whose kind a Server reports in an ErrorBody, and that a
+// RemoteError matches.
+var ErrorKinds = []error{
+	commands.ErrMappingMissing,
+	commands.ErrDecoderFailure,
+	commands.ErrValidationFailure,
+	commands.ErrHandlerMissing,
+	commands.ErrCommandTimeout,
+	commands.ErrCodecMissing,
+	commands.ErrCodecNotAcceptable,
+	middleware.ErrRateLimited,
+	middleware.ErrCircuitOpen,
+	middleware.ErrIdempotencyConflict,
+}
+
+// ErrorKind returns the machine-readable kind of an error, which is the message of the first of
+// ErrorKinds it wraps.
+//
+// Parameters:
+//   - err: The error to classify.
+//
+// Returns:
+//   - The kind of err, or an empty string if it wraps none of ErrorKinds.
+func ErrorKind(err error) string {
+	for _, kind := range ErrorKinds {
+		if errors.Is(err, kind) {
+			return kind.Error()
+		}
+	}
+	return ""
+}
+
+// Server is an http.Handler that serves the cataloged commands as POST /{reqName},
+// matching the paths advertised by openapi.SpecWriter.
+//
+// Each request body is dispatched by name through a commands.Dispatcher. The body is
+// decoded with the codec of its Content-Type, and the result is encoded with the codec
+// negotiated from the Accept header; errors are always written as JSON.
+//
+// Fields:
+//   - mappingCatalog: The MappingCatalog used to resolve request names to types.
+//   - handlerCatalog: The HandlerCatalog used to look up command timeouts.
+//   - dispatcher: The commands.Dispatcher used to decode and dispatch request bodies.
+//   - encoderCatalog: An optional EncoderCatalog used to encode results.
+//   - codecCatalog: The CodecCatalog used to pick the codecs of requests and results.
+//   - maxBodySize: The maximum size, in bytes, of an accepted request body.
+//   - maxTimeout: The longest timeout a TimeoutHeader may request for a command without a configured timeout.
+//   - callerFunc: An optional function identifying the caller of a request.
+type Server struct {
+	mappingCatalog commands.MappingCatalog
+	handlerCatalog commands.HandlerCatalog
+	dispatcher     *commands.Dispatcher
+	encoderCatalog commands.EncoderCatalog
+	codecCatalog   commands.CodecCatalog
+	maxBodySize    int64
+	maxTimeout     time.Duration
+	callerFunc     func(request *http.Request) string
+}
+
+type ServerOption = util.Option[*Server]
+
+// WithMaxBodySize returns an option that sets the maximum size, in bytes, of a request
+// body accepted by a Server. Larger bodies are rejected with 413 Request Entity Too Large.
+//
+// Parameters:
+//   - maxBodySize: The maximum size, in bytes, of an accepted request body.
+func WithMaxBodySize(maxBodySize int64) ServerOption {
+	return func(s *Server) {
+		s.maxBodySize = maxBodySize
+	}
+}
+
+// WithMaxTimeout returns an option that sets the longest timeout a TimeoutHeader may request
+// for a command without a configured timeout. Longer requested timeouts are clamped to it.
+//
+// Parameters:
+//   - maxTimeout: The longest timeout a request may ask for; a non-positive value removes the limit.
+func WithMaxTimeout(maxTimeout time.Duration) ServerOption {
+	return func(s *Server) {
+		s.maxTimeout = maxTimeout
+	}
+}
+
+// WithCallerFunc returns an option that sets the function identifying the caller of a
+// request. The identity is attached to the context of the dispatch with
+// middleware.ContextWithCaller, where rate limits keyed by caller read it.
+//
+// Parameters:
+//   - callerFunc: A function returning the identity of the caller of a request, such as
+//     an API key or the remote address.
+func WithCallerFunc(callerFunc func(request *http.Request) string) ServerOption {
+	return func(s *Server) {
+		s.callerFunc = callerFunc
+	}
+}
+
+// WithEncoderCatalog returns an option that sets the EncoderCatalog a Server encodes
+// results with. Without one, results are encoded with json.Marshal.
+//
+// Parameters:
+//   - encoderCatalog: The EncoderCatalog used to encode results.
+func WithEncoderCatalog(encoderCatalog commands.EncoderCatalog) ServerOption {
+	return func(s *Server) {
+		s.encoderCatalog = encoderCatalog
+	}
+}
+
+// WithCodecCatalog returns an option that sets the CodecCatalog a Server picks the codecs of
+// requests and results from. Without one, only JSON is served.
+//
+// Parameters:
+//   - codecCatalog: The CodecCatalog used to pick the codecs of requests and results.
+func WithCodecCatalog(codecCatalog commands.CodecCatalog) ServerOption {
+	return func(s *Server) {
+		s.codecCatalog = codecCatalog
+	}
+}
+
+// NewServer creates and returns a new instance of Server.
+//
+// By default the Server uses DefaultMaxBodySize and DefaultMaxTimeout.
+//
+// Parameters:
+//   - mappingCatalog: The MappingCatalog used to resolve request names to types.
+//   - decoderCatalog: The DecoderCatalog used to decode request bodies.
+//   - handlerCatalog: The HandlerCatalog used to dispatch decoded requests.
+//   - options: Options applied to the Server.
+//
+// Returns:
+//   - A pointer to a Server instance.
+func NewServer(mappingCatalog commands.MappingCatalog, decoderCatalog commands.DecoderCatalog, handlerCatalog commands.HandlerCatalog, options ...ServerOption) (server *Server) {
+	server = &Server{
+		mappingCatalog: mappingCatalog,
+		handlerCatalog: handlerCatalog,
+		dispatcher:     nil,
+		encoderCatalog: nil,
+		codecCatalog:   commands.NewDefaultCodecCatalog(),
+		maxBodySize:    DefaultMaxBodySize,
+		maxTimeout:     DefaultMaxTimeout,
+		callerFunc:     nil,
+	}
+	for _, option := range options {
+		option(server)
+	}
+	server.dispatcher = commands.NewDispatcher(mappingCatalog, decoderCatalog, handlerCatalog, commands.WithEncoderCatalog(server.encoderCatalog))
+	return server
+}
+
+// ServeHTTP handles a POST /{reqName} request by decoding the body into the mapped
+// request type, dispatching it and writing the encoded result.
+//
+// A Content-Type without a cataloged codec is rejected with 415 Unsupported Media Type,
+// and an Accept header no cataloged codec satisfies with 406 Not Acceptable.
+//
+// If the HandlerCatalog implements commands.StreamCatalog and streams the request type, the
+// items are written as they are produced, as MediaTypeNDJSON or, if the Accept header prefers
+// it, as MediaTypeEventStream. Other request types are also served as MediaTypeEventStream if
+// the Accept header prefers it, writing the Progress reported by the handler as it runs.
+//
+// An IdempotencyKeyHeader on the request is attached to the context of the dispatch.
+// A TimeoutHeader on the request overrides the timeout configured for the command, but is
+// clamped to it, so a caller can only shorten it. For a command without a configured timeout,
+// the requested timeout is clamped to the limit set with WithMaxTimeout. A zero TimeoutHeader
+// is ignored. If the HandlerCatalog implements commands.TimeoutCatalog, the effective timeout
+// is advertised in the TimeoutHeader of the response.
+//
+// Parameters:
+//   - writer: The http.ResponseWriter the result or error is written to.
+//   - request: The incoming *http.Request.
+func (s *Server) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		writer.Header().Set("Allow", http.MethodPost)
+		writeError(writer, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", request.Method))
+		return
+	}
+
+	reqName := strings.Trim(request.URL.Path, "/")
+	reqType, err := s.mappingCatalog.ByName(reqName)
+	if err != nil {
+		writeError(writer, StatusCode(err), err)
+		return
+	}
+
+	reqCodec, err := s.codecCatalog.ByMediaType(request.Header.Get("Content-Type"))
+	if err != nil {
+		writeError(writer, StatusCode(err), err)
+		return
+	}
+	streamCatalog, isStream := s.handlerCatalog.(commands.StreamCatalog)
+	isStream = isStream && streamCatalog.IsStream(reqType)
+	resCodec, resType := commands.Codec(nil), ""
+	if isStream {
+		resType, err = commands.NegotiateMediaType(request.Header.Get("Accept"), MediaTypeNDJSON, MediaTypeEventStream)
+	} else if resType, err = commands.NegotiateMediaType(request.Header.Get("Accept"), append(s.codecCatalog.MediaTypes(), MediaTypeEventStream)...); err == nil && resType != MediaTypeEventStream {
+		resCodec, err = s.codecCatalog.ByMediaType(resType)
+	}
+	if err != nil {
+		writeError(writer, StatusCode(err), err)
+		return
+	}
+
+	reqData, err := io.ReadAll(http.MaxBytesReader(writer, request.Body, s.maxBodySize))
+	if err != nil {
+		writeError(writer, StatusCode(err), err)
+		return
+	}
+
+	req, err := s.dispatcher.DecodeWith(reqName, reqCodec, reqData)
+	if err != nil {
+		writeError(writer, StatusCode(err), err)
+		return
+	}
+
+	ctx := request.Context()
+	if s.callerFunc != nil {
+		ctx = middleware.ContextWithCaller(ctx, s.callerFunc(request))
+	}
+	if key := request.Header.Get(IdempotencyKeyHeader); key != "" {
+		ctx = middleware.ContextWithIdempotencyKey(ctx, key)
+	}
+	timeout, hasTimeout := time.Duration(0), false
+	if timeoutCatalog, ok := s.handlerCatalog.(commands.TimeoutCatalog); ok {
+		timeout, hasTimeout = timeoutCatalog.Timeout(reqType), true
+	}
+	if header := request.Header.Get(TimeoutHeader); header != "" {
+		override, err := time.ParseDuration(header)
+		if err != nil || override < 0 {
+			writeError(writer, http.StatusBadRequest, fmt.Errorf("invalid %s header: %q", TimeoutHeader, header))
+			return
+		}
+		if override > 0 {
+			if limit := s.timeoutLimit(timeout); limit > 0 {
+				override = min(override, limit)
+			}
+			timeout = override
+			ctx, hasTimeout = commands.ContextWithTimeout(ctx, timeout), true
+		}
+	}
+	if hasTimeout && timeout > 0 {
+		writer.Header().Set(TimeoutHeader, timeout.String())
+	}
+
+	if isStream {
+		s.serveStream(newEventWriter(writer, resType), streamCatalog.Stream(ctx, req))
+		return
+	}
+	if resType == MediaTypeEventStream {
+		s.serveProgress(newEventWriter(writer, resType), ctx, req)
+		return
+	}
+
+	res, err := s.handlerCatalog.Handle(ctx, req)
+	if err != nil {
+		writeError(writer, StatusCode(err), err)
+		return
+	}
+
+	resData, err := s.dispatcher.EncodeWith(res, resCodec)
+	if err != nil {
+		writeError(writer, StatusCode(err), err)
+		return
+	}
+	writer.Header().Set("Content-Type", resCodec.MediaType())
+	writer.WriteHeader(http.StatusOK)
+	_, _ = writer.Write(resData)
+}
+
+// timeoutLimit returns the longest timeout a TimeoutHeader may request for a command, given its
+// configured timeout: the configured timeout itself or, without one, the maxTimeout of the
+// Server. A non-positive result means the requested timeout is not limited.
+func (s *Server) timeoutLimit(configured time.Duration) time.Duration {
+	if configured > 0 {
+		return configured
+	}
+	return s.maxTimeout
+}
+
+// serveStream writes the items of a stream as they are produced, as "item" events. A stream
+// written as MediaTypeEventStream ends with an "end" event, so clients can tell completion from
+// a dropped connection.
+func (s *Server) serveStream(events *eventWriter, stream iter.Seq2[commands.CommandRes, error]) {
+	for item, err := range stream {
+		var itemData []byte
+		if err == nil {
+			itemData, err = s.dispatcher.Encode(item)
+		}
+		if err != nil {
+			events.fail(err)
+			return
+		}
+		if !events.write("item", itemData) {
+			return
+		}
+	}
+	events.end()
+}
+
+// serveProgress dispatches a request whose caller asked for MediaTypeEventStream, writing the
+// Progress reported by the handler as "progress" events, skipping reports superseded before they
+// could be written, and the encoded result as a "result" event, followed by an "end" event.
+func (s *Server) serveProgress(events *eventWriter, ctx context.Context, req commands.CommandReq[commands.CommandRes]) {
+	// Progress events are written off the goroutine of the handler, and stale ones are dropped,
+	// so a slow client never blocks a report.
+	observer, stop := commands.QueuedProgressObserver(func(progress commands.Progress) {
+		data, _ := json.Marshal(progress)
+		events.write("progress", data)
+	})
+	progress := commands.NewProgressReporter(observer)
+	if parent := commands.ProgressFromContext(ctx); parent != nil {
+		progress.Observe(parent.Report)
+	}
+	res, err := s.handlerCatalog.Handle(commands.ContextWithProgress(ctx, progress), req)
+	stop()
+	var resData []byte
+	if err == nil {
+		resData, err = s.dispatcher.Encode(res)
+	}
+	if err != nil {
+		events.fail(err)
+		return
+	}
+	if events.write("result", resData) {
+		events.end()
+	}
+}
+
+// eventWriter writes the events of a response streamed as MediaTypeNDJSON or MediaTypeEventStream,
+// flushing each. The headers are sent with the first event, so a failure before it is written as
+// an ordinary error response. Events are written one at a time, and none after the response ends.
+//
+// Fields:
+//   - writer: The http.ResponseWriter the events are written to.
+//   - controller: The http.ResponseController used to flush each event.
+//   - mediaType: The media type of the response.
+//   - started: Whether the headers have been sent.
+//   - done: Whether the response has ended, by completing, failing or losing the connection.
+type eventWriter struct {
+	mutex      sync.Mutex
+	writer     http.ResponseWriter
+	controller *http.ResponseController
+	mediaType  string
+	started    bool
+	done       bool
+}
+
+func newEventWriter(writer http.ResponseWriter, mediaType string) *eventWriter {
+	return &eventWriter{
+		mutex:      sync.Mutex{},
+		writer:     writer,
+		controller: http.NewResponseController(writer),
+		mediaType:  mediaType,
+		started:    false,
+		done:       false,
+	}
+}
+
+// write writes an event carrying JSON data, which MediaTypeNDJSON writes as a bare line.
+// It reports whether the event was written.
+func (w *eventWriter) write(event string, data []byte) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.writeLocked(event, data)
+}
+
+func (w *eventWriter) writeLocked(event string, data []byte) bool {
+	if w.done {
+		return false
+	}
+	if !w.started {
+		w.started = true
+		w.writer.Header().Set("Content-Type", w.mediaType)
+		if w.mediaType == MediaTypeEventStream {
+			w.writer.Header().Set("Cache-Control", "no-cache")
+		}
+		w.writer.WriteHeader(http.StatusOK)
+	}
+	buffer := bytes.Buffer{}
+	if err := json.Compact(&buffer, data); err != nil {
+		buffer.Reset()
+		buffer.Write(data)
+	}
+	if w.mediaType == MediaTypeEventStream {
+		data = fmt.Appendf(nil, "event: %s\ndata: %s\n\n", event, buffer.Bytes())
+	} else {
+		data = append(buffer.Bytes(), '\n')
+	}
+	if _, err := w.writer.Write(data); err != nil {
+		w.done = true
+		return false
+	}
+	_ = w.controller.Flush()
+	return true
+}
+
+// fail ends the response with an error, written as an ordinary error response if no event was
+// written yet, or otherwise as an "error" event carrying an ErrorBody.
+func (w *eventWriter) fail(err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.done {
+		return
+	}
+	if !w.started {
+		w.started, w.done = true, true
+		writeError(w.writer, StatusCode(err), err)
+		return
+	}
+	errData, _ := json.Marshal(errorBody(err))
+	w.writeLocked("error", errData)
+	w.done = true
+}
+
+// end ends the response, writing the headers if no event was written and an "end" event for
+// MediaTypeEventStream.
+func (w *eventWriter) end() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.done {
+		return
+	}
+	if w.mediaType == MediaTypeEventStream {
+		w.writeLocked("end", []byte("{}"))
+	} else if !w.started {
+		w.started = true
+		w.writer.Header().Set("Content-Type", w.mediaType)
+		w.writer.WriteHeader(http.StatusOK)
+	}
+	w.done = true
+}
+
+// StatusCode maps an error returned while serving a command to an HTTP status code.
+//
+// Parameters:
+//   - err: The error to map.
+//
+// Returns:
+//   - The HTTP status code that best describes err.
+func StatusCode(err error) int {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.As(err, &maxBytesErr):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, commands.ErrMappingMissing):
+		return http.StatusNotFound
+	case errors.Is(err, commands.ErrDecoderFailure), errors.Is(err, commands.ErrInvalidEnvelope):
+		return http.StatusBadRequest
+	case errors.Is(err, commands.ErrCodecMissing):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, commands.ErrCodecNotAcceptable):
+		return http.StatusNotAcceptable
+	case errors.Is(err, commands.ErrValidationFailure):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, commands.ErrHandlerMissing):
+		return http.StatusNotImplemented
+	case errors.Is(err, commands.ErrCommandTimeout):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, middleware.ErrRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, middleware.ErrCircuitOpen):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, middleware.ErrIdempotencyConflict):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeError(writer http.ResponseWriter, statusCode int, err error) {
+	body := errorBody(err)
+	var rateLimitErr *middleware.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		writer.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(rateLimitErr.RetryAfter.Seconds())), 10))
+	}
+	writeJSON(writer, statusCode, body)
+}
+
+func errorBody(err error) ErrorBody {
+	body := ErrorBody{Error: err.Error(), Kind: ErrorKind(err)}
+	var validationErr *commands.ValidationError
+	if errors.As(err, &validationErr) {
+		body.Fields = validationErr.Fields
+	}
+	return body
+}
+
+func writeJSON(writer http.ResponseWriter, statusCode int, body any) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		statusCode = http.StatusInternalServerError
+		data, _ = json.Marshal(ErrorBody{Error: fmt.Sprintf("failed to encode response: %s", err)})
+	}
+	writer.Header().Set("Content-Type", contentTypeJSON)
+	writer.WriteHeader(statusCode)
+	_, _ = writer.Write(data)
+}
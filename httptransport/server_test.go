@@ -0,0 +1,399 @@
+package httptransport
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dan-lugg/go-commands/codecs"
+	"github.com/dan-lugg/go-commands/commands"
+	"github.com/dan-lugg/go-commands/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_NewServer(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		mappingCatalog, decoderCatalog, handlerCatalog := newCatalogs()
+		server := NewServer(mappingCatalog, decoderCatalog, handlerCatalog)
+		assert.NotNil(t, server)
+		assert.NotNil(t, server.dispatcher)
+		assert.NotNil(t, server.codecCatalog)
+		assert.Equal(t, DefaultMaxBodySize, server.maxBodySize)
+		assert.Equal(t, DefaultMaxTimeout, server.maxTimeout)
+	})
+
+	t.Run("with options", func(t *testing.T) {
+		mappingCatalog, decoderCatalog, handlerCatalog := newCatalogs()
+		server := NewServer(mappingCatalog, decoderCatalog, handlerCatalog, WithMaxBodySize(16), WithMaxTimeout(time.Second))
+		assert.NotNil(t, server)
+		assert.Equal(t, int64(16), server.maxBodySize)
+		assert.Equal(t, time.Second, server.maxTimeout)
+	})
+}
+
+func Test_Server_ServeHTTP(t *testing.T) {
+	mappingCatalog, decoderCatalog, handlerCatalog := newCatalogs()
+	server := NewServer(mappingCatalog, decoderCatalog, handlerCatalog, WithMaxBodySize(64))
+
+	serve := func(method string, path string, body string, headers ...string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		for i := 0; i+1 < len(headers); i += 2 {
+			request.Header.Set(headers[i], headers[i+1])
+		}
+		server.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	t.Run("default", func(t *testing.T) {
+		recorder := serve(http.MethodPost, "/add", `{"argX": 3, "argY": 4}`)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+		res := AddCommandRes{}
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+		assert.Equal(t, AddCommandRes{Result: 7}, res)
+	})
+
+	t.Run("method not allowed", func(t *testing.T) {
+		recorder := serve(http.MethodGet, "/add", ``)
+		assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+		assert.Equal(t, http.MethodPost, recorder.Header().Get("Allow"))
+	})
+
+	t.Run("mapping missing", func(t *testing.T) {
+		recorder := serve(http.MethodPost, "/mul", `{}`)
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+		body := ErrorBody{}
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+		assert.Contains(t, body.Error, "mapping missing")
+	})
+
+	t.Run("decoder failure", func(t *testing.T) {
+		recorder := serve(http.MethodPost, "/add", `#!`)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+
+	t.Run("validation failure", func(t *testing.T) {
+		recorder := serve(http.MethodPost, "/valid", `{}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+		body := ErrorBody{}
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+		assert.Equal(t, []commands.FieldError{{Field: "name", Rule: "required", Message: "is required"}}, body.Fields)
+	})
+
+	t.Run("handler missing", func(t *testing.T) {
+		recorder := serve(http.MethodPost, "/sub", `{}`)
+		assert.Equal(t, http.StatusNotImplemented, recorder.Code)
+	})
+
+	t.Run("handler failure", func(t *testing.T) {
+		recorder := serve(http.MethodPost, "/fail", `{}`)
+		assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	})
+
+	t.Run("body too large", func(t *testing.T) {
+		recorder := serve(http.MethodPost, "/add", `{"argX": 3, "argY": 4, "padding": "`+strings.Repeat("x", 64)+`"}`)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		recorder := serve(http.MethodPost, "/wait", `{"duration": 1000000000}`)
+		assert.Equal(t, http.StatusGatewayTimeout, recorder.Code)
+		assert.Equal(t, "50ms", recorder.Header().Get(TimeoutHeader))
+	})
+
+	t.Run("timeout override", func(t *testing.T) {
+		recorder := serve(http.MethodPost, "/wait", `{"duration": 30000000}`, TimeoutHeader, "10ms")
+		assert.Equal(t, http.StatusGatewayTimeout, recorder.Code)
+		assert.Equal(t, "10ms", recorder.Header().Get(TimeoutHeader))
+	})
+
+	t.Run("timeout override clamped", func(t *testing.T) {
+		recorder := serve(http.MethodPost, "/wait", `{"duration": 100000000}`, TimeoutHeader, "1000h")
+		assert.Equal(t, http.StatusGatewayTimeout, recorder.Code)
+		assert.Equal(t, "50ms", recorder.Header().Get(TimeoutHeader))
+	})
+
+	t.Run("timeout override zero", func(t *testing.T) {
+		recorder := serve(http.MethodPost, "/wait", `{"duration": 100000000}`, TimeoutHeader, "0s")
+		assert.Equal(t, http.StatusGatewayTimeout, recorder.Code)
+		assert.Equal(t, "50ms", recorder.Header().Get(TimeoutHeader))
+	})
+
+	t.Run("timeout override unconfigured", func(t *testing.T) {
+		recorder := serve(http.MethodPost, "/add", `{}`, TimeoutHeader, "1000h")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, DefaultMaxTimeout.String(), recorder.Header().Get(TimeoutHeader))
+	})
+
+	t.Run("timeout invalid", func(t *testing.T) {
+		recorder := serve(http.MethodPost, "/wait", `{}`, TimeoutHeader, "soon")
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+
+	t.Run("timeout unset", func(t *testing.T) {
+		recorder := serve(http.MethodPost, "/add", `{}`)
+		assert.Empty(t, recorder.Header().Get(TimeoutHeader))
+	})
+}
+
+func Test_Server_ServeHTTP_RateLimit(t *testing.T) {
+	mappingCatalog, decoderCatalog, handlerCatalog := newCatalogs()
+	limiter := middleware.NewRateLimiter(middleware.RateLimitPolicy{Rate: 0.5, Burst: 1, Key: middleware.LimitByCaller})
+	handlerCatalog.Use(limiter.Interceptor())
+	server := NewServer(mappingCatalog, decoderCatalog, handlerCatalog, WithCallerFunc(func(request *http.Request) string {
+		return request.Header.Get("X-Api-Key")
+	}))
+
+	serve := func(apiKey string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/add", strings.NewReader(`{}`))
+		request.Header.Set("X-Api-Key", apiKey)
+		server.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	assert.Equal(t, http.StatusOK, serve("alice").Code)
+	recorder := serve("alice")
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.Equal(t, "2", recorder.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, serve("bob").Code)
+}
+
+func Test_Server_ServeHTTP_Idempotency(t *testing.T) {
+	mappingCatalog, decoderCatalog, handlerCatalog := newCatalogs()
+	handlerCatalog.Use(middleware.Idempotency(middleware.NewMemoryIdempotencyStore(), time.Minute))
+	server := NewServer(mappingCatalog, decoderCatalog, handlerCatalog)
+
+	serve := func(body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/add", strings.NewReader(body))
+		request.Header.Set(IdempotencyKeyHeader, "k1")
+		server.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	assert.Equal(t, http.StatusOK, serve(`{"argX": 3, "argY": 4}`).Code)
+	assert.Equal(t, http.StatusOK, serve(`{"argX": 3, "argY": 4}`).Code)
+	assert.Equal(t, http.StatusConflict, serve(`{"argX": 4, "argY": 4}`).Code)
+}
+
+func Test_Server_ServeHTTP_Encoder(t *testing.T) {
+	mappingCatalog, decoderCatalog, handlerCatalog := newCatalogs()
+	encoderCatalog := commands.NewDefaultEncoderCatalog()
+	commands.InsertEncoder[AddCommandRes](encoderCatalog, func(res commands.CommandRes) ([]byte, error) {
+		return json.Marshal(map[string]int{"sum": res.(AddCommandRes).Result})
+	})
+	server := NewServer(mappingCatalog, decoderCatalog, handlerCatalog, WithEncoderCatalog(encoderCatalog))
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"argX": 3, "argY": 4}`)))
+		return recorder
+	}
+
+	t.Run("custom encoder", func(t *testing.T) {
+		recorder := serve("/add")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+		assert.JSONEq(t, `{"sum": 7}`, recorder.Body.String())
+	})
+
+	t.Run("encoder missing", func(t *testing.T) {
+		recorder := serve("/wait")
+		assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), commands.ErrEncoderMissing.Error())
+	})
+}
+
+func Test_Server_ServeHTTP_Codecs(t *testing.T) {
+	mappingCatalog, decoderCatalog, handlerCatalog := newCatalogs()
+	server := NewServer(mappingCatalog, decoderCatalog, handlerCatalog, WithCodecCatalog(codecs.NewCodecCatalog()))
+
+	serve := func(body []byte, contentType string, accept string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/add", strings.NewReader(string(body)))
+		request.Header.Set("Content-Type", contentType)
+		request.Header.Set("Accept", accept)
+		server.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	t.Run("yaml", func(t *testing.T) {
+		recorder := serve([]byte("argX: 3\nargY: 4\n"), "application/yaml", "application/yaml")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "application/yaml", recorder.Header().Get("Content-Type"))
+		assert.Equal(t, "result: 7\n", recorder.Body.String())
+	})
+
+	t.Run("cbor to json", func(t *testing.T) {
+		body, err := codecs.CBOR{}.Marshal(AddCommandReq{ArgX: 3, ArgY: 4})
+		assert.NoError(t, err)
+		recorder := serve(body, "application/cbor", "application/json, application/cbor;q=0.5")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+		assert.JSONEq(t, `{"result": 7}`, recorder.Body.String())
+	})
+
+	t.Run("msgpack", func(t *testing.T) {
+		body, err := codecs.MessagePack{}.Marshal(AddCommandReq{ArgX: 3, ArgY: 4})
+		assert.NoError(t, err)
+		recorder := serve(body, "application/msgpack", "application/msgpack")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "application/msgpack", recorder.Header().Get("Content-Type"))
+		res := AddCommandRes{}
+		assert.NoError(t, codecs.MessagePack{}.Unmarshal(recorder.Body.Bytes(), &res))
+		assert.Equal(t, AddCommandRes{Result: 7}, res)
+	})
+
+	t.Run("unsupported media type", func(t *testing.T) {
+		recorder := serve([]byte(`<add/>`), "application/xml", "")
+		assert.Equal(t, http.StatusUnsupportedMediaType, recorder.Code)
+		assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+		assert.Contains(t, recorder.Body.String(), commands.ErrCodecMissing.Error())
+	})
+
+	t.Run("not acceptable", func(t *testing.T) {
+		recorder := serve([]byte(`{"argX": 3, "argY": 4}`), "application/json", "application/xml")
+		assert.Equal(t, http.StatusNotAcceptable, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), commands.ErrCodecNotAcceptable.Error())
+	})
+
+	t.Run("invalid body", func(t *testing.T) {
+		recorder := serve([]byte("argX: [\n"), "application/yaml", "application/yaml")
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	})
+}
+
+func Test_Server_ServeHTTP_Stream(t *testing.T) {
+	mappingCatalog, decoderCatalog, handlerCatalog := newCatalogs()
+	server := NewServer(mappingCatalog, decoderCatalog, handlerCatalog)
+
+	serve := func(body string, accept string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/range", strings.NewReader(body))
+		request.Header.Set("Accept", accept)
+		server.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	t.Run("ndjson", func(t *testing.T) {
+		recorder := serve(`{"to": 3}`, "")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, MediaTypeNDJSON, recorder.Header().Get("Content-Type"))
+		assert.Equal(t, "{\"value\":1}\n{\"value\":2}\n{\"value\":3}\n", recorder.Body.String())
+		assert.True(t, recorder.Flushed)
+	})
+
+	t.Run("event stream", func(t *testing.T) {
+		recorder := serve(`{"to": 2}`, "text/event-stream")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, MediaTypeEventStream, recorder.Header().Get("Content-Type"))
+		assert.Equal(t, "no-cache", recorder.Header().Get("Cache-Control"))
+		assert.Equal(t, "event: item\ndata: {\"value\":1}\n\nevent: item\ndata: {\"value\":2}\n\nevent: end\ndata: {}\n\n", recorder.Body.String())
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		recorder := serve(`{"to": 0}`, MediaTypeNDJSON)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Empty(t, recorder.Body.String())
+	})
+
+	t.Run("failure before first item", func(t *testing.T) {
+		recorder := serve(`{"to": 3, "failAt": 1}`, "")
+		assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+		assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+		assert.Contains(t, recorder.Body.String(), ErrFailure.Error())
+	})
+
+	t.Run("failure after first item", func(t *testing.T) {
+		recorder := serve(`{"to": 3, "failAt": 2}`, "")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "{\"value\":1}\n{\"error\":\"failure\"}\n", recorder.Body.String())
+
+		recorder = serve(`{"to": 3, "failAt": 2}`, "text/event-stream")
+		assert.Equal(t, "event: item\ndata: {\"value\":1}\n\nevent: error\ndata: {\"error\":\"failure\"}\n\n", recorder.Body.String())
+	})
+
+	t.Run("not acceptable", func(t *testing.T) {
+		recorder := serve(`{"to": 3}`, "application/json")
+		assert.Equal(t, http.StatusNotAcceptable, recorder.Code)
+	})
+
+	t.Run("interceptor rejects", func(t *testing.T) {
+		mappingCatalog, decoderCatalog, handlerCatalog := newCatalogs()
+		handlerCatalog.Use(func(ctx context.Context, info commands.InterceptorInfo, req commands.CommandReq[commands.CommandRes], next commands.Invoker) (commands.CommandRes, error) {
+			return nil, middleware.ErrRateLimited
+		})
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/range", strings.NewReader(`{"to": 3}`))
+		NewServer(mappingCatalog, decoderCatalog, handlerCatalog).ServeHTTP(recorder, request)
+		assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+		assert.NotContains(t, recorder.Body.String(), "value")
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		httpServer := httptest.NewServer(server)
+		defer httpServer.Close()
+		response, err := httpServer.Client().Post(httpServer.URL+"/range", "application/json", strings.NewReader(`{"to": 1000000}`))
+		assert.NoError(t, err)
+		line := make([]byte, 12)
+		_, err = io.ReadFull(response.Body, line)
+		assert.NoError(t, err)
+		assert.Equal(t, "{\"value\":1}\n", string(line))
+		assert.NoError(t, response.Body.Close())
+	})
+}
+
+func Test_Server_ServeHTTP_Progress(t *testing.T) {
+	mappingCatalog, decoderCatalog, handlerCatalog := newCatalogs()
+	server := NewServer(mappingCatalog, decoderCatalog, handlerCatalog)
+
+	serve := func(body string, accept string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/step", strings.NewReader(body))
+		request.Header.Set("Accept", accept)
+		server.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	t.Run("event stream", func(t *testing.T) {
+		recorder := serve(`{"steps": 2}`, "text/event-stream")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, MediaTypeEventStream, recorder.Header().Get("Content-Type"))
+		// The first report may be superseded by the second before it is written.
+		stale := "event: progress\ndata: {\"percent\":50,\"stage\":\"step\"}\n\n"
+		latest := "" +
+			"event: progress\ndata: {\"percent\":100,\"stage\":\"step\"}\n\n" +
+			"event: result\ndata: {\"done\":2}\n\n" +
+			"event: end\ndata: {}\n\n"
+		assert.Contains(t, []string{stale + latest, latest}, recorder.Body.String())
+	})
+
+	t.Run("json preferred", func(t *testing.T) {
+		recorder := serve(`{"steps": 2}`, "application/json, text/event-stream")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+		assert.JSONEq(t, `{"done": 2}`, recorder.Body.String())
+	})
+
+	t.Run("failure before progress", func(t *testing.T) {
+		recorder := serve(`{"steps": 2, "failAt": 1}`, "text/event-stream")
+		assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), ErrFailure.Error())
+	})
+
+	t.Run("failure after progress", func(t *testing.T) {
+		recorder := serve(`{"steps": 2, "failAt": 2}`, "text/event-stream")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, ""+
+			"event: progress\ndata: {\"percent\":50,\"stage\":\"step\"}\n\n"+
+			"event: error\ndata: {\"error\":\"failure\"}\n\n", recorder.Body.String())
+	})
+}
@@ -0,0 +1,327 @@
+package inject
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/dan-lugg/go-commands/util"
+)
+
+var (
+	ErrServiceMissing  = errors.New("service missing")
+	ErrServiceCycle    = errors.New("service cycle")
+	ErrInvalidProvider = errors.New("invalid provider")
+)
+
+const (
+	// InjectTag is the struct tag key marking the fields of a handler that are set
+	// from the Container, for example `inject:""`.
+	InjectTag = "inject"
+)
+
+var errorType = reflect.TypeFor[error]()
+
+// provider holds the constructor of a service and, once resolved, its instance.
+//
+// Fields:
+//   - constructor: The constructor function, or an invalid reflect.Value for supplied instances.
+//   - deps: The parameter types of the constructor.
+//   - instance: The resolved instance of the service.
+//   - resolved: Whether instance has been resolved.
+//   - pending: A channel closed when the running constructor returns, or nil if none is running.
+type provider struct {
+	constructor reflect.Value
+	deps        []reflect.Type
+	instance    reflect.Value
+	resolved    bool
+	pending     chan struct{}
+}
+
+// Container is a dependency injection container holding singleton services keyed by type.
+//
+// Services are registered with Provide, which takes a constructor whose parameters are
+// resolved from the Container, or with Supply, which takes an existing instance. Each
+// service is constructed at most once, on first use.
+//
+// Constructors run without holding the lock of the Container, so they may resolve other
+// services from it. A constructor must not resolve its own service, directly or through
+// other constructors, as that call waits for the constructor to return.
+//
+// Fields:
+//   - providers: A map that associates service types with their providers.
+type Container struct {
+	mutex     sync.Mutex
+	providers map[reflect.Type]*provider
+}
+
+type ContainerOption = util.Option[*Container]
+
+// NewContainer creates and returns a new instance of Container.
+//
+// Parameters:
+//   - options: Options applied to the Container.
+//
+// Returns:
+//   - A pointer to a Container instance.
+func NewContainer(options ...ContainerOption) (container *Container) {
+	container = &Container{
+		mutex:     sync.Mutex{},
+		providers: make(map[reflect.Type]*provider),
+	}
+	for _, option := range options {
+		option(container)
+	}
+	return container
+}
+
+// Provide registers a constructor for a service.
+//
+// The constructor must be a function returning the service, optionally followed by an
+// error. The service is registered under the exact type of the first return value, and
+// every parameter is resolved from the Container when the service is first used.
+//
+// Parameters:
+//   - constructor: The constructor function of the service.
+//
+// Returns:
+//   - An error wrapping ErrInvalidProvider if constructor is not a valid constructor.
+func (c *Container) Provide(constructor any) (err error) {
+	constructorValue := reflect.ValueOf(constructor)
+	serviceType, deps, err := constructorTypes(constructorValue)
+	if err != nil {
+		return err
+	}
+	c.insert(serviceType, &provider{
+		constructor: constructorValue,
+		deps:        deps,
+	})
+	return nil
+}
+
+// Supply is a generic function that registers an existing instance of a service.
+//
+// Type Parameters:
+//   - T: The type the service is registered under.
+//
+// Parameters:
+//   - container: A pointer to the Container where the service will be registered.
+//   - value: The instance of the service.
+func Supply[T any](container *Container, value T) {
+	container.insert(reflect.TypeFor[T](), &provider{
+		instance: reflect.ValueOf(&value).Elem(),
+		resolved: true,
+	})
+}
+
+// Resolve is a generic function that returns the instance of a service, constructing
+// it and its dependencies on first use.
+//
+// Type Parameters:
+//   - T: The type of the service.
+//
+// Parameters:
+//   - container: A pointer to the Container holding the service.
+//
+// Returns:
+//   - value: The instance of the service.
+//   - err: An error wrapping ErrServiceMissing or ErrServiceCycle if the service cannot be
+//     resolved, or the error returned by a constructor.
+func Resolve[T any](container *Container) (value T, err error) {
+	instance, err := container.Resolve(reflect.TypeFor[T]())
+	if err != nil {
+		return value, err
+	}
+	return instance.Interface().(T), nil
+}
+
+// Resolve returns the instance of the service registered under serviceType,
+// constructing it and its dependencies on first use.
+//
+// Parameters:
+//   - serviceType: The reflect.Type of the service.
+//
+// Returns:
+//   - instance: The instance of the service.
+//   - err: An error wrapping ErrServiceMissing or ErrServiceCycle if the service cannot be
+//     resolved, or the error returned by a constructor.
+func (c *Container) Resolve(serviceType reflect.Type) (instance reflect.Value, err error) {
+	instances, err := c.resolveTypes([]reflect.Type{serviceType})
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return instances[0], nil
+}
+
+// Verify checks that the dependencies of every registered service can be resolved
+// and that no service depends on itself, without constructing any service.
+//
+// Returns:
+//   - An error joining every missing dependency and cycle found.
+func (c *Container) Verify() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	errs := make([]error, 0)
+	for serviceType := range c.providers {
+		errs = append(errs, c.check(serviceType, nil))
+	}
+	return errors.Join(errs...)
+}
+
+// VerifyTypes checks that each of the given types can be resolved, without constructing any service.
+//
+// Parameters:
+//   - serviceTypes: The types to check.
+//
+// Returns:
+//   - An error joining every missing dependency and cycle found.
+func (c *Container) VerifyTypes(serviceTypes ...reflect.Type) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	errs := make([]error, 0, len(serviceTypes))
+	for _, serviceType := range serviceTypes {
+		errs = append(errs, c.check(serviceType, nil))
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Container) insert(serviceType reflect.Type, serviceProvider *provider) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.providers == nil {
+		c.providers = make(map[reflect.Type]*provider)
+	}
+	c.providers[serviceType] = serviceProvider
+}
+
+// check walks the dependencies of serviceType, reporting missing services and cycles.
+func (c *Container) check(serviceType reflect.Type, path []reflect.Type) error {
+	for i, pathType := range path {
+		if pathType == serviceType {
+			return fmt.Errorf("%w: %s", ErrServiceCycle, formatPath(append(path[i:], serviceType)))
+		}
+	}
+	provider, found := c.providers[serviceType]
+	if !found {
+		if len(path) == 0 {
+			return fmt.Errorf("%w: %s", ErrServiceMissing, serviceType)
+		}
+		return fmt.Errorf("%w: %s required by %s", ErrServiceMissing, serviceType, formatPath(path))
+	}
+	if provider.resolved {
+		return nil
+	}
+	path = append(path, serviceType)
+	for _, dep := range provider.deps {
+		if err := c.check(dep, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveTypes checks the given types while holding the Container lock, then resolves them.
+func (c *Container) resolveTypes(serviceTypes []reflect.Type) (instances []reflect.Value, err error) {
+	c.mutex.Lock()
+	for _, serviceType := range serviceTypes {
+		if err = c.check(serviceType, nil); err != nil {
+			c.mutex.Unlock()
+			return nil, err
+		}
+	}
+	c.mutex.Unlock()
+	return c.resolveAll(serviceTypes)
+}
+
+// resolve constructs serviceType and its dependencies; check must have succeeded first.
+// The lock is only held to read and update the provider, never while a constructor runs,
+// and a service being constructed by another call is waited for rather than constructed twice.
+func (c *Container) resolve(serviceType reflect.Type) (instance reflect.Value, err error) {
+	for {
+		c.mutex.Lock()
+		provider, found := c.providers[serviceType]
+		if !found {
+			c.mutex.Unlock()
+			return reflect.Value{}, fmt.Errorf("%w: %s", ErrServiceMissing, serviceType)
+		}
+		if provider.resolved {
+			c.mutex.Unlock()
+			return provider.instance, nil
+		}
+		if pending := provider.pending; pending != nil {
+			c.mutex.Unlock()
+			<-pending
+			continue
+		}
+		provider.pending = make(chan struct{})
+		c.mutex.Unlock()
+		return c.construct(serviceType, provider)
+	}
+}
+
+// construct calls the constructor of provider, which the caller marked as pending, and stores
+// its instance. A failed or panicking constructor leaves the service unresolved, so waiting
+// calls construct it again.
+func (c *Container) construct(serviceType reflect.Type, provider *provider) (instance reflect.Value, err error) {
+	defer func() {
+		c.mutex.Lock()
+		if err == nil && instance.IsValid() {
+			provider.instance, provider.resolved = instance, true
+		}
+		pending := provider.pending
+		provider.pending = nil
+		c.mutex.Unlock()
+		close(pending)
+	}()
+	args, err := c.resolveAll(provider.deps)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	results := provider.constructor.Call(args)
+	if len(results) == 2 && !results[1].IsNil() {
+		return reflect.Value{}, fmt.Errorf("failed to construct %s: %w", serviceType, results[1].Interface().(error))
+	}
+	return results[0], nil
+}
+
+func (c *Container) resolveAll(serviceTypes []reflect.Type) (instances []reflect.Value, err error) {
+	instances = make([]reflect.Value, len(serviceTypes))
+	for i, serviceType := range serviceTypes {
+		if instances[i], err = c.resolve(serviceType); err != nil {
+			return nil, err
+		}
+	}
+	return instances, nil
+}
+
+// constructorTypes returns the type produced by a constructor and the types of its parameters.
+func constructorTypes(constructor reflect.Value) (serviceType reflect.Type, deps []reflect.Type, err error) {
+	if !constructor.IsValid() || constructor.Kind() != reflect.Func || constructor.IsNil() {
+		return nil, nil, fmt.Errorf("%w: %v is not a function", ErrInvalidProvider, constructor)
+	}
+	constructorType := constructor.Type()
+	if constructorType.IsVariadic() {
+		return nil, nil, fmt.Errorf("%w: %s is variadic", ErrInvalidProvider, constructorType)
+	}
+	switch {
+	case constructorType.NumOut() == 1:
+	case constructorType.NumOut() == 2 && constructorType.Out(1) == errorType:
+	default:
+		return nil, nil, fmt.Errorf("%w: %s must return a value and an optional error", ErrInvalidProvider, constructorType)
+	}
+	deps = make([]reflect.Type, constructorType.NumIn())
+	for i := range deps {
+		deps[i] = constructorType.In(i)
+	}
+	return constructorType.Out(0), deps, nil
+}
+
+func formatPath(path []reflect.Type) string {
+	names := make([]string, len(path))
+	for i, pathType := range path {
+		names[i] = pathType.String()
+	}
+	return strings.Join(names, " -> ")
+}
@@ -0,0 +1,182 @@
+package inject
+
+import (
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type Config struct {
+	Name string
+}
+
+type Store struct {
+	Config *Config
+}
+
+type Cache struct {
+	Store *Store
+}
+
+type CycleA struct{}
+
+type CycleB struct{}
+
+func NewStore(config *Config) *Store {
+	return &Store{Config: config}
+}
+
+func NewCache(store *Store) (*Cache, error) {
+	return &Cache{Store: store}, nil
+}
+
+func Test_NewContainer(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		container := NewContainer()
+		assert.NotNil(t, container)
+		assert.Empty(t, container.providers)
+	})
+
+	t.Run("with options", func(t *testing.T) {
+		container := NewContainer(func(*Container) {})
+		assert.NotNil(t, container)
+		assert.Empty(t, container.providers)
+	})
+}
+
+func Test_Container_Provide(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		container := NewContainer()
+		assert.NoError(t, container.Provide(NewStore))
+		assert.NoError(t, container.Provide(NewCache))
+		assert.Contains(t, container.providers, reflect.TypeFor[*Store]())
+		assert.Contains(t, container.providers, reflect.TypeFor[*Cache]())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		container := NewContainer()
+		assert.ErrorIs(t, container.Provide("store"), ErrInvalidProvider)
+		assert.ErrorIs(t, container.Provide(func() {}), ErrInvalidProvider)
+		assert.ErrorIs(t, container.Provide(func() (*Store, *Cache) { return nil, nil }), ErrInvalidProvider)
+		assert.ErrorIs(t, container.Provide(func(...int) *Store { return nil }), ErrInvalidProvider)
+	})
+}
+
+func Test_Resolve(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		container := NewContainer()
+		Supply(container, &Config{Name: "test"})
+		assert.NoError(t, container.Provide(NewStore))
+		assert.NoError(t, container.Provide(NewCache))
+
+		cache, err := Resolve[*Cache](container)
+		assert.NoError(t, err)
+		assert.Equal(t, "test", cache.Store.Config.Name)
+
+		store, err := Resolve[*Store](container)
+		assert.NoError(t, err)
+		assert.Same(t, cache.Store, store)
+	})
+
+	t.Run("interface", func(t *testing.T) {
+		container := NewContainer()
+		Supply[error](container, errors.New("supplied"))
+		err, resolveErr := Resolve[error](container)
+		assert.NoError(t, resolveErr)
+		assert.EqualError(t, err, "supplied")
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		container := NewContainer()
+		assert.NoError(t, container.Provide(NewCache))
+		_, err := Resolve[*Cache](container)
+		assert.ErrorIs(t, err, ErrServiceMissing)
+		assert.ErrorContains(t, err, "*inject.Store required by *inject.Cache")
+	})
+
+	t.Run("constructor error", func(t *testing.T) {
+		errFailed := errors.New("failed")
+		container := NewContainer()
+		assert.NoError(t, container.Provide(func() (*Config, error) { return nil, errFailed }))
+		_, err := Resolve[*Config](container)
+		assert.ErrorIs(t, err, errFailed)
+	})
+}
+
+func Test_Container_Verify(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		container := NewContainer()
+		Supply(container, &Config{})
+		assert.NoError(t, container.Provide(NewStore))
+		assert.NoError(t, container.Verify())
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		container := NewContainer()
+		assert.NoError(t, container.Provide(NewStore))
+		assert.ErrorIs(t, container.Verify(), ErrServiceMissing)
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		container := NewContainer()
+		assert.NoError(t, container.Provide(func(*CycleB) *CycleA { return &CycleA{} }))
+		assert.NoError(t, container.Provide(func(*CycleA) *CycleB { return &CycleB{} }))
+		err := container.Verify()
+		assert.ErrorIs(t, err, ErrServiceCycle)
+		_, err = Resolve[*CycleA](container)
+		assert.ErrorIs(t, err, ErrServiceCycle)
+		assert.ErrorContains(t, err, "*inject.CycleA -> *inject.CycleB -> *inject.CycleA")
+	})
+}
+
+func Test_Container_resolve(t *testing.T) {
+	t.Run("constructor resolves lazily", func(t *testing.T) {
+		container := NewContainer()
+		Supply(container, &Config{Name: "test"})
+		assert.NoError(t, container.Provide(NewStore))
+		assert.NoError(t, container.Provide(func(container *Container) (*Cache, error) {
+			store, err := Resolve[*Store](container)
+			return &Cache{Store: store}, err
+		}))
+		Supply(container, container)
+
+		cache, err := Resolve[*Cache](container)
+		assert.NoError(t, err)
+		assert.Equal(t, "test", cache.Store.Config.Name)
+	})
+
+	t.Run("constructed once", func(t *testing.T) {
+		calls := atomic.Int32{}
+		release := make(chan struct{})
+		container := NewContainer()
+		assert.NoError(t, container.Provide(func() *Config {
+			calls.Add(1)
+			<-release
+			return &Config{}
+		}))
+
+		results := make(chan *Config, 2)
+		for range 2 {
+			go func() {
+				config, _ := Resolve[*Config](container)
+				results <- config
+			}()
+		}
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+		first, second := <-results, <-results
+		assert.Same(t, first, second)
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("constructor panics", func(t *testing.T) {
+		container := NewContainer()
+		assert.NoError(t, container.Provide(func() *Config { panic("failed") }))
+		assert.Panics(t, func() { _, _ = Resolve[*Config](container) })
+		assert.Panics(t, func() { _, _ = Resolve[*Config](container) })
+	})
+}
@@ -0,0 +1,182 @@
+package inject
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/dan-lugg/go-commands/commands"
+)
+
+// failingHandler is returned by a HandlerFactory built by this package when the
+// handler cannot be constructed, so the construction error reaches the caller of Handle.
+type failingHandler[TReq commands.CommandReq[TRes], TRes commands.CommandRes] struct {
+	err error
+}
+
+func (h *failingHandler[TReq, TRes]) Handle(ctx context.Context, req TReq) (res TRes, err error) {
+	return res, h.err
+}
+
+// HandlerFactory is a generic function that builds a commands.HandlerFactory from a constructor
+// whose parameters are resolved from the Container.
+//
+// The constructor must return a commands.Handler[TReq, TRes] implementation, optionally followed
+// by an error. If it returns a pointer to a struct, the fields tagged with InjectTag are also set
+// from the Container. Every dependency is verified when the factory is built.
+//
+// Type Parameters:
+//   - TReq: The type of the command request, which must implement the CommandReq interface.
+//   - TRes: The type of the command response, which must implement the CommandRes interface.
+//
+// Parameters:
+//   - container: A pointer to the Container the dependencies are resolved from.
+//   - constructor: The constructor function of the handler.
+//
+// Returns:
+//   - factory: A HandlerFactory that constructs the handler with its dependencies.
+//   - err: An error wrapping ErrInvalidProvider, ErrServiceMissing or ErrServiceCycle.
+func HandlerFactory[TReq commands.CommandReq[TRes], TRes commands.CommandRes](container *Container, constructor any) (factory commands.HandlerFactory[TReq, TRes], err error) {
+	constructorValue := reflect.ValueOf(constructor)
+	handlerType, deps, err := constructorTypes(constructorValue)
+	if err != nil {
+		return nil, err
+	}
+	if !handlerType.Implements(reflect.TypeFor[commands.Handler[TReq, TRes]]()) {
+		return nil, fmt.Errorf("%w: %s does not implement %s", ErrInvalidProvider, handlerType, reflect.TypeFor[commands.Handler[TReq, TRes]]())
+	}
+	fields, err := injectFields(handlerType)
+	if err != nil {
+		return nil, err
+	}
+	if err = container.VerifyTypes(append(deps, fieldTypes(handlerType, fields)...)...); err != nil {
+		return nil, fmt.Errorf("failed to verify handler %s: %w", handlerType, err)
+	}
+	return func() commands.Handler[TReq, TRes] {
+		args, err := container.resolveTypes(deps)
+		if err != nil {
+			return &failingHandler[TReq, TRes]{err: err}
+		}
+		results := constructorValue.Call(args)
+		if len(results) == 2 && !results[1].IsNil() {
+			return &failingHandler[TReq, TRes]{err: fmt.Errorf("failed to construct %s: %w", handlerType, results[1].Interface().(error))}
+		}
+		if err = container.inject(results[0], fields); err != nil {
+			return &failingHandler[TReq, TRes]{err: err}
+		}
+		return results[0].Interface().(commands.Handler[TReq, TRes])
+	}, nil
+}
+
+// StructFactory is a generic function that builds a commands.HandlerFactory creating a new
+// THandler for each call and setting its fields tagged with InjectTag from the Container.
+// Every dependency is verified when the factory is built.
+//
+// Type Parameters:
+//   - TReq: The type of the command request, which must implement the CommandReq interface.
+//   - TRes: The type of the command response, which must implement the CommandRes interface.
+//   - THandler: The struct type of the handler, whose pointer must implement commands.Handler[TReq, TRes].
+//
+// Parameters:
+//   - container: A pointer to the Container the dependencies are resolved from.
+//
+// Returns:
+//   - factory: A HandlerFactory that creates the handler with its dependencies.
+//   - err: An error wrapping ErrInvalidProvider, ErrServiceMissing or ErrServiceCycle.
+func StructFactory[TReq commands.CommandReq[TRes], TRes commands.CommandRes, THandler any](container *Container) (factory commands.HandlerFactory[TReq, TRes], err error) {
+	return HandlerFactory[TReq, TRes](container, func() *THandler {
+		return new(THandler)
+	})
+}
+
+// InsertHandler is a generic function that catalogs a handler constructed from the Container.
+// See HandlerFactory for the requirements on constructor.
+//
+// Type Parameters:
+//   - TReq: The type of the command request, which must implement the CommandReq interface.
+//   - TRes: The type of the command response, which must implement the CommandRes interface.
+//
+// Parameters:
+//   - catalog: A pointer to the DefaultHandlerCatalog where the handler will be cataloged.
+//   - container: A pointer to the Container the dependencies are resolved from.
+//   - constructor: The constructor function of the handler.
+//   - options: Options applied to the registration, such as commands.WithLifetime.
+//
+// Returns:
+//   - An error if the constructor is invalid or its dependencies cannot be resolved,
+//     in which case nothing is cataloged.
+func InsertHandler[TReq commands.CommandReq[TRes], TRes commands.CommandRes](catalog *commands.DefaultHandlerCatalog, container *Container, constructor any, options ...commands.HandlerOption) error {
+	factory, err := HandlerFactory[TReq, TRes](container, constructor)
+	if err != nil {
+		return err
+	}
+	commands.InsertHandler(catalog, factory, options...)
+	return nil
+}
+
+// InsertStructHandler is a generic function that catalogs a handler created by StructFactory.
+//
+// Type Parameters:
+//   - TReq: The type of the command request, which must implement the CommandReq interface.
+//   - TRes: The type of the command response, which must implement the CommandRes interface.
+//   - THandler: The struct type of the handler, whose pointer must implement commands.Handler[TReq, TRes].
+//
+// Parameters:
+//   - catalog: A pointer to the DefaultHandlerCatalog where the handler will be cataloged.
+//   - container: A pointer to the Container the dependencies are resolved from.
+//   - options: Options applied to the registration, such as commands.WithLifetime.
+//
+// Returns:
+//   - An error if THandler is invalid or its dependencies cannot be resolved,
+//     in which case nothing is cataloged.
+func InsertStructHandler[TReq commands.CommandReq[TRes], TRes commands.CommandRes, THandler any](catalog *commands.DefaultHandlerCatalog, container *Container, options ...commands.HandlerOption) error {
+	factory, err := StructFactory[TReq, TRes, THandler](container)
+	if err != nil {
+		return err
+	}
+	commands.InsertHandler(catalog, factory, options...)
+	return nil
+}
+
+// injectFields returns the indexes of the fields of a struct pointer type tagged with InjectTag.
+func injectFields(handlerType reflect.Type) (fields []int, err error) {
+	if handlerType.Kind() != reflect.Pointer || handlerType.Elem().Kind() != reflect.Struct {
+		return nil, nil
+	}
+	structType := handlerType.Elem()
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if _, ok := field.Tag.Lookup(InjectTag); !ok {
+			continue
+		}
+		if !field.IsExported() {
+			return nil, fmt.Errorf("%w: field %s of %s is tagged %q but not exported", ErrInvalidProvider, field.Name, structType, InjectTag)
+		}
+		fields = append(fields, i)
+	}
+	return fields, nil
+}
+
+func fieldTypes(handlerType reflect.Type, fields []int) (types []reflect.Type) {
+	types = make([]reflect.Type, len(fields))
+	for i, field := range fields {
+		types[i] = handlerType.Elem().Field(field).Type
+	}
+	return types
+}
+
+// inject sets the given fields of the struct pointed to by handler from the Container.
+func (c *Container) inject(handler reflect.Value, fields []int) error {
+	if len(fields) == 0 || handler.IsNil() {
+		return nil
+	}
+	structValue := handler.Elem()
+	values, err := c.resolveTypes(fieldTypes(handler.Type(), fields))
+	if err != nil {
+		return err
+	}
+	for i, field := range fields {
+		structValue.Field(field).Set(values[i])
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package inject
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dan-lugg/go-commands/commands"
+	"github.com/stretchr/testify/assert"
+)
+
+type GreetCommandRes struct {
+	Greeting string
+}
+
+type GreetCommandReq struct {
+	Name string
+}
+
+type GreetHandler struct {
+	commands.Handler[GreetCommandReq, GreetCommandRes]
+	config *Config
+	Store  *Store `inject:""`
+}
+
+func NewGreetHandler(config *Config) *GreetHandler {
+	return &GreetHandler{config: config}
+}
+
+func (h *GreetHandler) Handle(ctx context.Context, req GreetCommandReq) (res GreetCommandRes, err error) {
+	prefix := h.Store.Config.Name
+	if h.config != nil {
+		prefix = h.config.Name
+	}
+	return GreetCommandRes{Greeting: prefix + " " + req.Name}, nil
+}
+
+type UnexportedHandler struct {
+	commands.Handler[GreetCommandReq, GreetCommandRes]
+	store *Store `inject:""`
+}
+
+func (h *UnexportedHandler) Handle(ctx context.Context, req GreetCommandReq) (res GreetCommandRes, err error) {
+	return GreetCommandRes{}, nil
+}
+
+func newGreetContainer() *Container {
+	container := NewContainer()
+	Supply(container, &Config{Name: "hello"})
+	_ = container.Provide(NewStore)
+	return container
+}
+
+func Test_HandlerFactory(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		factory, err := HandlerFactory[GreetCommandReq, GreetCommandRes](newGreetContainer(), NewGreetHandler)
+		assert.NoError(t, err)
+		handler := factory()
+		assert.NotNil(t, handler.(*GreetHandler).Store)
+		res, err := handler.Handle(nil, GreetCommandReq{Name: "world"})
+		assert.NoError(t, err)
+		assert.Equal(t, GreetCommandRes{Greeting: "hello world"}, res)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		_, err := HandlerFactory[GreetCommandReq, GreetCommandRes](NewContainer(), NewGreetHandler)
+		assert.ErrorIs(t, err, ErrServiceMissing)
+	})
+
+	t.Run("not a handler", func(t *testing.T) {
+		_, err := HandlerFactory[GreetCommandReq, GreetCommandRes](newGreetContainer(), NewStore)
+		assert.ErrorIs(t, err, ErrInvalidProvider)
+	})
+
+	t.Run("unexported field", func(t *testing.T) {
+		_, err := StructFactory[GreetCommandReq, GreetCommandRes, UnexportedHandler](newGreetContainer())
+		assert.ErrorIs(t, err, ErrInvalidProvider)
+	})
+}
+
+func Test_InsertHandler(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		catalog := commands.NewDefaultHandlerCatalog()
+		err := InsertHandler[GreetCommandReq, GreetCommandRes](catalog, newGreetContainer(), NewGreetHandler)
+		assert.NoError(t, err)
+		res, err := commands.Handle[GreetCommandReq, GreetCommandRes](nil, catalog, GreetCommandReq{Name: "world"})
+		assert.NoError(t, err)
+		assert.Equal(t, GreetCommandRes{Greeting: "hello world"}, res)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		catalog := commands.NewDefaultHandlerCatalog()
+		err := InsertHandler[GreetCommandReq, GreetCommandRes](catalog, NewContainer(), NewGreetHandler)
+		assert.ErrorIs(t, err, ErrServiceMissing)
+		assert.Empty(t, catalog.TypeMap())
+	})
+}
+
+func Test_InsertStructHandler(t *testing.T) {
+	catalog := commands.NewDefaultHandlerCatalog()
+	err := InsertStructHandler[GreetCommandReq, GreetCommandRes, GreetHandler](catalog, newGreetContainer(), commands.WithLifetime(commands.LifetimeTransient))
+	assert.NoError(t, err)
+	res, err := commands.Handle[GreetCommandReq, GreetCommandRes](nil, catalog, GreetCommandReq{Name: "world"})
+	assert.NoError(t, err)
+	assert.Equal(t, GreetCommandRes{Greeting: "hello world"}, res)
+}
@@ -0,0 +1,514 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/dan-lugg/go-commands/commands"
+	"github.com/dan-lugg/go-commands/util"
+)
+
+var (
+	ErrJobMissing     = errors.New("job missing")
+	ErrJobFinished    = errors.New("job already finished")
+	ErrManagerStopped = errors.New("job manager stopped")
+	ErrQueueFull      = errors.New("job queue full")
+)
+
+const (
+	// DefaultConcurrency is the number of jobs a Manager runs at once, unless overridden with WithConcurrency.
+	DefaultConcurrency = 8
+
+	// DefaultRetention is how long a Manager keeps a finished job, unless overridden with WithRetention.
+	DefaultRetention = time.Hour
+
+	// DefaultMaxRetained is the number of finished jobs a Manager keeps, unless overridden with WithMaxRetained.
+	DefaultMaxRetained = 1000
+
+	// DefaultMaxQueued is the number of jobs a Manager keeps waiting for a free slot, unless overridden with WithMaxQueued.
+	DefaultMaxQueued = 1000
+)
+
+// Status is the state of a Job in its lifecycle.
+type Status string
+
+const (
+	// StatusQueued is the status of a Job waiting for a free slot.
+	StatusQueued Status = "queued"
+	// StatusRunning is the status of a Job whose command is running.
+	StatusRunning Status = "running"
+	// StatusSucceeded is the status of a Job whose command returned a result.
+	StatusSucceeded Status = "succeeded"
+	// StatusFailed is the status of a Job whose command returned an error.
+	StatusFailed Status = "failed"
+	// StatusCanceled is the status of a Job canceled before its command returned.
+	StatusCanceled Status = "canceled"
+)
+
+// Finished reports whether the Status is final, that is succeeded, failed or canceled.
+func (s Status) Finished() bool {
+	return s == StatusSucceeded || s == StatusFailed || s == StatusCanceled
+}
+
+// Job is a snapshot of a command submitted to a Manager.
+//
+// Fields:
+//   - ID: The unique ID of the Job.
+//   - Name: The mapped name of the request type.
+//   - Status: The Status of the Job.
+//   - Progress: The latest commands.Progress reported by the handler, if any.
+//   - Result: The encoded result, if the Job succeeded.
+//   - Error: A human-readable description of the failure, if the Job failed or was canceled.
+//   - Submitted: The time the Job was submitted.
+//   - Started: The time the command started, or the zero time.Time if it has not started.
+//   - Finished: The time the Job finished, or the zero time.Time if it has not finished.
+//   - Err: The error of the Job, for in-process callers; it is not serialized.
+type Job struct {
+	ID        string             `json:"id"`
+	Name      string             `json:"name"`
+	Status    Status             `json:"status"`
+	Progress  *commands.Progress `json:"progress,omitempty"`
+	Result    json.RawMessage    `json:"result,omitempty"`
+	Error     string             `json:"error,omitempty"`
+	Submitted time.Time          `json:"submitted"`
+	Started   time.Time          `json:"started"`
+	Finished  time.Time          `json:"finished"`
+	Err       error              `json:"-"`
+}
+
+// entry is the state a Manager keeps for a Job.
+//
+// Fields:
+//   - job: The current snapshot of the Job.
+//   - seq: The position of the Job in the order of submission.
+//   - req: The decoded request of the Job.
+//   - ctx: The context.Context the command runs with.
+//   - cancel: The function canceling ctx.
+//   - canceled: Whether the Job was canceled.
+//   - done: A channel closed once the Job has finished.
+type entry struct {
+	job      Job
+	seq      int
+	req      commands.CommandReq[commands.CommandRes]
+	ctx      context.Context
+	cancel   context.CancelFunc
+	canceled bool
+	done     chan struct{}
+}
+
+// Manager runs commands in the background as jobs, which any caller can poll or cancel by ID.
+//
+// Submitted jobs are queued and run in the order they were submitted, at most the configured
+// concurrency at once; once the maximum number of jobs are waiting, further jobs are rejected
+// with ErrQueueFull. Canceling a Job cancels the context.Context its handler runs with. Finished
+// jobs are kept until they are older than the retention, or until more finished jobs than the
+// maximum are kept, the oldest being removed first.
+//
+// Fields:
+//   - mappingCatalog: The MappingCatalog used to resolve request names to types and back.
+//   - decoderCatalog: The DecoderCatalog used to decode payloads.
+//   - handlerCatalog: The HandlerCatalog the commands are dispatched through.
+//   - encoderCatalog: The EncoderCatalog used to encode results, or nil to encode them as JSON.
+//   - dispatcher: The commands.Dispatcher combining the catalogs.
+//   - concurrency: The number of jobs run at once.
+//   - retention: How long a finished Job is kept; a non-positive value keeps it indefinitely.
+//   - maxRetained: The number of finished jobs kept; a non-positive value keeps all of them.
+//   - maxQueued: The number of jobs waiting for a free slot; a non-positive value removes the limit.
+//   - entries: A map that associates job IDs with their state.
+//   - queue: The IDs of the queued jobs, in the order they were submitted.
+//   - finished: The IDs of the finished jobs, in the order they finished.
+//   - nextSeq: The position of the next Job submitted.
+//   - running: The number of running jobs.
+//   - stopped: Whether the Manager has been stopped.
+//   - inflight: The running jobs.
+type Manager struct {
+	mappingCatalog commands.MappingCatalog
+	decoderCatalog commands.DecoderCatalog
+	handlerCatalog commands.HandlerCatalog
+	encoderCatalog commands.EncoderCatalog
+	dispatcher     *commands.Dispatcher
+	concurrency    int
+	retention      time.Duration
+	maxRetained    int
+	maxQueued      int
+	mutex          sync.Mutex
+	entries        map[string]*entry
+	queue          []string
+	finished       []string
+	nextSeq        int
+	running        int
+	stopped        bool
+	inflight       sync.WaitGroup
+}
+
+type ManagerOption = util.Option[*Manager]
+
+// WithConcurrency returns an option that sets the number of jobs a Manager runs at once.
+//
+// Parameters:
+//   - concurrency: The number of jobs run at once; values below 1 are treated as 1.
+func WithConcurrency(concurrency int) ManagerOption {
+	return func(m *Manager) {
+		m.concurrency = max(concurrency, 1)
+	}
+}
+
+// WithRetention returns an option that sets how long a Manager keeps a finished Job.
+//
+// Parameters:
+//   - retention: How long a finished Job is kept; a non-positive value keeps it indefinitely.
+func WithRetention(retention time.Duration) ManagerOption {
+	return func(m *Manager) {
+		m.retention = retention
+	}
+}
+
+// WithMaxRetained returns an option that sets the number of finished jobs a Manager keeps.
+//
+// Parameters:
+//   - maxRetained: The number of finished jobs kept; a non-positive value keeps all of them.
+func WithMaxRetained(maxRetained int) ManagerOption {
+	return func(m *Manager) {
+		m.maxRetained = maxRetained
+	}
+}
+
+// WithMaxQueued returns an option that sets the number of jobs a Manager keeps waiting for a
+// free slot. Jobs submitted while that many are waiting are rejected with ErrQueueFull.
+//
+// Parameters:
+//   - maxQueued: The number of jobs waiting for a free slot; a non-positive value removes the limit.
+func WithMaxQueued(maxQueued int) ManagerOption {
+	return func(m *Manager) {
+		m.maxQueued = maxQueued
+	}
+}
+
+// WithEncoderCatalog returns an option that sets the EncoderCatalog a Manager encodes results with.
+//
+// Parameters:
+//   - encoderCatalog: The EncoderCatalog used to encode results, or nil to encode them as JSON.
+func WithEncoderCatalog(encoderCatalog commands.EncoderCatalog) ManagerOption {
+	return func(m *Manager) {
+		m.encoderCatalog = encoderCatalog
+	}
+}
+
+// NewManager creates and returns a new instance of Manager.
+//
+// By default the Manager uses DefaultConcurrency, DefaultRetention, DefaultMaxRetained and
+// DefaultMaxQueued.
+//
+// Parameters:
+//   - mappingCatalog: The MappingCatalog used to resolve request names to types and back.
+//   - decoderCatalog: The DecoderCatalog used to decode payloads.
+//   - handlerCatalog: The HandlerCatalog the commands are dispatched through.
+//   - options: Options applied to the Manager.
+//
+// Returns:
+//   - A pointer to a Manager instance.
+func NewManager(mappingCatalog commands.MappingCatalog, decoderCatalog commands.DecoderCatalog, handlerCatalog commands.HandlerCatalog, options ...ManagerOption) (manager *Manager) {
+	manager = &Manager{
+		mappingCatalog: mappingCatalog,
+		decoderCatalog: decoderCatalog,
+		handlerCatalog: handlerCatalog,
+		encoderCatalog: nil,
+		concurrency:    DefaultConcurrency,
+		retention:      DefaultRetention,
+		maxRetained:    DefaultMaxRetained,
+		maxQueued:      DefaultMaxQueued,
+		mutex:          sync.Mutex{},
+		entries:        make(map[string]*entry),
+		queue:          make([]string, 0),
+		finished:       make([]string, 0),
+		nextSeq:        0,
+		running:        0,
+		stopped:        false,
+	}
+	for _, option := range options {
+		option(manager)
+	}
+	manager.dispatcher = commands.NewDispatcher(mappingCatalog, decoderCatalog, handlerCatalog,
+		commands.WithEncoderCatalog(manager.encoderCatalog))
+	return manager
+}
+
+// Submit decodes a payload into the request type mapped to a name and queues it as a Job.
+//
+// The command runs with a context.Context carrying the values of ctx, but not its cancellation or
+// deadline, so a Job outlives the request that submitted it.
+//
+// Parameters:
+//   - ctx: A context.Context whose values are provided to the command.
+//   - reqName: The mapped name of the request type.
+//   - payload: The serialized request.
+//
+// Returns:
+//   - job: The queued Job.
+//   - err: An error if the request cannot be resolved or decoded, wrapping ErrQueueFull if too
+//     many jobs are waiting, or wrapping ErrManagerStopped if the Manager has been stopped.
+func (m *Manager) Submit(ctx context.Context, reqName string, payload []byte) (job Job, err error) {
+	req, err := m.dispatcher.Decode(reqName, payload)
+	if err != nil {
+		return Job{}, err
+	}
+	return m.submit(ctx, reqName, req)
+}
+
+// SubmitReq queues a request as a Job, as Submit does for a decoded request.
+//
+// Parameters:
+//   - ctx: A context.Context whose values are provided to the command.
+//   - req: The request to run; its type must be mapped in the MappingCatalog.
+//
+// Returns:
+//   - job: The queued Job.
+//   - err: An error wrapping ErrMappingMissing if the request type is not mapped, wrapping
+//     ErrQueueFull if too many jobs are waiting, or wrapping ErrManagerStopped if the Manager
+//     has been stopped.
+func (m *Manager) SubmitReq(ctx context.Context, req commands.CommandReq[commands.CommandRes]) (job Job, err error) {
+	reqName, err := m.mappingCatalog.ByType(reflect.TypeOf(req))
+	if err != nil {
+		return Job{}, err
+	}
+	return m.submit(ctx, reqName, req)
+}
+
+// Get returns the current snapshot of a Job.
+//
+// Parameters:
+//   - id: The ID of the Job.
+//
+// Returns:
+//   - job: The snapshot of the Job.
+//   - err: An error wrapping ErrJobMissing if no Job has the ID, or if it is no longer retained.
+func (m *Manager) Get(id string) (job Job, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.prune(time.Now())
+	found, ok := m.entries[id]
+	if !ok {
+		return Job{}, fmt.Errorf("%w: %s", ErrJobMissing, id)
+	}
+	return found.job, nil
+}
+
+// Jobs returns the snapshots of the retained jobs, ordered by submission.
+//
+// Returns:
+//   - The snapshots of the jobs.
+func (m *Manager) Jobs() []Job {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.prune(time.Now())
+	entries := make([]*entry, 0, len(m.entries))
+	for _, found := range m.entries {
+		entries = append(entries, found)
+	}
+	slices.SortFunc(entries, func(a, b *entry) int {
+		return a.seq - b.seq
+	})
+	jobs := make([]Job, 0, len(entries))
+	for _, found := range entries {
+		jobs = append(jobs, found.job)
+	}
+	return jobs
+}
+
+// Wait waits for a Job to finish and returns its final snapshot.
+//
+// Parameters:
+//   - ctx: A context.Context bounding the wait; it does not affect the Job.
+//   - id: The ID of the Job.
+//
+// Returns:
+//   - job: The final snapshot of the Job.
+//   - err: An error wrapping ErrJobMissing if no Job has the ID, or the error of ctx if it ends first.
+func (m *Manager) Wait(ctx context.Context, id string) (job Job, err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	m.mutex.Lock()
+	found, ok := m.entries[id]
+	m.mutex.Unlock()
+	if !ok {
+		return Job{}, fmt.Errorf("%w: %s", ErrJobMissing, id)
+	}
+	select {
+	case <-found.done:
+	case <-ctx.Done():
+		return Job{}, ctx.Err()
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return found.job, nil
+}
+
+// Cancel cancels a Job. A queued Job is canceled at once; a running Job has the context.Context of
+// its handler canceled, and is canceled once the handler returns an error. A handler that returns
+// a result anyway still succeeds.
+//
+// Parameters:
+//   - id: The ID of the Job.
+//
+// Returns:
+//   - job: The snapshot of the Job after the cancellation.
+//   - err: An error wrapping ErrJobMissing if no Job has the ID, or wrapping ErrJobFinished if
+//     the Job has already finished.
+func (m *Manager) Cancel(id string) (job Job, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.prune(time.Now())
+	found, ok := m.entries[id]
+	if !ok {
+		return Job{}, fmt.Errorf("%w: %s", ErrJobMissing, id)
+	}
+	if found.job.Status.Finished() {
+		return found.job, fmt.Errorf("%w: %s", ErrJobFinished, id)
+	}
+	m.cancel(found)
+	return found.job, nil
+}
+
+// Stop cancels every queued and running Job and waits for the running handlers to return.
+// Jobs submitted afterward are rejected with ErrManagerStopped.
+func (m *Manager) Stop() {
+	m.mutex.Lock()
+	m.stopped = true
+	for _, found := range m.entries {
+		if !found.job.Status.Finished() {
+			m.cancel(found)
+		}
+	}
+	m.mutex.Unlock()
+	m.inflight.Wait()
+}
+
+// submit registers a Job for a decoded request and starts it if a slot is free.
+func (m *Manager) submit(ctx context.Context, reqName string, req commands.CommandReq[commands.CommandRes]) (job Job, err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.stopped {
+		return Job{}, ErrManagerStopped
+	}
+	if m.maxQueued > 0 && m.running >= m.concurrency && len(m.queue) >= m.maxQueued {
+		return Job{}, fmt.Errorf("%w: %d jobs queued", ErrQueueFull, len(m.queue))
+	}
+	now := time.Now()
+	m.prune(now)
+	jobCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	found := &entry{
+		job: Job{
+			ID:        newID(),
+			Name:      reqName,
+			Status:    StatusQueued,
+			Submitted: now,
+		},
+		seq:    m.nextSeq,
+		req:    req,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	found.ctx = commands.ContextWithProgress(jobCtx, commands.NewProgressReporter(func(progress commands.Progress) {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+		found.job.Progress = &progress
+	}))
+	m.nextSeq++
+	m.entries[found.job.ID] = found
+	m.queue = append(m.queue, found.job.ID)
+	m.start()
+	return found.job, nil
+}
+
+// start runs queued jobs while a slot is free. The caller must hold the mutex.
+func (m *Manager) start() {
+	for m.running < m.concurrency && len(m.queue) > 0 {
+		found := m.entries[m.queue[0]]
+		m.queue = m.queue[1:]
+		m.running++
+		found.job.Status, found.job.Started = StatusRunning, time.Now()
+		m.inflight.Add(1)
+		go m.run(found)
+	}
+}
+
+// run dispatches the request of a Job and records its outcome.
+func (m *Manager) run(found *entry) {
+	defer m.inflight.Done()
+	res, err := m.handlerCatalog.Handle(found.ctx, found.req)
+	var resData []byte
+	if err == nil {
+		resData, err = m.dispatcher.Encode(res)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	found.cancel()
+	m.running--
+	switch {
+	case err == nil:
+		m.finish(found, StatusSucceeded, resData, nil)
+	case found.canceled:
+		m.finish(found, StatusCanceled, nil, err)
+	default:
+		m.finish(found, StatusFailed, nil, err)
+	}
+	m.start()
+}
+
+// cancel cancels a Job that has not finished. The caller must hold the mutex.
+func (m *Manager) cancel(found *entry) {
+	found.canceled = true
+	found.cancel()
+	if found.job.Status == StatusQueued {
+		m.queue = slices.DeleteFunc(m.queue, func(id string) bool {
+			return id == found.job.ID
+		})
+		m.finish(found, StatusCanceled, nil, context.Canceled)
+	}
+}
+
+// finish records the outcome of a Job and applies the retention. The caller must hold the mutex.
+func (m *Manager) finish(found *entry, status Status, resData []byte, err error) {
+	found.job.Status, found.job.Result, found.job.Finished, found.job.Err = status, resData, time.Now(), err
+	if err != nil {
+		found.job.Error = err.Error()
+	}
+	close(found.done)
+	m.finished = append(m.finished, found.job.ID)
+	m.prune(found.job.Finished)
+}
+
+// prune removes the finished jobs beyond the retention. The caller must hold the mutex.
+func (m *Manager) prune(now time.Time) {
+	expired := 0
+	for _, id := range m.finished {
+		overflow := m.maxRetained > 0 && len(m.finished)-expired > m.maxRetained
+		stale := m.retention > 0 && now.Sub(m.entries[id].job.Finished) > m.retention
+		if !overflow && !stale {
+			break
+		}
+		delete(m.entries, id)
+		expired++
+	}
+	m.finished = m.finished[expired:]
+}
+
+// newID returns a random job ID.
+func newID() string {
+	data := make([]byte, 16)
+	_, _ = rand.Read(data)
+	return hex.EncodeToString(data)
+}
@@ -0,0 +1,286 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dan-lugg/go-commands/commands"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_NewManager(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		mappingCatalog, decoderCatalog, handlerCatalog, _ := newCatalogs()
+		manager := NewManager(mappingCatalog, decoderCatalog, handlerCatalog)
+		assert.NotNil(t, manager)
+		assert.NotNil(t, manager.dispatcher)
+		assert.Equal(t, DefaultConcurrency, manager.concurrency)
+		assert.Equal(t, DefaultRetention, manager.retention)
+		assert.Equal(t, DefaultMaxRetained, manager.maxRetained)
+		assert.Equal(t, DefaultMaxQueued, manager.maxQueued)
+	})
+
+	t.Run("with options", func(t *testing.T) {
+		mappingCatalog, decoderCatalog, handlerCatalog, _ := newCatalogs()
+		manager := NewManager(mappingCatalog, decoderCatalog, handlerCatalog,
+			WithConcurrency(0), WithRetention(time.Minute), WithMaxRetained(5), WithMaxQueued(3))
+		assert.Equal(t, 1, manager.concurrency)
+		assert.Equal(t, time.Minute, manager.retention)
+		assert.Equal(t, 5, manager.maxRetained)
+		assert.Equal(t, 3, manager.maxQueued)
+	})
+}
+
+func Test_Manager_Submit(t *testing.T) {
+	mappingCatalog, decoderCatalog, handlerCatalog, _ := newCatalogs()
+	manager := NewManager(mappingCatalog, decoderCatalog, handlerCatalog)
+	defer manager.Stop()
+
+	t.Run("succeeded", func(t *testing.T) {
+		job, err := manager.Submit(context.Background(), EchoReqName, []byte(`{"value": "hello"}`))
+		assert.NoError(t, err)
+		assert.NotEmpty(t, job.ID)
+		assert.Equal(t, EchoReqName, job.Name)
+
+		job, err = manager.Wait(context.Background(), job.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, StatusSucceeded, job.Status)
+		assert.JSONEq(t, `{"value": "hello"}`, string(job.Result))
+		assert.Equal(t, &commands.Progress{Percent: 100, Stage: "echo", Message: "hello"}, job.Progress)
+		assert.False(t, job.Started.IsZero())
+		assert.False(t, job.Finished.Before(job.Started))
+		assert.Empty(t, job.Error)
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		job, err := manager.SubmitReq(context.Background(), FailCommandReq{})
+		assert.NoError(t, err)
+		assert.Equal(t, FailReqName, job.Name)
+
+		job, err = manager.Wait(context.Background(), job.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, StatusFailed, job.Status)
+		assert.ErrorIs(t, job.Err, ErrFailure)
+		assert.Equal(t, ErrFailure.Error(), job.Error)
+		assert.Nil(t, job.Result)
+	})
+
+	t.Run("mapping missing", func(t *testing.T) {
+		_, err := manager.Submit(context.Background(), "unknown", []byte(`{}`))
+		assert.ErrorIs(t, err, commands.ErrMappingMissing)
+		_, err = manager.SubmitReq(context.Background(), commands.CommandReq[commands.CommandRes](nil))
+		assert.Error(t, err)
+	})
+
+	t.Run("decoder failure", func(t *testing.T) {
+		_, err := manager.Submit(context.Background(), EchoReqName, []byte(`{`))
+		assert.ErrorIs(t, err, commands.ErrDecoderFailure)
+	})
+
+	t.Run("outlives submitter", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		job, err := manager.Submit(ctx, EchoReqName, []byte(`{"value": "later"}`))
+		cancel()
+		assert.NoError(t, err)
+		job, err = manager.Wait(context.Background(), job.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, StatusSucceeded, job.Status)
+	})
+}
+
+func Test_Manager_Queue(t *testing.T) {
+	mappingCatalog, decoderCatalog, handlerCatalog, gate := newCatalogs()
+	manager := NewManager(mappingCatalog, decoderCatalog, handlerCatalog, WithConcurrency(1))
+	defer manager.Stop()
+
+	first, err := manager.SubmitReq(context.Background(), BlockCommandReq{Key: "first"})
+	assert.NoError(t, err)
+	second, err := manager.SubmitReq(context.Background(), BlockCommandReq{Key: "second"})
+	assert.NoError(t, err)
+	assert.Equal(t, "first", <-gate.started)
+
+	first, _ = manager.Get(first.ID)
+	second, _ = manager.Get(second.ID)
+	assert.Equal(t, StatusRunning, first.Status)
+	assert.Equal(t, StatusQueued, second.Status)
+	assert.True(t, second.Started.IsZero())
+
+	jobs := manager.Jobs()
+	assert.Len(t, jobs, 2)
+	assert.Equal(t, first.ID, jobs[0].ID)
+	assert.Equal(t, second.ID, jobs[1].ID)
+
+	gate.release <- struct{}{}
+	assert.Equal(t, "second", <-gate.started)
+	first, _ = manager.Wait(context.Background(), first.ID)
+	assert.Equal(t, StatusSucceeded, first.Status)
+	gate.release <- struct{}{}
+	second, _ = manager.Wait(context.Background(), second.ID)
+	assert.Equal(t, StatusSucceeded, second.Status)
+}
+
+func Test_Manager_MaxQueued(t *testing.T) {
+	mappingCatalog, decoderCatalog, handlerCatalog, gate := newCatalogs()
+	manager := NewManager(mappingCatalog, decoderCatalog, handlerCatalog, WithConcurrency(1), WithMaxQueued(1))
+	defer manager.Stop()
+
+	running, err := manager.SubmitReq(context.Background(), BlockCommandReq{Key: "running"})
+	assert.NoError(t, err)
+	queued, err := manager.SubmitReq(context.Background(), BlockCommandReq{Key: "queued"})
+	assert.NoError(t, err)
+	assert.Equal(t, "running", <-gate.started)
+
+	_, err = manager.SubmitReq(context.Background(), EchoCommandReq{Value: "a"})
+	assert.ErrorIs(t, err, ErrQueueFull)
+	assert.Len(t, manager.Jobs(), 2)
+
+	_, err = manager.Cancel(queued.ID)
+	assert.NoError(t, err)
+	accepted, err := manager.SubmitReq(context.Background(), BlockCommandReq{Key: "accepted"})
+	assert.NoError(t, err)
+	assert.Equal(t, StatusQueued, accepted.Status)
+
+	gate.release <- struct{}{}
+	running, _ = manager.Wait(context.Background(), running.ID)
+	assert.Equal(t, StatusSucceeded, running.Status)
+	assert.Equal(t, "accepted", <-gate.started)
+	gate.release <- struct{}{}
+}
+
+func Test_Manager_Cancel(t *testing.T) {
+	mappingCatalog, decoderCatalog, handlerCatalog, gate := newCatalogs()
+	manager := NewManager(mappingCatalog, decoderCatalog, handlerCatalog, WithConcurrency(1))
+	defer manager.Stop()
+
+	running, _ := manager.SubmitReq(context.Background(), BlockCommandReq{Key: "running"})
+	queued, _ := manager.SubmitReq(context.Background(), BlockCommandReq{Key: "queued"})
+	<-gate.started
+
+	t.Run("queued", func(t *testing.T) {
+		job, err := manager.Cancel(queued.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, StatusCanceled, job.Status)
+		assert.ErrorIs(t, job.Err, context.Canceled)
+		assert.True(t, job.Started.IsZero())
+	})
+
+	t.Run("running", func(t *testing.T) {
+		job, err := manager.Cancel(running.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, StatusRunning, job.Status)
+		job, err = manager.Wait(context.Background(), running.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, StatusCanceled, job.Status)
+		assert.ErrorIs(t, job.Err, context.Canceled)
+		assert.Equal(t, &commands.Progress{Percent: 50, Stage: "block", Message: "running"}, job.Progress)
+	})
+
+	t.Run("finished", func(t *testing.T) {
+		_, err := manager.Cancel(running.ID)
+		assert.ErrorIs(t, err, ErrJobFinished)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		_, err := manager.Cancel("unknown")
+		assert.ErrorIs(t, err, ErrJobMissing)
+		_, err = manager.Get("unknown")
+		assert.ErrorIs(t, err, ErrJobMissing)
+		_, err = manager.Wait(context.Background(), "unknown")
+		assert.ErrorIs(t, err, ErrJobMissing)
+	})
+}
+
+func Test_Manager_Wait(t *testing.T) {
+	mappingCatalog, decoderCatalog, handlerCatalog, gate := newCatalogs()
+	manager := NewManager(mappingCatalog, decoderCatalog, handlerCatalog)
+	defer manager.Stop()
+
+	job, _ := manager.SubmitReq(context.Background(), BlockCommandReq{Key: "wait"})
+	<-gate.started
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := manager.Wait(ctx, job.ID)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	job, _ = manager.Get(job.ID)
+	assert.Equal(t, StatusRunning, job.Status)
+}
+
+func Test_Manager_Retention(t *testing.T) {
+	t.Run("max retained", func(t *testing.T) {
+		mappingCatalog, decoderCatalog, handlerCatalog, _ := newCatalogs()
+		manager := NewManager(mappingCatalog, decoderCatalog, handlerCatalog, WithConcurrency(1), WithMaxRetained(2))
+		defer manager.Stop()
+
+		ids := make([]string, 0)
+		for _, value := range []string{"a", "b", "c"} {
+			job, _ := manager.SubmitReq(context.Background(), EchoCommandReq{Value: value})
+			_, _ = manager.Wait(context.Background(), job.ID)
+			ids = append(ids, job.ID)
+		}
+		_, err := manager.Get(ids[0])
+		assert.ErrorIs(t, err, ErrJobMissing)
+		jobs := manager.Jobs()
+		assert.Len(t, jobs, 2)
+		assert.Equal(t, ids[1], jobs[0].ID)
+		assert.Equal(t, ids[2], jobs[1].ID)
+	})
+
+	t.Run("retention", func(t *testing.T) {
+		mappingCatalog, decoderCatalog, handlerCatalog, gate := newCatalogs()
+		manager := NewManager(mappingCatalog, decoderCatalog, handlerCatalog, WithRetention(20*time.Millisecond))
+		defer manager.Stop()
+
+		finished, _ := manager.SubmitReq(context.Background(), EchoCommandReq{Value: "a"})
+		_, _ = manager.Wait(context.Background(), finished.ID)
+		running, _ := manager.SubmitReq(context.Background(), BlockCommandReq{Key: "b"})
+		<-gate.started
+		_, err := manager.Get(finished.ID)
+		assert.NoError(t, err)
+
+		time.Sleep(40 * time.Millisecond)
+		_, err = manager.Get(finished.ID)
+		assert.ErrorIs(t, err, ErrJobMissing)
+		_, err = manager.Get(running.ID)
+		assert.NoError(t, err)
+	})
+
+	t.Run("unlimited", func(t *testing.T) {
+		mappingCatalog, decoderCatalog, handlerCatalog, _ := newCatalogs()
+		manager := NewManager(mappingCatalog, decoderCatalog, handlerCatalog, WithRetention(0), WithMaxRetained(0))
+		defer manager.Stop()
+
+		for i := 0; i < 3; i++ {
+			job, _ := manager.SubmitReq(context.Background(), EchoCommandReq{Value: "a"})
+			_, _ = manager.Wait(context.Background(), job.ID)
+		}
+		assert.Len(t, manager.Jobs(), 3)
+	})
+}
+
+func Test_Manager_Stop(t *testing.T) {
+	mappingCatalog, decoderCatalog, handlerCatalog, gate := newCatalogs()
+	manager := NewManager(mappingCatalog, decoderCatalog, handlerCatalog, WithConcurrency(1))
+
+	running, _ := manager.SubmitReq(context.Background(), BlockCommandReq{Key: "running"})
+	queued, _ := manager.SubmitReq(context.Background(), BlockCommandReq{Key: "queued"})
+	<-gate.started
+	manager.Stop()
+
+	running, _ = manager.Get(running.ID)
+	queued, _ = manager.Get(queued.ID)
+	assert.Equal(t, StatusCanceled, running.Status)
+	assert.Equal(t, StatusCanceled, queued.Status)
+
+	_, err := manager.SubmitReq(context.Background(), EchoCommandReq{Value: "a"})
+	assert.ErrorIs(t, err, ErrManagerStopped)
+}
+
+func Test_Status_Finished(t *testing.T) {
+	assert.False(t, StatusQueued.Finished())
+	assert.False(t, StatusRunning.Finished())
+	assert.True(t, StatusSucceeded.Finished())
+	assert.True(t, StatusFailed.Finished())
+	assert.True(t, StatusCanceled.Finished())
+}
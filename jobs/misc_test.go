@@ -0,0 +1,105 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dan-lugg/go-commands/commands"
+)
+
+const (
+	EchoReqName  = "echo"
+	BlockReqName = "block"
+	FailReqName  = "fail"
+)
+
+var ErrFailure = errors.New("failure")
+
+type EchoCommandRes struct {
+	Value string `json:"value"`
+}
+
+type EchoCommandReq struct {
+	Value string `json:"value"`
+}
+
+type EchoHandler struct {
+	commands.Handler[EchoCommandReq, EchoCommandRes]
+}
+
+func (h *EchoHandler) Handle(ctx context.Context, req EchoCommandReq) (res EchoCommandRes, err error) {
+	commands.ReportProgress(ctx, 100, "echo", req.Value)
+	return EchoCommandRes{Value: req.Value}, nil
+}
+
+type BlockCommandRes struct{}
+
+type BlockCommandReq struct {
+	Key string `json:"key"`
+}
+
+// Gate releases the BlockCommandReq requests handled by BlockHandler, and signals when they start.
+type Gate struct {
+	started chan string
+	release chan struct{}
+}
+
+func NewGate() *Gate {
+	return &Gate{
+		started: make(chan string, 16),
+		release: make(chan struct{}),
+	}
+}
+
+type BlockHandler struct {
+	commands.Handler[BlockCommandReq, BlockCommandRes]
+	gate *Gate
+}
+
+func (h *BlockHandler) Handle(ctx context.Context, req BlockCommandReq) (res BlockCommandRes, err error) {
+	h.gate.started <- req.Key
+	commands.ReportProgress(ctx, 50, "block", req.Key)
+	select {
+	case <-h.gate.release:
+		return BlockCommandRes{}, nil
+	case <-ctx.Done():
+		return BlockCommandRes{}, ctx.Err()
+	}
+}
+
+type FailCommandRes struct{}
+
+type FailCommandReq struct{}
+
+type FailHandler struct {
+	commands.Handler[FailCommandReq, FailCommandRes]
+}
+
+func (h *FailHandler) Handle(ctx context.Context, req FailCommandReq) (res FailCommandRes, err error) {
+	return FailCommandRes{}, ErrFailure
+}
+
+func newCatalogs() (*commands.DefaultMappingCatalog, *commands.DefaultDecoderCatalog, *commands.DefaultHandlerCatalog, *Gate) {
+	mappingCatalog := commands.NewMappingCatalog()
+	commands.InsertMapping[EchoCommandReq](mappingCatalog, EchoReqName)
+	commands.InsertMapping[BlockCommandReq](mappingCatalog, BlockReqName)
+	commands.InsertMapping[FailCommandReq](mappingCatalog, FailReqName)
+
+	decoderCatalog := commands.NewDefaultDecoderCatalog()
+	commands.InsertDecoder[EchoCommandReq](decoderCatalog, commands.DefaultDecoder[EchoCommandReq]())
+	commands.InsertDecoder[BlockCommandReq](decoderCatalog, commands.DefaultDecoder[BlockCommandReq]())
+	commands.InsertDecoder[FailCommandReq](decoderCatalog, commands.DefaultDecoder[FailCommandReq]())
+
+	gate := NewGate()
+	handlerCatalog := commands.NewDefaultHandlerCatalog()
+	commands.InsertHandler[EchoCommandReq, EchoCommandRes](handlerCatalog, func() commands.Handler[EchoCommandReq, EchoCommandRes] {
+		return &EchoHandler{}
+	})
+	commands.InsertHandler[BlockCommandReq, BlockCommandRes](handlerCatalog, func() commands.Handler[BlockCommandReq, BlockCommandRes] {
+		return &BlockHandler{gate: gate}
+	})
+	commands.InsertHandler[FailCommandReq, FailCommandRes](handlerCatalog, func() commands.Handler[FailCommandReq, FailCommandRes] {
+		return &FailHandler{}
+	})
+	return mappingCatalog, decoderCatalog, handlerCatalog, gate
+}
@@ -0,0 +1,152 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/dan-lugg/go-commands/commands"
+	"github.com/dan-lugg/go-commands/httptransport"
+	"github.com/dan-lugg/go-commands/util"
+)
+
+// Server is an http.Handler exposing a Manager over HTTP:
+//
+//   - POST /{reqName} submits the request body as a Job and responds 202 Accepted with the Job,
+//     and a Location header pointing at it.
+//   - GET /{id} responds with the current snapshot of a Job.
+//   - DELETE /{id} cancels a Job and responds with its snapshot.
+//
+// Failures are written as an httptransport.ErrorBody, with the status codes of
+// httptransport.StatusCode. A missing Job responds 404 Not Found, canceling a finished Job
+// responds 409 Conflict, and submitting to a stopped Manager, or one whose queue is full,
+// responds 503 Service Unavailable.
+//
+// Fields:
+//   - manager: The Manager the jobs are submitted to.
+//   - maxBodySize: The maximum size, in bytes, of a request body.
+type Server struct {
+	manager     *Manager
+	maxBodySize int64
+}
+
+type ServerOption = util.Option[*Server]
+
+// WithMaxBodySize returns an option that sets the maximum size of a request body accepted by a Server.
+//
+// Parameters:
+//   - maxBodySize: The maximum size, in bytes, of a request body.
+func WithMaxBodySize(maxBodySize int64) ServerOption {
+	return func(s *Server) {
+		s.maxBodySize = maxBodySize
+	}
+}
+
+// NewServer creates and returns a new instance of Server.
+//
+// By default the Server accepts request bodies of up to httptransport.DefaultMaxBodySize.
+//
+// Parameters:
+//   - manager: The Manager the jobs are submitted to.
+//   - options: Options applied to the Server.
+//
+// Returns:
+//   - A pointer to a Server instance.
+func NewServer(manager *Manager, options ...ServerOption) (server *Server) {
+	server = &Server{
+		manager:     manager,
+		maxBodySize: httptransport.DefaultMaxBodySize,
+	}
+	for _, option := range options {
+		option(server)
+	}
+	return server
+}
+
+// ServeHTTP routes a request to the Manager by its method, as described on Server.
+func (s *Server) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	path := strings.Trim(request.URL.Path, "/")
+	switch {
+	case request.Method == http.MethodPost && path != "":
+		s.submit(writer, request, path)
+	case request.Method == http.MethodGet && path != "":
+		job, err := s.manager.Get(path)
+		if err != nil {
+			writeError(writer, err)
+			return
+		}
+		writeJSON(writer, http.StatusOK, job)
+	case request.Method == http.MethodDelete && path != "":
+		job, err := s.manager.Cancel(path)
+		if err != nil {
+			writeError(writer, err)
+			return
+		}
+		writeJSON(writer, http.StatusOK, job)
+	default:
+		writer.Header().Set("Allow", strings.Join([]string{http.MethodGet, http.MethodPost, http.MethodDelete}, ", "))
+		writeJSON(writer, http.StatusMethodNotAllowed, httptransport.ErrorBody{
+			Error: fmt.Sprintf("method %s not allowed", request.Method),
+		})
+	}
+}
+
+// submit submits the body of a request as a Job of the request type mapped to reqName.
+func (s *Server) submit(writer http.ResponseWriter, request *http.Request, reqName string) {
+	payload, err := io.ReadAll(http.MaxBytesReader(writer, request.Body, s.maxBodySize))
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+	job, err := s.manager.Submit(request.Context(), reqName, payload)
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+	writer.Header().Set("Location", job.ID)
+	writeJSON(writer, http.StatusAccepted, job)
+}
+
+// StatusCode maps an error returned by a Manager to an HTTP status code, deferring to
+// httptransport.StatusCode for the errors of the commands.
+//
+// Parameters:
+//   - err: The error to map.
+//
+// Returns:
+//   - The HTTP status code for err.
+func StatusCode(err error) int {
+	switch {
+	case errors.Is(err, ErrJobMissing):
+		return http.StatusNotFound
+	case errors.Is(err, ErrJobFinished):
+		return http.StatusConflict
+	case errors.Is(err, ErrManagerStopped), errors.Is(err, ErrQueueFull):
+		return http.StatusServiceUnavailable
+	default:
+		return httptransport.StatusCode(err)
+	}
+}
+
+func writeError(writer http.ResponseWriter, err error) {
+	body := httptransport.ErrorBody{Error: err.Error(), Kind: httptransport.ErrorKind(err)}
+	var validationErr *commands.ValidationError
+	if errors.As(err, &validationErr) {
+		body.Fields = validationErr.Fields
+	}
+	writeJSON(writer, StatusCode(err), body)
+}
+
+func writeJSON(writer http.ResponseWriter, statusCode int, body any) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		statusCode = http.StatusInternalServerError
+		data, _ = json.Marshal(httptransport.ErrorBody{Error: fmt.Sprintf("failed to encode response: %s", err)})
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(statusCode)
+	_, _ = writer.Write(data)
+}
@@ -0,0 +1,133 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_NewServer(t *testing.T) {
+	mappingCatalog, decoderCatalog, handlerCatalog, _ := newCatalogs()
+	manager := NewManager(mappingCatalog, decoderCatalog, handlerCatalog)
+
+	t.Run("default", func(t *testing.T) {
+		server := NewServer(manager)
+		assert.NotNil(t, server)
+		assert.Same(t, manager, server.manager)
+	})
+
+	t.Run("with options", func(t *testing.T) {
+		server := NewServer(manager, WithMaxBodySize(16))
+		assert.Equal(t, int64(16), server.maxBodySize)
+	})
+}
+
+func Test_Server_ServeHTTP(t *testing.T) {
+	mappingCatalog, decoderCatalog, handlerCatalog, gate := newCatalogs()
+	manager := NewManager(mappingCatalog, decoderCatalog, handlerCatalog)
+	defer manager.Stop()
+	server := NewServer(manager, WithMaxBodySize(64))
+
+	serve := func(method string, path string, body string) (*httptest.ResponseRecorder, Job) {
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+		job := Job{}
+		_ = json.Unmarshal(recorder.Body.Bytes(), &job)
+		return recorder, job
+	}
+
+	t.Run("submit and poll", func(t *testing.T) {
+		recorder, job := serve(http.MethodPost, "/echo", `{"value": "hello"}`)
+		assert.Equal(t, http.StatusAccepted, recorder.Code)
+		assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+		assert.Equal(t, job.ID, recorder.Header().Get("Location"))
+		assert.Equal(t, EchoReqName, job.Name)
+
+		_, _ = manager.Wait(context.Background(), job.ID)
+		recorder, job = serve(http.MethodGet, "/"+job.ID, ``)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, StatusSucceeded, job.Status)
+		assert.JSONEq(t, `{"value": "hello"}`, string(job.Result))
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		_, job := serve(http.MethodPost, "/block", `{"key": "cancel"}`)
+		<-gate.started
+		recorder, _ := serve(http.MethodDelete, "/"+job.ID, ``)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+
+		_, _ = manager.Wait(context.Background(), job.ID)
+		recorder, job = serve(http.MethodGet, "/"+job.ID, ``)
+		assert.Equal(t, StatusCanceled, job.Status)
+		assert.Equal(t, "context canceled", job.Error)
+
+		recorder, _ = serve(http.MethodDelete, "/"+job.ID, ``)
+		assert.Equal(t, http.StatusConflict, recorder.Code)
+	})
+
+	t.Run("list not served", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+		assert.NotContains(t, recorder.Body.String(), `"id"`)
+	})
+
+	t.Run("job missing", func(t *testing.T) {
+		recorder, _ := serve(http.MethodGet, "/unknown", ``)
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+		recorder, _ = serve(http.MethodDelete, "/unknown", ``)
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+	})
+
+	t.Run("mapping missing", func(t *testing.T) {
+		recorder, _ := serve(http.MethodPost, "/unknown", `{}`)
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+	})
+
+	t.Run("decoder failure", func(t *testing.T) {
+		recorder, _ := serve(http.MethodPost, "/echo", `{`)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+
+	t.Run("body too large", func(t *testing.T) {
+		recorder, _ := serve(http.MethodPost, "/echo", `{"value": "`+strings.Repeat("a", 64)+`"}`)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+	})
+
+	t.Run("method not allowed", func(t *testing.T) {
+		recorder, _ := serve(http.MethodPut, "/echo", ``)
+		assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+		assert.Equal(t, "GET, POST, DELETE", recorder.Header().Get("Allow"))
+		recorder, _ = serve(http.MethodPost, "/", ``)
+		assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+	})
+}
+
+func Test_Server_ServeHTTP_Stopped(t *testing.T) {
+	mappingCatalog, decoderCatalog, handlerCatalog, _ := newCatalogs()
+	manager := NewManager(mappingCatalog, decoderCatalog, handlerCatalog)
+	manager.Stop()
+
+	recorder := httptest.NewRecorder()
+	NewServer(manager).ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(`{}`)))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+}
+
+func Test_Server_ServeHTTP_QueueFull(t *testing.T) {
+	mappingCatalog, decoderCatalog, handlerCatalog, gate := newCatalogs()
+	manager := NewManager(mappingCatalog, decoderCatalog, handlerCatalog, WithConcurrency(1), WithMaxQueued(1))
+	defer manager.Stop()
+	_, _ = manager.SubmitReq(context.Background(), BlockCommandReq{Key: "running"})
+	_, _ = manager.SubmitReq(context.Background(), BlockCommandReq{Key: "queued"})
+	<-gate.started
+
+	recorder := httptest.NewRecorder()
+	NewServer(manager).ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(`{}`)))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), ErrQueueFull.Error())
+}
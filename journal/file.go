@@ -0,0 +1,302 @@
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dan-lugg/go-commands/util"
+)
+
+var (
+	ErrJournalClosed = errors.New("journal closed")
+)
+
+const (
+	// DefaultSegmentSize is the size, in bytes, at which a FileJournal starts a new segment
+	// unless overridden with WithSegmentSize.
+	DefaultSegmentSize int64 = 64 << 20
+
+	segmentPrefix = "segment-"
+	segmentSuffix = ".jsonl"
+)
+
+// FileJournal is a Writer and Source keeping entries as JSON lines in segment files of a directory.
+//
+// Entries are appended to the latest segment until it reaches the segment size, at which point
+// a new segment is started. Segments are named by sequence number, so reopening a directory
+// continues after the latest segment.
+//
+// An entry is only part of the journal once the newline ending it is written. A partial entry
+// left at the end of a segment by a failed append is truncated before Append returns, and one
+// left by a crash in the middle of an append is skipped by Scan, and truncated before the next
+// entry is appended to the segment.
+//
+// Fields:
+//   - dir: The directory holding the segments.
+//   - segmentSize: The size, in bytes, at which a new segment is started.
+//   - sync: Whether every append is flushed to stable storage.
+//   - file: The segment entries are appended to.
+//   - sequence: The sequence number of the current segment.
+//   - size: The size, in bytes, of the current segment.
+//   - closed: Whether Close has been called.
+type FileJournal struct {
+	mutex       sync.Mutex
+	dir         string
+	segmentSize int64
+	sync        bool
+	file        *os.File
+	sequence    int
+	size        int64
+	closed      bool
+}
+
+type FileJournalOption = util.Option[*FileJournal]
+
+// WithSegmentSize returns an option that sets the size, in bytes, at which a FileJournal starts a new segment.
+//
+// Parameters:
+//   - segmentSize: The size, in bytes, of a full segment.
+func WithSegmentSize(segmentSize int64) FileJournalOption {
+	return func(j *FileJournal) {
+		j.segmentSize = segmentSize
+	}
+}
+
+// WithSync returns an option that sets whether a FileJournal flushes every append to stable storage.
+//
+// Parameters:
+//   - sync: Whether every append is flushed.
+func WithSync(sync bool) FileJournalOption {
+	return func(j *FileJournal) {
+		j.sync = sync
+	}
+}
+
+// NewFileJournal creates and returns a new instance of FileJournal, creating its directory if needed.
+//
+// Parameters:
+//   - dir: The directory holding the segments.
+//   - options: Options applied to the FileJournal.
+//
+// Returns:
+//   - journal: A pointer to a FileJournal instance.
+//   - err: An error if the directory cannot be created or read.
+func NewFileJournal(dir string, options ...FileJournalOption) (journal *FileJournal, err error) {
+	journal = &FileJournal{
+		mutex:       sync.Mutex{},
+		dir:         dir,
+		segmentSize: DefaultSegmentSize,
+	}
+	for _, option := range options {
+		option(journal)
+	}
+	if err = os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create journal directory: %w", err)
+	}
+	sequences, err := journal.Segments()
+	if err != nil {
+		return nil, err
+	}
+	if len(sequences) > 0 {
+		journal.sequence = sequences[len(sequences)-1]
+	}
+	return journal, nil
+}
+
+// Append writes an entry to the current segment, starting a new segment first if it is full.
+//
+// Parameters:
+//   - entry: The entry to append.
+//
+// Returns:
+//   - An error wrapping ErrJournalClosed if the journal is closed, or if the entry cannot be written.
+func (j *FileJournal) Append(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode journal entry: %w", err)
+	}
+	data = append(data, '\n')
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if j.closed {
+		return ErrJournalClosed
+	}
+	if j.file == nil {
+		if err = j.open(); err != nil {
+			return err
+		}
+	}
+	if j.size > 0 && j.size+int64(len(data)) > j.segmentSize {
+		if err = j.file.Close(); err != nil {
+			return fmt.Errorf("failed to close journal segment: %w", err)
+		}
+		j.file = nil
+		j.sequence++
+		if err = j.open(); err != nil {
+			return err
+		}
+	}
+	if _, err = j.file.Write(data); err != nil {
+		// Drop the part of the entry that was written, so the next entry starts on its own line.
+		// If that fails too, the segment is reopened, truncating the partial entry, on the next append.
+		if truncateErr := j.file.Truncate(j.size); truncateErr != nil {
+			_ = j.file.Close()
+			j.file = nil
+		}
+		return fmt.Errorf("failed to write journal entry: %w", err)
+	}
+	j.size += int64(len(data))
+	if j.sync {
+		if err = j.file.Sync(); err != nil {
+			return fmt.Errorf("failed to sync journal segment: %w", err)
+		}
+	}
+	return nil
+}
+
+// Scan passes every entry of every segment to fn, in the order they were appended.
+//
+// Parameters:
+//   - fn: The function receiving the entries; scanning stops at the first error it returns.
+//
+// Returns:
+//   - An error if a segment cannot be read or decoded, or the error returned by fn.
+func (j *FileJournal) Scan(fn func(entry Entry) error) error {
+	sequences, err := j.Segments()
+	if err != nil {
+		return err
+	}
+	for _, sequence := range sequences {
+		if err = j.scanSegment(j.segmentPath(sequence), fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Segments returns the sequence numbers of the segments of the journal.
+//
+// Returns:
+//   - sequences: The sequence numbers, in ascending order.
+//   - err: An error if the directory cannot be read.
+func (j *FileJournal) Segments() (sequences []int, err error) {
+	dirEntries, err := os.ReadDir(j.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal directory: %w", err)
+	}
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+		if dirEntry.IsDir() || !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		sequence, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentSuffix))
+		if err == nil {
+			sequences = append(sequences, sequence)
+		}
+	}
+	slices.Sort(sequences)
+	return sequences, nil
+}
+
+// Close closes the current segment. Appending to a closed journal fails with ErrJournalClosed,
+// while it can still be scanned.
+//
+// Returns:
+//   - An error if the current segment cannot be closed.
+func (j *FileJournal) Close() error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.closed = true
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+// open opens the current segment for appending, truncating a partial entry at its end.
+func (j *FileJournal) open() error {
+	file, err := os.OpenFile(j.segmentPath(j.sequence), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open journal segment: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to stat journal segment: %w", err)
+	}
+	size, err := truncatePartial(file, info.Size())
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to truncate journal segment: %w", err)
+	}
+	j.file, j.size = file, size
+	return nil
+}
+
+// truncatePartial truncates a segment of a size after its last newline, returning its new size.
+func truncatePartial(file *os.File, size int64) (int64, error) {
+	buffer := make([]byte, 4096)
+	end := size
+	for end > 0 {
+		start := max(end-int64(len(buffer)), 0)
+		chunk := buffer[:end-start]
+		if _, err := file.ReadAt(chunk, start); err != nil {
+			return size, err
+		}
+		if index := bytes.LastIndexByte(chunk, '\n'); index >= 0 {
+			end = start + int64(index) + 1
+			break
+		}
+		end = start
+	}
+	if end == size {
+		return size, nil
+	}
+	return end, file.Truncate(end)
+}
+
+func (j *FileJournal) segmentPath(sequence int) string {
+	return filepath.Join(j.dir, fmt.Sprintf("%s%08d%s", segmentPrefix, sequence, segmentSuffix))
+}
+
+func (j *FileJournal) scanSegment(path string, fn func(entry Entry) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open journal segment: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+	reader := bufio.NewReader(file)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// A line without a newline is a partial entry, not yet part of the journal.
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read journal segment: %w", err)
+		}
+		if data = bytes.TrimSpace(data); len(data) == 0 {
+			continue
+		}
+		entry := Entry{}
+		if err = json.Unmarshal(data, &entry); err != nil {
+			return fmt.Errorf("failed to decode journal entry at %s:%d: %w", filepath.Base(path), line, err)
+		}
+		if err = fn(entry); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package journal
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func scanAll(t *testing.T, source Source) []Entry {
+	entries := make([]Entry, 0)
+	assert.NoError(t, source.Scan(func(entry Entry) error {
+		entries = append(entries, entry)
+		return nil
+	}))
+	return entries
+}
+
+func Test_NewFileJournal(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		journal, err := NewFileJournal(t.TempDir())
+		assert.NoError(t, err)
+		assert.Equal(t, DefaultSegmentSize, journal.segmentSize)
+		assert.False(t, journal.sync)
+	})
+
+	t.Run("with options", func(t *testing.T) {
+		journal, err := NewFileJournal(t.TempDir(), WithSegmentSize(1024), WithSync(true))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1024), journal.segmentSize)
+		assert.True(t, journal.sync)
+	})
+}
+
+func Test_FileJournal(t *testing.T) {
+	t.Run("append and scan", func(t *testing.T) {
+		journal, err := NewFileJournal(t.TempDir())
+		assert.NoError(t, err)
+		for i := 0; i < 3; i++ {
+			assert.NoError(t, journal.Append(Entry{Kind: KindDispatch, ID: fmt.Sprint(i), Name: AddReqName}))
+		}
+		entries := scanAll(t, journal)
+		assert.Len(t, entries, 3)
+		assert.Equal(t, "2", entries[2].ID)
+	})
+
+	t.Run("rotates segments", func(t *testing.T) {
+		dir := t.TempDir()
+		journal, err := NewFileJournal(dir, WithSegmentSize(200))
+		assert.NoError(t, err)
+		for i := 0; i < 10; i++ {
+			assert.NoError(t, journal.Append(Entry{Kind: KindDispatch, ID: fmt.Sprint(i), Name: AddReqName}))
+		}
+		segments, err := journal.Segments()
+		assert.NoError(t, err)
+		assert.Greater(t, len(segments), 1)
+		assert.NoError(t, journal.Close())
+
+		reopened, err := NewFileJournal(dir, WithSegmentSize(200))
+		assert.NoError(t, err)
+		assert.NoError(t, reopened.Append(Entry{Kind: KindDispatch, ID: "10", Name: AddReqName}))
+		entries := scanAll(t, reopened)
+		assert.Len(t, entries, 11)
+		for i, entry := range entries {
+			assert.Equal(t, fmt.Sprint(i), entry.ID)
+		}
+	})
+
+	t.Run("partial entry", func(t *testing.T) {
+		dir := t.TempDir()
+		journal, err := NewFileJournal(dir)
+		assert.NoError(t, err)
+		assert.NoError(t, journal.Append(Entry{Kind: KindDispatch, ID: "0", Name: AddReqName}))
+		assert.NoError(t, journal.Close())
+
+		segments, err := journal.Segments()
+		assert.NoError(t, err)
+		file, err := os.OpenFile(journal.segmentPath(segments[0]), os.O_WRONLY|os.O_APPEND, 0o644)
+		assert.NoError(t, err)
+		_, err = file.WriteString(`{"kind":"dispatch","id":"1","na`)
+		assert.NoError(t, err)
+		assert.NoError(t, file.Close())
+
+		reopened, err := NewFileJournal(dir)
+		assert.NoError(t, err)
+		assert.Len(t, scanAll(t, reopened), 1)
+		assert.NoError(t, reopened.Append(Entry{Kind: KindDispatch, ID: "2", Name: AddReqName}))
+		entries := scanAll(t, reopened)
+		assert.Len(t, entries, 2)
+		assert.Equal(t, "0", entries[0].ID)
+		assert.Equal(t, "2", entries[1].ID)
+	})
+
+	t.Run("failed write", func(t *testing.T) {
+		journal, err := NewFileJournal(t.TempDir())
+		assert.NoError(t, err)
+		assert.NoError(t, journal.Append(Entry{Kind: KindDispatch, ID: "0", Name: AddReqName}))
+
+		path := journal.file.Name()
+		assert.NoError(t, journal.file.Close())
+		journal.file, err = os.Open(path)
+		assert.NoError(t, err)
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+		assert.NoError(t, err)
+		_, err = file.WriteString(`{"kind":"dispatch","id":"1","na`)
+		assert.NoError(t, err)
+		assert.NoError(t, file.Close())
+		assert.Error(t, journal.Append(Entry{Kind: KindDispatch, ID: "1", Name: AddReqName}))
+
+		assert.NoError(t, journal.Append(Entry{Kind: KindDispatch, ID: "2", Name: AddReqName}))
+		entries := scanAll(t, journal)
+		assert.Len(t, entries, 2)
+		assert.Equal(t, "0", entries[0].ID)
+		assert.Equal(t, "2", entries[1].ID)
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		journal, err := NewFileJournal(t.TempDir())
+		assert.NoError(t, err)
+		assert.NoError(t, journal.Append(Entry{Kind: KindDispatch, ID: "0"}))
+		assert.NoError(t, journal.Close())
+		assert.ErrorIs(t, journal.Append(Entry{Kind: KindDispatch, ID: "1"}), ErrJournalClosed)
+		assert.Len(t, scanAll(t, journal), 1)
+	})
+}
@@ -0,0 +1,197 @@
+package journal
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/dan-lugg/go-commands/commands"
+)
+
+// EntryKind distinguishes the entries written for a command before and after it runs.
+type EntryKind string
+
+const (
+	// KindDispatch is the kind of the entry written before a command runs, holding its payload.
+	KindDispatch EntryKind = "dispatch"
+	// KindResult is the kind of the entry written after a command finishes, holding its result or error.
+	KindResult EntryKind = "result"
+)
+
+// Entry is a record of a journal.
+//
+// Every journaled command produces a KindDispatch entry before it runs and a KindResult entry
+// with the same ID once it finishes. A dispatch without a result entry did not finish.
+//
+// Fields:
+//   - Kind: The EntryKind of the entry.
+//   - ID: The identifier shared by the entries of one dispatch.
+//   - CorrelationID: The correlation ID carried by the context of the dispatch.
+//   - Name: The mapped name of the request.
+//   - Time: The time the entry was written.
+//   - Payload: The JSON encoding of the request, for dispatch entries.
+//   - Result: The JSON encoding of the result, for result entries of successful commands.
+//   - Error: The message of the error, for result entries of failed commands.
+//   - Duration: The time the command took to run, for result entries.
+type Entry struct {
+	Kind          EntryKind       `json:"kind"`
+	ID            string          `json:"id"`
+	CorrelationID string          `json:"correlationId,omitempty"`
+	Name          string          `json:"name"`
+	Time          time.Time       `json:"time"`
+	Payload       json.RawMessage `json:"payload,omitempty"`
+	Result        json.RawMessage `json:"result,omitempty"`
+	Error         string          `json:"error,omitempty"`
+	Duration      time.Duration   `json:"duration,omitempty"`
+}
+
+// Writer is an append-only sink of journal entries.
+type Writer interface {
+	Append(entry Entry) error
+}
+
+// Source is a readable journal, passing its entries to fn in the order they were appended.
+type Source interface {
+	Scan(fn func(entry Entry) error) error
+}
+
+type correlationKey struct{}
+
+type replayKey struct{}
+
+type journaledKey struct{}
+
+// ContextWithCorrelationID returns a context.Context carrying the correlation ID recorded
+// in the journal entries of the commands dispatched with it.
+//
+// Parameters:
+//   - ctx: The parent context.Context.
+//   - correlationID: The correlation ID.
+//
+// Returns:
+//   - A context.Context carrying the correlation ID.
+func ContextWithCorrelationID(ctx context.Context, correlationID string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, correlationKey{}, correlationID)
+}
+
+// CorrelationIDFromContext returns the correlation ID carried by a context.Context.
+//
+// Parameters:
+//   - ctx: The context.Context to inspect.
+//
+// Returns:
+//   - correlationID: The correlation ID, or an empty string.
+//   - ok: Whether ctx carries a correlation ID.
+func CorrelationIDFromContext(ctx context.Context) (correlationID string, ok bool) {
+	if ctx == nil {
+		return "", false
+	}
+	correlationID, ok = ctx.Value(correlationKey{}).(string)
+	return correlationID, ok
+}
+
+// IsReplay reports whether a context.Context belongs to a dispatch made by a Replayer.
+// The Journal interceptor does not journal replayed dispatches.
+//
+// Parameters:
+//   - ctx: The context.Context to inspect.
+//
+// Returns:
+//   - true if ctx belongs to a replayed dispatch.
+func IsReplay(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	replay, _ := ctx.Value(replayKey{}).(bool)
+	return replay
+}
+
+// Journal returns a commands.Interceptor writing every dispatch to a Writer.
+//
+// A KindDispatch entry is appended before the command runs; if it cannot be appended, the
+// command does not run and the error is returned. A KindResult entry is appended once the
+// command finishes; a failure to append it does not fail the command.
+//
+// Only top-level dispatches are journaled. The commands a journaled handler dispatches with the
+// context it was given are not, as replaying the journal dispatches them again through their parent.
+//
+// Requests are recorded under their mapped name, so the catalog must be created with
+// commands.WithMappingCatalog for the journal to be replayable. If the context carries no
+// correlation ID, the ID of the dispatch is used.
+//
+// Parameters:
+//   - writer: The Writer the entries are appended to.
+//
+// Returns:
+//   - A commands.Interceptor journaling dispatches.
+func Journal(writer Writer) commands.Interceptor {
+	return func(ctx context.Context, info commands.InterceptorInfo, req commands.CommandReq[commands.CommandRes], next commands.Invoker) (res commands.CommandRes, err error) {
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		if IsReplay(ctx) || ctx.Value(journaledKey{}) != nil {
+			return next(ctx, req)
+		}
+		payload, err := json.Marshal(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode req: %w", err)
+		}
+		name := info.ReqName
+		if name == "" {
+			name = info.ReqType.String()
+		}
+		id := NewID()
+		correlationID, ok := CorrelationIDFromContext(ctx)
+		if !ok {
+			correlationID = id
+		}
+		start := time.Now()
+		err = writer.Append(Entry{
+			Kind:          KindDispatch,
+			ID:            id,
+			CorrelationID: correlationID,
+			Name:          name,
+			Time:          start,
+			Payload:       payload,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to journal dispatch: %w", err)
+		}
+
+		res, err = next(context.WithValue(ctx, journaledKey{}, true), req)
+
+		result := Entry{
+			Kind:          KindResult,
+			ID:            id,
+			CorrelationID: correlationID,
+			Name:          name,
+			Time:          time.Now(),
+			Duration:      time.Since(start),
+		}
+		if err != nil {
+			result.Error = err.Error()
+		} else if data, encodeErr := json.Marshal(res); encodeErr == nil {
+			result.Result = data
+		} else {
+			result.Error = fmt.Sprintf("failed to encode res: %s", encodeErr)
+		}
+		_ = writer.Append(result)
+		return res, err
+	}
+}
+
+// NewID returns a random identifier for a journal entry.
+//
+// Returns:
+//   - A 32 character hexadecimal string.
+func NewID() string {
+	data := make([]byte, 16)
+	_, _ = rand.Read(data)
+	return hex.EncodeToString(data)
+}
@@ -0,0 +1,101 @@
+package journal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/dan-lugg/go-commands/commands"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryWriter is a Writer collecting entries in memory.
+type memoryWriter struct {
+	entries []Entry
+	err     error
+}
+
+func (w *memoryWriter) Append(entry Entry) error {
+	if w.err != nil {
+		return w.err
+	}
+	w.entries = append(w.entries, entry)
+	return nil
+}
+
+func Test_ContextWithCorrelationID(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		correlationID, ok := CorrelationIDFromContext(context.Background())
+		assert.False(t, ok)
+		assert.Empty(t, correlationID)
+	})
+
+	t.Run("with correlation id", func(t *testing.T) {
+		correlationID, ok := CorrelationIDFromContext(ContextWithCorrelationID(nil, "c1"))
+		assert.True(t, ok)
+		assert.Equal(t, "c1", correlationID)
+	})
+}
+
+func Test_NewID(t *testing.T) {
+	assert.Len(t, NewID(), 32)
+	assert.NotEqual(t, NewID(), NewID())
+}
+
+func Test_Journal(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		writer := &memoryWriter{}
+		_, _, handlerCatalog, _ := newCatalogs(Journal(writer))
+		ctx := ContextWithCorrelationID(context.Background(), "c1")
+		_, err := commands.Handle[AddCommandReq, AddCommandRes](ctx, handlerCatalog, AddCommandReq{ArgX: 3, ArgY: 4})
+		assert.NoError(t, err)
+
+		assert.Len(t, writer.entries, 2)
+		dispatch, result := writer.entries[0], writer.entries[1]
+		assert.Equal(t, KindDispatch, dispatch.Kind)
+		assert.Equal(t, AddReqName, dispatch.Name)
+		assert.Equal(t, "c1", dispatch.CorrelationID)
+		assert.JSONEq(t, `{"argX":3,"argY":4}`, string(dispatch.Payload))
+		assert.Equal(t, KindResult, result.Kind)
+		assert.Equal(t, dispatch.ID, result.ID)
+		assert.JSONEq(t, `{"result":7}`, string(result.Result))
+		assert.Empty(t, result.Error)
+	})
+
+	t.Run("nested dispatches", func(t *testing.T) {
+		writer := &memoryWriter{}
+		_, _, handlerCatalog, _ := newCatalogs(Journal(writer))
+		res, err := commands.Handle[SumCommandReq, SumCommandRes](nil, handlerCatalog, SumCommandReq{Terms: []AddCommandReq{{ArgX: 1}, {ArgX: 2}}})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, res.Result)
+
+		assert.Len(t, writer.entries, 2)
+		assert.Equal(t, SumReqName, writer.entries[0].Name)
+		assert.Equal(t, SumReqName, writer.entries[1].Name)
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		writer := &memoryWriter{}
+		_, _, handlerCatalog, _ := newCatalogs(Journal(writer))
+		_, err := commands.Handle[AddCommandReq, AddCommandRes](nil, handlerCatalog, AddCommandReq{ArgX: -1})
+		assert.ErrorIs(t, err, ErrNegative)
+		assert.Len(t, writer.entries, 2)
+		assert.Equal(t, writer.entries[0].ID, writer.entries[0].CorrelationID)
+		assert.Equal(t, ErrNegative.Error(), writer.entries[1].Error)
+		assert.Nil(t, writer.entries[1].Result)
+	})
+
+	t.Run("append failure", func(t *testing.T) {
+		writer := &memoryWriter{err: errors.New("disk full")}
+		_, _, handlerCatalog, _ := newCatalogs(Journal(writer))
+		_, err := commands.Handle[AddCommandReq, AddCommandRes](nil, handlerCatalog, AddCommandReq{ArgX: 3, ArgY: 4})
+		assert.ErrorIs(t, err, writer.err)
+	})
+
+	t.Run("entry encoding", func(t *testing.T) {
+		data, err := json.Marshal(Entry{Kind: KindDispatch, ID: "1", Name: AddReqName})
+		assert.NoError(t, err)
+		assert.NotContains(t, string(data), "result")
+	})
+}
@@ -0,0 +1,95 @@
+package journal
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"github.com/dan-lugg/go-commands/commands"
+)
+
+const (
+	AddReqName = "add"
+	SumReqName = "sum"
+)
+
+var ErrNegative = errors.New("negative")
+
+type AddCommandRes struct {
+	Result int `json:"result"`
+}
+
+type AddCommandReq struct {
+	ArgX int `json:"argX"`
+	ArgY int `json:"argY"`
+}
+
+// AddHandler adds its arguments, plus an offset that lets tests change its results between runs.
+type AddHandler struct {
+	commands.Handler[AddCommandReq, AddCommandRes]
+	offset *atomic.Int64
+}
+
+func (h *AddHandler) Handle(ctx context.Context, req AddCommandReq) (res AddCommandRes, err error) {
+	if req.ArgX < 0 {
+		return AddCommandRes{}, ErrNegative
+	}
+	return AddCommandRes{Result: req.ArgX + req.ArgY + int(h.offset.Load())}, nil
+}
+
+type SumCommandRes struct {
+	Result int `json:"result"`
+}
+
+type SumCommandReq struct {
+	Terms []AddCommandReq `json:"terms"`
+}
+
+// SumHandler adds the results of its terms, dispatching each of them through catalog.
+type SumHandler struct {
+	commands.Handler[SumCommandReq, SumCommandRes]
+	catalog commands.HandlerCatalog
+}
+
+func (h *SumHandler) Handle(ctx context.Context, req SumCommandReq) (res SumCommandRes, err error) {
+	for _, term := range req.Terms {
+		termRes, err := commands.Handle[AddCommandReq, AddCommandRes](ctx, h.catalog, term)
+		if err != nil {
+			return SumCommandRes{}, err
+		}
+		res.Result += termRes.Result
+	}
+	return res, nil
+}
+
+func newCatalogs(interceptors ...commands.Interceptor) (*commands.DefaultMappingCatalog, *commands.DefaultDecoderCatalog, *commands.DefaultHandlerCatalog, *atomic.Int64) {
+	mappingCatalog := commands.NewMappingCatalog()
+	commands.InsertMapping[AddCommandReq](mappingCatalog, AddReqName)
+	commands.InsertMapping[SumCommandReq](mappingCatalog, SumReqName)
+
+	decoderCatalog := commands.NewDefaultDecoderCatalog()
+	commands.InsertDecoder[AddCommandReq](decoderCatalog, commands.DefaultDecoder[AddCommandReq]())
+	commands.InsertDecoder[SumCommandReq](decoderCatalog, commands.DefaultDecoder[SumCommandReq]())
+
+	offset := &atomic.Int64{}
+	handlerCatalog := commands.NewDefaultHandlerCatalog(commands.WithMappingCatalog(mappingCatalog), commands.WithInterceptors(interceptors...))
+	commands.InsertHandler[AddCommandReq, AddCommandRes](handlerCatalog, func() commands.Handler[AddCommandReq, AddCommandRes] {
+		return &AddHandler{offset: offset}
+	})
+	commands.InsertHandler[SumCommandReq, SumCommandRes](handlerCatalog, func() commands.Handler[SumCommandReq, SumCommandRes] {
+		return &SumHandler{catalog: handlerCatalog}
+	})
+	return mappingCatalog, decoderCatalog, handlerCatalog, offset
+}
+
+// sliceSource is a Source over a slice of entries.
+type sliceSource []Entry
+
+func (s sliceSource) Scan(fn func(entry Entry) error) error {
+	for _, entry := range s {
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
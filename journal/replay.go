@@ -0,0 +1,204 @@
+package journal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/dan-lugg/go-commands/commands"
+	"github.com/dan-lugg/go-commands/util"
+)
+
+// ReplayMode determines what a Replayer does with the commands it re-dispatches.
+type ReplayMode int
+
+const (
+	// ReplayDispatch re-dispatches each journaled command and reports its new outcome.
+	ReplayDispatch ReplayMode = iota
+	// ReplayCompare re-dispatches each journaled command and compares its new outcome with the recorded one.
+	ReplayCompare
+)
+
+// String returns the name of the ReplayMode.
+func (m ReplayMode) String() string {
+	switch m {
+	case ReplayDispatch:
+		return "dispatch"
+	case ReplayCompare:
+		return "compare"
+	default:
+		return "unknown"
+	}
+}
+
+// ReplayResult is the outcome of re-dispatching one journaled command.
+//
+// Fields:
+//   - Dispatch: The KindDispatch entry that was replayed.
+//   - Recorded: The KindResult entry recorded for it, or nil if the original dispatch did not finish.
+//   - Result: The JSON encoding of the new result, if the command succeeded.
+//   - Err: The error of the new dispatch, including errors resolving or decoding the entry.
+//   - Match: In ReplayCompare mode, whether the new outcome equals the recorded one.
+type ReplayResult struct {
+	Dispatch Entry
+	Recorded *Entry
+	Result   json.RawMessage
+	Err      error
+	Match    bool
+}
+
+// Replayer reads a journal back and re-dispatches its commands.
+//
+// Each KindDispatch entry is resolved by name through the MappingCatalog, decoded through the
+// DecoderCatalog and dispatched through the HandlerCatalog, with a context.Context carrying its
+// correlation ID and marked so that IsReplay reports true.
+//
+// Fields:
+//   - mappingCatalog: The MappingCatalog used to resolve entry names to request types.
+//   - decoderCatalog: The DecoderCatalog used to decode entry payloads.
+//   - handlerCatalog: The HandlerCatalog the commands are dispatched through.
+//   - mode: The ReplayMode of the Replayer.
+//   - filter: An optional function selecting the dispatch entries to replay.
+type Replayer struct {
+	mappingCatalog commands.MappingCatalog
+	decoderCatalog commands.DecoderCatalog
+	handlerCatalog commands.HandlerCatalog
+	mode           ReplayMode
+	filter         func(entry Entry) bool
+}
+
+type ReplayerOption = util.Option[*Replayer]
+
+// WithReplayMode returns an option that sets the ReplayMode of a Replayer.
+//
+// Parameters:
+//   - mode: The ReplayMode of the Replayer.
+func WithReplayMode(mode ReplayMode) ReplayerOption {
+	return func(r *Replayer) {
+		r.mode = mode
+	}
+}
+
+// WithFilter returns an option that sets the function selecting the dispatch entries a Replayer replays.
+//
+// Parameters:
+//   - filter: A function returning true for the entries to replay.
+func WithFilter(filter func(entry Entry) bool) ReplayerOption {
+	return func(r *Replayer) {
+		r.filter = filter
+	}
+}
+
+// NewReplayer creates and returns a new instance of Replayer.
+//
+// By default the Replayer uses ReplayDispatch and replays every entry.
+//
+// Parameters:
+//   - mappingCatalog: The MappingCatalog used to resolve entry names to request types.
+//   - decoderCatalog: The DecoderCatalog used to decode entry payloads.
+//   - handlerCatalog: The HandlerCatalog the commands are dispatched through.
+//   - options: Options applied to the Replayer.
+//
+// Returns:
+//   - A pointer to a Replayer instance.
+func NewReplayer(mappingCatalog commands.MappingCatalog, decoderCatalog commands.DecoderCatalog, handlerCatalog commands.HandlerCatalog, options ...ReplayerOption) (replayer *Replayer) {
+	replayer = &Replayer{
+		mappingCatalog: mappingCatalog,
+		decoderCatalog: decoderCatalog,
+		handlerCatalog: handlerCatalog,
+		mode:           ReplayDispatch,
+		filter:         nil,
+	}
+	for _, option := range options {
+		option(replayer)
+	}
+	return replayer
+}
+
+// Replay re-dispatches the commands of a journal, one at a time, in the order they were journaled.
+// A command that fails to resolve, decode or run does not stop the replay; its error is recorded
+// in its ReplayResult.
+//
+// Parameters:
+//   - ctx: A context.Context providing context for the dispatches.
+//   - source: The journal to read.
+//
+// Returns:
+//   - results: The ReplayResult of every replayed command.
+//   - err: An error if the journal cannot be read or ctx ends.
+func (r *Replayer) Replay(ctx context.Context, source Source) (results []ReplayResult, err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	dispatches := make([]Entry, 0)
+	recorded := make(map[string]*Entry)
+	err = source.Scan(func(entry Entry) error {
+		switch entry.Kind {
+		case KindDispatch:
+			if r.filter == nil || r.filter(entry) {
+				dispatches = append(dispatches, entry)
+			}
+		case KindResult:
+			recorded[entry.ID] = &entry
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	results = make([]ReplayResult, 0, len(dispatches))
+	for _, dispatch := range dispatches {
+		if err = ctx.Err(); err != nil {
+			return results, err
+		}
+		result := r.replay(ctx, dispatch)
+		result.Recorded = recorded[dispatch.ID]
+		if r.mode == ReplayCompare {
+			result.Match = matches(result, result.Recorded)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// replay re-dispatches one journaled command.
+func (r *Replayer) replay(ctx context.Context, dispatch Entry) (result ReplayResult) {
+	result.Dispatch = dispatch
+	reqType, err := r.mappingCatalog.ByName(dispatch.Name)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	req, err := r.decoderCatalog.Decode(reqType, dispatch.Payload)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	ctx = context.WithValue(ContextWithCorrelationID(ctx, dispatch.CorrelationID), replayKey{}, true)
+	res, err := r.handlerCatalog.Handle(ctx, req)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if result.Result, err = json.Marshal(res); err != nil {
+		result.Err = fmt.Errorf("failed to encode res: %w", err)
+	}
+	return result
+}
+
+// matches reports whether the outcome of a replay equals the recorded outcome.
+func matches(result ReplayResult, recorded *Entry) bool {
+	if recorded == nil {
+		return false
+	}
+	if result.Err != nil || recorded.Error != "" {
+		return result.Err != nil && result.Err.Error() == recorded.Error
+	}
+	var replayed, original any
+	if json.Unmarshal(result.Result, &replayed) != nil || json.Unmarshal(recorded.Result, &original) != nil {
+		return false
+	}
+	return reflect.DeepEqual(replayed, original)
+}
@@ -0,0 +1,73 @@
+package journal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dan-lugg/go-commands/commands"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ReplayMode_String(t *testing.T) {
+	assert.Equal(t, "dispatch", ReplayDispatch.String())
+	assert.Equal(t, "compare", ReplayCompare.String())
+	assert.Equal(t, "unknown", ReplayMode(-1).String())
+}
+
+func Test_Replayer_Replay(t *testing.T) {
+	record := func(t *testing.T) (*FileJournal, *commands.DefaultMappingCatalog, *commands.DefaultDecoderCatalog, *commands.DefaultHandlerCatalog, func(int64)) {
+		journal, err := NewFileJournal(t.TempDir())
+		assert.NoError(t, err)
+		mappingCatalog, decoderCatalog, handlerCatalog, offset := newCatalogs(Journal(journal))
+		ctx := ContextWithCorrelationID(context.Background(), "c1")
+		_, _ = commands.Handle[AddCommandReq, AddCommandRes](ctx, handlerCatalog, AddCommandReq{ArgX: 3, ArgY: 4})
+		_, _ = commands.Handle[AddCommandReq, AddCommandRes](ctx, handlerCatalog, AddCommandReq{ArgX: -1})
+		return journal, mappingCatalog, decoderCatalog, handlerCatalog, offset.Store
+	}
+
+	t.Run("dispatch", func(t *testing.T) {
+		journal, mappingCatalog, decoderCatalog, handlerCatalog, _ := record(t)
+		results, err := NewReplayer(mappingCatalog, decoderCatalog, handlerCatalog).Replay(nil, journal)
+		assert.NoError(t, err)
+		assert.Len(t, results, 2)
+		assert.JSONEq(t, `{"result":7}`, string(results[0].Result))
+		assert.NotNil(t, results[0].Recorded)
+		assert.ErrorIs(t, results[1].Err, ErrNegative)
+		assert.Len(t, scanAll(t, journal), 4)
+	})
+
+	t.Run("compare", func(t *testing.T) {
+		journal, mappingCatalog, decoderCatalog, handlerCatalog, setOffset := record(t)
+		replayer := NewReplayer(mappingCatalog, decoderCatalog, handlerCatalog, WithReplayMode(ReplayCompare))
+		results, err := replayer.Replay(nil, journal)
+		assert.NoError(t, err)
+		assert.True(t, results[0].Match)
+		assert.True(t, results[1].Match)
+
+		setOffset(1)
+		results, err = replayer.Replay(nil, journal)
+		assert.NoError(t, err)
+		assert.False(t, results[0].Match)
+		assert.JSONEq(t, `{"result":8}`, string(results[0].Result))
+		assert.True(t, results[1].Match)
+	})
+
+	t.Run("filter", func(t *testing.T) {
+		journal, mappingCatalog, decoderCatalog, handlerCatalog, _ := record(t)
+		replayer := NewReplayer(mappingCatalog, decoderCatalog, handlerCatalog, WithFilter(func(entry Entry) bool {
+			return entry.Error == "" && string(entry.Payload) == `{"argX":3,"argY":4}`
+		}))
+		results, err := replayer.Replay(nil, journal)
+		assert.NoError(t, err)
+		assert.Len(t, results, 1)
+	})
+
+	t.Run("unknown name", func(t *testing.T) {
+		mappingCatalog, decoderCatalog, handlerCatalog, _ := newCatalogs()
+		source := sliceSource{{Kind: KindDispatch, ID: "1", Name: "mul", Payload: []byte(`{}`)}}
+		results, err := NewReplayer(mappingCatalog, decoderCatalog, handlerCatalog, WithReplayMode(ReplayCompare)).Replay(nil, source)
+		assert.NoError(t, err)
+		assert.ErrorIs(t, results[0].Err, commands.ErrMappingMissing)
+		assert.False(t, results[0].Match)
+	})
+}
@@ -0,0 +1,101 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/dan-lugg/go-commands/commands"
+)
+
+// Version is the value of the jsonrpc member of every request and response.
+const Version = "2.0"
+
+// The error codes defined by the JSON-RPC 2.0 specification, plus CodeServerError, the
+// implementation-defined code used for commands that fail.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+	CodeServerError    = -32000
+)
+
+// Request is a JSON-RPC 2.0 request, or a notification if it has no ID.
+//
+// Fields:
+//   - JSONRPC: The protocol version, which must be Version.
+//   - Method: The mapped name of the request type.
+//   - Params: The serialized request.
+//   - ID: The ID of the request, echoed in its Response; nil for a notification.
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+// IsNotification reports whether the Request is a notification, which gets no Response.
+func (r Request) IsNotification() bool {
+	return r.ID == nil
+}
+
+// Response is a JSON-RPC 2.0 response, carrying either a result or an error.
+//
+// Fields:
+//   - JSONRPC: The protocol version, always Version.
+//   - Result: The JSON encoded result, if the command succeeded.
+//   - Error: The error, if the request failed.
+//   - ID: The ID of the Request, or null if it could not be read.
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// Error is a JSON-RPC 2.0 error object.
+//
+// Fields:
+//   - Code: One of the Code constants.
+//   - Message: A human-readable description of the failure.
+//   - Data: Additional information, such as the field-level violations of a commands.ValidationError.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+// Error returns the message of the Error, implementing the error interface.
+func (e *Error) Error() string {
+	return fmt.Sprintf("jsonrpc error %d: %s", e.Code, e.Message)
+}
+
+// NewError maps an error returned while serving a request to a JSON-RPC 2.0 Error.
+//
+// An unmapped name or a missing handler becomes CodeMethodNotFound, a request that fails to
+// decode or validate becomes CodeInvalidParams, and any other failure becomes CodeServerError.
+//
+// Parameters:
+//   - err: The error to map.
+//
+// Returns:
+//   - A pointer to the Error that best describes err, or err itself if it is already an *Error.
+func NewError(err error) *Error {
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+	mapped := &Error{Code: CodeServerError, Message: err.Error()}
+	var validationErr *commands.ValidationError
+	switch {
+	case errors.Is(err, commands.ErrMappingMissing), errors.Is(err, commands.ErrHandlerMissing):
+		mapped.Code = CodeMethodNotFound
+	case errors.As(err, &validationErr):
+		mapped.Code, mapped.Data = CodeInvalidParams, validationErr.Fields
+	case errors.Is(err, commands.ErrDecoderFailure), errors.Is(err, commands.ErrValidationFailure):
+		mapped.Code = CodeInvalidParams
+	}
+	return mapped
+}
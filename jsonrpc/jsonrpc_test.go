@@ -0,0 +1,53 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/dan-lugg/go-commands/commands"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Request_IsNotification(t *testing.T) {
+	assert.True(t, Request{Method: AddReqName}.IsNotification())
+	assert.False(t, Request{Method: AddReqName, ID: json.RawMessage(`1`)}.IsNotification())
+	assert.False(t, Request{Method: AddReqName, ID: json.RawMessage(`null`)}.IsNotification())
+}
+
+func Test_Error_Error(t *testing.T) {
+	err := &Error{Code: CodeMethodNotFound, Message: "missing"}
+	assert.Equal(t, "jsonrpc error -32601: missing", err.Error())
+}
+
+func Test_NewError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		code int
+	}{
+		{"mapping missing", fmt.Errorf("%w: x", commands.ErrMappingMissing), CodeMethodNotFound},
+		{"handler missing", fmt.Errorf("%w: x", commands.ErrHandlerMissing), CodeMethodNotFound},
+		{"decoder failure", fmt.Errorf("%w: x", commands.ErrDecoderFailure), CodeInvalidParams},
+		{"validation failure", fmt.Errorf("%w: x", commands.ErrValidationFailure), CodeInvalidParams},
+		{"other", ErrFailure, CodeServerError},
+		{"rpc error", &Error{Code: CodeInternalError, Message: "x"}, CodeInternalError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mapped := NewError(test.err)
+			assert.Equal(t, test.code, mapped.Code)
+		})
+	}
+
+	t.Run("message", func(t *testing.T) {
+		assert.Equal(t, ErrFailure.Error(), NewError(ErrFailure).Message)
+	})
+
+	t.Run("validation error", func(t *testing.T) {
+		err := commands.Validate(ValidCommandReq{})
+		mapped := NewError(err)
+		assert.Equal(t, CodeInvalidParams, mapped.Code)
+		assert.NotEmpty(t, mapped.Data)
+	})
+}
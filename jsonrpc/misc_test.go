@@ -0,0 +1,140 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/dan-lugg/go-commands/commands"
+)
+
+const (
+	AddReqName   = "add"
+	SubReqName   = "sub"
+	FailReqName  = "fail"
+	ValidReqName = "valid"
+	SlowReqName  = "slow"
+)
+
+var ErrFailure = errors.New("failure")
+
+type AddCommandRes struct {
+	Result int `json:"result"`
+}
+
+type AddCommandReq struct {
+	ArgX int `json:"argX"`
+	ArgY int `json:"argY"`
+}
+
+// AddHandler adds its arguments, counting its calls so tests can observe notifications.
+type AddHandler struct {
+	commands.Handler[AddCommandReq, AddCommandRes]
+	calls *atomic.Int64
+}
+
+func (h *AddHandler) Handle(ctx context.Context, req AddCommandReq) (res AddCommandRes, err error) {
+	h.calls.Add(1)
+	return AddCommandRes{Result: req.ArgX + req.ArgY}, nil
+}
+
+type SubCommandRes struct {
+	Result int `json:"result"`
+}
+
+type SubCommandReq struct {
+	ArgX int `json:"argX"`
+	ArgY int `json:"argY"`
+}
+
+type FailCommandRes struct{}
+
+type FailCommandReq struct{}
+
+type FailHandler struct {
+	commands.Handler[FailCommandReq, FailCommandRes]
+}
+
+func (h *FailHandler) Handle(ctx context.Context, req FailCommandReq) (res FailCommandRes, err error) {
+	return FailCommandRes{}, ErrFailure
+}
+
+type ValidCommandRes struct{}
+
+type ValidCommandReq struct {
+	Name string `json:"name" validate:"required"`
+}
+
+type ValidHandler struct {
+	commands.Handler[ValidCommandReq, ValidCommandRes]
+}
+
+func (h *ValidHandler) Handle(ctx context.Context, req ValidCommandReq) (res ValidCommandRes, err error) {
+	return ValidCommandRes{}, nil
+}
+
+type SlowCommandRes struct{}
+
+type SlowCommandReq struct {
+	Delay time.Duration `json:"delay"`
+}
+
+// SlowHandler sleeps for the Delay of each request, recording the peak number of concurrent calls.
+type SlowHandler struct {
+	commands.Handler[SlowCommandReq, SlowCommandRes]
+	active *atomic.Int64
+	peak   *atomic.Int64
+}
+
+func (h *SlowHandler) Handle(ctx context.Context, req SlowCommandReq) (res SlowCommandRes, err error) {
+	active := h.active.Add(1)
+	defer h.active.Add(-1)
+	for peak := h.peak.Load(); active > peak && !h.peak.CompareAndSwap(peak, active); peak = h.peak.Load() {
+	}
+	time.Sleep(req.Delay)
+	return SlowCommandRes{}, nil
+}
+
+// newSlowServer returns a Server dispatching SlowCommandReq, and the peak number of concurrent calls.
+func newSlowServer(options ...ServerOption) (*Server, *atomic.Int64) {
+	mappingCatalog := commands.NewMappingCatalog()
+	commands.InsertMapping[SlowCommandReq](mappingCatalog, SlowReqName)
+
+	decoderCatalog := commands.NewDefaultDecoderCatalog()
+	commands.InsertDecoder[SlowCommandReq](decoderCatalog, commands.DefaultDecoder[SlowCommandReq]())
+
+	active, peak := &atomic.Int64{}, &atomic.Int64{}
+	handlerCatalog := commands.NewDefaultHandlerCatalog()
+	commands.InsertHandler[SlowCommandReq, SlowCommandRes](handlerCatalog, func() commands.Handler[SlowCommandReq, SlowCommandRes] {
+		return &SlowHandler{active: active, peak: peak}
+	})
+	return NewServer(mappingCatalog, decoderCatalog, handlerCatalog, options...), peak
+}
+
+func newServer(options ...ServerOption) (*Server, *atomic.Int64) {
+	mappingCatalog := commands.NewMappingCatalog()
+	commands.InsertMapping[AddCommandReq](mappingCatalog, AddReqName)
+	commands.InsertMapping[SubCommandReq](mappingCatalog, SubReqName)
+	commands.InsertMapping[FailCommandReq](mappingCatalog, FailReqName)
+	commands.InsertMapping[ValidCommandReq](mappingCatalog, ValidReqName)
+
+	decoderCatalog := commands.NewDefaultDecoderCatalog()
+	commands.InsertDecoder[AddCommandReq](decoderCatalog, commands.DefaultDecoder[AddCommandReq]())
+	commands.InsertDecoder[SubCommandReq](decoderCatalog, commands.DefaultDecoder[SubCommandReq]())
+	commands.InsertDecoder[FailCommandReq](decoderCatalog, commands.DefaultDecoder[FailCommandReq]())
+	commands.InsertDecoder[ValidCommandReq](decoderCatalog, commands.DefaultDecoder[ValidCommandReq]())
+
+	calls := &atomic.Int64{}
+	handlerCatalog := commands.NewDefaultHandlerCatalog()
+	commands.InsertHandler[AddCommandReq, AddCommandRes](handlerCatalog, func() commands.Handler[AddCommandReq, AddCommandRes] {
+		return &AddHandler{calls: calls}
+	})
+	commands.InsertHandler[FailCommandReq, FailCommandRes](handlerCatalog, func() commands.Handler[FailCommandReq, FailCommandRes] {
+		return &FailHandler{}
+	})
+	commands.InsertHandler[ValidCommandReq, ValidCommandRes](handlerCatalog, func() commands.Handler[ValidCommandReq, ValidCommandRes] {
+		return &ValidHandler{}
+	})
+	return NewServer(mappingCatalog, decoderCatalog, handlerCatalog, options...), calls
+}
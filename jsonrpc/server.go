@@ -0,0 +1,340 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/dan-lugg/go-commands/commands"
+	"github.com/dan-lugg/go-commands/util"
+)
+
+const (
+	// DefaultMaxBodySize is the maximum size, in bytes, of a request body accepted over HTTP
+	// unless overridden with WithMaxBodySize.
+	DefaultMaxBodySize int64 = 1 << 20
+
+	// DefaultMaxConcurrency is the number of requests a Server dispatches at once for a batch or
+	// a stream, unless overridden with WithMaxConcurrency.
+	DefaultMaxConcurrency = 16
+
+	contentTypeJSON = "application/json"
+)
+
+// Server serves the cataloged commands over JSON-RPC 2.0, using the mapped request names as
+// method names and the params as the serialized requests.
+//
+// Requests are dispatched through a commands.Dispatcher, one at a time or as batch arrays, over
+// HTTP with ServeHTTP or over any stream with ServeConn. The requests of a batch, and the
+// messages of a stream, are dispatched concurrently up to a limit; further requests wait for a
+// running one to complete.
+//
+// Fields:
+//   - dispatcher: The commands.Dispatcher used to decode and dispatch requests.
+//   - encoderCatalog: An optional EncoderCatalog used to encode results.
+//   - maxBodySize: The maximum size, in bytes, of a request body accepted over HTTP.
+//   - maxConcurrency: The number of requests dispatched at once for a batch or a stream.
+type Server struct {
+	dispatcher     *commands.Dispatcher
+	encoderCatalog commands.EncoderCatalog
+	maxBodySize    int64
+	maxConcurrency int
+}
+
+type ServerOption = util.Option[*Server]
+
+// WithMaxBodySize returns an option that sets the maximum size, in bytes, of a request body
+// accepted over HTTP. Larger bodies are rejected with 413 Request Entity Too Large.
+//
+// Parameters:
+//   - maxBodySize: The maximum size, in bytes, of an accepted request body.
+func WithMaxBodySize(maxBodySize int64) ServerOption {
+	return func(s *Server) {
+		s.maxBodySize = maxBodySize
+	}
+}
+
+// WithMaxConcurrency returns an option that sets the number of requests a Server dispatches at
+// once for a batch, or for the messages of a stream served with ServeConn. Further requests wait
+// for a running one to complete; over a stream, no more messages are read in the meantime.
+//
+// Parameters:
+//   - maxConcurrency: The number of requests dispatched at once; values below 1 are treated as 1.
+func WithMaxConcurrency(maxConcurrency int) ServerOption {
+	return func(s *Server) {
+		s.maxConcurrency = max(maxConcurrency, 1)
+	}
+}
+
+// WithEncoderCatalog returns an option that sets the EncoderCatalog a Server encodes results
+// with. The encoders must produce JSON, as results are embedded in the responses. Without an
+// EncoderCatalog, results are encoded with json.Marshal.
+//
+// Parameters:
+//   - encoderCatalog: The EncoderCatalog used to encode results.
+func WithEncoderCatalog(encoderCatalog commands.EncoderCatalog) ServerOption {
+	return func(s *Server) {
+		s.encoderCatalog = encoderCatalog
+	}
+}
+
+// NewServer creates and returns a new instance of Server.
+//
+// By default the Server uses DefaultMaxBodySize and DefaultMaxConcurrency.
+//
+// Parameters:
+//   - mappingCatalog: The MappingCatalog used to resolve method names to request types.
+//   - decoderCatalog: The DecoderCatalog used to decode params.
+//   - handlerCatalog: The HandlerCatalog used to dispatch decoded requests.
+//   - options: Options applied to the Server.
+//
+// Returns:
+//   - A pointer to a Server instance.
+func NewServer(mappingCatalog commands.MappingCatalog, decoderCatalog commands.DecoderCatalog, handlerCatalog commands.HandlerCatalog, options ...ServerOption) (server *Server) {
+	server = &Server{
+		dispatcher:     nil,
+		encoderCatalog: nil,
+		maxBodySize:    DefaultMaxBodySize,
+		maxConcurrency: DefaultMaxConcurrency,
+	}
+	for _, option := range options {
+		option(server)
+	}
+	server.dispatcher = commands.NewDispatcher(mappingCatalog, decoderCatalog, handlerCatalog, commands.WithEncoderCatalog(server.encoderCatalog))
+	return server
+}
+
+// Handle serves a single JSON-RPC message, which is either a request or a batch array of requests.
+// The requests of a batch are dispatched concurrently, up to the concurrency limit of the Server,
+// and their responses are returned in order.
+//
+// Parameters:
+//   - ctx: A context.Context providing context for the dispatches.
+//   - data: The JSON encoded message.
+//
+// Returns:
+//   - The JSON encoded response or batch of responses, or nil if the message holds only notifications.
+func (s *Server) Handle(ctx context.Context, data []byte) []byte {
+	result := make(chan []byte, 1)
+	s.serve(ctx, data, make(chan struct{}, s.maxConcurrency), func(resData []byte) {
+		result <- resData
+	})
+	return <-result
+}
+
+// ServeHTTP serves a JSON-RPC message posted as the body of an HTTP request. A message holding
+// only notifications is answered with 204 No Content.
+//
+// Parameters:
+//   - writer: The http.ResponseWriter the response is written to.
+//   - request: The incoming *http.Request.
+func (s *Server) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		writer.Header().Set("Allow", http.MethodPost)
+		writeJSON(writer, http.StatusMethodNotAllowed, errorResponse(nil, &Error{Code: CodeInvalidRequest, Message: fmt.Sprintf("method %s not allowed", request.Method)}))
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(writer, request.Body, s.maxBodySize))
+	if err != nil {
+		statusCode := http.StatusBadRequest
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			statusCode = http.StatusRequestEntityTooLarge
+		}
+		writeJSON(writer, statusCode, errorResponse(nil, &Error{Code: CodeParseError, Message: err.Error()}))
+		return
+	}
+	resData := s.Handle(request.Context(), data)
+	if resData == nil {
+		writer.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writer.Header().Set("Content-Type", contentTypeJSON)
+	writer.WriteHeader(http.StatusOK)
+	_, _ = writer.Write(resData)
+}
+
+// ServeConn serves the JSON-RPC messages of a stream, such as stdio or a Unix socket, until the
+// stream ends. Messages are read as consecutive JSON values and dispatched concurrently, and
+// each response is written as one line, in the order the dispatches complete. The requests of
+// every message share the concurrency limit of the Server, and no more messages are read while
+// it is reached. A message that cannot be parsed is answered with a CodeParseError response and
+// ends the stream, as the following messages cannot be framed anymore.
+//
+// Parameters:
+//   - ctx: A context.Context providing context for the dispatches; once it ends, no more messages are read.
+//   - conn: The stream the messages are read from and the responses are written to.
+//
+// Returns:
+//   - An error if the stream cannot be read or parsed, or a response cannot be written; nil once the stream ends.
+func (s *Server) ServeConn(ctx context.Context, conn io.ReadWriter) (err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	writeMutex := sync.Mutex{}
+	writeErr := error(nil)
+	write := func(resData []byte) {
+		writeMutex.Lock()
+		defer writeMutex.Unlock()
+		if writeErr != nil {
+			return
+		}
+		if _, writeErr = conn.Write(append(resData, '\n')); writeErr != nil {
+			cancel()
+		}
+	}
+
+	wg := sync.WaitGroup{}
+	slots := make(chan struct{}, s.maxConcurrency)
+	decoder := json.NewDecoder(conn)
+	for ctx.Err() == nil {
+		data := json.RawMessage{}
+		if err = decoder.Decode(&data); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = nil
+				break
+			}
+			resData, _ := json.Marshal(errorResponse(nil, &Error{Code: CodeParseError, Message: err.Error()}))
+			write(resData)
+			break
+		}
+		wg.Add(1)
+		s.serve(ctx, data, slots, func(resData []byte) {
+			defer wg.Done()
+			if resData != nil {
+				write(resData)
+			}
+		})
+	}
+	wg.Wait()
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+	return errors.Join(err, writeErr)
+}
+
+// serve dispatches a single JSON-RPC message, taking a slot for each of its requests, and passes
+// the JSON encoded response, or nil if the message holds only notifications, to done once the
+// requests complete. It returns once every request has been started, waiting for free slots.
+func (s *Server) serve(ctx context.Context, data []byte, slots chan struct{}, done func(resData []byte)) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '[' {
+		slots <- struct{}{}
+		go func() {
+			response := s.handle(ctx, data)
+			<-slots
+			if response == nil {
+				done(nil)
+				return
+			}
+			resData, _ := json.Marshal(response)
+			done(resData)
+		}()
+		return
+	}
+
+	elements := make([]json.RawMessage, 0)
+	if err := json.Unmarshal(data, &elements); err != nil {
+		resData, _ := json.Marshal(errorResponse(nil, &Error{Code: CodeParseError, Message: err.Error()}))
+		done(resData)
+		return
+	}
+	if len(elements) == 0 {
+		resData, _ := json.Marshal(errorResponse(nil, &Error{Code: CodeInvalidRequest, Message: "empty batch"}))
+		done(resData)
+		return
+	}
+	responses := make([]*Response, len(elements))
+	wg := sync.WaitGroup{}
+	for i, element := range elements {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responses[i] = s.handle(ctx, element)
+			<-slots
+		}()
+	}
+	go func() {
+		wg.Wait()
+		batch := make([]*Response, 0, len(responses))
+		for _, response := range responses {
+			if response != nil {
+				batch = append(batch, response)
+			}
+		}
+		if len(batch) == 0 {
+			done(nil)
+			return
+		}
+		resData, _ := json.Marshal(batch)
+		done(resData)
+	}()
+}
+
+// handle serves a single request, returning nil for a notification.
+func (s *Server) handle(ctx context.Context, data []byte) *Response {
+	request := Request{}
+	if err := json.Unmarshal(data, &request); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return errorResponse(nil, &Error{Code: CodeParseError, Message: err.Error()})
+		}
+		return errorResponse(nil, &Error{Code: CodeInvalidRequest, Message: err.Error()})
+	}
+	if request.JSONRPC != Version || request.Method == "" || !validID(request.ID) {
+		return errorResponse(request.ID, &Error{Code: CodeInvalidRequest, Message: "invalid request"})
+	}
+
+	params := []byte(request.Params)
+	if len(params) == 0 || bytes.Equal(params, []byte("null")) {
+		params = []byte("{}")
+	}
+	res, err := s.dispatcher.Handle(ctx, request.Method, params)
+	if request.IsNotification() {
+		return nil
+	}
+	if err != nil {
+		return errorResponse(request.ID, NewError(err))
+	}
+	result, err := s.dispatcher.Encode(res)
+	if err != nil {
+		return errorResponse(request.ID, &Error{Code: CodeInternalError, Message: err.Error()})
+	}
+	return &Response{JSONRPC: Version, Result: result, ID: request.ID}
+}
+
+// validID reports whether an ID is absent, a string, a number or null, as the specification requires.
+func validID(id json.RawMessage) bool {
+	if id == nil {
+		return true
+	}
+	var value any
+	if err := json.Unmarshal(id, &value); err != nil {
+		return false
+	}
+	switch value.(type) {
+	case nil, string, float64:
+		return true
+	default:
+		return false
+	}
+}
+
+func errorResponse(id json.RawMessage, err *Error) *Response {
+	return &Response{JSONRPC: Version, Error: err, ID: id}
+}
+
+func writeJSON(writer http.ResponseWriter, statusCode int, body any) {
+	data, _ := json.Marshal(body)
+	writer.Header().Set("Content-Type", contentTypeJSON)
+	writer.WriteHeader(statusCode)
+	_, _ = writer.Write(data)
+}
@@ -0,0 +1,263 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dan-lugg/go-commands/commands"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_NewServer(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		server, _ := newServer()
+		assert.NotNil(t, server.dispatcher)
+		assert.Equal(t, DefaultMaxBodySize, server.maxBodySize)
+	})
+
+	t.Run("with options", func(t *testing.T) {
+		server, _ := newServer(WithMaxBodySize(16), WithMaxConcurrency(0))
+		assert.Equal(t, int64(16), server.maxBodySize)
+		assert.Equal(t, 1, server.maxConcurrency)
+	})
+}
+
+func Test_Server_MaxConcurrency(t *testing.T) {
+	slow := `{"jsonrpc":"2.0","method":"slow","params":{"delay":10000000},"id":1}`
+
+	t.Run("batch", func(t *testing.T) {
+		server, peak := newSlowServer(WithMaxConcurrency(2))
+		batch := "[" + strings.TrimSuffix(strings.Repeat(slow+",", 6), ",") + "]"
+		responses := make([]Response, 0)
+		assert.NoError(t, json.Unmarshal(server.Handle(context.Background(), []byte(batch)), &responses))
+		assert.Len(t, responses, 6)
+		assert.Equal(t, int64(2), peak.Load())
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		server, peak := newSlowServer(WithMaxConcurrency(3))
+		output := &bytes.Buffer{}
+		input := strings.Repeat(slow+"\n", 4) + "[" + slow + "," + slow + "]"
+		assert.NoError(t, server.ServeConn(context.Background(), pipeConn{Reader: strings.NewReader(input), output: output}))
+		assert.Len(t, strings.Split(strings.TrimSpace(output.String()), "\n"), 5)
+		assert.Equal(t, int64(3), peak.Load())
+	})
+}
+
+func Test_Server_Handle(t *testing.T) {
+	server, calls := newServer()
+	tests := []struct {
+		name    string
+		reqRaw  string
+		resRaw  string
+		errCode int
+	}{
+		{"success", `{"jsonrpc":"2.0","method":"add","params":{"argX":1,"argY":2},"id":1}`, `{"jsonrpc":"2.0","result":{"result":3},"id":1}`, 0},
+		{"string id", `{"jsonrpc":"2.0","method":"add","params":{"argX":1,"argY":2},"id":"a"}`, `{"jsonrpc":"2.0","result":{"result":3},"id":"a"}`, 0},
+		{"null id", `{"jsonrpc":"2.0","method":"add","params":{"argX":1,"argY":2},"id":null}`, `{"jsonrpc":"2.0","result":{"result":3},"id":null}`, 0},
+		{"no params", `{"jsonrpc":"2.0","method":"add","id":1}`, `{"jsonrpc":"2.0","result":{"result":0},"id":1}`, 0},
+		{"method not found", `{"jsonrpc":"2.0","method":"missing","id":1}`, ``, CodeMethodNotFound},
+		{"handler missing", `{"jsonrpc":"2.0","method":"sub","params":{},"id":1}`, ``, CodeMethodNotFound},
+		{"invalid params", `{"jsonrpc":"2.0","method":"add","params":[1,2],"id":1}`, ``, CodeInvalidParams},
+		{"validation failure", `{"jsonrpc":"2.0","method":"valid","params":{},"id":1}`, ``, CodeInvalidParams},
+		{"server error", `{"jsonrpc":"2.0","method":"fail","id":1}`, `{"jsonrpc":"2.0","error":{"code":-32000,"message":"failure"},"id":1}`, CodeServerError},
+		{"wrong version", `{"jsonrpc":"1.0","method":"add","id":1}`, `{"jsonrpc":"2.0","error":{"code":-32600,"message":"invalid request"},"id":1}`, CodeInvalidRequest},
+		{"missing method", `{"jsonrpc":"2.0","id":1}`, ``, CodeInvalidRequest},
+		{"invalid method", `{"jsonrpc":"2.0","method":1,"id":1}`, ``, CodeInvalidRequest},
+		{"invalid id", `{"jsonrpc":"2.0","method":"add","id":{}}`, ``, CodeInvalidRequest},
+		{"not an object", `1`, ``, CodeInvalidRequest},
+		{"parse error", `{"jsonrpc":`, `{"jsonrpc":"2.0","error":{"code":-32700,"message":"unexpected end of JSON input"},"id":null}`, CodeParseError},
+		{"empty batch", `[]`, `{"jsonrpc":"2.0","error":{"code":-32600,"message":"empty batch"},"id":null}`, CodeInvalidRequest},
+		{"invalid batch", `[1`, ``, CodeParseError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resData := server.Handle(context.Background(), []byte(test.reqRaw))
+			if test.resRaw != "" {
+				assert.JSONEq(t, test.resRaw, string(resData))
+			}
+			response := Response{}
+			assert.NoError(t, json.Unmarshal(resData, &response))
+			assert.Equal(t, Version, response.JSONRPC)
+			if test.errCode == 0 {
+				assert.Nil(t, response.Error)
+			} else {
+				assert.Equal(t, test.errCode, response.Error.Code)
+			}
+		})
+	}
+
+	t.Run("notification", func(t *testing.T) {
+		before := calls.Load()
+		assert.Nil(t, server.Handle(context.Background(), []byte(`{"jsonrpc":"2.0","method":"add","params":{"argX":1}}`)))
+		assert.Nil(t, server.Handle(context.Background(), []byte(`{"jsonrpc":"2.0","method":"fail"}`)))
+		assert.Equal(t, before+1, calls.Load())
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		resData := server.Handle(context.Background(), []byte(`[
+			{"jsonrpc":"2.0","method":"add","params":{"argX":1,"argY":2},"id":"1"},
+			{"jsonrpc":"2.0","method":"add","params":{"argX":5}},
+			{"jsonrpc":"2.0","method":"missing","id":"2"},
+			1,
+			{"jsonrpc":"2.0","method":"add","params":{"argX":3,"argY":4},"id":"3"}
+		]`))
+		responses := make([]Response, 0)
+		assert.NoError(t, json.Unmarshal(resData, &responses))
+		assert.Len(t, responses, 4)
+		assert.JSONEq(t, `{"result":3}`, string(responses[0].Result))
+		assert.Equal(t, CodeMethodNotFound, responses[1].Error.Code)
+		assert.JSONEq(t, `"2"`, string(responses[1].ID))
+		assert.Equal(t, CodeInvalidRequest, responses[2].Error.Code)
+		assert.JSONEq(t, `{"result":7}`, string(responses[3].Result))
+	})
+
+	t.Run("batch of notifications", func(t *testing.T) {
+		assert.Nil(t, server.Handle(context.Background(), []byte(`[{"jsonrpc":"2.0","method":"add"},{"jsonrpc":"2.0","method":"add"}]`)))
+	})
+}
+
+func Test_Server_ServeHTTP(t *testing.T) {
+	server, _ := newServer(WithMaxBodySize(128))
+
+	serve := func(method string, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, httptest.NewRequest(method, "/rpc", strings.NewReader(body)))
+		return recorder
+	}
+
+	t.Run("success", func(t *testing.T) {
+		recorder := serve(http.MethodPost, `{"jsonrpc":"2.0","method":"add","params":{"argX":1,"argY":2},"id":1}`)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+		assert.JSONEq(t, `{"jsonrpc":"2.0","result":{"result":3},"id":1}`, recorder.Body.String())
+	})
+
+	t.Run("error", func(t *testing.T) {
+		recorder := serve(http.MethodPost, `{"jsonrpc":"2.0","method":"missing","id":1}`)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), `"code":-32601`)
+	})
+
+	t.Run("notification", func(t *testing.T) {
+		recorder := serve(http.MethodPost, `{"jsonrpc":"2.0","method":"add"}`)
+		assert.Equal(t, http.StatusNoContent, recorder.Code)
+		assert.Empty(t, recorder.Body.String())
+	})
+
+	t.Run("method not allowed", func(t *testing.T) {
+		recorder := serve(http.MethodGet, ``)
+		assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+		assert.Equal(t, http.MethodPost, recorder.Header().Get("Allow"))
+	})
+
+	t.Run("body too large", func(t *testing.T) {
+		recorder := serve(http.MethodPost, `{"jsonrpc":"2.0","method":"add","params":{"argX":1,"argY":2},"id":"`+strings.Repeat("x", 128)+`"}`)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), `"code":-32700`)
+	})
+}
+
+// pipeConn is an io.ReadWriter reading from a fixed input and recording the output.
+type pipeConn struct {
+	io.Reader
+	output *bytes.Buffer
+}
+
+func (c pipeConn) Write(data []byte) (int, error) {
+	return c.output.Write(data)
+}
+
+func Test_Server_ServeConn(t *testing.T) {
+	server, calls := newServer()
+
+	lines := func(output *bytes.Buffer) []Response {
+		responses := make([]Response, 0)
+		for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+			response := Response{}
+			if line != "" && json.Unmarshal([]byte(line), &response) == nil {
+				responses = append(responses, response)
+			}
+		}
+		return responses
+	}
+
+	t.Run("stream", func(t *testing.T) {
+		before := calls.Load()
+		output := &bytes.Buffer{}
+		input := strings.Join([]string{
+			`{"jsonrpc":"2.0","method":"add","params":{"argX":1,"argY":2},"id":1}`,
+			`{"jsonrpc":"2.0","method":"add","params":{"argX":1,"argY":2}}`,
+			`{"jsonrpc":"2.0","method":"fail","id":2} {"jsonrpc":"2.0","method":"add","params":{"argX":3,"argY":4},"id":3}`,
+			`[{"jsonrpc":"2.0","method":"add","id":4}]`,
+		}, "\n")
+		assert.NoError(t, server.ServeConn(context.Background(), pipeConn{Reader: strings.NewReader(input), output: output}))
+		responses := lines(output)
+		assert.Len(t, responses, 3)
+		assert.Equal(t, before+4, calls.Load())
+		batches := 0
+		for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+			if strings.HasPrefix(line, "[") {
+				batches++
+			}
+		}
+		assert.Equal(t, 1, batches)
+	})
+
+	t.Run("parse error", func(t *testing.T) {
+		output := &bytes.Buffer{}
+		input := `{"jsonrpc":"2.0","method":"add","id":1}` + "\n" + `{"jsonrpc"::}` + "\n" + `{"jsonrpc":"2.0","method":"add","id":2}`
+		err := server.ServeConn(context.Background(), pipeConn{Reader: strings.NewReader(input), output: output})
+		assert.Error(t, err)
+		responses := lines(output)
+		assert.Len(t, responses, 2)
+		codes := []int{0, 0}
+		for i, response := range responses {
+			if response.Error != nil {
+				codes[i] = response.Error.Code
+			}
+		}
+		assert.ElementsMatch(t, []int{0, CodeParseError}, codes)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		reader, writer := io.Pipe()
+		defer func() { _ = writer.Close() }()
+		done := make(chan error)
+		go func() {
+			done <- server.ServeConn(ctx, pipeConn{Reader: reader, output: &bytes.Buffer{}})
+		}()
+		select {
+		case err := <-done:
+			assert.NoError(t, err)
+		case <-time.After(time.Second):
+			assert.Fail(t, "ServeConn did not return")
+		}
+	})
+}
+
+func Test_Server_Handle_Encoder(t *testing.T) {
+	encoderCatalog := commands.NewDefaultEncoderCatalog()
+	commands.InsertEncoder[AddCommandRes](encoderCatalog, func(res commands.CommandRes) ([]byte, error) {
+		return json.Marshal(res.(AddCommandRes).Result)
+	})
+	server, _ := newServer(WithEncoderCatalog(encoderCatalog))
+
+	resData := server.Handle(context.Background(), []byte(`{"jsonrpc":"2.0","method":"add","params":{"argX":3,"argY":4},"id":1}`))
+	assert.JSONEq(t, `{"jsonrpc":"2.0","result":7,"id":1}`, string(resData))
+
+	resData = server.Handle(context.Background(), []byte(`{"jsonrpc":"2.0","method":"valid","params":{"name":"x"},"id":2}`))
+	response := Response{}
+	assert.NoError(t, json.Unmarshal(resData, &response))
+	assert.Equal(t, CodeInternalError, response.Error.Code)
+	assert.Contains(t, response.Error.Message, commands.ErrEncoderMissing.Error())
+}
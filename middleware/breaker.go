@@ -0,0 +1,440 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dan-lugg/go-commands/commands"
+)
+
+var (
+	ErrCircuitOpen = errors.New("circuit open")
+)
+
+// CircuitState is the state of the circuit of a CircuitBreaker.
+type CircuitState int
+
+const (
+	// CircuitClosed lets every call through, recording its outcome in the rolling window.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails every call with ErrCircuitOpen until the cooldown has elapsed.
+	CircuitOpen
+	// CircuitHalfOpen lets a limited number of probe calls through to decide whether to close again.
+	CircuitHalfOpen
+)
+
+// String returns the name of the CircuitState.
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitEvent describes a change in the state of a circuit.
+//
+// Fields:
+//   - Key: The key of the circuit.
+//   - From: The state the circuit left.
+//   - To: The state the circuit entered.
+//   - Time: The time of the change.
+type CircuitEvent struct {
+	Key  string
+	From CircuitState
+	To   CircuitState
+	Time time.Time
+}
+
+// KeyByType keys a circuit by the request type of the dispatch.
+//
+// Parameters:
+//   - info: The InterceptorInfo of the dispatch.
+//
+// Returns:
+//   - The name of the request type.
+func KeyByType(info commands.InterceptorInfo) string {
+	return info.ReqType.String()
+}
+
+// KeyByName keys a circuit by the mapped name of the request, falling back to the
+// request type if the catalog has no MappingCatalog or the type is not mapped.
+//
+// Parameters:
+//   - info: The InterceptorInfo of the dispatch.
+//
+// Returns:
+//   - The mapped name of the request, or the name of its type.
+func KeyByName(info commands.InterceptorInfo) string {
+	if info.ReqName != "" {
+		return info.ReqName
+	}
+	return KeyByType(info)
+}
+
+// IsFailure is the default Classifier of a BreakerPolicy. It reports every error
+// as a failure, except cancellations of the caller's context and validation failures.
+//
+// Parameters:
+//   - err: The error to classify.
+//
+// Returns:
+//   - true if err counts towards opening the circuit.
+func IsFailure(err error) bool {
+	return err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, commands.ErrValidationFailure)
+}
+
+// BreakerPolicy configures a CircuitBreaker.
+//
+// Fields:
+//   - Window: The duration of the rolling window over which outcomes are counted.
+//   - Buckets: The number of buckets the window is divided into.
+//   - MinRequests: The number of calls the window must hold before the circuit can open.
+//   - FailureRatio: The ratio of failed calls, between 0 and 1, at which the circuit opens.
+//   - Cooldown: The duration the circuit stays open before probing.
+//   - Probes: The number of successful probes needed to close a half-open circuit.
+//   - Key: A function returning the key of the circuit a dispatch goes through.
+//   - Classifier: A function reporting whether an error counts as a failure.
+//   - OnStateChange: An optional function receiving a CircuitEvent for every change of state.
+type BreakerPolicy struct {
+	Window        time.Duration
+	Buckets       int
+	MinRequests   int
+	FailureRatio  float64
+	Cooldown      time.Duration
+	Probes        int
+	Key           func(info commands.InterceptorInfo) string
+	Classifier    func(err error) bool
+	OnStateChange func(event CircuitEvent)
+}
+
+// DefaultBreakerPolicy returns a BreakerPolicy opening a circuit when at least half of
+// 20 or more calls over a 10s window fail, cooling down for 5s and closing again after
+// 1 successful probe. Circuits are keyed by request type.
+//
+// Returns:
+//   - The default BreakerPolicy.
+func DefaultBreakerPolicy() BreakerPolicy {
+	return BreakerPolicy{
+		Window:        10 * time.Second,
+		Buckets:       10,
+		MinRequests:   20,
+		FailureRatio:  0.5,
+		Cooldown:      5 * time.Second,
+		Probes:        1,
+		Key:           KeyByType,
+		Classifier:    IsFailure,
+		OnStateChange: nil,
+	}
+}
+
+// bucket counts the outcomes of the calls made during one slice of the rolling window.
+type bucket struct {
+	epoch     int64
+	successes int
+	failures  int
+}
+
+// ticket identifies a call let through a circuit, so that its outcome is only counted in the
+// state it was let through in.
+//
+// Fields:
+//   - generation: The generation of the circuit when the call was let through.
+//   - probe: Whether the call was let through as a probe of a half-open circuit.
+type ticket struct {
+	generation uint64
+	probe      bool
+}
+
+// circuit holds the state of one key of a CircuitBreaker.
+//
+// Fields:
+//   - state: The current CircuitState.
+//   - generation: A counter incremented on every change of state.
+//   - openedAt: The time the circuit last opened.
+//   - buckets: The ring of buckets making up the rolling window.
+//   - probes: The number of probes let through since the circuit became half-open.
+//   - successes: The number of successful probes since the circuit became half-open.
+type circuit struct {
+	state      CircuitState
+	generation uint64
+	openedAt   time.Time
+	buckets    []bucket
+	probes     int
+	successes  int
+}
+
+// CircuitBreaker fails calls fast with ErrCircuitOpen while the handlers behind a key
+// are failing, instead of letting them pile up.
+//
+// A circuit starts closed. It opens when the ratio of failures in the rolling window
+// reaches FailureRatio, stays open for Cooldown, and then becomes half-open, letting
+// Probes calls through. It closes when they all succeed, and opens again if any fails.
+// Calls canceled by their caller are not counted, and neither are calls that complete after
+// the circuit changed state.
+//
+// Fields:
+//   - policy: The BreakerPolicy applied to every circuit.
+//   - circuits: A map that associates keys with their circuits.
+//   - pending: The events raised under the lock, emitted once it is released.
+type CircuitBreaker struct {
+	mutex    sync.Mutex
+	policy   BreakerPolicy
+	circuits map[string]*circuit
+	pending  []CircuitEvent
+}
+
+// NewCircuitBreaker creates and returns a new instance of CircuitBreaker.
+//
+// Parameters:
+//   - policy: The BreakerPolicy applied to every circuit.
+//
+// Returns:
+//   - A pointer to a CircuitBreaker instance.
+func NewCircuitBreaker(policy BreakerPolicy) (breaker *CircuitBreaker) {
+	if policy.Key == nil {
+		policy.Key = KeyByType
+	}
+	if policy.Classifier == nil {
+		policy.Classifier = IsFailure
+	}
+	policy.Buckets = max(policy.Buckets, 1)
+	policy.Probes = max(policy.Probes, 1)
+	return &CircuitBreaker{
+		mutex:    sync.Mutex{},
+		policy:   policy,
+		circuits: make(map[string]*circuit),
+		pending:  nil,
+	}
+}
+
+// Interceptor returns a commands.Interceptor routing each dispatch through the circuit of its key.
+//
+// Returns:
+//   - A commands.Interceptor failing with an error wrapping ErrCircuitOpen while the circuit is open.
+func (b *CircuitBreaker) Interceptor() commands.Interceptor {
+	return func(ctx context.Context, info commands.InterceptorInfo, req commands.CommandReq[commands.CommandRes], next commands.Invoker) (res commands.CommandRes, err error) {
+		key := b.policy.Key(info)
+		token, err := b.allow(key)
+		if err != nil {
+			return nil, err
+		}
+		recorded := false
+		defer func() {
+			if !recorded {
+				b.release(key, token)
+			}
+		}()
+		res, err = next(ctx, req)
+		recorded = true
+		b.record(key, token, err)
+		return res, err
+	}
+}
+
+// State returns the current state of the circuit of a key.
+//
+// Parameters:
+//   - key: The key of the circuit.
+//
+// Returns:
+//   - The CircuitState of the circuit, or CircuitClosed if no call has gone through it.
+func (b *CircuitBreaker) State(key string) CircuitState {
+	defer b.emit()
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	found, ok := b.circuits[key]
+	if !ok {
+		return CircuitClosed
+	}
+	b.advance(key, found, time.Now())
+	return found.state
+}
+
+// States returns the current state of every circuit.
+//
+// Returns:
+//   - A map associating the keys of the circuits with their CircuitState.
+func (b *CircuitBreaker) States() map[string]CircuitState {
+	defer b.emit()
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := time.Now()
+	states := make(map[string]CircuitState, len(b.circuits))
+	for key, found := range b.circuits {
+		b.advance(key, found, now)
+		states[key] = found.state
+	}
+	return states
+}
+
+// Reset closes the circuit of a key and clears its rolling window.
+//
+// Parameters:
+//   - key: The key of the circuit.
+func (b *CircuitBreaker) Reset(key string) {
+	defer b.emit()
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if found, ok := b.circuits[key]; ok {
+		clear(found.buckets)
+		b.transition(key, found, CircuitClosed, time.Now())
+	}
+}
+
+// allow reports whether a call may go through the circuit of key, returning the ticket its
+// outcome is recorded with.
+func (b *CircuitBreaker) allow(key string) (ticket, error) {
+	defer b.emit()
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := time.Now()
+	found := b.circuit(key)
+	b.advance(key, found, now)
+	switch found.state {
+	case CircuitOpen:
+		retryAfter := found.openedAt.Add(b.policy.Cooldown).Sub(now)
+		return ticket{}, fmt.Errorf("%w for key: %s, retry after %s", ErrCircuitOpen, key, retryAfter)
+	case CircuitHalfOpen:
+		if found.probes >= b.policy.Probes {
+			return ticket{}, fmt.Errorf("%w for key: %s, probe in progress", ErrCircuitOpen, key)
+		}
+		found.probes++
+		return ticket{generation: found.generation, probe: true}, nil
+	}
+	return ticket{generation: found.generation, probe: false}, nil
+}
+
+// record counts the outcome of a call that went through the circuit of key. The outcome of a
+// call canceled by its caller is not counted, and neither is the outcome of a call let through
+// before the last change of state of the circuit.
+func (b *CircuitBreaker) record(key string, token ticket, err error) {
+	if errors.Is(err, context.Canceled) {
+		b.release(key, token)
+		return
+	}
+	failed := b.policy.Classifier(err)
+	defer b.emit()
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := time.Now()
+	found := b.circuit(key)
+	if found.generation != token.generation {
+		return
+	}
+	switch found.state {
+	case CircuitHalfOpen:
+		if failed {
+			b.transition(key, found, CircuitOpen, now)
+			return
+		}
+		if found.successes++; found.successes >= b.policy.Probes {
+			clear(found.buckets)
+			b.transition(key, found, CircuitClosed, now)
+		}
+	case CircuitClosed:
+		current := b.bucket(found, now)
+		if failed {
+			current.failures++
+		} else {
+			current.successes++
+		}
+		successes, failures := b.count(found, now)
+		total := successes + failures
+		if failures > 0 && total >= b.policy.MinRequests && float64(failures)/float64(total) >= b.policy.FailureRatio {
+			b.transition(key, found, CircuitOpen, now)
+		}
+	}
+}
+
+// release frees the probe slot held by a call whose outcome is not counted, so that another
+// probe may take it.
+func (b *CircuitBreaker) release(key string, token ticket) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	found := b.circuit(key)
+	if token.probe && found.generation == token.generation && found.state == CircuitHalfOpen {
+		found.probes--
+	}
+}
+
+// circuit returns the circuit of key, creating it on first use.
+func (b *CircuitBreaker) circuit(key string) *circuit {
+	found, ok := b.circuits[key]
+	if !ok {
+		found = &circuit{
+			state:   CircuitClosed,
+			buckets: make([]bucket, b.policy.Buckets),
+		}
+		b.circuits[key] = found
+	}
+	return found
+}
+
+// advance moves an open circuit whose cooldown has elapsed to half-open.
+func (b *CircuitBreaker) advance(key string, found *circuit, now time.Time) {
+	if found.state == CircuitOpen && !now.Before(found.openedAt.Add(b.policy.Cooldown)) {
+		b.transition(key, found, CircuitHalfOpen, now)
+	}
+}
+
+// transition changes the state of a circuit and emits a CircuitEvent.
+func (b *CircuitBreaker) transition(key string, found *circuit, state CircuitState, now time.Time) {
+	from := found.state
+	found.state = state
+	found.generation++
+	found.probes, found.successes = 0, 0
+	if state == CircuitOpen {
+		found.openedAt = now
+	}
+	if from != state && b.policy.OnStateChange != nil {
+		b.pending = append(b.pending, CircuitEvent{Key: key, From: from, To: state, Time: now})
+	}
+}
+
+// emit passes the pending events to OnStateChange, outside the lock so that it may query the CircuitBreaker.
+func (b *CircuitBreaker) emit() {
+	b.mutex.Lock()
+	pending := b.pending
+	b.pending = nil
+	b.mutex.Unlock()
+	for _, event := range pending {
+		b.policy.OnStateChange(event)
+	}
+}
+
+// bucket returns the bucket of the rolling window covering now, resetting it if it is stale.
+func (b *CircuitBreaker) bucket(found *circuit, now time.Time) *bucket {
+	epoch := b.epoch(now)
+	current := &found.buckets[epoch%int64(len(found.buckets))]
+	if current.epoch != epoch {
+		*current = bucket{epoch: epoch}
+	}
+	return current
+}
+
+// count sums the outcomes held by the buckets of the rolling window covering now.
+func (b *CircuitBreaker) count(found *circuit, now time.Time) (successes int, failures int) {
+	epoch := b.epoch(now)
+	for _, counted := range found.buckets {
+		if counted.epoch > epoch-int64(len(found.buckets)) {
+			successes += counted.successes
+			failures += counted.failures
+		}
+	}
+	return successes, failures
+}
+
+// epoch returns the index of the bucket-sized slice of time covering now.
+func (b *CircuitBreaker) epoch(now time.Time) int64 {
+	width := max(int64(b.policy.Window)/int64(b.policy.Buckets), 1)
+	return now.UnixNano() / width
+}
@@ -0,0 +1,198 @@
+package middleware
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dan-lugg/go-commands/commands"
+	"github.com/stretchr/testify/assert"
+)
+
+func fastBreakerPolicy() BreakerPolicy {
+	policy := DefaultBreakerPolicy()
+	policy.Window = time.Second
+	policy.MinRequests = 4
+	policy.FailureRatio = 0.5
+	policy.Cooldown = 50 * time.Millisecond
+	return policy
+}
+
+func Test_CircuitState_String(t *testing.T) {
+	assert.Equal(t, "closed", CircuitClosed.String())
+	assert.Equal(t, "open", CircuitOpen.String())
+	assert.Equal(t, "half-open", CircuitHalfOpen.String())
+	assert.Equal(t, "unknown", CircuitState(-1).String())
+}
+
+func Test_KeyByName(t *testing.T) {
+	reqType := reflect.TypeFor[FlakyCommandReq]()
+	assert.Equal(t, "flaky", KeyByName(commands.InterceptorInfo{ReqType: reqType, ReqName: "flaky"}))
+	assert.Equal(t, reqType.String(), KeyByName(commands.InterceptorInfo{ReqType: reqType}))
+}
+
+func Test_IsFailure(t *testing.T) {
+	assert.True(t, IsFailure(ErrFailure))
+	assert.False(t, IsFailure(nil))
+	assert.False(t, IsFailure(context.Canceled))
+	assert.False(t, IsFailure(commands.ErrValidationFailure))
+}
+
+func Test_CircuitBreaker(t *testing.T) {
+	key := reflect.TypeFor[FlakyCommandReq]().String()
+
+	t.Run("stays closed below min requests", func(t *testing.T) {
+		breaker := NewCircuitBreaker(fastBreakerPolicy())
+		catalog, _ := newFlakyCatalog(breaker.Interceptor())
+		for i := 0; i < 3; i++ {
+			_, err := commands.Handle[FlakyCommandReq, FlakyCommandRes](nil, catalog, FlakyCommandReq{Failures: 10, Err: ErrFailure})
+			assert.ErrorIs(t, err, ErrFailure)
+		}
+		assert.Equal(t, CircuitClosed, breaker.State(key))
+	})
+
+	t.Run("stays closed below failure ratio", func(t *testing.T) {
+		breaker := NewCircuitBreaker(fastBreakerPolicy())
+		catalog, _ := newFlakyCatalog(breaker.Interceptor())
+		_, _ = commands.Handle[FlakyCommandReq, FlakyCommandRes](nil, catalog, FlakyCommandReq{Failures: 1, Err: ErrFailure})
+		for i := 0; i < 5; i++ {
+			_, err := commands.Handle[FlakyCommandReq, FlakyCommandRes](nil, catalog, FlakyCommandReq{Failures: 1, Err: ErrFailure})
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, CircuitClosed, breaker.State(key))
+	})
+
+	t.Run("opens and fails fast", func(t *testing.T) {
+		breaker := NewCircuitBreaker(fastBreakerPolicy())
+		catalog, handler := newFlakyCatalog(breaker.Interceptor())
+		for i := 0; i < 4; i++ {
+			_, _ = commands.Handle[FlakyCommandReq, FlakyCommandRes](nil, catalog, FlakyCommandReq{Failures: 10, Err: ErrFailure})
+		}
+		assert.Equal(t, CircuitOpen, breaker.State(key))
+		_, err := commands.Handle[FlakyCommandReq, FlakyCommandRes](nil, catalog, FlakyCommandReq{Failures: 10, Err: ErrFailure})
+		assert.ErrorIs(t, err, ErrCircuitOpen)
+		assert.Equal(t, int64(4), handler.calls.Load())
+	})
+
+	t.Run("half-open probe closes", func(t *testing.T) {
+		breaker := NewCircuitBreaker(fastBreakerPolicy())
+		catalog, _ := newFlakyCatalog(breaker.Interceptor())
+		for i := 0; i < 4; i++ {
+			_, _ = commands.Handle[FlakyCommandReq, FlakyCommandRes](nil, catalog, FlakyCommandReq{Failures: 4, Err: ErrFailure})
+		}
+		time.Sleep(60 * time.Millisecond)
+		assert.Equal(t, CircuitHalfOpen, breaker.State(key))
+		_, err := commands.Handle[FlakyCommandReq, FlakyCommandRes](nil, catalog, FlakyCommandReq{Failures: 4, Err: ErrFailure})
+		assert.NoError(t, err)
+		assert.Equal(t, CircuitClosed, breaker.State(key))
+	})
+
+	t.Run("half-open probe reopens", func(t *testing.T) {
+		breaker := NewCircuitBreaker(fastBreakerPolicy())
+		catalog, _ := newFlakyCatalog(breaker.Interceptor())
+		for i := 0; i < 4; i++ {
+			_, _ = commands.Handle[FlakyCommandReq, FlakyCommandRes](nil, catalog, FlakyCommandReq{Failures: 10, Err: ErrFailure})
+		}
+		time.Sleep(60 * time.Millisecond)
+		_, err := commands.Handle[FlakyCommandReq, FlakyCommandRes](nil, catalog, FlakyCommandReq{Failures: 10, Err: ErrFailure})
+		assert.ErrorIs(t, err, ErrFailure)
+		assert.Equal(t, CircuitOpen, breaker.State(key))
+	})
+
+	t.Run("canceled probe is not counted", func(t *testing.T) {
+		breaker := NewCircuitBreaker(fastBreakerPolicy())
+		catalog, _ := newFlakyCatalog(breaker.Interceptor())
+		for i := 0; i < 4; i++ {
+			_, _ = commands.Handle[FlakyCommandReq, FlakyCommandRes](nil, catalog, FlakyCommandReq{Failures: 10, Err: ErrFailure})
+		}
+		time.Sleep(60 * time.Millisecond)
+		_, err := commands.Handle[FlakyCommandReq, FlakyCommandRes](nil, catalog, FlakyCommandReq{Failures: 10, Err: context.Canceled})
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, CircuitHalfOpen, breaker.State(key))
+		_, err = commands.Handle[FlakyCommandReq, FlakyCommandRes](nil, catalog, FlakyCommandReq{Failures: 10, Err: ErrFailure})
+		assert.ErrorIs(t, err, ErrFailure)
+		assert.Equal(t, CircuitOpen, breaker.State(key))
+	})
+
+	t.Run("panicking probe is released", func(t *testing.T) {
+		breaker := NewCircuitBreaker(fastBreakerPolicy())
+		interceptor := breaker.Interceptor()
+		info := commands.InterceptorInfo{ReqType: reflect.TypeFor[FlakyCommandReq]()}
+		invoke := func(next commands.Invoker) (err error) {
+			defer func() {
+				if recover() != nil {
+					err = ErrFailure
+				}
+			}()
+			_, err = interceptor(context.Background(), info, FlakyCommandReq{}, next)
+			return err
+		}
+		for i := 0; i < 4; i++ {
+			_ = invoke(func(ctx context.Context, req commands.CommandReq[commands.CommandRes]) (commands.CommandRes, error) {
+				return nil, ErrFailure
+			})
+		}
+		time.Sleep(60 * time.Millisecond)
+		_ = invoke(func(ctx context.Context, req commands.CommandReq[commands.CommandRes]) (commands.CommandRes, error) {
+			panic("probe")
+		})
+		assert.Equal(t, CircuitHalfOpen, breaker.State(key))
+		err := invoke(func(ctx context.Context, req commands.CommandReq[commands.CommandRes]) (commands.CommandRes, error) {
+			return FlakyCommandRes{}, nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, CircuitClosed, breaker.State(key))
+	})
+
+	t.Run("stale success is not a probe", func(t *testing.T) {
+		breaker := NewCircuitBreaker(fastBreakerPolicy())
+		stale, err := breaker.allow(key)
+		assert.NoError(t, err)
+		for i := 0; i < 4; i++ {
+			token, _ := breaker.allow(key)
+			breaker.record(key, token, ErrFailure)
+		}
+		time.Sleep(60 * time.Millisecond)
+		assert.Equal(t, CircuitHalfOpen, breaker.State(key))
+		breaker.record(key, stale, nil)
+		assert.Equal(t, CircuitHalfOpen, breaker.State(key))
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		breaker := NewCircuitBreaker(fastBreakerPolicy())
+		catalog, _ := newFlakyCatalog(breaker.Interceptor())
+		for i := 0; i < 4; i++ {
+			_, _ = commands.Handle[FlakyCommandReq, FlakyCommandRes](nil, catalog, FlakyCommandReq{Failures: 10, Err: ErrFailure})
+		}
+		breaker.Reset(key)
+		assert.Equal(t, map[string]CircuitState{key: CircuitClosed}, breaker.States())
+	})
+
+	t.Run("events", func(t *testing.T) {
+		mutex := sync.Mutex{}
+		events := make([]CircuitEvent, 0)
+		policy := fastBreakerPolicy()
+		policy.OnStateChange = func(event CircuitEvent) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			events = append(events, event)
+		}
+		breaker := NewCircuitBreaker(policy)
+		catalog, _ := newFlakyCatalog(breaker.Interceptor())
+		for i := 0; i < 4; i++ {
+			_, _ = commands.Handle[FlakyCommandReq, FlakyCommandRes](nil, catalog, FlakyCommandReq{Failures: 4, Err: ErrFailure})
+		}
+		time.Sleep(60 * time.Millisecond)
+		_, _ = commands.Handle[FlakyCommandReq, FlakyCommandRes](nil, catalog, FlakyCommandReq{Failures: 4, Err: ErrFailure})
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		assert.Len(t, events, 3)
+		assert.Equal(t, CircuitEvent{Key: key, From: CircuitClosed, To: CircuitOpen, Time: events[0].Time}, events[0])
+		assert.Equal(t, CircuitOpen, events[1].From)
+		assert.Equal(t, CircuitHalfOpen, events[1].To)
+		assert.Equal(t, CircuitClosed, events[2].To)
+	})
+}
@@ -0,0 +1,313 @@
+package middleware
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/dan-lugg/go-commands/commands"
+	"github.com/dan-lugg/go-commands/util"
+)
+
+const (
+	// DefaultCacheEntries is the number of results a Cache holds unless overridden with WithMaxEntries.
+	DefaultCacheEntries = 1024
+	// DefaultCacheTTL is the duration a Cache holds results unless overridden with WithDefaultTTL
+	// or by the request type.
+	DefaultCacheTTL = time.Minute
+)
+
+// CacheableReq is implemented by request types whose results may be cached, such as pure reads.
+// CacheTTL returns how long a result is held, or 0 to use the default TTL of the Cache.
+type CacheableReq interface {
+	CacheTTL() time.Duration
+}
+
+// CacheKeyer is an optional interface for cacheable requests providing their own cache key.
+// Other requests are keyed by a hash of their JSON encoding.
+type CacheKeyer interface {
+	CacheKey() string
+}
+
+// Invalidation identifies the cached results to drop.
+//
+// Fields:
+//   - ReqType: The request type of the results.
+//   - Key: The cache key of the result, or an empty string for every result of ReqType.
+type Invalidation struct {
+	ReqType reflect.Type
+	Key     string
+}
+
+// InvalidatingReq is an optional interface for requests that make cached results stale,
+// such as writes. Once such a request is handled successfully, the Cache drops the results
+// returned by Invalidations.
+type InvalidatingReq interface {
+	Invalidations() []Invalidation
+}
+
+// InvalidateType is a generic function returning an Invalidation of every cached result of a request type.
+//
+// Type Parameters:
+//   - TReq: The request type.
+//
+// Returns:
+//   - An Invalidation of every result of TReq.
+func InvalidateType[TReq any]() Invalidation {
+	return Invalidation{ReqType: reflect.TypeFor[TReq]()}
+}
+
+// InvalidateKey is a generic function returning an Invalidation of the cached result of a request.
+//
+// Type Parameters:
+//   - TReq: The request type.
+//
+// Parameters:
+//   - req: The request whose result is dropped.
+//
+// Returns:
+//   - An Invalidation of the result of req, or of every result of TReq if req cannot be encoded.
+func InvalidateKey[TReq any](req TReq) Invalidation {
+	key, _ := CacheKeyOf(req)
+	return Invalidation{ReqType: reflect.TypeFor[TReq](), Key: key}
+}
+
+// CacheKeyOf returns the cache key of a request.
+//
+// Parameters:
+//   - req: The request.
+//
+// Returns:
+//   - key: The key returned by CacheKey if req implements CacheKeyer, otherwise a hash of its JSON encoding.
+//   - err: An error if req cannot be encoded.
+func CacheKeyOf(req any) (key string, err error) {
+	if keyer, ok := req.(CacheKeyer); ok {
+		return keyer.CacheKey(), nil
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode req: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// cacheKey identifies a cached result.
+type cacheKey struct {
+	reqType reflect.Type
+	key     string
+}
+
+// cacheEntry is a cached result, held in the LRU list of a Cache.
+type cacheEntry struct {
+	key       cacheKey
+	res       commands.CommandRes
+	expiresAt time.Time
+}
+
+// Cache holds the results of cacheable requests, so repeat calls with the same payload
+// skip the handler.
+//
+// Only successful results of requests implementing CacheableReq are cached. Results are held
+// until their TTL expires, they are invalidated, or they are evicted as the least recently
+// used entry once the Cache is full. Cached results are returned as is, so results holding
+// pointers must not be modified by callers. A result is not cached if results were invalidated
+// or cleared while it was computed, as it may predate the invalidation.
+//
+// Fields:
+//   - maxEntries: The maximum number of results held.
+//   - defaultTTL: The duration results are held for unless the request type sets one.
+//   - entries: A map that associates cache keys with their element in the LRU list.
+//   - lru: The list of entries, from most to least recently used.
+//   - generation: The number of invalidations and clears applied so far.
+type Cache struct {
+	mutex      sync.Mutex
+	maxEntries int
+	defaultTTL time.Duration
+	entries    map[cacheKey]*list.Element
+	lru        *list.List
+	generation uint64
+}
+
+type CacheOption = util.Option[*Cache]
+
+// WithMaxEntries returns an option that sets the maximum number of results held by a Cache.
+//
+// Parameters:
+//   - maxEntries: The maximum number of results held.
+func WithMaxEntries(maxEntries int) CacheOption {
+	return func(c *Cache) {
+		c.maxEntries = maxEntries
+	}
+}
+
+// WithDefaultTTL returns an option that sets the duration a Cache holds results for,
+// unless the request type sets one.
+//
+// Parameters:
+//   - ttl: The duration results are held for.
+func WithDefaultTTL(ttl time.Duration) CacheOption {
+	return func(c *Cache) {
+		c.defaultTTL = ttl
+	}
+}
+
+// NewCache creates and returns a new instance of Cache.
+//
+// By default the Cache holds DefaultCacheEntries results for DefaultCacheTTL.
+//
+// Parameters:
+//   - options: Options applied to the Cache.
+//
+// Returns:
+//   - A pointer to a Cache instance.
+func NewCache(options ...CacheOption) (cache *Cache) {
+	cache = &Cache{
+		mutex:      sync.Mutex{},
+		maxEntries: DefaultCacheEntries,
+		defaultTTL: DefaultCacheTTL,
+		entries:    make(map[cacheKey]*list.Element),
+		lru:        list.New(),
+	}
+	for _, option := range options {
+		option(cache)
+	}
+	cache.maxEntries = max(cache.maxEntries, 1)
+	return cache
+}
+
+// Interceptor returns a commands.Interceptor serving cacheable requests from the Cache,
+// and applying the invalidations of InvalidatingReq requests once they succeed. Streams are
+// never cached.
+//
+// Returns:
+//   - A commands.Interceptor applying the Cache.
+func (c *Cache) Interceptor() commands.Interceptor {
+	return func(ctx context.Context, info commands.InterceptorInfo, req commands.CommandReq[commands.CommandRes], next commands.Invoker) (res commands.CommandRes, err error) {
+		cacheable, ok := req.(CacheableReq)
+		if !ok || info.Stream {
+			res, err = next(ctx, req)
+			c.invalidateFor(req, err)
+			return res, err
+		}
+		key, err := CacheKeyOf(req)
+		if err != nil {
+			return nil, err
+		}
+		entryKey := cacheKey{reqType: info.ReqType, key: key}
+		res, found, generation := c.get(entryKey)
+		if found {
+			return res, nil
+		}
+		res, err = next(ctx, req)
+		if err == nil {
+			ttl := cacheable.CacheTTL()
+			if ttl <= 0 {
+				ttl = c.defaultTTL
+			}
+			c.put(entryKey, res, ttl, generation)
+		}
+		c.invalidateFor(req, err)
+		return res, err
+	}
+}
+
+// Invalidate drops cached results.
+//
+// Parameters:
+//   - invalidations: The results to drop.
+func (c *Cache) Invalidate(invalidations ...Invalidation) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.generation++
+	for _, invalidation := range invalidations {
+		if invalidation.Key != "" {
+			if element, found := c.entries[cacheKey{reqType: invalidation.ReqType, key: invalidation.Key}]; found {
+				c.remove(element)
+			}
+			continue
+		}
+		for entryKey, element := range c.entries {
+			if entryKey.reqType == invalidation.ReqType {
+				c.remove(element)
+			}
+		}
+	}
+}
+
+// Clear drops every cached result.
+func (c *Cache) Clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.generation++
+	clear(c.entries)
+	c.lru.Init()
+}
+
+// Len returns the number of results held, including expired results not yet dropped.
+//
+// Returns:
+//   - The number of results.
+func (c *Cache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.lru.Len()
+}
+
+// invalidateFor applies the invalidations of a request that succeeded.
+func (c *Cache) invalidateFor(req commands.CommandReq[commands.CommandRes], err error) {
+	if invalidating, ok := req.(InvalidatingReq); ok && err == nil {
+		c.Invalidate(invalidating.Invalidations()...)
+	}
+}
+
+// get returns an unexpired cached result, marking it as the most recently used, along with
+// the generation to pass to put on a miss.
+func (c *Cache) get(entryKey cacheKey) (res commands.CommandRes, found bool, generation uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, found := c.entries[entryKey]
+	if !found {
+		return nil, false, c.generation
+	}
+	entry := element.Value.(*cacheEntry)
+	if !time.Now().Before(entry.expiresAt) {
+		c.remove(element)
+		return nil, false, c.generation
+	}
+	c.lru.MoveToFront(element)
+	return entry.res, true, c.generation
+}
+
+// put caches a result computed from the given generation, evicting the least recently used
+// results if the Cache is full. The result is dropped if an invalidation or clear has been
+// applied since, as it may be stale.
+func (c *Cache) put(entryKey cacheKey, res commands.CommandRes, ttl time.Duration, generation uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.generation != generation {
+		return
+	}
+	entry := &cacheEntry{key: entryKey, res: res, expiresAt: time.Now().Add(ttl)}
+	if element, found := c.entries[entryKey]; found {
+		element.Value = entry
+		c.lru.MoveToFront(element)
+		return
+	}
+	c.entries[entryKey] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.maxEntries {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove drops a cached result.
+func (c *Cache) remove(element *list.Element) {
+	c.lru.Remove(element)
+	delete(c.entries, element.Value.(*cacheEntry).key)
+}
@@ -0,0 +1,212 @@
+package middleware
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dan-lugg/go-commands/commands"
+	"github.com/stretchr/testify/assert"
+)
+
+type QueryCommandRes struct {
+	Value string
+	Calls int64
+}
+
+type QueryCommandReq struct {
+	Name string
+	TTL  time.Duration
+}
+
+func (r QueryCommandReq) CacheTTL() time.Duration {
+	return r.TTL
+}
+
+type KeyedQueryCommandReq struct {
+	Name    string
+	Ignored int
+}
+
+func (r KeyedQueryCommandReq) CacheTTL() time.Duration {
+	return 0
+}
+
+func (r KeyedQueryCommandReq) CacheKey() string {
+	return r.Name
+}
+
+type UpdateCommandRes struct{}
+
+type UpdateCommandReq struct {
+	Name string
+}
+
+func (r UpdateCommandReq) Invalidations() []Invalidation {
+	if r.Name == "" {
+		return []Invalidation{InvalidateType[QueryCommandReq]()}
+	}
+	return []Invalidation{InvalidateKey(QueryCommandReq{Name: r.Name})}
+}
+
+type QueryHandler struct {
+	commands.Handler[QueryCommandReq, QueryCommandRes]
+	calls *atomic.Int64
+}
+
+func (h *QueryHandler) Handle(ctx context.Context, req QueryCommandReq) (res QueryCommandRes, err error) {
+	return QueryCommandRes{Value: req.Name, Calls: h.calls.Add(1)}, nil
+}
+
+type KeyedQueryHandler struct {
+	commands.Handler[KeyedQueryCommandReq, QueryCommandRes]
+	calls *atomic.Int64
+}
+
+func (h *KeyedQueryHandler) Handle(ctx context.Context, req KeyedQueryCommandReq) (res QueryCommandRes, err error) {
+	return QueryCommandRes{Value: req.Name, Calls: h.calls.Add(1)}, nil
+}
+
+type UpdateHandler struct {
+	commands.Handler[UpdateCommandReq, UpdateCommandRes]
+}
+
+func (h *UpdateHandler) Handle(ctx context.Context, req UpdateCommandReq) (res UpdateCommandRes, err error) {
+	return UpdateCommandRes{}, nil
+}
+
+func newQueryCatalog(cache *Cache) (*commands.DefaultHandlerCatalog, *atomic.Int64) {
+	calls := &atomic.Int64{}
+	catalog := commands.NewDefaultHandlerCatalog(commands.WithInterceptors(cache.Interceptor()))
+	commands.InsertHandler[QueryCommandReq, QueryCommandRes](catalog, func() commands.Handler[QueryCommandReq, QueryCommandRes] {
+		return &QueryHandler{calls: calls}
+	})
+	commands.InsertHandler[KeyedQueryCommandReq, QueryCommandRes](catalog, func() commands.Handler[KeyedQueryCommandReq, QueryCommandRes] {
+		return &KeyedQueryHandler{calls: calls}
+	})
+	commands.InsertHandler[UpdateCommandReq, UpdateCommandRes](catalog, func() commands.Handler[UpdateCommandReq, UpdateCommandRes] {
+		return &UpdateHandler{}
+	})
+	return catalog, calls
+}
+
+func Test_NewCache(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		cache := NewCache()
+		assert.Equal(t, DefaultCacheEntries, cache.maxEntries)
+		assert.Equal(t, DefaultCacheTTL, cache.defaultTTL)
+	})
+
+	t.Run("with options", func(t *testing.T) {
+		cache := NewCache(WithMaxEntries(2), WithDefaultTTL(time.Second))
+		assert.Equal(t, 2, cache.maxEntries)
+		assert.Equal(t, time.Second, cache.defaultTTL)
+	})
+}
+
+func Test_CacheKeyOf(t *testing.T) {
+	key, err := CacheKeyOf(KeyedQueryCommandReq{Name: "a", Ignored: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, "a", key)
+
+	keyA, err := CacheKeyOf(QueryCommandReq{Name: "a"})
+	assert.NoError(t, err)
+	keyB, err := CacheKeyOf(QueryCommandReq{Name: "b"})
+	assert.NoError(t, err)
+	assert.NotEqual(t, keyA, keyB)
+
+	_, err = CacheKeyOf(func() {})
+	assert.Error(t, err)
+}
+
+func Test_Cache_Interceptor(t *testing.T) {
+	t.Run("caches results", func(t *testing.T) {
+		catalog, calls := newQueryCatalog(NewCache())
+		for i := 0; i < 3; i++ {
+			res, err := commands.Handle[QueryCommandReq, QueryCommandRes](nil, catalog, QueryCommandReq{Name: "a"})
+			assert.NoError(t, err)
+			assert.Equal(t, QueryCommandRes{Value: "a", Calls: 1}, res)
+		}
+		res, err := commands.Handle[QueryCommandReq, QueryCommandRes](nil, catalog, QueryCommandReq{Name: "b"})
+		assert.NoError(t, err)
+		assert.Equal(t, QueryCommandRes{Value: "b", Calls: 2}, res)
+		assert.Equal(t, int64(2), calls.Load())
+	})
+
+	t.Run("cache key method", func(t *testing.T) {
+		catalog, calls := newQueryCatalog(NewCache())
+		_, _ = commands.Handle[KeyedQueryCommandReq, QueryCommandRes](nil, catalog, KeyedQueryCommandReq{Name: "a", Ignored: 1})
+		_, _ = commands.Handle[KeyedQueryCommandReq, QueryCommandRes](nil, catalog, KeyedQueryCommandReq{Name: "a", Ignored: 2})
+		assert.Equal(t, int64(1), calls.Load())
+	})
+
+	t.Run("expires", func(t *testing.T) {
+		catalog, calls := newQueryCatalog(NewCache())
+		_, _ = commands.Handle[QueryCommandReq, QueryCommandRes](nil, catalog, QueryCommandReq{Name: "a", TTL: 20 * time.Millisecond})
+		time.Sleep(30 * time.Millisecond)
+		_, _ = commands.Handle[QueryCommandReq, QueryCommandRes](nil, catalog, QueryCommandReq{Name: "a", TTL: 20 * time.Millisecond})
+		assert.Equal(t, int64(2), calls.Load())
+	})
+
+	t.Run("evicts least recently used", func(t *testing.T) {
+		cache := NewCache(WithMaxEntries(2))
+		catalog, calls := newQueryCatalog(cache)
+		for _, name := range []string{"a", "b", "a", "c", "a", "b"} {
+			_, _ = commands.Handle[QueryCommandReq, QueryCommandRes](nil, catalog, QueryCommandReq{Name: name})
+		}
+		assert.Equal(t, int64(4), calls.Load())
+		assert.Equal(t, 2, cache.Len())
+	})
+
+	t.Run("invalidates key", func(t *testing.T) {
+		catalog, calls := newQueryCatalog(NewCache())
+		_, _ = commands.Handle[QueryCommandReq, QueryCommandRes](nil, catalog, QueryCommandReq{Name: "a"})
+		_, _ = commands.Handle[QueryCommandReq, QueryCommandRes](nil, catalog, QueryCommandReq{Name: "b"})
+		_, err := commands.Handle[UpdateCommandReq, UpdateCommandRes](nil, catalog, UpdateCommandReq{Name: "a"})
+		assert.NoError(t, err)
+		_, _ = commands.Handle[QueryCommandReq, QueryCommandRes](nil, catalog, QueryCommandReq{Name: "a"})
+		_, _ = commands.Handle[QueryCommandReq, QueryCommandRes](nil, catalog, QueryCommandReq{Name: "b"})
+		assert.Equal(t, int64(3), calls.Load())
+	})
+
+	t.Run("invalidates type", func(t *testing.T) {
+		cache := NewCache()
+		catalog, calls := newQueryCatalog(cache)
+		_, _ = commands.Handle[QueryCommandReq, QueryCommandRes](nil, catalog, QueryCommandReq{Name: "a"})
+		_, _ = commands.Handle[QueryCommandReq, QueryCommandRes](nil, catalog, QueryCommandReq{Name: "b"})
+		_, _ = commands.Handle[KeyedQueryCommandReq, QueryCommandRes](nil, catalog, KeyedQueryCommandReq{Name: "a"})
+		_, _ = commands.Handle[UpdateCommandReq, UpdateCommandRes](nil, catalog, UpdateCommandReq{})
+		assert.Equal(t, 1, cache.Len())
+		_, _ = commands.Handle[QueryCommandReq, QueryCommandRes](nil, catalog, QueryCommandReq{Name: "a"})
+		assert.Equal(t, int64(4), calls.Load())
+	})
+
+	t.Run("invalidated while computing", func(t *testing.T) {
+		cache := NewCache()
+		info := commands.InterceptorInfo{ReqType: reflect.TypeFor[QueryCommandReq](), ResType: reflect.TypeFor[QueryCommandRes]()}
+		stale := func(ctx context.Context, req commands.CommandReq[commands.CommandRes]) (commands.CommandRes, error) {
+			cache.Invalidate(InvalidateType[QueryCommandReq]())
+			return QueryCommandRes{Value: "stale"}, nil
+		}
+		res, err := cache.Interceptor()(nil, info, QueryCommandReq{Name: "a"}, stale)
+		assert.NoError(t, err)
+		assert.Equal(t, QueryCommandRes{Value: "stale"}, res)
+		assert.Equal(t, 0, cache.Len())
+
+		fresh := func(ctx context.Context, req commands.CommandReq[commands.CommandRes]) (commands.CommandRes, error) {
+			return QueryCommandRes{Value: "fresh"}, nil
+		}
+		_, _ = cache.Interceptor()(nil, info, QueryCommandReq{Name: "a"}, fresh)
+		assert.Equal(t, 1, cache.Len())
+	})
+
+	t.Run("clear", func(t *testing.T) {
+		cache := NewCache()
+		catalog, _ := newQueryCatalog(cache)
+		_, _ = commands.Handle[QueryCommandReq, QueryCommandRes](nil, catalog, QueryCommandReq{Name: "a"})
+		cache.Clear()
+		assert.Equal(t, 0, cache.Len())
+	})
+}
@@ -0,0 +1,275 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/dan-lugg/go-commands/commands"
+)
+
+var (
+	ErrIdempotencyConflict = errors.New("idempotency key reused with a different request")
+)
+
+// storedSentinels are the sentinel errors a StoredError still matches after a replay. The
+// sentinel wrapped by a failed call is stored by its message, as the Kind of its record.
+var storedSentinels = []error{
+	commands.ErrMappingMissing,
+	commands.ErrDecoderFailure,
+	commands.ErrValidationFailure,
+	commands.ErrHandlerMissing,
+	ErrIdempotencyConflict,
+}
+
+// IdempotentReq is an optional interface for requests carrying their own idempotency key.
+// A key set with ContextWithIdempotencyKey takes precedence.
+type IdempotentReq interface {
+	IdempotencyKey() string
+}
+
+type idempotencyKey struct{}
+
+// ContextWithIdempotencyKey returns a context.Context carrying the idempotency key of the
+// command dispatched with it. Transports use it to apply a key sent by the caller.
+//
+// Parameters:
+//   - ctx: The parent context.Context.
+//   - key: The idempotency key.
+//
+// Returns:
+//   - A context.Context carrying the key.
+func ContextWithIdempotencyKey(ctx context.Context, key string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+// IdempotencyKeyFromContext returns the idempotency key carried by a context.Context.
+//
+// Parameters:
+//   - ctx: The context.Context to inspect.
+//
+// Returns:
+//   - key: The idempotency key, or an empty string.
+//   - ok: Whether ctx carries a key.
+func IdempotencyKeyFromContext(ctx context.Context) (key string, ok bool) {
+	if ctx == nil {
+		return "", false
+	}
+	key, ok = ctx.Value(idempotencyKey{}).(string)
+	return key, ok
+}
+
+// StoredError is the error replayed for an idempotency key whose first call failed.
+// The message of the original error is stored, along with the sentinel error it wrapped
+// if it is one of the sentinels of the commands package, or ErrIdempotencyConflict.
+//
+// Fields:
+//   - Message: The message of the original error.
+//   - Err: The sentinel error wrapped by the original error, or nil.
+type StoredError struct {
+	Message string
+	Err     error
+}
+
+// Error returns the message of the original error.
+func (e *StoredError) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the sentinel error wrapped by the original error, so that errors.Is
+// matches a replayed error as it matched the original one.
+func (e *StoredError) Unwrap() error {
+	return e.Err
+}
+
+// IdempotencyRecord is the outcome of the first call made with an idempotency key.
+//
+// Fields:
+//   - Fingerprint: A hash of the JSON encoding of the request, detecting reused keys.
+//   - Res: The JSON encoding of the result, if the call succeeded.
+//   - Err: The message of the error, if the call failed.
+//   - Kind: The message of the sentinel error wrapped by the error, if any.
+//   - ExpiresAt: The time after which the record is discarded.
+type IdempotencyRecord struct {
+	Fingerprint string          `json:"fingerprint"`
+	Res         json.RawMessage `json:"res,omitempty"`
+	Err         string          `json:"err,omitempty"`
+	Kind        string          `json:"kind,omitempty"`
+	ExpiresAt   time.Time       `json:"expiresAt"`
+}
+
+// Expired reports whether the record has expired.
+//
+// Parameters:
+//   - now: The current time.
+//
+// Returns:
+//   - true if the record must be discarded.
+func (r IdempotencyRecord) Expired(now time.Time) bool {
+	return !r.ExpiresAt.IsZero() && !now.Before(r.ExpiresAt)
+}
+
+// IdempotencyStore holds the IdempotencyRecord of each idempotency key.
+// Implementations must not return expired records.
+type IdempotencyStore interface {
+	Get(key string) (record IdempotencyRecord, found bool, err error)
+	Put(key string, record IdempotencyRecord) error
+	Delete(key string) error
+}
+
+// inflight is a call made with an idempotency key that has not completed yet.
+//
+// Fields:
+//   - done: A channel closed when the call completes.
+//   - record: The outcome of the call.
+//   - stored: Whether the outcome was stored, or must be retried by the waiting calls.
+type inflight struct {
+	done   chan struct{}
+	record IdempotencyRecord
+	stored bool
+}
+
+// Idempotency returns a commands.Interceptor that runs each command at most once per idempotency key.
+//
+// The key is taken from the context, set with ContextWithIdempotencyKey, or from requests
+// implementing IdempotentReq; dispatches without a key, and streams, are passed through. The
+// outcome of the first call is stored and replayed to repeat calls with the same key until it
+// expires; repeat calls made while the first is still running wait for it. Outcomes of calls
+// whose context ended are not stored, so they can be retried, and neither are the transient
+// failures reported by IsTransient, such as timeouts, open circuits and rate limits. A call
+// that panics stores nothing either. A failure to store an outcome does not fail the call that
+// produced it.
+//
+// Keys are scoped by mapped request name and by the caller set with ContextWithCaller, so
+// callers never see each other's outcomes. Reusing a key with a different request fails with
+// ErrIdempotencyConflict. A replayed error is a *StoredError holding the original message.
+//
+// Parameters:
+//   - store: The IdempotencyStore holding the outcomes.
+//   - ttl: The duration outcomes are kept for, or 0 to keep them until deleted.
+//
+// Returns:
+//   - A commands.Interceptor applying idempotency keys.
+func Idempotency(store IdempotencyStore, ttl time.Duration) commands.Interceptor {
+	mutex := sync.Mutex{}
+	running := make(map[string]*inflight)
+
+	return func(ctx context.Context, info commands.InterceptorInfo, req commands.CommandReq[commands.CommandRes], next commands.Invoker) (res commands.CommandRes, err error) {
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		key, ok := IdempotencyKeyFromContext(ctx)
+		if idempotentReq, isIdempotent := req.(IdempotentReq); !ok && isIdempotent {
+			key, ok = idempotentReq.IdempotencyKey(), true
+		}
+		if !ok || key == "" || info.Stream {
+			return next(ctx, req)
+		}
+		caller, _ := CallerFromContext(ctx)
+		key = fmt.Sprintf("%s|%q|%s", KeyByName(info), caller, key)
+		fingerprint, err := fingerprintOf(req)
+		if err != nil {
+			return nil, err
+		}
+
+		for {
+			mutex.Lock()
+			if call, found := running[key]; found {
+				mutex.Unlock()
+				select {
+				case <-call.done:
+					if !call.stored {
+						continue
+					}
+					return replay(info.ResType, fingerprint, call.record)
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			}
+			record, found, err := store.Get(key)
+			if err != nil {
+				mutex.Unlock()
+				return nil, fmt.Errorf("failed to load idempotency record for key: %s: %w", key, err)
+			}
+			if found {
+				mutex.Unlock()
+				return replay(info.ResType, fingerprint, record)
+			}
+			call := &inflight{done: make(chan struct{})}
+			running[key] = call
+			mutex.Unlock()
+			defer func() {
+				mutex.Lock()
+				delete(running, key)
+				mutex.Unlock()
+				close(call.done)
+			}()
+
+			res, err = next(ctx, req)
+			call.record = IdempotencyRecord{Fingerprint: fingerprint}
+			if err != nil {
+				call.record.Err, call.record.Kind = err.Error(), kindOf(err)
+			} else if call.record.Res, err = json.Marshal(res); err != nil {
+				err = fmt.Errorf("failed to encode res: %w", err)
+				call.record.Err = err.Error()
+			}
+			if ttl > 0 {
+				call.record.ExpiresAt = time.Now().Add(ttl)
+			}
+			if ctx.Err() == nil && !IsTransient(err) {
+				call.stored = store.Put(key, call.record) == nil
+			}
+			return res, err
+		}
+	}
+}
+
+// replay returns the outcome held by a record.
+func replay(resType reflect.Type, fingerprint string, record IdempotencyRecord) (res commands.CommandRes, err error) {
+	if record.Fingerprint != fingerprint {
+		return nil, ErrIdempotencyConflict
+	}
+	if record.Err != "" {
+		storedErr := &StoredError{Message: record.Err, Err: nil}
+		for _, sentinel := range storedSentinels {
+			if record.Kind == sentinel.Error() {
+				storedErr.Err = sentinel
+			}
+		}
+		return nil, storedErr
+	}
+	resValue := reflect.New(resType)
+	if err = json.Unmarshal(record.Res, resValue.Interface()); err != nil {
+		return nil, fmt.Errorf("failed to decode stored res: %w", err)
+	}
+	return resValue.Elem().Interface(), nil
+}
+
+// kindOf returns the message of the sentinel error wrapped by err, if it is one of storedSentinels.
+func kindOf(err error) string {
+	for _, sentinel := range storedSentinels {
+		if errors.Is(err, sentinel) {
+			return sentinel.Error()
+		}
+	}
+	return ""
+}
+
+// fingerprintOf returns a hash of the JSON encoding of a request.
+func fingerprintOf(req commands.CommandReq[commands.CommandRes]) (fingerprint string, err error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode req: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,284 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IdempotencySweepInterval is how often the stores of this package sweep expired records, as
+// records are added.
+const IdempotencySweepInterval = time.Minute
+
+// MemoryIdempotencyStore is an IdempotencyStore holding records in memory.
+// Expired records are discarded when read, and swept when records are added, at most once
+// per IdempotencySweepInterval.
+//
+// Fields:
+//   - records: A map that associates idempotency keys with their records.
+//   - sweptAt: The time of the last sweep.
+type MemoryIdempotencyStore struct {
+	mutex   sync.Mutex
+	records map[string]IdempotencyRecord
+	sweptAt time.Time
+}
+
+// NewMemoryIdempotencyStore creates and returns a new instance of MemoryIdempotencyStore.
+//
+// Returns:
+//   - A pointer to a MemoryIdempotencyStore instance.
+func NewMemoryIdempotencyStore() (store *MemoryIdempotencyStore) {
+	return &MemoryIdempotencyStore{
+		mutex:   sync.Mutex{},
+		records: make(map[string]IdempotencyRecord),
+		sweptAt: time.Now(),
+	}
+}
+
+// Get returns the record of an idempotency key.
+//
+// Parameters:
+//   - key: The idempotency key.
+//
+// Returns:
+//   - record: The record of the key.
+//   - found: Whether an unexpired record exists.
+//   - err: Always nil.
+func (s *MemoryIdempotencyStore) Get(key string) (record IdempotencyRecord, found bool, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	record, found = s.records[key]
+	if found && record.Expired(time.Now()) {
+		delete(s.records, key)
+		return IdempotencyRecord{}, false, nil
+	}
+	return record, found, nil
+}
+
+// Put stores the record of an idempotency key.
+//
+// Parameters:
+//   - key: The idempotency key.
+//   - record: The record to store.
+//
+// Returns:
+//   - Always nil.
+func (s *MemoryIdempotencyStore) Put(key string, record IdempotencyRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if now := time.Now(); now.Sub(s.sweptAt) >= IdempotencySweepInterval {
+		s.sweep(now)
+	}
+	s.records[key] = record
+	return nil
+}
+
+// Sweep discards every expired record.
+//
+// Returns:
+//   - Always nil.
+func (s *MemoryIdempotencyStore) Sweep() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sweep(time.Now())
+	return nil
+}
+
+// sweep discards the records expired at now. The caller must hold the mutex.
+func (s *MemoryIdempotencyStore) sweep(now time.Time) {
+	for storedKey, stored := range s.records {
+		if stored.Expired(now) {
+			delete(s.records, storedKey)
+		}
+	}
+	s.sweptAt = now
+}
+
+// Delete removes the record of an idempotency key.
+//
+// Parameters:
+//   - key: The idempotency key.
+//
+// Returns:
+//   - Always nil.
+func (s *MemoryIdempotencyStore) Delete(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+// Len returns the number of records held, including expired records not yet swept.
+//
+// Returns:
+//   - The number of records.
+func (s *MemoryIdempotencyStore) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.records)
+}
+
+// FileIdempotencyStore is an IdempotencyStore holding each record as a JSON file in a
+// directory, so records survive restarts. Expired records are deleted when read, and swept
+// when records are added, at most once per IdempotencySweepInterval.
+//
+// Fields:
+//   - dir: The directory holding the records.
+//   - sweptAt: The time of the last sweep, or the zero time.Time to sweep on the first Put.
+type FileIdempotencyStore struct {
+	mutex   sync.Mutex
+	dir     string
+	sweptAt time.Time
+}
+
+// NewFileIdempotencyStore creates and returns a new instance of FileIdempotencyStore,
+// creating its directory if needed.
+//
+// Parameters:
+//   - dir: The directory holding the records.
+//
+// Returns:
+//   - store: A pointer to a FileIdempotencyStore instance.
+//   - err: An error if the directory cannot be created.
+func NewFileIdempotencyStore(dir string) (store *FileIdempotencyStore, err error) {
+	if err = os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create idempotency store directory: %w", err)
+	}
+	return &FileIdempotencyStore{
+		mutex:   sync.Mutex{},
+		dir:     dir,
+		sweptAt: time.Time{},
+	}, nil
+}
+
+// Get returns the record of an idempotency key.
+//
+// Parameters:
+//   - key: The idempotency key.
+//
+// Returns:
+//   - record: The record of the key.
+//   - found: Whether an unexpired record exists.
+//   - err: An error if the record cannot be read or decoded.
+func (s *FileIdempotencyStore) Get(key string) (record IdempotencyRecord, found bool, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	data, err := os.ReadFile(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return IdempotencyRecord{}, false, nil
+	}
+	if err != nil {
+		return IdempotencyRecord{}, false, fmt.Errorf("failed to read idempotency record: %w", err)
+	}
+	if err = json.Unmarshal(data, &record); err != nil {
+		return IdempotencyRecord{}, false, fmt.Errorf("failed to decode idempotency record: %w", err)
+	}
+	if record.Expired(time.Now()) {
+		_ = os.Remove(s.path(key))
+		return IdempotencyRecord{}, false, nil
+	}
+	return record, true, nil
+}
+
+// Put stores the record of an idempotency key, replacing its file atomically.
+//
+// Parameters:
+//   - key: The idempotency key.
+//   - record: The record to store.
+//
+// Returns:
+//   - An error if the record cannot be encoded or written.
+func (s *FileIdempotencyStore) Put(key string, record IdempotencyRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode idempotency record: %w", err)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if now := time.Now(); now.Sub(s.sweptAt) >= IdempotencySweepInterval {
+		// A failed sweep is retried after the next interval; it does not fail the Put.
+		_ = s.sweep(now)
+	}
+	file, err := os.CreateTemp(s.dir, "record-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create idempotency record: %w", err)
+	}
+	_, err = file.Write(data)
+	err = errors.Join(err, file.Close())
+	if err == nil {
+		err = os.Rename(file.Name(), s.path(key))
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return fmt.Errorf("failed to write idempotency record: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the record of an idempotency key.
+//
+// Parameters:
+//   - key: The idempotency key.
+//
+// Returns:
+//   - An error if the record exists and cannot be removed.
+func (s *FileIdempotencyStore) Delete(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete idempotency record: %w", err)
+	}
+	return nil
+}
+
+// Sweep deletes the files of every expired record.
+//
+// Returns:
+//   - An error if the directory cannot be read, or an expired record cannot be removed.
+func (s *FileIdempotencyStore) Sweep() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.sweep(time.Now())
+}
+
+// sweep deletes the files of the records expired at now, skipping files that cannot be read
+// or decoded. The caller must hold the mutex.
+func (s *FileIdempotencyStore) sweep(now time.Time) (err error) {
+	s.sweptAt = now
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read idempotency store directory: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(s.dir, entry.Name())
+		data, readErr := os.ReadFile(path)
+		if readErr != nil {
+			continue
+		}
+		record := IdempotencyRecord{}
+		if json.Unmarshal(data, &record) != nil || !record.Expired(now) {
+			continue
+		}
+		if removeErr := os.Remove(path); removeErr != nil && !errors.Is(removeErr, fs.ErrNotExist) {
+			err = errors.Join(err, fmt.Errorf("failed to delete idempotency record: %w", removeErr))
+		}
+	}
+	return err
+}
+
+// path returns the path of the file holding the record of key.
+func (s *FileIdempotencyStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+".json")
+}
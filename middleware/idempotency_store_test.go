@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testIdempotencyStore(t *testing.T, store IdempotencyStore) {
+	record := IdempotencyRecord{Fingerprint: "f1", Res: json.RawMessage(`{"Attempt":1}`), ExpiresAt: time.Now().Add(time.Minute)}
+
+	_, found, err := store.Get("k1")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	assert.NoError(t, store.Put("k1", record))
+	stored, found, err := store.Get("k1")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, record.Fingerprint, stored.Fingerprint)
+	assert.JSONEq(t, string(record.Res), string(stored.Res))
+
+	assert.NoError(t, store.Delete("k1"))
+	_, found, err = store.Get("k1")
+	assert.NoError(t, err)
+	assert.False(t, found)
+	assert.NoError(t, store.Delete("k1"))
+
+	assert.NoError(t, store.Put("k2", IdempotencyRecord{Fingerprint: "f2", ExpiresAt: time.Now().Add(-time.Second)}))
+	_, found, err = store.Get("k2")
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
+
+func Test_IdempotencyRecord_Expired(t *testing.T) {
+	now := time.Now()
+	assert.False(t, IdempotencyRecord{}.Expired(now))
+	assert.False(t, IdempotencyRecord{ExpiresAt: now.Add(time.Second)}.Expired(now))
+	assert.True(t, IdempotencyRecord{ExpiresAt: now}.Expired(now))
+}
+
+func Test_MemoryIdempotencyStore(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		testIdempotencyStore(t, NewMemoryIdempotencyStore())
+	})
+
+	t.Run("sweeps expired records", func(t *testing.T) {
+		store := NewMemoryIdempotencyStore()
+		assert.NoError(t, store.Put("k1", IdempotencyRecord{ExpiresAt: time.Now().Add(-time.Second)}))
+		assert.NoError(t, store.Put("k2", IdempotencyRecord{}))
+		assert.Equal(t, 2, store.Len())
+		assert.NoError(t, store.Sweep())
+		assert.Equal(t, 1, store.Len())
+	})
+
+	t.Run("sweeps on put once per interval", func(t *testing.T) {
+		store := NewMemoryIdempotencyStore()
+		assert.NoError(t, store.Put("k1", IdempotencyRecord{ExpiresAt: time.Now().Add(-time.Second)}))
+		store.sweptAt = time.Now().Add(-IdempotencySweepInterval)
+		assert.NoError(t, store.Put("k2", IdempotencyRecord{}))
+		assert.Equal(t, 1, store.Len())
+	})
+}
+
+func Test_FileIdempotencyStore(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		store, err := NewFileIdempotencyStore(t.TempDir())
+		assert.NoError(t, err)
+		testIdempotencyStore(t, store)
+	})
+
+	t.Run("sweeps expired records", func(t *testing.T) {
+		dir := t.TempDir()
+		store, err := NewFileIdempotencyStore(dir)
+		assert.NoError(t, err)
+		assert.NoError(t, store.Put("k1", IdempotencyRecord{ExpiresAt: time.Now().Add(-time.Second)}))
+		assert.NoError(t, store.Put("k2", IdempotencyRecord{ExpiresAt: time.Now().Add(time.Minute)}))
+		assert.NoError(t, store.Put("k3", IdempotencyRecord{}))
+		files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+		assert.Len(t, files, 3)
+
+		assert.NoError(t, store.Sweep())
+		files, _ = filepath.Glob(filepath.Join(dir, "*.json"))
+		assert.Len(t, files, 2)
+		_, found, _ := store.Get("k2")
+		assert.True(t, found)
+	})
+
+	t.Run("sweeps on put once per interval", func(t *testing.T) {
+		dir := t.TempDir()
+		store, err := NewFileIdempotencyStore(dir)
+		assert.NoError(t, err)
+		assert.NoError(t, store.Put("k1", IdempotencyRecord{ExpiresAt: time.Now().Add(-time.Second)}))
+		store.sweptAt = time.Now().Add(-IdempotencySweepInterval)
+		assert.NoError(t, store.Put("k2", IdempotencyRecord{}))
+		files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+		assert.Len(t, files, 1)
+	})
+}
@@ -0,0 +1,174 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dan-lugg/go-commands/commands"
+	"github.com/stretchr/testify/assert"
+)
+
+type KeyedCommandReq struct {
+	Key   string
+	Delay time.Duration
+}
+
+func (r KeyedCommandReq) IdempotencyKey() string {
+	return r.Key
+}
+
+type KeyedHandler struct {
+	commands.Handler[KeyedCommandReq, FlakyCommandRes]
+	mutex sync.Mutex
+	calls int64
+}
+
+func (h *KeyedHandler) Handle(ctx context.Context, req KeyedCommandReq) (res FlakyCommandRes, err error) {
+	time.Sleep(req.Delay)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.calls++
+	return FlakyCommandRes{Attempt: h.calls}, nil
+}
+
+func Test_ContextWithIdempotencyKey(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		key, ok := IdempotencyKeyFromContext(context.Background())
+		assert.False(t, ok)
+		assert.Empty(t, key)
+	})
+
+	t.Run("with key", func(t *testing.T) {
+		key, ok := IdempotencyKeyFromContext(ContextWithIdempotencyKey(nil, "k1"))
+		assert.True(t, ok)
+		assert.Equal(t, "k1", key)
+	})
+}
+
+func Test_Idempotency(t *testing.T) {
+	t.Run("without key", func(t *testing.T) {
+		catalog, handler := newFlakyCatalog(Idempotency(NewMemoryIdempotencyStore(), time.Minute))
+		for i := 0; i < 2; i++ {
+			_, err := commands.Handle[FlakyCommandReq, FlakyCommandRes](nil, catalog, FlakyCommandReq{})
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, int64(2), handler.calls.Load())
+	})
+
+	t.Run("replays result", func(t *testing.T) {
+		catalog, handler := newFlakyCatalog(Idempotency(NewMemoryIdempotencyStore(), time.Minute))
+		ctx := ContextWithIdempotencyKey(context.Background(), "k1")
+		for i := 0; i < 3; i++ {
+			res, err := commands.Handle[FlakyCommandReq, FlakyCommandRes](ctx, catalog, FlakyCommandReq{})
+			assert.NoError(t, err)
+			assert.Equal(t, FlakyCommandRes{Attempt: 1}, res)
+		}
+		assert.Equal(t, int64(1), handler.calls.Load())
+	})
+
+	t.Run("replays error", func(t *testing.T) {
+		catalog, handler := newFlakyCatalog(Idempotency(NewMemoryIdempotencyStore(), time.Minute))
+		ctx := ContextWithIdempotencyKey(context.Background(), "k1")
+		_, err := commands.Handle[FlakyCommandReq, FlakyCommandRes](ctx, catalog, FlakyCommandReq{Failures: 1, Err: ErrFailure})
+		assert.ErrorIs(t, err, ErrFailure)
+		_, err = commands.Handle[FlakyCommandReq, FlakyCommandRes](ctx, catalog, FlakyCommandReq{Failures: 1, Err: ErrFailure})
+		storedErr := &StoredError{}
+		assert.ErrorAs(t, err, &storedErr)
+		assert.Equal(t, ErrFailure.Error(), storedErr.Message)
+		assert.Equal(t, int64(1), handler.calls.Load())
+	})
+
+	t.Run("replays sentinel", func(t *testing.T) {
+		catalog, handler := newFlakyCatalog(Idempotency(NewMemoryIdempotencyStore(), time.Minute))
+		ctx := ContextWithIdempotencyKey(context.Background(), "k1")
+		failure := fmt.Errorf("%w: argX is required", commands.ErrValidationFailure)
+		_, _ = commands.Handle[FlakyCommandReq, FlakyCommandRes](ctx, catalog, FlakyCommandReq{Failures: 1, Err: failure})
+		_, err := commands.Handle[FlakyCommandReq, FlakyCommandRes](ctx, catalog, FlakyCommandReq{Failures: 1, Err: failure})
+		assert.ErrorIs(t, err, commands.ErrValidationFailure)
+		assert.Equal(t, failure.Error(), err.Error())
+		assert.Equal(t, int64(1), handler.calls.Load())
+	})
+
+	t.Run("does not store transient errors", func(t *testing.T) {
+		for _, failure := range []error{commands.ErrCommandTimeout, Transient(ErrFailure), ErrCircuitOpen, ErrRateLimited} {
+			catalog, handler := newFlakyCatalog(Idempotency(NewMemoryIdempotencyStore(), time.Minute))
+			ctx := ContextWithIdempotencyKey(context.Background(), "k1")
+			_, err := commands.Handle[FlakyCommandReq, FlakyCommandRes](ctx, catalog, FlakyCommandReq{Failures: 1, Err: failure})
+			assert.ErrorIs(t, err, failure)
+			res, err := commands.Handle[FlakyCommandReq, FlakyCommandRes](ctx, catalog, FlakyCommandReq{Failures: 1, Err: failure})
+			assert.NoError(t, err)
+			assert.Equal(t, FlakyCommandRes{Attempt: 2}, res)
+			assert.Equal(t, int64(2), handler.calls.Load())
+		}
+	})
+
+	t.Run("panicking call is released", func(t *testing.T) {
+		catalog, handler := newFlakyCatalog(Idempotency(NewMemoryIdempotencyStore(), time.Minute))
+		ctx := ContextWithIdempotencyKey(context.Background(), "k1")
+		assert.PanicsWithError(t, ErrFailure.Error(), func() {
+			_, _ = commands.Handle[FlakyCommandReq, FlakyCommandRes](ctx, catalog, FlakyCommandReq{Failures: 1, Err: ErrFailure, Panic: true})
+		})
+		ctx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		res, err := commands.Handle[FlakyCommandReq, FlakyCommandRes](ctx, catalog, FlakyCommandReq{Failures: 1, Err: ErrFailure, Panic: true})
+		assert.NoError(t, err)
+		assert.Equal(t, FlakyCommandRes{Attempt: 2}, res)
+		assert.Equal(t, int64(2), handler.calls.Load())
+	})
+
+	t.Run("scoped by caller", func(t *testing.T) {
+		catalog, handler := newFlakyCatalog(Idempotency(NewMemoryIdempotencyStore(), time.Minute))
+		for _, caller := range []string{"alice", "bob", "alice"} {
+			ctx := ContextWithIdempotencyKey(ContextWithCaller(context.Background(), caller), "k1")
+			_, err := commands.Handle[FlakyCommandReq, FlakyCommandRes](ctx, catalog, FlakyCommandReq{})
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, int64(2), handler.calls.Load())
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		catalog, _ := newFlakyCatalog(Idempotency(NewMemoryIdempotencyStore(), time.Minute))
+		ctx := ContextWithIdempotencyKey(context.Background(), "k1")
+		_, err := commands.Handle[FlakyCommandReq, FlakyCommandRes](ctx, catalog, FlakyCommandReq{})
+		assert.NoError(t, err)
+		_, err = commands.Handle[FlakyCommandReq, FlakyCommandRes](ctx, catalog, FlakyCommandReq{Failures: 1})
+		assert.ErrorIs(t, err, ErrIdempotencyConflict)
+	})
+
+	t.Run("expires", func(t *testing.T) {
+		catalog, handler := newFlakyCatalog(Idempotency(NewMemoryIdempotencyStore(), 20*time.Millisecond))
+		ctx := ContextWithIdempotencyKey(context.Background(), "k1")
+		_, _ = commands.Handle[FlakyCommandReq, FlakyCommandRes](ctx, catalog, FlakyCommandReq{})
+		time.Sleep(30 * time.Millisecond)
+		res, err := commands.Handle[FlakyCommandReq, FlakyCommandRes](ctx, catalog, FlakyCommandReq{})
+		assert.NoError(t, err)
+		assert.Equal(t, FlakyCommandRes{Attempt: 2}, res)
+		assert.Equal(t, int64(2), handler.calls.Load())
+	})
+
+	t.Run("request key waits for running call", func(t *testing.T) {
+		handler := &KeyedHandler{}
+		catalog := commands.NewDefaultHandlerCatalog(commands.WithInterceptors(Idempotency(NewMemoryIdempotencyStore(), time.Minute)))
+		commands.InsertHandler[KeyedCommandReq, FlakyCommandRes](catalog, func() commands.Handler[KeyedCommandReq, FlakyCommandRes] {
+			return handler
+		})
+
+		waitGroup := sync.WaitGroup{}
+		results := make([]FlakyCommandRes, 5)
+		for i := range results {
+			waitGroup.Add(1)
+			go func() {
+				defer waitGroup.Done()
+				results[i], _ = commands.Handle[KeyedCommandReq, FlakyCommandRes](nil, catalog, KeyedCommandReq{Key: "k1", Delay: 50 * time.Millisecond})
+			}()
+		}
+		waitGroup.Wait()
+		for _, res := range results {
+			assert.Equal(t, FlakyCommandRes{Attempt: 1}, res)
+		}
+		assert.Equal(t, int64(1), handler.calls)
+	})
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"github.com/dan-lugg/go-commands/commands"
+)
+
+var ErrFailure = errors.New("failure")
+
+type FlakyCommandRes struct {
+	Attempt int64
+}
+
+type FlakyCommandReq struct {
+	Failures int64
+	Err      error
+	Panic    bool
+}
+
+// FlakyHandler fails the first Failures calls it receives with Err, or panics with it if Panic is set.
+type FlakyHandler struct {
+	commands.Handler[FlakyCommandReq, FlakyCommandRes]
+	calls atomic.Int64
+}
+
+func (h *FlakyHandler) Handle(ctx context.Context, req FlakyCommandReq) (res FlakyCommandRes, err error) {
+	attempt := h.calls.Add(1)
+	if attempt <= req.Failures {
+		if req.Panic {
+			panic(req.Err)
+		}
+		return FlakyCommandRes{}, req.Err
+	}
+	return FlakyCommandRes{Attempt: attempt}, nil
+}
+
+func newFlakyCatalog(interceptors ...commands.Interceptor) (*commands.DefaultHandlerCatalog, *FlakyHandler) {
+	handler := &FlakyHandler{}
+	catalog := commands.NewDefaultHandlerCatalog(commands.WithInterceptors(interceptors...))
+	commands.InsertHandler[FlakyCommandReq, FlakyCommandRes](catalog, func() commands.Handler[FlakyCommandReq, FlakyCommandRes] {
+		return handler
+	})
+	return catalog, handler
+}
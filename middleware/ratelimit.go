@@ -0,0 +1,248 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/dan-lugg/go-commands/commands"
+)
+
+var (
+	ErrRateLimited = errors.New("rate limited")
+)
+
+// RateLimitError is returned by a RateLimiter when a call is rejected, recording how
+// long the caller should wait before retrying. It matches ErrRateLimited.
+//
+// Fields:
+//   - Key: The key of the bucket that ran out of tokens.
+//   - RetryAfter: The duration after which the bucket will hold a token again.
+type RateLimitError struct {
+	Key        string
+	RetryAfter time.Duration
+}
+
+// Error returns a human-readable description of the RateLimitError.
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s for key: %s, retry after %s", ErrRateLimited, e.Key, e.RetryAfter)
+}
+
+// Unwrap returns ErrRateLimited.
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+type callerKey struct{}
+
+// ContextWithCaller returns a context.Context carrying the identity of the caller of a
+// command. Transports use it to record who sent a request.
+//
+// Parameters:
+//   - ctx: The parent context.Context.
+//   - caller: The identity of the caller.
+//
+// Returns:
+//   - A context.Context carrying the caller.
+func ContextWithCaller(ctx context.Context, caller string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// CallerFromContext returns the identity of the caller carried by a context.Context.
+//
+// Parameters:
+//   - ctx: The context.Context to inspect.
+//
+// Returns:
+//   - caller: The identity of the caller, or an empty string.
+//   - ok: Whether ctx carries a caller.
+func CallerFromContext(ctx context.Context) (caller string, ok bool) {
+	if ctx == nil {
+		return "", false
+	}
+	caller, ok = ctx.Value(callerKey{}).(string)
+	return caller, ok
+}
+
+// LimitByName keys a rate limit bucket by the mapped name of the request, as KeyByName does.
+//
+// Parameters:
+//   - ctx: The context.Context of the dispatch.
+//   - info: The InterceptorInfo of the dispatch.
+//
+// Returns:
+//   - The mapped name of the request, or the name of its type.
+func LimitByName(ctx context.Context, info commands.InterceptorInfo) string {
+	return KeyByName(info)
+}
+
+// LimitByCaller keys a rate limit bucket by the caller carried by the context, so every
+// command sent by a caller shares its budget. Calls without a caller share one bucket.
+//
+// Parameters:
+//   - ctx: The context.Context of the dispatch.
+//   - info: The InterceptorInfo of the dispatch.
+//
+// Returns:
+//   - The identity of the caller.
+func LimitByCaller(ctx context.Context, info commands.InterceptorInfo) string {
+	caller, _ := CallerFromContext(ctx)
+	return caller
+}
+
+// LimitByNameAndCaller keys a rate limit bucket by both the mapped name of the request and
+// the caller carried by the context, so each caller has its own budget for each command.
+//
+// Parameters:
+//   - ctx: The context.Context of the dispatch.
+//   - info: The InterceptorInfo of the dispatch.
+//
+// Returns:
+//   - The mapped name of the request and the identity of the caller.
+func LimitByNameAndCaller(ctx context.Context, info commands.InterceptorInfo) string {
+	return fmt.Sprintf("%s|%s", LimitByName(ctx, info), LimitByCaller(ctx, info))
+}
+
+// RateLimitPolicy configures a RateLimiter.
+//
+// Fields:
+//   - Rate: The number of tokens added to each bucket per second.
+//   - Burst: The number of tokens a bucket holds when full.
+//   - Key: A function returning the key of the bucket a dispatch draws from.
+type RateLimitPolicy struct {
+	Rate  float64
+	Burst int
+	Key   func(ctx context.Context, info commands.InterceptorInfo) string
+}
+
+// tokenBucket holds the tokens left for one key of a RateLimiter.
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// RateLimiter rejects calls with a *RateLimitError once the token bucket of their key is empty.
+//
+// Each key has a bucket holding up to Burst tokens, refilled at Rate tokens per second.
+// Every call takes one token. Buckets that have refilled completely are forgotten.
+//
+// Fields:
+//   - policy: The RateLimitPolicy applied to every bucket.
+//   - buckets: A map that associates keys with their buckets.
+//   - swept: The time full buckets were last forgotten.
+type RateLimiter struct {
+	mutex   sync.Mutex
+	policy  RateLimitPolicy
+	buckets map[string]*tokenBucket
+	swept   time.Time
+}
+
+// NewRateLimiter creates and returns a new instance of RateLimiter.
+//
+// Parameters:
+//   - policy: The RateLimitPolicy applied to every bucket.
+//
+// Returns:
+//   - A pointer to a RateLimiter instance.
+func NewRateLimiter(policy RateLimitPolicy) (limiter *RateLimiter) {
+	if policy.Key == nil {
+		policy.Key = LimitByName
+	}
+	policy.Burst = max(policy.Burst, 1)
+	return &RateLimiter{
+		mutex:   sync.Mutex{},
+		policy:  policy,
+		buckets: make(map[string]*tokenBucket),
+		swept:   time.Now(),
+	}
+}
+
+// Interceptor returns a commands.Interceptor taking a token from the bucket of each dispatch.
+//
+// Returns:
+//   - A commands.Interceptor failing with a *RateLimitError when the bucket is empty.
+func (l *RateLimiter) Interceptor() commands.Interceptor {
+	return func(ctx context.Context, info commands.InterceptorInfo, req commands.CommandReq[commands.CommandRes], next commands.Invoker) (res commands.CommandRes, err error) {
+		key := l.policy.Key(ctx, info)
+		if retryAfter, ok := l.Allow(key); !ok {
+			return nil, &RateLimitError{Key: key, RetryAfter: retryAfter}
+		}
+		return next(ctx, req)
+	}
+}
+
+// Allow takes a token from the bucket of a key, if it holds one.
+//
+// Parameters:
+//   - key: The key of the bucket.
+//
+// Returns:
+//   - retryAfter: The duration after which the bucket will hold a token again, if it is empty.
+//   - ok: Whether a token was taken.
+func (l *RateLimiter) Allow(key string) (retryAfter time.Duration, ok bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := time.Now()
+	l.sweep(now)
+	found, exists := l.buckets[key]
+	if !exists {
+		found = &tokenBucket{tokens: float64(l.policy.Burst), updated: now}
+		l.buckets[key] = found
+	}
+	found.tokens = l.refill(found, now)
+	found.updated = now
+	if found.tokens >= 1 {
+		found.tokens--
+		return 0, true
+	}
+	if l.policy.Rate <= 0 {
+		return time.Duration(math.MaxInt64), false
+	}
+	return time.Duration((1 - found.tokens) / l.policy.Rate * float64(time.Second)), false
+}
+
+// Tokens returns the number of tokens left in the bucket of a key.
+//
+// Parameters:
+//   - key: The key of the bucket.
+//
+// Returns:
+//   - The number of tokens left, which is Burst for a key that has not been used.
+func (l *RateLimiter) Tokens(key string) float64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	found, exists := l.buckets[key]
+	if !exists {
+		return float64(l.policy.Burst)
+	}
+	return l.refill(found, time.Now())
+}
+
+// refill returns the number of tokens a bucket holds at now.
+func (l *RateLimiter) refill(found *tokenBucket, now time.Time) float64 {
+	elapsed := now.Sub(found.updated).Seconds()
+	return min(found.tokens+elapsed*max(l.policy.Rate, 0), float64(l.policy.Burst))
+}
+
+// sweep forgets the buckets that have refilled completely, at most once per refill period.
+func (l *RateLimiter) sweep(now time.Time) {
+	if l.policy.Rate <= 0 {
+		return
+	}
+	period := time.Duration(float64(l.policy.Burst) / l.policy.Rate * float64(time.Second))
+	if now.Sub(l.swept) < period {
+		return
+	}
+	l.swept = now
+	for key, found := range l.buckets {
+		if l.refill(found, now) >= float64(l.policy.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
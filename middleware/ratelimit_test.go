@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dan-lugg/go-commands/commands"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ContextWithCaller(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		caller, ok := CallerFromContext(context.Background())
+		assert.False(t, ok)
+		assert.Empty(t, caller)
+	})
+
+	t.Run("with caller", func(t *testing.T) {
+		caller, ok := CallerFromContext(ContextWithCaller(nil, "alice"))
+		assert.True(t, ok)
+		assert.Equal(t, "alice", caller)
+	})
+}
+
+func Test_LimitBy(t *testing.T) {
+	ctx := ContextWithCaller(context.Background(), "alice")
+	info := commands.InterceptorInfo{ReqType: reflect.TypeFor[FlakyCommandReq](), ReqName: "flaky"}
+	assert.Equal(t, "flaky", LimitByName(ctx, info))
+	assert.Equal(t, "alice", LimitByCaller(ctx, info))
+	assert.Equal(t, "flaky|alice", LimitByNameAndCaller(ctx, info))
+}
+
+func Test_RateLimiter_Allow(t *testing.T) {
+	t.Run("burst", func(t *testing.T) {
+		limiter := NewRateLimiter(RateLimitPolicy{Rate: 1, Burst: 2})
+		_, ok := limiter.Allow("key")
+		assert.True(t, ok)
+		_, ok = limiter.Allow("key")
+		assert.True(t, ok)
+		retryAfter, ok := limiter.Allow("key")
+		assert.False(t, ok)
+		assert.InDelta(t, time.Second, retryAfter, float64(50*time.Millisecond))
+	})
+
+	t.Run("refill", func(t *testing.T) {
+		limiter := NewRateLimiter(RateLimitPolicy{Rate: 100, Burst: 1})
+		_, ok := limiter.Allow("key")
+		assert.True(t, ok)
+		_, ok = limiter.Allow("key")
+		assert.False(t, ok)
+		time.Sleep(20 * time.Millisecond)
+		_, ok = limiter.Allow("key")
+		assert.True(t, ok)
+	})
+
+	t.Run("separate keys", func(t *testing.T) {
+		limiter := NewRateLimiter(RateLimitPolicy{Rate: 1, Burst: 1})
+		_, ok := limiter.Allow("alice")
+		assert.True(t, ok)
+		_, ok = limiter.Allow("bob")
+		assert.True(t, ok)
+		assert.Equal(t, 1.0, limiter.Tokens("carol"))
+	})
+}
+
+func Test_RateLimiter_Interceptor(t *testing.T) {
+	t.Run("by name and caller", func(t *testing.T) {
+		limiter := NewRateLimiter(RateLimitPolicy{Rate: 1, Burst: 1, Key: LimitByNameAndCaller})
+		catalog, handler := newFlakyCatalog(limiter.Interceptor())
+		alice := ContextWithCaller(context.Background(), "alice")
+		bob := ContextWithCaller(context.Background(), "bob")
+
+		_, err := commands.Handle[FlakyCommandReq, FlakyCommandRes](alice, catalog, FlakyCommandReq{})
+		assert.NoError(t, err)
+		_, err = commands.Handle[FlakyCommandReq, FlakyCommandRes](alice, catalog, FlakyCommandReq{})
+		assert.ErrorIs(t, err, ErrRateLimited)
+		rateLimitErr := &RateLimitError{}
+		assert.ErrorAs(t, err, &rateLimitErr)
+		assert.Greater(t, rateLimitErr.RetryAfter, time.Duration(0))
+		_, err = commands.Handle[FlakyCommandReq, FlakyCommandRes](bob, catalog, FlakyCommandReq{})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), handler.calls.Load())
+	})
+}
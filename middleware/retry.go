@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/dan-lugg/go-commands/commands"
+)
+
+var (
+	ErrTransient = errors.New("transient")
+)
+
+// RetryError is returned by the Retry interceptor when a dispatch fails, recording
+// how many attempts were made. It wraps the error of the last attempt.
+//
+// Fields:
+//   - Attempts: The number of attempts made, including the first.
+//   - Err: The error returned by the last attempt.
+type RetryError struct {
+	Attempts int
+	Err      error
+}
+
+// Error returns a human-readable description of the RetryError.
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("failed after %d attempt(s): %s", e.Attempts, e.Err)
+}
+
+// Unwrap returns the error of the last attempt.
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// Transient wraps an error with ErrTransient, marking it as retryable by IsTransient.
+//
+// Parameters:
+//   - err: The error to mark.
+//
+// Returns:
+//   - An error wrapping both ErrTransient and err, or nil if err is nil.
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%w: %w", ErrTransient, err)
+}
+
+// IsTransient is the default Classifier of a RetryPolicy, and tells the failures an Idempotency
+// interceptor does not store. It reports whether err wraps ErrTransient, commands.ErrCommandTimeout,
+// ErrCircuitOpen or ErrRateLimited, or wraps an error with a Timeout() or Temporary() method
+// returning true, such as context.DeadlineExceeded. Cancellations are never retried.
+// Whether the caller's own context has ended is not told by err; Retry checks it separately.
+//
+// Parameters:
+//   - err: The error to classify.
+//
+// Returns:
+//   - true if err can be retried.
+func IsTransient(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, ErrTransient) || errors.Is(err, commands.ErrCommandTimeout) ||
+		errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrRateLimited) {
+		return true
+	}
+	var timeout interface{ Timeout() bool }
+	if errors.As(err, &timeout) && timeout.Timeout() {
+		return true
+	}
+	var temporary interface{ Temporary() bool }
+	return errors.As(err, &temporary) && temporary.Temporary()
+}
+
+// RetryPolicy configures the Retry interceptor.
+//
+// Fields:
+//   - MaxAttempts: The maximum number of attempts, including the first.
+//   - InitialBackoff: The delay before the second attempt.
+//   - MaxBackoff: The upper bound of the delay between attempts.
+//   - Multiplier: The factor the delay grows by after each attempt.
+//   - Jitter: The fraction, between 0 and 1, by which each delay is randomly varied.
+//   - Classifier: A function reporting whether an error can be retried.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	Jitter         float64
+	Classifier     func(err error) bool
+}
+
+// DefaultRetryPolicy returns a RetryPolicy making up to 3 attempts, backing off
+// exponentially from 100ms up to 5s with 20% jitter, and retrying IsTransient errors.
+//
+// Returns:
+//   - The default RetryPolicy.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		Classifier:     IsTransient,
+	}
+}
+
+// Backoff returns the delay before the given attempt.
+//
+// Parameters:
+//   - attempt: The number of the attempt about to be made, starting at 2.
+//
+// Returns:
+//   - The delay, with jitter applied.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := float64(p.InitialBackoff)
+	for i := 2; i < attempt; i++ {
+		backoff *= max(p.Multiplier, 1)
+	}
+	if p.MaxBackoff > 0 {
+		backoff = min(backoff, float64(p.MaxBackoff))
+	}
+	if p.Jitter > 0 {
+		backoff *= 1 + min(p.Jitter, 1)*(2*rand.Float64()-1)
+	}
+	return time.Duration(backoff)
+}
+
+// Retry returns a commands.Interceptor that retries failed dispatches according to policy.
+//
+// A failed attempt is retried if the context of the caller is not done, the Classifier reports
+// its error as retryable, fewer than MaxAttempts attempts have been made, and the context is not
+// due to expire before the next attempt. Any error returned is wrapped in a *RetryError. Streams are passed
+// through, as their items are delivered before they fail.
+//
+// Parameters:
+//   - policy: The RetryPolicy to apply.
+//
+// Returns:
+//   - A commands.Interceptor applying the policy.
+func Retry(policy RetryPolicy) commands.Interceptor {
+	classifier := policy.Classifier
+	if classifier == nil {
+		classifier = IsTransient
+	}
+	return func(ctx context.Context, info commands.InterceptorInfo, req commands.CommandReq[commands.CommandRes], next commands.Invoker) (res commands.CommandRes, err error) {
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		if info.Stream {
+			return next(ctx, req)
+		}
+		attempt := 1
+		for ; ; attempt++ {
+			res, err = next(ctx, req)
+			if err == nil {
+				return res, nil
+			}
+			if ctx.Err() != nil || attempt >= policy.MaxAttempts || !classifier(err) {
+				break
+			}
+			backoff := policy.Backoff(attempt + 1)
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < backoff {
+				break
+			}
+			if !sleep(ctx, backoff) {
+				break
+			}
+		}
+		return res, &RetryError{Attempts: attempt, Err: err}
+	}
+}
+
+// sleep waits for the given duration, returning false if ctx is done first.
+func sleep(ctx context.Context, duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
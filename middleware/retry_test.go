@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dan-lugg/go-commands/commands"
+	"github.com/stretchr/testify/assert"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string { return "timeout" }
+
+func (timeoutError) Timeout() bool { return true }
+
+func fastRetryPolicy(maxAttempts int) RetryPolicy {
+	policy := DefaultRetryPolicy()
+	policy.MaxAttempts = maxAttempts
+	policy.InitialBackoff = time.Millisecond
+	policy.MaxBackoff = 5 * time.Millisecond
+	return policy
+}
+
+func Test_IsTransient(t *testing.T) {
+	assert.True(t, IsTransient(Transient(ErrFailure)))
+	assert.True(t, IsTransient(timeoutError{}))
+	assert.False(t, IsTransient(ErrFailure))
+	assert.False(t, IsTransient(context.Canceled))
+	assert.True(t, IsTransient(context.DeadlineExceeded))
+	assert.True(t, IsTransient(ErrCircuitOpen))
+	assert.True(t, IsTransient(&RateLimitError{Key: "key", RetryAfter: time.Second}))
+	assert.True(t, IsTransient(fmt.Errorf("%w: %w", commands.ErrCommandTimeout, context.DeadlineExceeded)))
+	assert.Nil(t, Transient(nil))
+}
+
+func Test_RetryPolicy_Backoff(t *testing.T) {
+	t.Run("exponential", func(t *testing.T) {
+		policy := RetryPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond, Multiplier: 2}
+		assert.Equal(t, 10*time.Millisecond, policy.Backoff(2))
+		assert.Equal(t, 20*time.Millisecond, policy.Backoff(3))
+		assert.Equal(t, 40*time.Millisecond, policy.Backoff(4))
+		assert.Equal(t, 50*time.Millisecond, policy.Backoff(5))
+	})
+
+	t.Run("jitter", func(t *testing.T) {
+		policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, Multiplier: 2, Jitter: 0.5}
+		for i := 0; i < 100; i++ {
+			backoff := policy.Backoff(2)
+			assert.GreaterOrEqual(t, backoff, 50*time.Millisecond)
+			assert.LessOrEqual(t, backoff, 150*time.Millisecond)
+		}
+	})
+}
+
+func Test_Retry(t *testing.T) {
+	t.Run("recovers", func(t *testing.T) {
+		catalog, _ := newFlakyCatalog(Retry(fastRetryPolicy(3)))
+		res, err := commands.Handle[FlakyCommandReq, FlakyCommandRes](nil, catalog, FlakyCommandReq{Failures: 2, Err: Transient(ErrFailure)})
+		assert.NoError(t, err)
+		assert.Equal(t, FlakyCommandRes{Attempt: 3}, res)
+	})
+
+	t.Run("exhausted", func(t *testing.T) {
+		catalog, handler := newFlakyCatalog(Retry(fastRetryPolicy(3)))
+		_, err := commands.Handle[FlakyCommandReq, FlakyCommandRes](nil, catalog, FlakyCommandReq{Failures: 5, Err: Transient(ErrFailure)})
+		assert.ErrorIs(t, err, ErrFailure)
+		retryErr := &RetryError{}
+		assert.ErrorAs(t, err, &retryErr)
+		assert.Equal(t, 3, retryErr.Attempts)
+		assert.Equal(t, int64(3), handler.calls.Load())
+	})
+
+	t.Run("not retryable", func(t *testing.T) {
+		catalog, handler := newFlakyCatalog(Retry(fastRetryPolicy(3)))
+		_, err := commands.Handle[FlakyCommandReq, FlakyCommandRes](nil, catalog, FlakyCommandReq{Failures: 5, Err: ErrFailure})
+		retryErr := &RetryError{}
+		assert.ErrorAs(t, err, &retryErr)
+		assert.Equal(t, 1, retryErr.Attempts)
+		assert.Equal(t, int64(1), handler.calls.Load())
+	})
+
+	t.Run("custom classifier", func(t *testing.T) {
+		policy := fastRetryPolicy(2)
+		policy.Classifier = func(err error) bool { return true }
+		catalog, _ := newFlakyCatalog(Retry(policy))
+		res, err := commands.Handle[FlakyCommandReq, FlakyCommandRes](nil, catalog, FlakyCommandReq{Failures: 1, Err: ErrFailure})
+		assert.NoError(t, err)
+		assert.Equal(t, FlakyCommandRes{Attempt: 2}, res)
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		policy := fastRetryPolicy(5)
+		policy.InitialBackoff = time.Second
+		policy.MaxBackoff = time.Second
+		catalog, handler := newFlakyCatalog(Retry(policy))
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, err := commands.Handle[FlakyCommandReq, FlakyCommandRes](ctx, catalog, FlakyCommandReq{Failures: 5, Err: Transient(ErrFailure)})
+		assert.Less(t, time.Since(start), 100*time.Millisecond)
+		assert.ErrorIs(t, err, ErrFailure)
+		assert.Equal(t, int64(1), handler.calls.Load())
+	})
+
+	t.Run("command timeout", func(t *testing.T) {
+		catalog, handler := newFlakyCatalog(Retry(fastRetryPolicy(3)))
+		timeoutErr := fmt.Errorf("%w: %w", commands.ErrCommandTimeout, context.DeadlineExceeded)
+		res, err := commands.Handle[FlakyCommandReq, FlakyCommandRes](nil, catalog, FlakyCommandReq{Failures: 1, Err: timeoutErr})
+		assert.NoError(t, err)
+		assert.Equal(t, FlakyCommandRes{Attempt: 2}, res)
+		assert.Equal(t, int64(2), handler.calls.Load())
+	})
+
+	t.Run("caller context ended", func(t *testing.T) {
+		catalog, handler := newFlakyCatalog(Retry(fastRetryPolicy(3)))
+		ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+		defer cancel()
+		<-ctx.Done()
+		_, err := commands.Handle[FlakyCommandReq, FlakyCommandRes](ctx, catalog, FlakyCommandReq{Failures: 5, Err: context.DeadlineExceeded})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, int64(1), handler.calls.Load())
+	})
+
+	t.Run("future", func(t *testing.T) {
+		catalog, _ := newFlakyCatalog(Retry(fastRetryPolicy(3)))
+		tup := commands.Future[FlakyCommandReq, FlakyCommandRes](nil, catalog, FlakyCommandReq{Failures: 2, Err: Transient(ErrFailure)}).Wait()
+		assert.NoError(t, tup.Val2)
+		assert.Equal(t, FlakyCommandRes{Attempt: 3}, tup.Val1)
+	})
+
+	t.Run("per type", func(t *testing.T) {
+		catalog, _ := newFlakyCatalog()
+		commands.InsertInterceptor[FlakyCommandReq](catalog, Retry(fastRetryPolicy(3)))
+		_, err := commands.Handle[FlakyCommandReq, FlakyCommandRes](nil, catalog, FlakyCommandReq{Failures: 2, Err: Transient(ErrFailure)})
+		assert.NoError(t, err)
+	})
+}
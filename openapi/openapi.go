@@ -2,6 +2,9 @@
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
+
 	"github.com/dan-lugg/go-commands/commands"
 	"github.com/dan-lugg/go-commands/util"
 	"github.com/getkin/kin-openapi/openapi3"
@@ -10,6 +13,11 @@
 	"reflect"
 )
 
+const (
+	// TimeoutExtension is the operation extension advertising the timeout of a command.
+	TimeoutExtension = "x-command-timeout"
+)
+
 type SpecWriter struct {
 	title          string
 	version        string
@@ -98,6 +106,10 @@ func (w *SpecWriter) CreateSpec() (spec openapi3.T, err error) {
 			return openapi3.T{}, fmt.Errorf("failed to create path item for request type %s: %w", reqType.Name(), err)
 		}
 
+		if timeout := w.handlerCatalog.Timeout(reqType); timeout > 0 {
+			pathItem.Post.Extensions = map[string]any{TimeoutExtension: timeout.String()}
+		}
+
 		spec.Paths.Set(fmt.Sprintf("/%s", reqName), &pathItem)
 	}
 
@@ -111,6 +123,7 @@ func (w *SpecWriter) CreatePathItem(reqName string, reqType reflect.Type, resTyp
 			ExportTopLevelSchema:   false,
 			ExportGenerics:         false,
 		}),
+		openapi3gen.SchemaCustomizer(ValidationCustomizer),
 	)
 
 	var reqSchemaRef *openapi3.SchemaRef
@@ -126,6 +139,9 @@ func (w *SpecWriter) CreatePathItem(reqName string, reqType reflect.Type, resTyp
 		return openapi3.PathItem{}, fmt.Errorf("failed to generate schema for response type %s: %w", resType.Name(), err)
 	}
 
+	inlineSchemaRefs(reqSchemaRef, map[*openapi3.Schema]bool{})
+	inlineSchemaRefs(resSchemaRef, map[*openapi3.Schema]bool{})
+
 	operation := &openapi3.Operation{
 		Summary:     fmt.Sprintf("HandleRaw %s", reqName),
 		Description: fmt.Sprintf("Handles the %s command", reqName),
@@ -145,3 +161,115 @@ func (w *SpecWriter) CreatePathItem(reqName string, reqType reflect.Type, resTyp
 		Post: operation,
 	}, nil
 }
+
+// ValidationCustomizer is an openapi3gen.SchemaCustomizerFn that translates the
+// commands.ValidateTag rules of struct fields into schema constraints, so the
+// generated schemas advertise the same rules enforced by commands.Validate.
+//
+// Parameters:
+//   - name: The name of the field or type being generated.
+//   - t: The reflect.Type being generated.
+//   - tag: The reflect.StructTag of the field being generated.
+//   - schema: The generated schema to customize.
+//
+// Returns:
+//   - An error if a rule argument cannot be parsed.
+func ValidationCustomizer(name string, t reflect.Type, tag reflect.StructTag, schema *openapi3.Schema) (err error) {
+	if t.Kind() == reflect.Struct {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			for _, rule := range commands.ValidationRules(field.Tag) {
+				if rule.Name == commands.RuleRequired && field.IsExported() && !field.Anonymous {
+					if fieldName := commands.FieldName(field); fieldName != "" {
+						schema.Required = append(schema.Required, fieldName)
+					}
+				}
+			}
+		}
+	}
+
+	for _, rule := range commands.ValidationRules(tag) {
+		switch rule.Name {
+		case commands.RuleMin, commands.RuleMax, commands.RuleLen:
+			var limit float64
+			if limit, err = strconv.ParseFloat(rule.Value, 64); err != nil {
+				return fmt.Errorf("invalid %s rule for %s: %w", rule.Name, name, err)
+			}
+			applyLimit(schema, rule.Name, limit)
+		case commands.RuleEnum:
+			for _, option := range strings.Split(rule.Value, "|") {
+				schema.Enum = append(schema.Enum, enumValue(schema, option))
+			}
+		case commands.RulePattern:
+			schema.Pattern = rule.Value
+		}
+	}
+	return nil
+}
+
+func applyLimit(schema *openapi3.Schema, ruleName string, limit float64) {
+	count := uint64(limit)
+	switch {
+	case schema.Type.Is(openapi3.TypeString):
+		if ruleName != commands.RuleMax {
+			schema.MinLength = count
+		}
+		if ruleName != commands.RuleMin {
+			schema.MaxLength = &count
+		}
+	case schema.Type.Is(openapi3.TypeArray):
+		if ruleName != commands.RuleMax {
+			schema.MinItems = count
+		}
+		if ruleName != commands.RuleMin {
+			schema.MaxItems = &count
+		}
+	case schema.Type.Is(openapi3.TypeObject):
+		if ruleName != commands.RuleMax {
+			schema.MinProps = count
+		}
+		if ruleName != commands.RuleMin {
+			schema.MaxProps = &count
+		}
+	case ruleName == commands.RuleMin:
+		schema.Min = &limit
+	case ruleName == commands.RuleMax:
+		schema.Max = &limit
+	}
+}
+
+func enumValue(schema *openapi3.Schema, option string) any {
+	switch {
+	case schema.Type.Is(openapi3.TypeInteger), schema.Type.Is(openapi3.TypeNumber):
+		if value, err := strconv.ParseFloat(option, 64); err == nil {
+			return value
+		}
+	case schema.Type.Is(openapi3.TypeBoolean):
+		if value, err := strconv.ParseBool(option); err == nil {
+			return value
+		}
+	}
+	return option
+}
+
+// inlineSchemaRefs clears the references that openapi3gen assigns to schemas that are
+// not exported as components, so the constraints on their values are written inline.
+func inlineSchemaRefs(schemaRef *openapi3.SchemaRef, visited map[*openapi3.Schema]bool) {
+	if schemaRef == nil || schemaRef.Value == nil {
+		return
+	}
+	if !strings.HasPrefix(schemaRef.Ref, "#/") {
+		schemaRef.Ref = ""
+	}
+	if visited[schemaRef.Value] {
+		return
+	}
+	visited[schemaRef.Value] = true
+	for _, property := range schemaRef.Value.Properties {
+		inlineSchemaRefs(property, visited)
+	}
+	inlineSchemaRefs(schemaRef.Value.Items, visited)
+	if schemaRef.Value.AdditionalProperties.Schema != nil {
+		inlineSchemaRefs(schemaRef.Value.AdditionalProperties.Schema, visited)
+	}
+}
@@ -9,6 +9,7 @@
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 // <editor-fold desc="Types">
@@ -54,6 +55,13 @@ func (h *SubHandler) Handle(ctx context.Context, req SubCommandReq) (res SubComm
 	return SubCommandRes{Result: result}, nil
 }
 
+type ValidCommandReq struct {
+	Name  string   `json:"name" validate:"required,min=1,max=8,pattern=^[a-z]+$"`
+	Count int      `json:"count" validate:"min=1,max=10"`
+	Kind  string   `json:"kind" validate:"enum=a|b"`
+	Tags  []string `json:"tags" validate:"len=2"`
+}
+
 // </editor-fold>
 
 // <editor-fold desc="Tests">
@@ -93,8 +101,56 @@ func TestSpecWriter_CreatePathItem(t *testing.T) {
 	assert.NotNil(t, pathItem)
 }
 
+func TestSpecWriter_CreatePathItem_Validation(t *testing.T) {
+	mappingCatalog := commands.NewMappingCatalog()
+	handlerCatalog := commands.NewDefaultHandlerCatalog()
+	specWriter := NewSpecWriter(mappingCatalog, handlerCatalog)
+	reqType := reflect.TypeFor[ValidCommandReq]()
+	resType := reflect.TypeFor[AddCommandRes]()
+	pathItem, err := specWriter.CreatePathItem("valid", reqType, resType)
+	assert.NoError(t, err)
+
+	schema := pathItem.Post.RequestBody.Value.Content.Get("application/json").Schema.Value
+	assert.Equal(t, []string{"name"}, schema.Required)
+
+	name := schema.Properties["name"]
+	assert.Empty(t, name.Ref)
+	assert.Equal(t, uint64(1), name.Value.MinLength)
+	assert.Equal(t, uint64(8), *name.Value.MaxLength)
+	assert.Equal(t, "^[a-z]+$", name.Value.Pattern)
+
+	count := schema.Properties["count"]
+	assert.Equal(t, 1.0, *count.Value.Min)
+	assert.Equal(t, 10.0, *count.Value.Max)
+
+	kind := schema.Properties["kind"]
+	assert.Equal(t, []any{"a", "b"}, kind.Value.Enum)
+
+	tags := schema.Properties["tags"]
+	assert.Equal(t, uint64(2), tags.Value.MinItems)
+	assert.Equal(t, uint64(2), *tags.Value.MaxItems)
+}
+
+func TestSpecWriter_CreateSpec_Timeout(t *testing.T) {
+	mappingCatalog := commands.NewMappingCatalog()
+	handlerCatalog := commands.NewDefaultHandlerCatalog()
+	specWriter := NewSpecWriter(mappingCatalog, handlerCatalog)
+	commands.InsertHandler[AddCommandReq, AddCommandRes](handlerCatalog, func() commands.Handler[AddCommandReq, AddCommandRes] {
+		return &AddHandler{}
+	}, commands.WithTimeout(2*time.Second))
+	commands.InsertHandler[SubCommandReq, SubCommandRes](handlerCatalog, func() commands.Handler[SubCommandReq, SubCommandRes] {
+		return &SubHandler{}
+	})
+	commands.InsertMapping[AddCommandReq](mappingCatalog, AddReqName)
+	commands.InsertMapping[SubCommandReq](mappingCatalog, SubReqName)
+	spec, err := specWriter.CreateSpec()
+	assert.NoError(t, err)
+	assert.Equal(t, "2s", spec.Paths.Value("/add").Post.Extensions[TimeoutExtension])
+	assert.NotContains(t, spec.Paths.Value("/sub").Post.Extensions, TimeoutExtension)
+}
+
 func TestSpecWriter_WriteSpec(t *testing.T) {
-	const ExpectSpec = `{"info":{"description":"API for handling commands","title":"Commands API","version":"1.0.0"},"openapi":"3.0.0","paths":{"/add":{"post":{"description":"Handles the add command","operationId":"add","requestBody":{"content":{"application/json":{"schema":{"properties":{"argX":{"$ref":"int"},"argY":{"$ref":"int"}},"type":"object"}}},"required":true},"responses":{"200":{"content":{"application/json":{"schema":{"properties":{"result":{"$ref":"int"}},"type":"object"}}}},"default":{"description":""}},"summary":"HandleRaw add"}},"/sub":{"post":{"description":"Handles the sub command","operationId":"sub","requestBody":{"content":{"application/json":{"schema":{"properties":{"argX":{"$ref":"int"},"argY":{"$ref":"int"}},"type":"object"}}},"required":true},"responses":{"200":{"content":{"application/json":{"schema":{"properties":{"result":{"$ref":"int"}},"type":"object"}}}},"default":{"description":""}},"summary":"HandleRaw sub"}}}}`
+	const ExpectSpec = `{"info":{"description":"API for handling commands","title":"Commands API","version":"1.0.0"},"openapi":"3.0.0","paths":{"/add":{"post":{"description":"Handles the add command","operationId":"add","requestBody":{"content":{"application/json":{"schema":{"properties":{"argX":{"type":"integer"},"argY":{"type":"integer"}},"type":"object"}}},"required":true},"responses":{"200":{"content":{"application/json":{"schema":{"properties":{"result":{"type":"integer"}},"type":"object"}}}},"default":{"description":""}},"summary":"HandleRaw add"}},"/sub":{"post":{"description":"Handles the sub command","operationId":"sub","requestBody":{"content":{"application/json":{"schema":{"properties":{"argX":{"type":"integer"},"argY":{"type":"integer"}},"type":"object"}}},"required":true},"responses":{"200":{"content":{"application/json":{"schema":{"properties":{"result":{"type":"integer"}},"type":"object"}}}},"default":{"description":""}},"summary":"HandleRaw sub"}}}}`
 	mappingCatalog := commands.NewMappingCatalog()
 	handlerCatalog := commands.NewDefaultHandlerCatalog()
 	specWriter := NewSpecWriter(mappingCatalog, handlerCatalog)
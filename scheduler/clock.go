@@ -0,0 +1,119 @@
+package scheduler
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of time of a Scheduler, allowing tests to control it.
+//
+// Methods:
+//   - Now(): Returns the current time.
+//   - After(d time.Duration): Returns a channel receiving the current time once d has elapsed.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+// SystemClock is the Clock backed by the system time.
+var SystemClock Clock = systemClock{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// waiter is a channel returned by ManualClock.After, fired once the clock reaches deadline.
+type waiter struct {
+	deadline time.Time
+	channel  chan time.Time
+}
+
+// ManualClock is a Clock whose time only changes when it is advanced, for tests.
+//
+// Fields:
+//   - now: The current time of the clock.
+//   - waiters: The channels returned by After that have not fired yet.
+type ManualClock struct {
+	mutex   sync.Mutex
+	now     time.Time
+	waiters []waiter
+}
+
+// NewManualClock creates and returns a new instance of ManualClock.
+//
+// Parameters:
+//   - now: The initial time of the clock.
+//
+// Returns:
+//   - A pointer to a ManualClock instance.
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{
+		mutex:   sync.Mutex{},
+		now:     now,
+		waiters: nil,
+	}
+}
+
+// Now returns the current time of the clock.
+//
+// Returns:
+//   - The current time.
+func (c *ManualClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// After returns a channel receiving the time of the clock once it has been advanced by d.
+//
+// Parameters:
+//   - d: The duration to wait for.
+//
+// Returns:
+//   - A channel receiving the time of the clock once d has elapsed.
+func (c *ManualClock) After(d time.Duration) <-chan time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	channel := make(chan time.Time, 1)
+	if d <= 0 {
+		channel <- c.now
+		return channel
+	}
+	c.waiters = append(c.waiters, waiter{deadline: c.now.Add(d), channel: channel})
+	return channel
+}
+
+// Advance moves the clock forward, firing the channels whose deadline has been reached.
+//
+// Parameters:
+//   - d: The duration to move the clock by.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.deadline.After(c.now) {
+			pending = append(pending, w)
+			continue
+		}
+		w.channel <- c.now
+	}
+	c.waiters = pending
+}
+
+// Waiters returns the number of channels returned by After that have not fired yet.
+//
+// Returns:
+//   - The number of pending channels.
+func (c *ManualClock) Waiters() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.waiters)
+}
@@ -0,0 +1,44 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SystemClock(t *testing.T) {
+	before := time.Now()
+	assert.False(t, SystemClock.Now().Before(before))
+	select {
+	case <-SystemClock.After(time.Millisecond):
+	case <-time.After(time.Second):
+		assert.Fail(t, "timer did not fire")
+	}
+}
+
+func Test_ManualClock(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("advance", func(t *testing.T) {
+		clock := NewManualClock(start)
+		early, late := clock.After(time.Second), clock.After(time.Minute)
+		assert.Equal(t, 2, clock.Waiters())
+
+		clock.Advance(30 * time.Second)
+		assert.Equal(t, start.Add(30*time.Second), clock.Now())
+		assert.Equal(t, start.Add(30*time.Second), <-early)
+		assert.Len(t, late, 0)
+		assert.Equal(t, 1, clock.Waiters())
+
+		clock.Advance(30 * time.Second)
+		assert.Equal(t, start.Add(time.Minute), <-late)
+		assert.Equal(t, 0, clock.Waiters())
+	})
+
+	t.Run("elapsed", func(t *testing.T) {
+		clock := NewManualClock(start)
+		assert.Equal(t, start, <-clock.After(0))
+		assert.Equal(t, 0, clock.Waiters())
+	})
+}
@@ -0,0 +1,196 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidCron = errors.New("invalid cron expression")
+)
+
+// cronField describes the range and names of one field of a cron expression.
+type cronField struct {
+	name  string
+	min   int
+	max   int
+	names []string
+}
+
+var (
+	minuteField = cronField{name: "minute", min: 0, max: 59}
+	hourField   = cronField{name: "hour", min: 0, max: 23}
+	domField    = cronField{name: "day of month", min: 1, max: 31}
+	monthField  = cronField{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}}
+	dowField    = cronField{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}}
+)
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Cron is a parsed cron expression.
+//
+// Fields:
+//   - expr: The expression the Cron was parsed from.
+//   - minutes, hours, doms, months, dows: Bit sets of the values matched by each field.
+//   - domStar, dowStar: Whether the day of month and day of week fields are unrestricted.
+type Cron struct {
+	expr    string
+	minutes uint64
+	hours   uint64
+	doms    uint64
+	months  uint64
+	dows    uint64
+	domStar bool
+	dowStar bool
+}
+
+// ParseCron parses a standard five-field cron expression: minute, hour, day of month,
+// month and day of week.
+//
+// Each field is *, a value, a range a-b, or a comma-separated list of those, each optionally
+// followed by a step /n. Months and days of week also accept three-letter English names, and
+// both 0 and 7 denote Sunday. As in standard cron, when both the day of month and the day of
+// week are restricted, a day matching either one matches. The descriptors @yearly, @annually,
+// @monthly, @weekly, @daily, @midnight and @hourly are also accepted.
+//
+// Parameters:
+//   - expr: The cron expression.
+//
+// Returns:
+//   - cron: A pointer to the parsed Cron.
+//   - err: An error wrapping ErrInvalidCron if expr cannot be parsed.
+func ParseCron(expr string) (cron *Cron, err error) {
+	spec := strings.TrimSpace(expr)
+	if descriptor, ok := cronDescriptors[strings.ToLower(spec)]; ok {
+		spec = descriptor
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%w: %q: expected 5 fields, found %d", ErrInvalidCron, expr, len(fields))
+	}
+	cron = &Cron{expr: expr}
+	if cron.minutes, _, err = parseCronField(fields[0], minuteField); err != nil {
+		return nil, fmt.Errorf("%w: %q: %w", ErrInvalidCron, expr, err)
+	}
+	if cron.hours, _, err = parseCronField(fields[1], hourField); err != nil {
+		return nil, fmt.Errorf("%w: %q: %w", ErrInvalidCron, expr, err)
+	}
+	if cron.doms, cron.domStar, err = parseCronField(fields[2], domField); err != nil {
+		return nil, fmt.Errorf("%w: %q: %w", ErrInvalidCron, expr, err)
+	}
+	if cron.months, _, err = parseCronField(fields[3], monthField); err != nil {
+		return nil, fmt.Errorf("%w: %q: %w", ErrInvalidCron, expr, err)
+	}
+	if cron.dows, cron.dowStar, err = parseCronField(fields[4], dowField); err != nil {
+		return nil, fmt.Errorf("%w: %q: %w", ErrInvalidCron, expr, err)
+	}
+	if cron.dows&(1<<7) != 0 {
+		cron.dows |= 1
+	}
+	return cron, nil
+}
+
+// String returns the expression the Cron was parsed from.
+func (c *Cron) String() string {
+	return c.expr
+}
+
+// Next returns the first time matched by the Cron strictly after the given time, in its location.
+//
+// Parameters:
+//   - after: The time to search from.
+//
+// Returns:
+//   - The next matching time, or the zero time.Time if none exists within five years.
+func (c *Cron) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := after.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.months&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hours&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minutes&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c *Cron) matchDay(t time.Time) bool {
+	domMatch := c.doms&(1<<uint(t.Day())) != 0
+	dowMatch := c.dows&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// parseCronField parses one field of a cron expression into a bit set of the values it matches.
+func parseCronField(spec string, field cronField) (bits uint64, star bool, err error) {
+	for _, part := range strings.Split(spec, ",") {
+		rangeSpec, stepSpec, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			if step, err = strconv.Atoi(stepSpec); err != nil || step <= 0 {
+				return 0, false, fmt.Errorf("invalid step %q in %s field", stepSpec, field.name)
+			}
+		}
+		low, high := field.min, field.max
+		switch {
+		case rangeSpec == "*":
+			star = star || !hasStep
+		case strings.Contains(rangeSpec, "-"):
+			lowSpec, highSpec, _ := strings.Cut(rangeSpec, "-")
+			if low, err = parseCronValue(lowSpec, field); err != nil {
+				return 0, false, err
+			}
+			if high, err = parseCronValue(highSpec, field); err != nil {
+				return 0, false, err
+			}
+			if low > high {
+				return 0, false, fmt.Errorf("invalid range %q in %s field", rangeSpec, field.name)
+			}
+		default:
+			if low, err = parseCronValue(rangeSpec, field); err != nil {
+				return 0, false, err
+			}
+			if !hasStep {
+				high = low
+			}
+		}
+		for value := low; value <= high; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+	return bits, star, nil
+}
+
+// parseCronValue parses a number or name of a cron field.
+func parseCronValue(spec string, field cronField) (value int, err error) {
+	for i, name := range field.names {
+		if strings.EqualFold(spec, name) {
+			return i + field.min, nil
+		}
+	}
+	if value, err = strconv.Atoi(spec); err != nil || value < field.min || value > field.max {
+		return 0, fmt.Errorf("invalid value %q in %s field", spec, field.name)
+	}
+	return value, nil
+}
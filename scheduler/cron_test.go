@@ -0,0 +1,63 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseCron(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		for _, expr := range []string{"* * * * *", "*/15 0-6 1,15 jan-jun mon-fri", "0 0 * * 7", "@daily", "@HOURLY", "5 4 * * sun"} {
+			cron, err := ParseCron(expr)
+			assert.NoError(t, err, expr)
+			assert.Equal(t, expr, cron.String())
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *", "@reboot"} {
+			_, err := ParseCron(expr)
+			assert.ErrorIs(t, err, ErrInvalidCron, expr)
+		}
+	})
+}
+
+func Test_Cron_Next(t *testing.T) {
+	at := func(value string) time.Time {
+		parsed, err := time.Parse(time.DateTime, value)
+		assert.NoError(t, err)
+		return parsed
+	}
+	tests := []struct {
+		expr  string
+		after string
+		next  string
+	}{
+		{"* * * * *", "2026-01-01 10:00:30", "2026-01-01 10:01:00"},
+		{"* * * * *", "2026-01-01 10:00:00", "2026-01-01 10:01:00"},
+		{"*/15 * * * *", "2026-01-01 10:16:00", "2026-01-01 10:30:00"},
+		{"0 3 * * *", "2026-01-01 10:00:00", "2026-01-02 03:00:00"},
+		{"@monthly", "2026-01-31 00:00:00", "2026-02-01 00:00:00"},
+		{"0 0 29 2 *", "2026-01-01 00:00:00", "2028-02-29 00:00:00"},
+		{"0 9 * * mon", "2026-01-01 00:00:00", "2026-01-05 09:00:00"},
+		{"0 0 * * 7", "2026-01-01 00:00:00", "2026-01-04 00:00:00"},
+		{"0 0 13 * fri", "2026-01-01 00:00:00", "2026-01-02 00:00:00"},
+		{"0 0 31 * *", "2026-04-01 00:00:00", "2026-05-31 00:00:00"},
+		{"30 23 31 12 *", "2026-12-31 23:30:00", "2027-12-31 23:30:00"},
+	}
+	for _, test := range tests {
+		t.Run(test.expr+" after "+test.after, func(t *testing.T) {
+			cron, err := ParseCron(test.expr)
+			assert.NoError(t, err)
+			assert.Equal(t, at(test.next), cron.Next(at(test.after)))
+		})
+	}
+
+	t.Run("never", func(t *testing.T) {
+		cron, err := ParseCron("0 0 31 2 *")
+		assert.NoError(t, err)
+		assert.True(t, cron.Next(at("2026-01-01 00:00:00")).IsZero())
+	})
+}
@@ -0,0 +1,87 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dan-lugg/go-commands/commands"
+)
+
+const (
+	RecordReqName = "record"
+)
+
+var (
+	ErrRejected     = errors.New("rejected")
+	ErrStoreFailure = errors.New("store failure")
+)
+
+type RecordCommandRes struct{}
+
+type RecordCommandReq struct {
+	Value string `json:"value"`
+}
+
+// Recorder collects the values of the RecordCommandReq requests handled by RecordHandler.
+type Recorder struct {
+	mutex  sync.Mutex
+	values []string
+}
+
+func (r *Recorder) Values() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]string(nil), r.values...)
+}
+
+type RecordHandler struct {
+	commands.Handler[RecordCommandReq, RecordCommandRes]
+	recorder *Recorder
+}
+
+func (h *RecordHandler) Handle(ctx context.Context, req RecordCommandReq) (res RecordCommandRes, err error) {
+	if req.Value == "" {
+		return RecordCommandRes{}, ErrRejected
+	}
+	h.recorder.mutex.Lock()
+	defer h.recorder.mutex.Unlock()
+	h.recorder.values = append(h.recorder.values, req.Value)
+	return RecordCommandRes{}, nil
+}
+
+// FailingStore is a MemoryStore whose updates fail with ErrStoreFailure while failing is set.
+type FailingStore struct {
+	*MemoryStore
+	failing atomic.Bool
+}
+
+func (s *FailingStore) Save(schedule Schedule) error {
+	if s.failing.Load() {
+		return ErrStoreFailure
+	}
+	return s.MemoryStore.Save(schedule)
+}
+
+func (s *FailingStore) Delete(id string) error {
+	if s.failing.Load() {
+		return ErrStoreFailure
+	}
+	return s.MemoryStore.Delete(id)
+}
+
+func newCatalogs() (*commands.DefaultMappingCatalog, *commands.DefaultDecoderCatalog, *commands.DefaultHandlerCatalog, *Recorder) {
+	mappingCatalog := commands.NewMappingCatalog()
+	commands.InsertMapping[RecordCommandReq](mappingCatalog, RecordReqName)
+
+	decoderCatalog := commands.NewDefaultDecoderCatalog()
+	commands.InsertDecoder[RecordCommandReq](decoderCatalog, commands.DefaultDecoder[RecordCommandReq]())
+
+	recorder := &Recorder{}
+	handlerCatalog := commands.NewDefaultHandlerCatalog(commands.WithMappingCatalog(mappingCatalog))
+	commands.InsertHandler[RecordCommandReq, RecordCommandRes](handlerCatalog, func() commands.Handler[RecordCommandReq, RecordCommandRes] {
+		return &RecordHandler{recorder: recorder}
+	})
+	return mappingCatalog, decoderCatalog, handlerCatalog, recorder
+}
@@ -0,0 +1,559 @@
+package scheduler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dan-lugg/go-commands/commands"
+	"github.com/dan-lugg/go-commands/util"
+)
+
+var (
+	ErrScheduleMissing  = errors.New("schedule missing")
+	ErrSchedulerRunning = errors.New("scheduler already running")
+)
+
+const (
+	// DefaultMisfireThreshold is how late a run may be before it is considered misfired,
+	// unless overridden with WithMisfireThreshold.
+	DefaultMisfireThreshold = time.Minute
+
+	// maxCatchUpRuns bounds the number of missed runs MisfireRunAll dispatches at once.
+	maxCatchUpRuns = 1000
+
+	// storeRetryDelay is how long a Scheduler waits before retrying a due schedule it failed to store.
+	storeRetryDelay = time.Second
+)
+
+// MisfirePolicy determines what a Scheduler does with a run that is later than its misfire threshold,
+// typically because the process was not running at the time.
+type MisfirePolicy int
+
+const (
+	// MisfireRunOnce dispatches the command once, however many runs were missed.
+	MisfireRunOnce MisfirePolicy = iota
+	// MisfireSkip drops the missed runs. A one-shot schedule is removed without dispatching.
+	MisfireSkip
+	// MisfireRunAll dispatches the command once for every missed run of a cron schedule, up to 1000.
+	MisfireRunAll
+)
+
+// String returns the name of the MisfirePolicy.
+func (p MisfirePolicy) String() string {
+	switch p {
+	case MisfireRunOnce:
+		return "run-once"
+	case MisfireSkip:
+		return "skip"
+	case MisfireRunAll:
+		return "run-all"
+	default:
+		return "unknown"
+	}
+}
+
+// Schedule is a command scheduled for dispatch, either once or on a cron expression.
+//
+// Fields:
+//   - ID: The unique ID of the Schedule.
+//   - Name: The mapped name of the request type.
+//   - Payload: The JSON encoding of the request.
+//   - Cron: The cron expression of a recurring Schedule, empty for a one-shot Schedule.
+//   - Misfire: The MisfirePolicy of the Schedule.
+//   - Next: The time of the next run.
+//   - LastRun: The time of the last run, or the zero time.Time if it has not run yet.
+type Schedule struct {
+	ID      string          `json:"id"`
+	Name    string          `json:"name"`
+	Payload json.RawMessage `json:"payload"`
+	Cron    string          `json:"cron,omitempty"`
+	Misfire MisfirePolicy   `json:"misfire"`
+	Next    time.Time       `json:"next"`
+	LastRun time.Time       `json:"lastRun"`
+}
+
+type ScheduleOption = util.Option[*Schedule]
+
+// WithID returns an option that sets the ID of a Schedule. Scheduling with the ID of an existing
+// Schedule replaces it, so recurring schedules can be registered on every start.
+//
+// Parameters:
+//   - id: The ID of the Schedule.
+func WithID(id string) ScheduleOption {
+	return func(s *Schedule) {
+		s.ID = id
+	}
+}
+
+// WithMisfirePolicy returns an option that sets the MisfirePolicy of a Schedule.
+//
+// Parameters:
+//   - policy: The MisfirePolicy of the Schedule.
+func WithMisfirePolicy(policy MisfirePolicy) ScheduleOption {
+	return func(s *Schedule) {
+		s.Misfire = policy
+	}
+}
+
+// Scheduler dispatches commands through a HandlerCatalog at a given time or on a cron expression.
+//
+// Schedules are kept in a Store and updated before each dispatch, so a run is dispatched at
+// most once, and a restarted Scheduler resumes the stored schedules, applying their MisfirePolicy
+// to the runs missed in between. If the Store fails to update a due schedule, its runs are not
+// dispatched; the failure is reported and the update retried after a second.
+//
+// Fields:
+//   - mappingCatalog: The MappingCatalog used to resolve request types to names and back.
+//   - decoderCatalog: The DecoderCatalog used to decode the stored payloads.
+//   - handlerCatalog: The HandlerCatalog the commands are dispatched through.
+//   - clock: The Clock of the Scheduler.
+//   - store: The Store the schedules are persisted to.
+//   - misfireThreshold: How late a run may be before its MisfirePolicy applies.
+//   - errorHandler: An optional function receiving the errors of dispatches and of the Store.
+//   - schedules: A map that associates schedule IDs with their schedules.
+//   - crons: A map that associates schedule IDs with their parsed cron expressions.
+//   - wake: A channel waking the loop when the schedules change.
+//   - cancel: The function stopping the loop, or nil if the Scheduler is not running.
+//   - done: A channel closed once the loop has returned.
+//   - inflight: The dispatches that have not completed yet.
+type Scheduler struct {
+	mappingCatalog   commands.MappingCatalog
+	decoderCatalog   commands.DecoderCatalog
+	handlerCatalog   commands.HandlerCatalog
+	clock            Clock
+	store            Store
+	misfireThreshold time.Duration
+	errorHandler     func(schedule Schedule, err error)
+	mutex            sync.Mutex
+	schedules        map[string]Schedule
+	crons            map[string]*Cron
+	wake             chan struct{}
+	cancel           context.CancelFunc
+	done             chan struct{}
+	inflight         sync.WaitGroup
+}
+
+type SchedulerOption = util.Option[*Scheduler]
+
+// WithClock returns an option that sets the Clock of a Scheduler.
+//
+// Parameters:
+//   - clock: The Clock of the Scheduler.
+func WithClock(clock Clock) SchedulerOption {
+	return func(s *Scheduler) {
+		s.clock = clock
+	}
+}
+
+// WithStore returns an option that sets the Store a Scheduler persists its schedules to.
+//
+// Parameters:
+//   - store: The Store of the Scheduler.
+func WithStore(store Store) SchedulerOption {
+	return func(s *Scheduler) {
+		s.store = store
+	}
+}
+
+// WithMisfireThreshold returns an option that sets how late a run may be before its MisfirePolicy applies.
+//
+// Parameters:
+//   - threshold: The misfire threshold of the Scheduler.
+func WithMisfireThreshold(threshold time.Duration) SchedulerOption {
+	return func(s *Scheduler) {
+		s.misfireThreshold = threshold
+	}
+}
+
+// WithErrorHandler returns an option that sets the function receiving the errors of dispatches and of the Store.
+//
+// Parameters:
+//   - errorHandler: The function receiving the errors, along with the Schedule they relate to.
+func WithErrorHandler(errorHandler func(schedule Schedule, err error)) SchedulerOption {
+	return func(s *Scheduler) {
+		s.errorHandler = errorHandler
+	}
+}
+
+// NewScheduler creates and returns a new instance of Scheduler.
+//
+// By default the Scheduler uses SystemClock, a MemoryStore and DefaultMisfireThreshold.
+//
+// Parameters:
+//   - mappingCatalog: The MappingCatalog used to resolve request types to names and back.
+//   - decoderCatalog: The DecoderCatalog used to decode the stored payloads.
+//   - handlerCatalog: The HandlerCatalog the commands are dispatched through.
+//   - options: Options applied to the Scheduler.
+//
+// Returns:
+//   - A pointer to a Scheduler instance.
+func NewScheduler(mappingCatalog commands.MappingCatalog, decoderCatalog commands.DecoderCatalog, handlerCatalog commands.HandlerCatalog, options ...SchedulerOption) (scheduler *Scheduler) {
+	scheduler = &Scheduler{
+		mappingCatalog:   mappingCatalog,
+		decoderCatalog:   decoderCatalog,
+		handlerCatalog:   handlerCatalog,
+		clock:            SystemClock,
+		store:            nil,
+		misfireThreshold: DefaultMisfireThreshold,
+		errorHandler:     nil,
+		mutex:            sync.Mutex{},
+		schedules:        make(map[string]Schedule),
+		crons:            make(map[string]*Cron),
+		wake:             make(chan struct{}, 1),
+	}
+	for _, option := range options {
+		option(scheduler)
+	}
+	if scheduler.store == nil {
+		scheduler.store = NewMemoryStore()
+	}
+	return scheduler
+}
+
+// Start loads the stored schedules and starts dispatching them in the background.
+//
+// Parameters:
+//   - ctx: A context.Context provided to the dispatches; when it ends, the Scheduler stops.
+//
+// Returns:
+//   - An error wrapping ErrSchedulerRunning if the Scheduler is already running, or if the Store cannot be loaded.
+func (s *Scheduler) Start(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	failures := make([]failure, 0)
+	defer func() {
+		for _, f := range failures {
+			s.report(f.schedule, f.err)
+		}
+	}()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.cancel != nil {
+		return ErrSchedulerRunning
+	}
+	schedules, err := s.store.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load schedules: %w", err)
+	}
+	for _, schedule := range schedules {
+		if _, found := s.schedules[schedule.ID]; found {
+			continue
+		}
+		if schedule.Cron != "" {
+			cron, err := ParseCron(schedule.Cron)
+			if err != nil {
+				failures = append(failures, failure{schedule, err})
+				continue
+			}
+			s.crons[schedule.ID] = cron
+		}
+		s.schedules[schedule.ID] = schedule
+	}
+	loopCtx, cancel := context.WithCancel(ctx)
+	s.cancel, s.done = cancel, make(chan struct{})
+	go s.loop(ctx, loopCtx, s.done)
+	return nil
+}
+
+// Stop stops the Scheduler, waiting for the dispatches in flight to complete. The schedules are
+// kept, so the Scheduler can be started again.
+func (s *Scheduler) Stop() {
+	s.mutex.Lock()
+	cancel, done := s.cancel, s.done
+	s.cancel, s.done = nil, nil
+	s.mutex.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+	s.inflight.Wait()
+}
+
+// At schedules a request to be dispatched once, at the given time.
+//
+// Parameters:
+//   - runAt: The time to dispatch the request at.
+//   - req: The request to dispatch; its type must be mapped in the MappingCatalog.
+//   - options: Options applied to the Schedule.
+//
+// Returns:
+//   - id: The ID of the Schedule.
+//   - err: An error if the request cannot be mapped or encoded, or the Schedule cannot be stored.
+func (s *Scheduler) At(runAt time.Time, req commands.CommandReq[commands.CommandRes], options ...ScheduleOption) (id string, err error) {
+	return s.insert(req, "", nil, runAt, options)
+}
+
+// After schedules a request to be dispatched once, after the given delay.
+//
+// Parameters:
+//   - delay: The delay after which to dispatch the request.
+//   - req: The request to dispatch; its type must be mapped in the MappingCatalog.
+//   - options: Options applied to the Schedule.
+//
+// Returns:
+//   - id: The ID of the Schedule.
+//   - err: An error if the request cannot be mapped or encoded, or the Schedule cannot be stored.
+func (s *Scheduler) After(delay time.Duration, req commands.CommandReq[commands.CommandRes], options ...ScheduleOption) (id string, err error) {
+	return s.At(s.clock.Now().Add(delay), req, options...)
+}
+
+// Cron schedules a request to be dispatched on every time matched by a cron expression.
+//
+// Parameters:
+//   - expr: The cron expression, as accepted by ParseCron.
+//   - req: The request to dispatch; its type must be mapped in the MappingCatalog.
+//   - options: Options applied to the Schedule.
+//
+// Returns:
+//   - id: The ID of the Schedule.
+//   - err: An error wrapping ErrInvalidCron if expr cannot be parsed, or if the request cannot be
+//     mapped or encoded, or the Schedule cannot be stored.
+func (s *Scheduler) Cron(expr string, req commands.CommandReq[commands.CommandRes], options ...ScheduleOption) (id string, err error) {
+	cron, err := ParseCron(expr)
+	if err != nil {
+		return "", err
+	}
+	next := cron.Next(s.clock.Now())
+	if next.IsZero() {
+		return "", fmt.Errorf("%w: %q never matches", ErrInvalidCron, expr)
+	}
+	return s.insert(req, expr, cron, next, options)
+}
+
+// Cancel removes a Schedule, so it is not dispatched anymore. Dispatches already in flight are not interrupted.
+//
+// Parameters:
+//   - id: The ID of the Schedule.
+//
+// Returns:
+//   - An error wrapping ErrScheduleMissing if no Schedule has the ID, or if the Store fails.
+func (s *Scheduler) Cancel(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, found := s.schedules[id]; !found {
+		return fmt.Errorf("%w: %s", ErrScheduleMissing, id)
+	}
+	if err := s.store.Delete(id); err != nil {
+		return fmt.Errorf("failed to delete schedule: %w", err)
+	}
+	delete(s.schedules, id)
+	delete(s.crons, id)
+	return nil
+}
+
+// Schedules returns the pending schedules, ordered by their next run.
+//
+// Returns:
+//   - The pending schedules.
+func (s *Scheduler) Schedules() []Schedule {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	schedules := make([]Schedule, 0, len(s.schedules))
+	for _, schedule := range s.schedules {
+		schedules = append(schedules, schedule)
+	}
+	slices.SortFunc(schedules, func(a, b Schedule) int {
+		if c := a.Next.Compare(b.Next); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return schedules
+}
+
+// insert creates, stores and registers a Schedule.
+func (s *Scheduler) insert(req commands.CommandReq[commands.CommandRes], expr string, cron *Cron, next time.Time, options []ScheduleOption) (id string, err error) {
+	name, err := s.mappingCatalog.ByType(reflect.TypeOf(req))
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode req: %w", err)
+	}
+	schedule := Schedule{
+		ID:      "",
+		Name:    name,
+		Payload: payload,
+		Cron:    expr,
+		Misfire: MisfireRunOnce,
+		Next:    next,
+	}
+	for _, option := range options {
+		option(&schedule)
+	}
+	if schedule.ID == "" {
+		schedule.ID = newID()
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err = s.store.Save(schedule); err != nil {
+		return "", fmt.Errorf("failed to save schedule: %w", err)
+	}
+	s.schedules[schedule.ID] = schedule
+	delete(s.crons, schedule.ID)
+	if cron != nil {
+		s.crons[schedule.ID] = cron
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return schedule.ID, nil
+}
+
+// loop dispatches the due schedules and waits for the next one, until loopCtx ends.
+func (s *Scheduler) loop(ctx context.Context, loopCtx context.Context, done chan struct{}) {
+	defer close(done)
+	for {
+		next := s.tick(ctx)
+		var timer <-chan time.Time
+		if !next.IsZero() {
+			timer = s.clock.After(next.Sub(s.clock.Now()))
+			// The clock may have moved between computing the delay and creating the timer.
+			if !s.clock.Now().Before(next) {
+				continue
+			}
+		}
+		select {
+		case <-loopCtx.Done():
+			return
+		case <-s.wake:
+		case <-timer:
+		}
+	}
+}
+
+// tick dispatches the due schedules and returns the time of the next run, or the zero time.Time if there is none.
+func (s *Scheduler) tick(ctx context.Context) (next time.Time) {
+	failures := make([]failure, 0)
+	defer func() {
+		for _, f := range failures {
+			s.report(f.schedule, f.err)
+		}
+	}()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := s.clock.Now()
+	for id, schedule := range s.schedules {
+		if schedule.Next.After(now) {
+			next = earliest(next, schedule.Next)
+			continue
+		}
+		runs := s.runs(schedule, now)
+		if cron, found := s.crons[id]; found {
+			schedule.Next = cron.Next(now)
+		} else {
+			schedule.Next = time.Time{}
+		}
+		if runs > 0 {
+			schedule.LastRun = now
+		}
+		if schedule.Next.IsZero() {
+			if err := s.store.Delete(id); err != nil {
+				failures = append(failures, failure{schedule, fmt.Errorf("failed to delete schedule: %w", err)})
+				next = earliest(next, now.Add(storeRetryDelay))
+				continue
+			}
+			delete(s.schedules, id)
+			delete(s.crons, id)
+		} else {
+			if err := s.store.Save(schedule); err != nil {
+				failures = append(failures, failure{schedule, fmt.Errorf("failed to save schedule: %w", err)})
+				next = earliest(next, now.Add(storeRetryDelay))
+				continue
+			}
+			s.schedules[id] = schedule
+			next = earliest(next, schedule.Next)
+		}
+		if runs > 0 {
+			s.inflight.Add(1)
+			go s.dispatch(ctx, schedule, runs)
+		}
+	}
+	return next
+}
+
+// earliest returns the earlier of two times, ignoring a zero time.Time.
+func earliest(next time.Time, at time.Time) time.Time {
+	if next.IsZero() || at.Before(next) {
+		return at
+	}
+	return next
+}
+
+// runs returns how many times a due Schedule is dispatched, applying its MisfirePolicy if it is late.
+func (s *Scheduler) runs(schedule Schedule, now time.Time) int {
+	if now.Sub(schedule.Next) <= s.misfireThreshold {
+		return 1
+	}
+	switch schedule.Misfire {
+	case MisfireSkip:
+		return 0
+	case MisfireRunAll:
+		cron, found := s.crons[schedule.ID]
+		if !found {
+			return 1
+		}
+		runs := 0
+		for at := schedule.Next; !at.IsZero() && !at.After(now) && runs < maxCatchUpRuns; at = cron.Next(at) {
+			runs++
+		}
+		return runs
+	default:
+		return 1
+	}
+}
+
+// dispatch decodes the request of a Schedule and dispatches it through the HandlerCatalog, runs times.
+func (s *Scheduler) dispatch(ctx context.Context, schedule Schedule, runs int) {
+	defer s.inflight.Done()
+	for run := 0; run < runs; run++ {
+		if err := s.handle(ctx, schedule); err != nil {
+			s.report(schedule, err)
+		}
+	}
+}
+
+func (s *Scheduler) handle(ctx context.Context, schedule Schedule) error {
+	reqType, err := s.mappingCatalog.ByName(schedule.Name)
+	if err != nil {
+		return err
+	}
+	req, err := s.decoderCatalog.Decode(reqType, schedule.Payload)
+	if err != nil {
+		return err
+	}
+	_, err = s.handlerCatalog.Handle(ctx, req)
+	return err
+}
+
+// failure is an error reported to the error handler once the Scheduler is unlocked.
+type failure struct {
+	schedule Schedule
+	err      error
+}
+
+func (s *Scheduler) report(schedule Schedule, err error) {
+	if s.errorHandler != nil {
+		s.errorHandler(schedule, err)
+	}
+}
+
+// newID returns a random schedule ID.
+func newID() string {
+	data := make([]byte, 16)
+	_, _ = rand.Read(data)
+	return hex.EncodeToString(data)
+}
@@ -0,0 +1,236 @@
+package scheduler
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dan-lugg/go-commands/commands"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MisfirePolicy_String(t *testing.T) {
+	assert.Equal(t, "run-once", MisfireRunOnce.String())
+	assert.Equal(t, "skip", MisfireSkip.String())
+	assert.Equal(t, "run-all", MisfireRunAll.String())
+	assert.Equal(t, "unknown", MisfirePolicy(-1).String())
+}
+
+func Test_Scheduler(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	newScheduler := func(t *testing.T, options ...SchedulerOption) (*Scheduler, *ManualClock, *Recorder) {
+		clock := NewManualClock(start)
+		mappingCatalog, decoderCatalog, handlerCatalog, recorder := newCatalogs()
+		scheduler := NewScheduler(mappingCatalog, decoderCatalog, handlerCatalog, append([]SchedulerOption{WithClock(clock)}, options...)...)
+		assert.NoError(t, scheduler.Start(context.Background()))
+		t.Cleanup(scheduler.Stop)
+		return scheduler, clock, recorder
+	}
+
+	recorded := func(t *testing.T, recorder *Recorder, values ...string) {
+		assert.Eventually(t, func() bool {
+			return assert.ObjectsAreEqual(values, recorder.Values())
+		}, time.Second, time.Millisecond, "expected %v, found %v", values, recorder.Values())
+	}
+
+	t.Run("after", func(t *testing.T) {
+		scheduler, clock, recorder := newScheduler(t)
+		id, err := scheduler.After(time.Hour, RecordCommandReq{Value: "a"})
+		assert.NoError(t, err)
+		assert.Len(t, scheduler.Schedules(), 1)
+		assert.Equal(t, start.Add(time.Hour), scheduler.Schedules()[0].Next)
+
+		clock.Advance(59 * time.Minute)
+		time.Sleep(10 * time.Millisecond)
+		assert.Empty(t, recorder.Values())
+
+		clock.Advance(time.Minute)
+		recorded(t, recorder, "a")
+		assert.Empty(t, scheduler.Schedules())
+		assert.ErrorIs(t, scheduler.Cancel(id), ErrScheduleMissing)
+	})
+
+	t.Run("at past", func(t *testing.T) {
+		scheduler, _, recorder := newScheduler(t)
+		_, err := scheduler.At(start.Add(-time.Second), RecordCommandReq{Value: "a"})
+		assert.NoError(t, err)
+		recorded(t, recorder, "a")
+	})
+
+	t.Run("cron", func(t *testing.T) {
+		scheduler, clock, recorder := newScheduler(t)
+		id, err := scheduler.Cron("*/10 * * * *", RecordCommandReq{Value: "tick"}, WithID("ticker"))
+		assert.NoError(t, err)
+		assert.Equal(t, "ticker", id)
+
+		for i := 0; i < 3; i++ {
+			clock.Advance(10 * time.Minute)
+			recorded(t, recorder, []string{"tick", "tick", "tick"}[:i+1]...)
+		}
+		schedules := scheduler.Schedules()
+		assert.Len(t, schedules, 1)
+		assert.Equal(t, start.Add(40*time.Minute), schedules[0].Next)
+		assert.Equal(t, start.Add(30*time.Minute), schedules[0].LastRun)
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		scheduler, clock, recorder := newScheduler(t)
+		id, err := scheduler.After(time.Minute, RecordCommandReq{Value: "a"})
+		assert.NoError(t, err)
+		_, err = scheduler.After(2*time.Minute, RecordCommandReq{Value: "b"})
+		assert.NoError(t, err)
+		assert.NoError(t, scheduler.Cancel(id))
+		assert.ErrorIs(t, scheduler.Cancel("missing"), ErrScheduleMissing)
+
+		clock.Advance(2 * time.Minute)
+		recorded(t, recorder, "b")
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		scheduler, clock, recorder := newScheduler(t)
+		_, err := scheduler.After(time.Minute, RecordCommandReq{Value: "a"}, WithID("job"))
+		assert.NoError(t, err)
+		_, err = scheduler.After(time.Minute, RecordCommandReq{Value: "b"}, WithID("job"))
+		assert.NoError(t, err)
+		assert.Len(t, scheduler.Schedules(), 1)
+
+		clock.Advance(time.Minute)
+		recorded(t, recorder, "b")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		scheduler, _, _ := newScheduler(t)
+		_, err := scheduler.Cron("bad", RecordCommandReq{Value: "a"})
+		assert.ErrorIs(t, err, ErrInvalidCron)
+		_, err = scheduler.Cron("0 0 31 2 *", RecordCommandReq{Value: "a"})
+		assert.ErrorIs(t, err, ErrInvalidCron)
+		_, err = scheduler.After(time.Minute, struct{}{})
+		assert.ErrorIs(t, err, commands.ErrMappingMissing)
+		assert.Empty(t, scheduler.Schedules())
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		mutex := sync.Mutex{}
+		failures := make([]error, 0)
+		scheduler, _, _ := newScheduler(t, WithErrorHandler(func(schedule Schedule, err error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			failures = append(failures, err)
+		}))
+		_, err := scheduler.After(0, RecordCommandReq{Value: ""})
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return len(failures) == 1
+		}, time.Second, time.Millisecond)
+		assert.ErrorIs(t, failures[0], ErrRejected)
+	})
+
+	t.Run("store failure", func(t *testing.T) {
+		mutex := sync.Mutex{}
+		failures := make([]error, 0)
+		store := &FailingStore{MemoryStore: NewMemoryStore()}
+		scheduler, clock, recorder := newScheduler(t, WithStore(store), WithErrorHandler(func(schedule Schedule, err error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			failures = append(failures, err)
+		}))
+		_, err := scheduler.Cron("*/10 * * * *", RecordCommandReq{Value: "tick"})
+		assert.NoError(t, err)
+
+		store.failing.Store(true)
+		clock.Advance(10 * time.Minute)
+		assert.Eventually(t, func() bool {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return len(failures) > 0
+		}, time.Second, time.Millisecond)
+		assert.ErrorIs(t, failures[0], ErrStoreFailure)
+		assert.Empty(t, recorder.Values())
+		assert.Equal(t, start.Add(10*time.Minute), scheduler.Schedules()[0].Next)
+
+		store.failing.Store(false)
+		clock.Advance(storeRetryDelay)
+		recorded(t, recorder, "tick")
+		assert.Equal(t, start.Add(20*time.Minute), scheduler.Schedules()[0].Next)
+	})
+
+	t.Run("running", func(t *testing.T) {
+		scheduler, _, _ := newScheduler(t)
+		assert.ErrorIs(t, scheduler.Start(context.Background()), ErrSchedulerRunning)
+		scheduler.Stop()
+		assert.NoError(t, scheduler.Start(context.Background()))
+	})
+}
+
+func Test_Scheduler_Restart(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// restart schedules a request, stops the scheduler, lets downtime pass
+	// and starts a new scheduler over the same file.
+	restart := func(t *testing.T, downtime time.Duration, schedule func(*Scheduler) error) []string {
+		path := filepath.Join(t.TempDir(), "schedules.json")
+		clock := NewManualClock(start)
+		mappingCatalog, decoderCatalog, handlerCatalog, recorder := newCatalogs()
+
+		store, err := NewFileStore(path)
+		assert.NoError(t, err)
+		first := NewScheduler(mappingCatalog, decoderCatalog, handlerCatalog, WithClock(clock), WithStore(store))
+		assert.NoError(t, first.Start(context.Background()))
+		assert.NoError(t, schedule(first))
+		first.Stop()
+
+		clock.Advance(downtime)
+		store, err = NewFileStore(path)
+		assert.NoError(t, err)
+		second := NewScheduler(mappingCatalog, decoderCatalog, handlerCatalog, WithClock(clock), WithStore(store))
+		assert.NoError(t, second.Start(context.Background()))
+		assert.Eventually(t, func() bool {
+			for _, s := range second.Schedules() {
+				if !s.Next.After(clock.Now()) {
+					return false
+				}
+			}
+			return true
+		}, time.Second, time.Millisecond)
+		second.Stop()
+		return recorder.Values()
+	}
+
+	hourly := func(policy MisfirePolicy) func(*Scheduler) error {
+		return func(s *Scheduler) error {
+			_, err := s.Cron("@hourly", RecordCommandReq{Value: "hourly"}, WithMisfirePolicy(policy))
+			return err
+		}
+	}
+
+	once := func(policy MisfirePolicy) func(*Scheduler) error {
+		return func(s *Scheduler) error {
+			_, err := s.After(time.Hour, RecordCommandReq{Value: "once"}, WithMisfirePolicy(policy))
+			return err
+		}
+	}
+
+	t.Run("on time", func(t *testing.T) {
+		assert.Equal(t, []string{"hourly"}, restart(t, time.Hour, hourly(MisfireSkip)))
+	})
+
+	t.Run("run once", func(t *testing.T) {
+		assert.Equal(t, []string{"hourly"}, restart(t, 3*time.Hour+time.Minute, hourly(MisfireRunOnce)))
+		assert.Equal(t, []string{"once"}, restart(t, 3*time.Hour, once(MisfireRunOnce)))
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		assert.Empty(t, restart(t, 3*time.Hour+time.Minute, hourly(MisfireSkip)))
+		assert.Empty(t, restart(t, 3*time.Hour, once(MisfireSkip)))
+	})
+
+	t.Run("run all", func(t *testing.T) {
+		assert.Equal(t, []string{"hourly", "hourly", "hourly"}, restart(t, 3*time.Hour+time.Minute, hourly(MisfireRunAll)))
+		assert.Equal(t, []string{"once"}, restart(t, 3*time.Hour, once(MisfireRunAll)))
+	})
+}
@@ -0,0 +1,215 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Store persists the schedules of a Scheduler, so they survive restarts.
+//
+// Methods:
+//   - Load(): Returns every stored Schedule.
+//   - Save(schedule Schedule): Inserts or replaces a Schedule.
+//   - Delete(id string): Removes a Schedule, succeeding if it does not exist.
+type Store interface {
+	Load() (schedules []Schedule, err error)
+	Save(schedule Schedule) error
+	Delete(id string) error
+}
+
+// MemoryStore is a Store holding schedules in memory. Schedules do not survive restarts.
+//
+// Fields:
+//   - schedules: A map that associates schedule IDs with their schedules.
+type MemoryStore struct {
+	mutex     sync.Mutex
+	schedules map[string]Schedule
+}
+
+// NewMemoryStore creates and returns a new instance of MemoryStore.
+//
+// Returns:
+//   - A pointer to a MemoryStore instance.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		mutex:     sync.Mutex{},
+		schedules: make(map[string]Schedule),
+	}
+}
+
+// Load returns every stored Schedule, ordered by ID.
+//
+// Returns:
+//   - schedules: The stored schedules.
+//   - err: Always nil.
+func (s *MemoryStore) Load() (schedules []Schedule, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return sortedSchedules(s.schedules), nil
+}
+
+// Save inserts or replaces a Schedule.
+//
+// Parameters:
+//   - schedule: The Schedule to store.
+//
+// Returns:
+//   - Always nil.
+func (s *MemoryStore) Save(schedule Schedule) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.schedules[schedule.ID] = schedule
+	return nil
+}
+
+// Delete removes a Schedule.
+//
+// Parameters:
+//   - id: The ID of the Schedule.
+//
+// Returns:
+//   - Always nil.
+func (s *MemoryStore) Delete(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.schedules, id)
+	return nil
+}
+
+// FileStore is a Store holding every schedule in one JSON file, rewritten atomically on each change.
+//
+// Fields:
+//   - path: The path of the file.
+//   - schedules: A map that associates schedule IDs with their schedules, mirroring the file.
+type FileStore struct {
+	mutex     sync.Mutex
+	path      string
+	schedules map[string]Schedule
+}
+
+// NewFileStore creates and returns a new instance of FileStore, reading the file if it exists.
+//
+// Parameters:
+//   - path: The path of the file.
+//
+// Returns:
+//   - store: A pointer to a FileStore instance.
+//   - err: An error if the file exists and cannot be read or decoded.
+func NewFileStore(path string) (store *FileStore, err error) {
+	store = &FileStore{
+		mutex:     sync.Mutex{},
+		path:      path,
+		schedules: make(map[string]Schedule),
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schedule store: %w", err)
+	}
+	schedules := make([]Schedule, 0)
+	if err = json.Unmarshal(data, &schedules); err != nil {
+		return nil, fmt.Errorf("failed to decode schedule store: %w", err)
+	}
+	for _, schedule := range schedules {
+		store.schedules[schedule.ID] = schedule
+	}
+	return store, nil
+}
+
+// Load returns every stored Schedule, ordered by ID.
+//
+// Returns:
+//   - schedules: The stored schedules.
+//   - err: Always nil.
+func (s *FileStore) Load() (schedules []Schedule, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return sortedSchedules(s.schedules), nil
+}
+
+// Save inserts or replaces a Schedule and rewrites the file.
+//
+// Parameters:
+//   - schedule: The Schedule to store.
+//
+// Returns:
+//   - An error if the file cannot be written.
+func (s *FileStore) Save(schedule Schedule) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	previous, found := s.schedules[schedule.ID]
+	s.schedules[schedule.ID] = schedule
+	if err := s.write(); err != nil {
+		if found {
+			s.schedules[schedule.ID] = previous
+		} else {
+			delete(s.schedules, schedule.ID)
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete removes a Schedule and rewrites the file.
+//
+// Parameters:
+//   - id: The ID of the Schedule.
+//
+// Returns:
+//   - An error if the file cannot be written.
+func (s *FileStore) Delete(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	previous, found := s.schedules[id]
+	if !found {
+		return nil
+	}
+	delete(s.schedules, id)
+	if err := s.write(); err != nil {
+		s.schedules[id] = previous
+		return err
+	}
+	return nil
+}
+
+// write replaces the file with the current schedules.
+func (s *FileStore) write() error {
+	data, err := json.MarshalIndent(sortedSchedules(s.schedules), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode schedule store: %w", err)
+	}
+	file, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write schedule store: %w", err)
+	}
+	_, err = file.Write(data)
+	err = errors.Join(err, file.Close())
+	if err == nil {
+		err = os.Rename(file.Name(), s.path)
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return fmt.Errorf("failed to write schedule store: %w", err)
+	}
+	return nil
+}
+
+func sortedSchedules(schedules map[string]Schedule) []Schedule {
+	sorted := make([]Schedule, 0, len(schedules))
+	for _, schedule := range schedules {
+		sorted = append(sorted, schedule)
+	}
+	slices.SortFunc(sorted, func(a, b Schedule) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return sorted
+}
@@ -0,0 +1,73 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	assert.NoError(t, store.Save(Schedule{ID: "b"}))
+	assert.NoError(t, store.Save(Schedule{ID: "a"}))
+	assert.NoError(t, store.Save(Schedule{ID: "b", Name: "record"}))
+
+	schedules, err := store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []Schedule{{ID: "a"}, {ID: "b", Name: "record"}}, schedules)
+
+	assert.NoError(t, store.Delete("a"))
+	assert.NoError(t, store.Delete("missing"))
+	schedules, err = store.Load()
+	assert.NoError(t, err)
+	assert.Len(t, schedules, 1)
+}
+
+func Test_FileStore(t *testing.T) {
+	next := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	schedule := Schedule{ID: "a", Name: "record", Payload: json.RawMessage(`{"value":"x"}`), Cron: "@daily", Misfire: MisfireSkip, Next: next}
+
+	t.Run("persist", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "schedules.json")
+		store, err := NewFileStore(path)
+		assert.NoError(t, err)
+		assert.NoError(t, store.Save(schedule))
+		assert.NoError(t, store.Save(Schedule{ID: "b", Next: next}))
+		assert.NoError(t, store.Delete("b"))
+
+		reopened, err := NewFileStore(path)
+		assert.NoError(t, err)
+		schedules, err := reopened.Load()
+		assert.NoError(t, err)
+		assert.Len(t, schedules, 1)
+		assert.Equal(t, schedule.ID, schedules[0].ID)
+		assert.Equal(t, schedule.Cron, schedules[0].Cron)
+		assert.Equal(t, schedule.Misfire, schedules[0].Misfire)
+		assert.True(t, schedule.Next.Equal(schedules[0].Next))
+		assert.JSONEq(t, string(schedule.Payload), string(schedules[0].Payload))
+
+		entries, err := os.ReadDir(filepath.Dir(path))
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1)
+	})
+
+	t.Run("corrupt", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "schedules.json")
+		assert.NoError(t, os.WriteFile(path, []byte("{"), 0o644))
+		_, err := NewFileStore(path)
+		assert.Error(t, err)
+	})
+
+	t.Run("unwritable", func(t *testing.T) {
+		store, err := NewFileStore(filepath.Join(t.TempDir(), "missing", "schedules.json"))
+		assert.NoError(t, err)
+		assert.Error(t, store.Save(schedule))
+		schedules, err := store.Load()
+		assert.NoError(t, err)
+		assert.Len(t, schedules, 0)
+	})
+}
@@ -0,0 +1,522 @@
+package wstransport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"net/http"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dan-lugg/go-commands/commands"
+	"github.com/dan-lugg/go-commands/futures"
+	"github.com/dan-lugg/go-commands/httptransport"
+	"github.com/dan-lugg/go-commands/util"
+	"github.com/gorilla/websocket"
+)
+
+// Client is a commands.HandlerCatalog and commands.StreamCatalog that dispatches requests to a
+// remote Server over a single WebSocket connection.
+//
+// Request types are registered on the Client with Insert or InsertRemote, and streamed request
+// types with InsertStream or InsertRemoteStream, which record the types used to decode the
+// replies. Requests are sent concurrently and matched with their replies by ID, so the generic
+// commands.Handle, commands.Future and commands.Stream helpers work unchanged against a Client.
+// Ending the context.Context of a request sends a FrameCancel, and the Progress reported by the
+// remote handler is reported to the commands.ProgressReporter carried by the context.
+//
+// Fields:
+//   - conn: The connection to the remote Server.
+//   - mappingCatalog: The MappingCatalog used to resolve request types to names.
+//   - resTypes: A map that associates request types with their response types.
+//   - itemTypes: A map that associates streamed request types with their item types.
+//   - calls: A map that associates the IDs of the requests in flight with their calls.
+//   - nextID: The ID of the next request.
+//   - writer: A mutex ensuring frames are written one at a time.
+//   - done: A channel closed once the connection has ended.
+//   - err: The error that ended the connection.
+type Client struct {
+	mutex          sync.RWMutex
+	conn           *websocket.Conn
+	mappingCatalog commands.MappingCatalog
+	resTypes       map[reflect.Type]reflect.Type
+	itemTypes      map[reflect.Type]reflect.Type
+	calls          map[string]*call
+	nextID         uint64
+	writer         sync.Mutex
+	done           chan struct{}
+	err            error
+}
+
+// dialConfig holds the options of Dial.
+//
+// Fields:
+//   - dialer: The websocket.Dialer used to connect.
+//   - header: The HTTP headers sent with the upgrade request.
+type dialConfig struct {
+	dialer *websocket.Dialer
+	header http.Header
+}
+
+type DialOption = util.Option[*dialConfig]
+
+// WithDialer returns an option that sets the websocket.Dialer used by Dial.
+//
+// Parameters:
+//   - dialer: The websocket.Dialer used to connect.
+func WithDialer(dialer *websocket.Dialer) DialOption {
+	return func(c *dialConfig) {
+		c.dialer = dialer
+	}
+}
+
+// WithHeader returns an option that sets the HTTP headers Dial sends with the upgrade request,
+// such as an Authorization header.
+//
+// Parameters:
+//   - header: The HTTP headers sent with the upgrade request.
+func WithHeader(header http.Header) DialOption {
+	return func(c *dialConfig) {
+		c.header = header
+	}
+}
+
+// Dial connects to a remote Server and returns a Client using the connection.
+//
+// Parameters:
+//   - ctx: A context.Context bounding the connection attempt.
+//   - url: The ws:// or wss:// URL the remote Server is mounted at.
+//   - mappingCatalog: The MappingCatalog used to resolve request types to names.
+//   - options: Options applied to the connection attempt.
+//
+// Returns:
+//   - client: The Client using the connection.
+//   - err: An error if the connection cannot be established.
+func Dial(ctx context.Context, url string, mappingCatalog commands.MappingCatalog, options ...DialOption) (client *Client, err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	config := &dialConfig{
+		dialer: websocket.DefaultDialer,
+		header: nil,
+	}
+	for _, option := range options {
+		option(config)
+	}
+	conn, response, err := config.dialer.DialContext(ctx, url, config.header)
+	if err != nil {
+		if response != nil {
+			return nil, fmt.Errorf("failed to dial: status %d: %w", response.StatusCode, err)
+		}
+		return nil, fmt.Errorf("failed to dial: %w", err)
+	}
+	return NewClient(conn, mappingCatalog), nil
+}
+
+// NewClient creates and returns a new instance of Client using an established connection,
+// which the Client reads from until it is closed.
+//
+// Parameters:
+//   - conn: The connection to the remote Server.
+//   - mappingCatalog: The MappingCatalog used to resolve request types to names.
+//
+// Returns:
+//   - A pointer to a Client instance.
+func NewClient(conn *websocket.Conn, mappingCatalog commands.MappingCatalog) (client *Client) {
+	client = &Client{
+		mutex:          sync.RWMutex{},
+		conn:           conn,
+		mappingCatalog: mappingCatalog,
+		resTypes:       make(map[reflect.Type]reflect.Type),
+		itemTypes:      make(map[reflect.Type]reflect.Type),
+		calls:          make(map[string]*call),
+		nextID:         0,
+		writer:         sync.Mutex{},
+		done:           make(chan struct{}),
+		err:            nil,
+	}
+	go client.read()
+	return client
+}
+
+// Close closes the connection, failing the requests in flight with ErrConnectionClosed.
+//
+// Returns:
+//   - An error if the connection cannot be closed.
+func (c *Client) Close() error {
+	_ = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(writeWait))
+	err := c.conn.Close()
+	<-c.done
+	return err
+}
+
+// Done returns a channel closed once the connection has ended.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Insert registers the request and response types of a HandlerAdapter with the Client.
+// The adapter itself is never invoked.
+//
+// Parameters:
+//   - adapter: The HandlerAdapter whose types are registered.
+func (c *Client) Insert(adapter commands.HandlerAdapter) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.resTypes[adapter.ReqType()] = adapter.ResType()
+}
+
+// InsertRemote is a generic function that registers a remote command with a Client.
+//
+// Type Parameters:
+//   - TReq: The type of the command request, which must implement the CommandReq interface.
+//   - TRes: The type of the command response, which must implement the CommandRes interface.
+//
+// Parameters:
+//   - client: A pointer to the Client where the command will be registered.
+func InsertRemote[TReq commands.CommandReq[TRes], TRes commands.CommandRes](client *Client) {
+	client.Insert(commands.NewDefaultHandlerAdapter[TReq, TRes](nil))
+}
+
+// InsertStream registers the request and item types of a StreamAdapter with the Client.
+// The adapter itself is never invoked.
+//
+// Parameters:
+//   - adapter: The StreamAdapter whose types are registered.
+func (c *Client) InsertStream(adapter commands.StreamAdapter) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.itemTypes[adapter.ReqType()] = adapter.ItemType()
+}
+
+// InsertRemoteStream is a generic function that registers a remote streaming command with a Client.
+//
+// Type Parameters:
+//   - TReq: The type of the command request, which must implement the CommandReq interface.
+//   - TItem: The type of the items produced, which must implement the CommandRes interface.
+//
+// Parameters:
+//   - client: A pointer to the Client where the command will be registered.
+func InsertRemoteStream[TReq commands.CommandReq[TItem], TItem commands.CommandRes](client *Client) {
+	client.InsertStream(commands.NewDefaultStreamAdapter[TReq, TItem](nil))
+}
+
+// IsStream reports whether a request type is registered as streamed with the Client.
+//
+// Parameters:
+//   - reqType: The reflect.Type of the request.
+//
+// Returns:
+//   - true if the request type was registered with InsertStream.
+func (c *Client) IsStream(reqType reflect.Type) bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	_, found := c.itemTypes[reqType]
+	return found
+}
+
+// Handle sends a command request to the remote Server and decodes the reply into the
+// registered response type.
+//
+// Parameters:
+//   - ctx: A context.Context providing context for the request; ending it cancels the request.
+//   - req: A CommandReq[CommandRes] representing the command request to be sent.
+//
+// Returns:
+//   - res: A CommandRes representing the decoded reply.
+//   - err: An error if the request type is not registered or mapped, the connection fails,
+//     or the remote Server reports an error as a *RemoteError.
+func (c *Client) Handle(ctx context.Context, req commands.CommandReq[commands.CommandRes]) (res commands.CommandRes, err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	reqType := reflect.TypeOf(req)
+	c.mutex.RLock()
+	resType, found := c.resTypes[reqType]
+	c.mutex.RUnlock()
+	if !found {
+		return nil, fmt.Errorf("%w for req type: %s", commands.ErrHandlerMissing, reqType)
+	}
+
+	call, err := c.send(req)
+	if err != nil {
+		return nil, err
+	}
+	defer c.finish(call)
+	progress := commands.ProgressFromContext(ctx)
+	for {
+		frame, err := c.receive(ctx, call)
+		if err != nil {
+			return nil, err
+		}
+		switch frame.Type {
+		case FrameProgress:
+			if frame.Progress != nil {
+				progress.Report(*frame.Progress)
+			}
+		case FrameResult:
+			return decode(resType, frame.Result)
+		case FrameError:
+			return nil, remoteError(frame)
+		}
+	}
+}
+
+// Future creates a futures.Future that asynchronously sends a command request to the remote Server.
+//
+// Parameters:
+//   - ctx: A context.Context providing context for the request.
+//   - req: A CommandReq[CommandRes] representing the command request to be sent.
+//
+// Returns:
+//   - A futures.Future containing a util.Tuple2 where:
+//   - Val1 is the CommandRes representing the decoded reply.
+//   - Val2 is an error if the request fails.
+func (c *Client) Future(ctx context.Context, req commands.CommandReq[commands.CommandRes]) futures.Future[util.Tuple2[commands.CommandRes, error]] {
+	return futures.Start(ctx, func(ctx context.Context) util.Tuple2[commands.CommandRes, error] {
+		res, err := c.Handle(ctx, req)
+		return util.Tuple2[commands.CommandRes, error]{
+			Val1: res,
+			Val2: err,
+		}
+	})
+}
+
+// Stream sends a streamed command request to the remote Server and yields the items it
+// replies with, decoded into the registered item type. Breaking out of the loop or ending ctx
+// cancels the request.
+//
+// Parameters:
+//   - ctx: A context.Context providing context for the request.
+//   - req: A CommandReq[CommandRes] representing the command request to be sent.
+//
+// Returns:
+//   - A sequence of the items produced, yielding a single error if the request type is not
+//     registered or mapped, the connection fails, or the remote Server reports an error.
+func (c *Client) Stream(ctx context.Context, req commands.CommandReq[commands.CommandRes]) iter.Seq2[commands.CommandRes, error] {
+	return func(yield func(commands.CommandRes, error) bool) {
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		reqType := reflect.TypeOf(req)
+		c.mutex.RLock()
+		itemType, found := c.itemTypes[reqType]
+		c.mutex.RUnlock()
+		if !found {
+			yield(nil, fmt.Errorf("%w for stream req type: %s", commands.ErrHandlerMissing, reqType))
+			return
+		}
+
+		call, err := c.send(req)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer c.finish(call)
+		for {
+			frame, err := c.receive(ctx, call)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			switch frame.Type {
+			case FrameItem:
+				item, err := decode(itemType, frame.Result)
+				if !yield(item, err) || err != nil {
+					return
+				}
+			case FrameEnd:
+				return
+			case FrameError:
+				yield(nil, remoteError(frame))
+				return
+			}
+		}
+	}
+}
+
+// TypeMap returns a mapping of registered request types to their corresponding response types.
+//
+// Returns:
+//   - typeMap: A map associating request types with their corresponding response types.
+func (c *Client) TypeMap() (typeMap map[reflect.Type]reflect.Type) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	typeMap = make(map[reflect.Type]reflect.Type, len(c.resTypes))
+	for reqType, resType := range c.resTypes {
+		typeMap[reqType] = resType
+	}
+	return typeMap
+}
+
+// StreamTypeMap returns a mapping of registered streamed request types to their item types.
+//
+// Returns:
+//   - typeMap: A map associating request types with their corresponding item types.
+func (c *Client) StreamTypeMap() (typeMap map[reflect.Type]reflect.Type) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	typeMap = make(map[reflect.Type]reflect.Type, len(c.itemTypes))
+	for reqType, itemType := range c.itemTypes {
+		typeMap[reqType] = itemType
+	}
+	return typeMap
+}
+
+// call is a request in flight, queuing the frames answering it until they are received.
+//
+// Fields:
+//   - id: The ID of the request.
+//   - frames: The frames received and not consumed yet.
+//   - notify: A channel signaled when a frame is queued.
+//   - finished: Whether the request has been answered, so it need not be canceled.
+type call struct {
+	mutex    sync.Mutex
+	id       string
+	frames   []Frame
+	notify   chan struct{}
+	finished bool
+}
+
+// send registers a call and writes the FrameRequest of a request.
+func (c *Client) send(req commands.CommandReq[commands.CommandRes]) (*call, error) {
+	reqName, err := c.mappingCatalog.ByType(reflect.TypeOf(req))
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode req: %w", err)
+	}
+
+	c.mutex.Lock()
+	if c.err != nil {
+		c.mutex.Unlock()
+		return nil, c.err
+	}
+	c.nextID++
+	call := &call{
+		mutex:  sync.Mutex{},
+		id:     strconv.FormatUint(c.nextID, 10),
+		frames: make([]Frame, 0),
+		notify: make(chan struct{}, 1),
+	}
+	c.calls[call.id] = call
+	c.mutex.Unlock()
+
+	if err = c.write(Frame{Type: FrameRequest, ID: call.id, Name: reqName, Payload: payload}); err != nil {
+		c.finish(call)
+		return nil, err
+	}
+	return call, nil
+}
+
+// receive returns the next frame answering a call.
+func (c *Client) receive(ctx context.Context, call *call) (Frame, error) {
+	for {
+		call.mutex.Lock()
+		if len(call.frames) > 0 {
+			frame := call.frames[0]
+			call.frames = call.frames[1:]
+			call.finished = frame.Type == FrameResult || frame.Type == FrameEnd || frame.Type == FrameError
+			call.mutex.Unlock()
+			return frame, nil
+		}
+		call.mutex.Unlock()
+		select {
+		case <-call.notify:
+		case <-ctx.Done():
+			return Frame{}, ctx.Err()
+		case <-c.done:
+			// Frames read before the connection ended are still delivered.
+			call.mutex.Lock()
+			pending := len(call.frames) > 0
+			call.mutex.Unlock()
+			if !pending {
+				return Frame{}, c.err
+			}
+		}
+	}
+}
+
+// finish unregisters a call, canceling its request on the remote Server if it was not answered.
+func (c *Client) finish(call *call) {
+	c.mutex.Lock()
+	delete(c.calls, call.id)
+	c.mutex.Unlock()
+	call.mutex.Lock()
+	finished := call.finished
+	call.mutex.Unlock()
+	if !finished {
+		_ = c.write(Frame{Type: FrameCancel, ID: call.id})
+	}
+}
+
+// write writes a frame, one at a time.
+func (c *Client) write(frame Frame) error {
+	data, err := json.Marshal(frame)
+	if err != nil {
+		return fmt.Errorf("failed to encode frame: %w", err)
+	}
+	c.writer.Lock()
+	defer c.writer.Unlock()
+	_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	if err = c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		return fmt.Errorf("%w: %w", ErrConnectionClosed, err)
+	}
+	return nil
+}
+
+// read routes the frames read from the connection to their calls, until the connection ends.
+func (c *Client) read() {
+	var err error
+	for {
+		var data []byte
+		if _, data, err = c.conn.ReadMessage(); err != nil {
+			break
+		}
+		frame := Frame{}
+		if json.Unmarshal(data, &frame) != nil {
+			continue
+		}
+		c.mutex.RLock()
+		call, found := c.calls[frame.ID]
+		c.mutex.RUnlock()
+		if !found {
+			continue
+		}
+		call.mutex.Lock()
+		call.frames = append(call.frames, frame)
+		call.mutex.Unlock()
+		select {
+		case call.notify <- struct{}{}:
+		default:
+		}
+	}
+	c.mutex.Lock()
+	c.err = fmt.Errorf("%w: %w", ErrConnectionClosed, err)
+	c.mutex.Unlock()
+	close(c.done)
+}
+
+// decode decodes an encoded result into a new value of a type.
+func decode(resType reflect.Type, data []byte) (commands.CommandRes, error) {
+	resValue := reflect.New(resType)
+	if err := json.Unmarshal(data, resValue.Interface()); err != nil {
+		return nil, fmt.Errorf("failed to decode res: %w", err)
+	}
+	return resValue.Elem().Interface(), nil
+}
+
+// remoteError returns the *RemoteError reported by a FrameError.
+func remoteError(frame Frame) error {
+	return &RemoteError{RemoteError: httptransport.RemoteError{
+		StatusCode: frame.Status,
+		Message:    frame.Error,
+		Kind:       frame.Kind,
+		Fields:     frame.Fields,
+	}}
+}
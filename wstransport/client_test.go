@@ -0,0 +1,190 @@
+package wstransport
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/dan-lugg/go-commands/commands"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestClient(t *testing.T, url string) *Client {
+	mappingCatalog, _, _, _ := newCatalogs()
+	client, err := Dial(context.Background(), url, mappingCatalog)
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+	InsertRemote[AddCommandReq, AddCommandRes](client)
+	InsertRemote[FailCommandReq, FailCommandRes](client)
+	InsertRemote[ValidCommandReq, ValidCommandRes](client)
+	InsertRemote[WaitCommandReq, WaitCommandRes](client)
+	InsertRemoteStream[RangeCommandReq, RangeCommandItem](client)
+	return client
+}
+
+func Test_Dial(t *testing.T) {
+	url, _ := newTestServer(t)
+	mappingCatalog, _, _, _ := newCatalogs()
+
+	t.Run("default", func(t *testing.T) {
+		client, err := Dial(context.Background(), url, mappingCatalog)
+		assert.NoError(t, err)
+		assert.NotNil(t, client)
+		assert.NoError(t, client.Close())
+		<-client.Done()
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		_, err := Dial(context.Background(), "ws://127.0.0.1:1", mappingCatalog)
+		assert.Error(t, err)
+		_, err = Dial(context.Background(), url, mappingCatalog, WithHeader(map[string][]string{"Origin": {"http://elsewhere.example"}}))
+		assert.ErrorContains(t, err, "status 403")
+	})
+}
+
+func Test_Client_Handle(t *testing.T) {
+	url, waiter := newTestServer(t, WithMaxConcurrency(2))
+	client := newTestClient(t, url)
+
+	t.Run("default", func(t *testing.T) {
+		res, err := commands.Handle[AddCommandReq, AddCommandRes](context.Background(), client, AddCommandReq{ArgX: 3, ArgY: 4})
+		assert.NoError(t, err)
+		assert.Equal(t, AddCommandRes{Result: 7}, res)
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		wg := sync.WaitGroup{}
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				res, err := commands.Handle[AddCommandReq, AddCommandRes](context.Background(), client, AddCommandReq{ArgX: i, ArgY: i})
+				assert.NoError(t, err)
+				assert.Equal(t, AddCommandRes{Result: 2 * i}, res)
+			}()
+		}
+		wg.Wait()
+	})
+
+	t.Run("future", func(t *testing.T) {
+		tup := commands.Future[AddCommandReq, AddCommandRes](context.Background(), client, AddCommandReq{ArgX: 1, ArgY: 2}).Wait()
+		assert.NoError(t, tup.Val2)
+		assert.Equal(t, AddCommandRes{Result: 3}, tup.Val1)
+	})
+
+	t.Run("progress", func(t *testing.T) {
+		progresses := make([]commands.Progress, 0)
+		ctx := commands.ContextWithProgress(context.Background(), commands.NewProgressReporter(func(progress commands.Progress) {
+			progresses = append(progresses, progress)
+		}))
+		_, err := client.Handle(ctx, AddCommandReq{})
+		assert.NoError(t, err)
+		assert.Equal(t, []commands.Progress{{Percent: 50, Stage: "add"}}, progresses)
+	})
+
+	t.Run("remote errors", func(t *testing.T) {
+		_, err := client.Handle(context.Background(), FailCommandReq{})
+		remoteErr := &RemoteError{}
+		assert.ErrorAs(t, err, &remoteErr)
+		assert.Equal(t, "failure", remoteErr.Message)
+
+		_, err = client.Handle(context.Background(), ValidCommandReq{})
+		assert.ErrorIs(t, err, commands.ErrValidationFailure)
+		assert.ErrorAs(t, err, &remoteErr)
+		assert.Len(t, remoteErr.Fields, 1)
+	})
+
+	t.Run("handler missing", func(t *testing.T) {
+		_, err := client.Handle(context.Background(), struct{}{})
+		assert.ErrorIs(t, err, commands.ErrHandlerMissing)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-waiter.started
+			cancel()
+		}()
+		_, err := client.Handle(ctx, WaitCommandReq{Key: "cancel"})
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, "cancel", <-waiter.canceled)
+	})
+
+	t.Run("concurrency limit", func(t *testing.T) {
+		first := client.Future(context.Background(), WaitCommandReq{Key: "a"})
+		second := client.Future(context.Background(), WaitCommandReq{Key: "b"})
+		<-waiter.started
+		<-waiter.started
+		_, err := client.Handle(context.Background(), AddCommandReq{})
+		assert.ErrorIs(t, err, ErrConcurrencyLimit)
+		waiter.release <- struct{}{}
+		waiter.release <- struct{}{}
+		assert.NoError(t, first.Wait().Val2)
+		assert.NoError(t, second.Wait().Val2)
+	})
+}
+
+func Test_Client_Stream(t *testing.T) {
+	url, _ := newTestServer(t)
+	client := newTestClient(t, url)
+
+	t.Run("default", func(t *testing.T) {
+		items := make([]RangeCommandItem, 0)
+		for item, err := range commands.Stream[RangeCommandReq, RangeCommandItem](context.Background(), client, RangeCommandReq{To: 3}) {
+			assert.NoError(t, err)
+			items = append(items, item)
+		}
+		assert.Equal(t, []RangeCommandItem{{Value: 1}, {Value: 2}, {Value: 3}}, items)
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		errs := make([]error, 0)
+		for _, err := range client.Stream(context.Background(), RangeCommandReq{To: 3, FailAt: 2}) {
+			errs = append(errs, err)
+		}
+		assert.Len(t, errs, 2)
+		assert.NoError(t, errs[0])
+		assert.ErrorContains(t, errs[1], "failure")
+	})
+
+	t.Run("break", func(t *testing.T) {
+		for item, err := range client.Stream(context.Background(), RangeCommandReq{To: 1000000}) {
+			assert.NoError(t, err)
+			assert.Equal(t, RangeCommandItem{Value: 1}, item)
+			break
+		}
+		res, err := client.Handle(context.Background(), AddCommandReq{ArgX: 1})
+		assert.NoError(t, err)
+		assert.Equal(t, AddCommandRes{Result: 1}, res)
+	})
+
+	t.Run("handler missing", func(t *testing.T) {
+		for _, err := range client.Stream(context.Background(), AddCommandReq{}) {
+			assert.ErrorIs(t, err, commands.ErrHandlerMissing)
+		}
+	})
+}
+
+func Test_Client_TypeMap(t *testing.T) {
+	url, _ := newTestServer(t)
+	client := newTestClient(t, url)
+	assert.Len(t, client.TypeMap(), 4)
+	assert.Len(t, client.StreamTypeMap(), 1)
+	assert.True(t, client.IsStream(reflect.TypeFor[RangeCommandReq]()))
+	assert.False(t, client.IsStream(reflect.TypeFor[AddCommandReq]()))
+}
+
+func Test_Client_Close(t *testing.T) {
+	url, waiter := newTestServer(t)
+	client := newTestClient(t, url)
+
+	fut := client.Future(context.Background(), WaitCommandReq{Key: "close"})
+	<-waiter.started
+	assert.NoError(t, client.Close())
+	assert.ErrorIs(t, fut.Wait().Val2, ErrConnectionClosed)
+	<-waiter.canceled
+
+	_, err := client.Handle(context.Background(), AddCommandReq{})
+	assert.ErrorIs(t, err, ErrConnectionClosed)
+}
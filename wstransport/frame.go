@@ -0,0 +1,137 @@
+package wstransport
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/dan-lugg/go-commands/commands"
+	"github.com/dan-lugg/go-commands/httptransport"
+)
+
+var (
+	ErrInvalidFrame     = errors.New("invalid frame")
+	ErrDuplicateID      = errors.New("duplicate frame id")
+	ErrConcurrencyLimit = errors.New("concurrency limit reached")
+	ErrConnectionClosed = errors.New("connection closed")
+)
+
+// FrameType distinguishes the frames exchanged over a connection.
+type FrameType string
+
+const (
+	// FrameRequest is the type of a frame sent by a client to dispatch a command. It is the
+	// type of a frame sent without one.
+	FrameRequest FrameType = "request"
+	// FrameCancel is the type of a frame sent by a client to cancel the request with its ID.
+	FrameCancel FrameType = "cancel"
+	// FrameResult is the type of the frame answering a request with its encoded result.
+	FrameResult FrameType = "result"
+	// FrameItem is the type of a frame carrying one encoded item of a streamed request.
+	FrameItem FrameType = "item"
+	// FrameEnd is the type of the frame ending the items of a streamed request.
+	FrameEnd FrameType = "end"
+	// FrameProgress is the type of a frame carrying the progress reported by the handler of a request.
+	FrameProgress FrameType = "progress"
+	// FrameError is the type of the frame answering a request that failed.
+	FrameError FrameType = "error"
+)
+
+// Frame is a JSON message exchanged over a connection. Requests are answered by frames with
+// the same ID, in the order they complete rather than the order they were sent.
+//
+// Fields:
+//   - Type: The FrameType of the frame; an empty type is a FrameRequest.
+//   - ID: The ID chosen by the client for a request, echoed in every frame answering it.
+//   - Name: The mapped name of the request type, for a FrameRequest.
+//   - Payload: The serialized request, for a FrameRequest.
+//   - Result: The encoded result or item, for a FrameResult or FrameItem.
+//   - Progress: The reported progress, for a FrameProgress.
+//   - Status: The HTTP status code StatusCode maps the failure to, for a FrameError.
+//   - Error: A human-readable description of the failure, for a FrameError.
+//   - Kind: The machine-readable kind of the failure, as returned by ErrorKind, for a FrameError.
+//   - Fields: The field-level violations, if the failure is a commands.ValidationError.
+type Frame struct {
+	Type     FrameType             `json:"type,omitempty"`
+	ID       string                `json:"id,omitempty"`
+	Name     string                `json:"name,omitempty"`
+	Payload  json.RawMessage       `json:"payload,omitempty"`
+	Result   json.RawMessage       `json:"result,omitempty"`
+	Progress *commands.Progress    `json:"progress,omitempty"`
+	Status   int                   `json:"status,omitempty"`
+	Error    string                `json:"error,omitempty"`
+	Kind     string                `json:"kind,omitempty"`
+	Fields   []commands.FieldError `json:"fields,omitempty"`
+}
+
+// errorFrame returns the FrameError answering the request with an ID.
+func errorFrame(id string, err error) Frame {
+	frame := Frame{Type: FrameError, ID: id, Status: StatusCode(err), Error: err.Error(), Kind: ErrorKind(err)}
+	var validationErr *commands.ValidationError
+	if errors.As(err, &validationErr) {
+		frame.Fields = validationErr.Fields
+	}
+	return frame
+}
+
+// StatusCode maps an error returned while serving a frame to the HTTP status code carried by its
+// FrameError, deferring to httptransport.StatusCode for the errors of the commands.
+//
+// Parameters:
+//   - err: The error to map.
+//
+// Returns:
+//   - The HTTP status code for err.
+func StatusCode(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidFrame):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrDuplicateID):
+		return http.StatusConflict
+	case errors.Is(err, ErrConcurrencyLimit):
+		return http.StatusTooManyRequests
+	default:
+		return httptransport.StatusCode(err)
+	}
+}
+
+// ErrorKind returns the machine-readable kind of an error returned while serving a frame,
+// deferring to httptransport.ErrorKind for the errors of the commands.
+//
+// Parameters:
+//   - err: The error to classify.
+//
+// Returns:
+//   - The kind of err, or an empty string if it has none.
+func ErrorKind(err error) string {
+	for _, kind := range []error{ErrInvalidFrame, ErrDuplicateID, ErrConcurrencyLimit} {
+		if errors.Is(err, kind) {
+			return kind.Error()
+		}
+	}
+	return httptransport.ErrorKind(err)
+}
+
+// RemoteError is returned by a Client when the remote Server answers a request with a FrameError.
+//
+// RemoteError matches the sentinel error named by the kind of the FrameError, as
+// httptransport.RemoteError does, as well as ErrInvalidFrame, ErrDuplicateID and ErrConcurrencyLimit.
+type RemoteError struct {
+	httptransport.RemoteError
+}
+
+// Is reports whether the RemoteError corresponds to the target sentinel error.
+//
+// Parameters:
+//   - target: The error to compare against.
+//
+// Returns:
+//   - true if the kind of the RemoteError is the one ErrorKind returns for target.
+func (e *RemoteError) Is(target error) bool {
+	switch target {
+	case ErrInvalidFrame, ErrDuplicateID, ErrConcurrencyLimit:
+		return e.Kind != "" && e.Kind == target.Error()
+	default:
+		return e.RemoteError.Is(target)
+	}
+}
@@ -0,0 +1,53 @@
+package wstransport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/dan-lugg/go-commands/commands"
+	"github.com/dan-lugg/go-commands/httptransport"
+	"github.com/dan-lugg/go-commands/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_StatusCode(t *testing.T) {
+	assert.Equal(t, http.StatusBadRequest, StatusCode(fmt.Errorf("%w: id is empty", ErrInvalidFrame)))
+	assert.Equal(t, http.StatusConflict, StatusCode(ErrDuplicateID))
+	assert.Equal(t, http.StatusTooManyRequests, StatusCode(ErrConcurrencyLimit))
+	assert.Equal(t, http.StatusNotFound, StatusCode(commands.ErrMappingMissing))
+	assert.Equal(t, http.StatusInternalServerError, StatusCode(context.Canceled))
+}
+
+func Test_ErrorKind(t *testing.T) {
+	assert.Equal(t, ErrInvalidFrame.Error(), ErrorKind(fmt.Errorf("%w: id is empty", ErrInvalidFrame)))
+	assert.Equal(t, ErrConcurrencyLimit.Error(), ErrorKind(ErrConcurrencyLimit))
+	assert.Equal(t, commands.ErrMappingMissing.Error(), ErrorKind(commands.ErrMappingMissing))
+	assert.Empty(t, ErrorKind(context.Canceled))
+}
+
+func Test_RemoteError_Is(t *testing.T) {
+	remoteErr := func(statusCode int, err error) error {
+		return &RemoteError{RemoteError: httptransport.RemoteError{StatusCode: statusCode, Message: "remote", Kind: ErrorKind(err)}}
+	}
+	assert.ErrorIs(t, remoteErr(http.StatusTooManyRequests, ErrConcurrencyLimit), ErrConcurrencyLimit)
+	assert.False(t, errors.Is(remoteErr(http.StatusTooManyRequests, ErrConcurrencyLimit), middleware.ErrRateLimited))
+	assert.ErrorIs(t, remoteErr(http.StatusTooManyRequests, middleware.ErrRateLimited), middleware.ErrRateLimited)
+	assert.False(t, errors.Is(remoteErr(http.StatusTooManyRequests, middleware.ErrRateLimited), ErrConcurrencyLimit))
+	assert.ErrorIs(t, remoteErr(http.StatusConflict, ErrDuplicateID), ErrDuplicateID)
+	assert.ErrorIs(t, remoteErr(http.StatusBadRequest, ErrInvalidFrame), ErrInvalidFrame)
+	assert.ErrorIs(t, remoteErr(http.StatusNotFound, commands.ErrMappingMissing), commands.ErrMappingMissing)
+	assert.False(t, errors.Is(remoteErr(http.StatusNotFound, nil), commands.ErrMappingMissing))
+	assert.Equal(t, "remote error: status 404: remote", remoteErr(http.StatusNotFound, nil).Error())
+}
+
+func Test_errorFrame(t *testing.T) {
+	frame := errorFrame("1", &commands.ValidationError{Fields: []commands.FieldError{{Field: "Name"}}})
+	assert.Equal(t, FrameError, frame.Type)
+	assert.Equal(t, "1", frame.ID)
+	assert.Equal(t, http.StatusUnprocessableEntity, frame.Status)
+	assert.Equal(t, commands.ErrValidationFailure.Error(), frame.Kind)
+	assert.Len(t, frame.Fields, 1)
+}
@@ -0,0 +1,186 @@
+package wstransport
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dan-lugg/go-commands/commands"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	AddReqName   = "add"
+	FailReqName  = "fail"
+	ValidReqName = "valid"
+	WaitReqName  = "wait"
+	RangeReqName = "range"
+)
+
+var ErrFailure = errors.New("failure")
+
+type AddCommandRes struct {
+	Result int `json:"result"`
+}
+
+type AddCommandReq struct {
+	ArgX int `json:"argX"`
+	ArgY int `json:"argY"`
+}
+
+type AddHandler struct {
+	commands.Handler[AddCommandReq, AddCommandRes]
+}
+
+func (h *AddHandler) Handle(ctx context.Context, req AddCommandReq) (res AddCommandRes, err error) {
+	commands.ReportProgress(ctx, 50, "add", "")
+	return AddCommandRes{Result: req.ArgX + req.ArgY}, nil
+}
+
+type FailCommandRes struct{}
+
+type FailCommandReq struct{}
+
+type FailHandler struct {
+	commands.Handler[FailCommandReq, FailCommandRes]
+}
+
+func (h *FailHandler) Handle(ctx context.Context, req FailCommandReq) (res FailCommandRes, err error) {
+	return FailCommandRes{}, ErrFailure
+}
+
+type ValidCommandRes struct{}
+
+type ValidCommandReq struct {
+	Name string `json:"name" validate:"required"`
+}
+
+type ValidHandler struct {
+	commands.Handler[ValidCommandReq, ValidCommandRes]
+}
+
+func (h *ValidHandler) Handle(ctx context.Context, req ValidCommandReq) (res ValidCommandRes, err error) {
+	return ValidCommandRes{}, nil
+}
+
+type WaitCommandRes struct {
+	Key string `json:"key"`
+}
+
+type WaitCommandReq struct {
+	Key string `json:"key"`
+}
+
+// Waiter releases the WaitCommandReq requests handled by WaitHandler, and signals when they
+// start and when they are canceled.
+type Waiter struct {
+	started  chan string
+	canceled chan string
+	release  chan struct{}
+}
+
+func NewWaiter() *Waiter {
+	return &Waiter{
+		started:  make(chan string, 16),
+		canceled: make(chan string, 16),
+		release:  make(chan struct{}),
+	}
+}
+
+type WaitHandler struct {
+	commands.Handler[WaitCommandReq, WaitCommandRes]
+	waiter *Waiter
+}
+
+func (h *WaitHandler) Handle(ctx context.Context, req WaitCommandReq) (res WaitCommandRes, err error) {
+	h.waiter.started <- req.Key
+	select {
+	case <-h.waiter.release:
+		return WaitCommandRes{Key: req.Key}, nil
+	case <-ctx.Done():
+		h.waiter.canceled <- req.Key
+		return WaitCommandRes{}, ctx.Err()
+	}
+}
+
+type RangeCommandItem struct {
+	Value int `json:"value"`
+}
+
+type RangeCommandReq struct {
+	To     int `json:"to"`
+	FailAt int `json:"failAt"`
+}
+
+type RangeHandler struct {
+	commands.StreamHandler[RangeCommandReq, RangeCommandItem]
+}
+
+func (h *RangeHandler) Stream(ctx context.Context, req RangeCommandReq) iter.Seq2[RangeCommandItem, error] {
+	return func(yield func(RangeCommandItem, error) bool) {
+		for i := 1; i <= req.To; i++ {
+			if i == req.FailAt {
+				yield(RangeCommandItem{}, ErrFailure)
+				return
+			}
+			if !yield(RangeCommandItem{Value: i}, nil) {
+				return
+			}
+		}
+	}
+}
+
+func newCatalogs() (*commands.DefaultMappingCatalog, *commands.DefaultDecoderCatalog, *commands.DefaultHandlerCatalog, *Waiter) {
+	mappingCatalog := commands.NewMappingCatalog()
+	commands.InsertMapping[AddCommandReq](mappingCatalog, AddReqName)
+	commands.InsertMapping[FailCommandReq](mappingCatalog, FailReqName)
+	commands.InsertMapping[ValidCommandReq](mappingCatalog, ValidReqName)
+	commands.InsertMapping[WaitCommandReq](mappingCatalog, WaitReqName)
+	commands.InsertMapping[RangeCommandReq](mappingCatalog, RangeReqName)
+
+	decoderCatalog := commands.NewDefaultDecoderCatalog()
+	commands.InsertDecoder[AddCommandReq](decoderCatalog, commands.DefaultDecoder[AddCommandReq]())
+	commands.InsertDecoder[FailCommandReq](decoderCatalog, commands.DefaultDecoder[FailCommandReq]())
+	commands.InsertDecoder[ValidCommandReq](decoderCatalog, commands.DefaultDecoder[ValidCommandReq]())
+	commands.InsertDecoder[WaitCommandReq](decoderCatalog, commands.DefaultDecoder[WaitCommandReq]())
+	commands.InsertDecoder[RangeCommandReq](decoderCatalog, commands.DefaultDecoder[RangeCommandReq]())
+
+	waiter := NewWaiter()
+	handlerCatalog := commands.NewDefaultHandlerCatalog()
+	commands.InsertHandler[AddCommandReq, AddCommandRes](handlerCatalog, func() commands.Handler[AddCommandReq, AddCommandRes] {
+		return &AddHandler{}
+	})
+	commands.InsertHandler[FailCommandReq, FailCommandRes](handlerCatalog, func() commands.Handler[FailCommandReq, FailCommandRes] {
+		return &FailHandler{}
+	})
+	commands.InsertHandler[ValidCommandReq, ValidCommandRes](handlerCatalog, func() commands.Handler[ValidCommandReq, ValidCommandRes] {
+		return &ValidHandler{}
+	})
+	commands.InsertHandler[WaitCommandReq, WaitCommandRes](handlerCatalog, func() commands.Handler[WaitCommandReq, WaitCommandRes] {
+		return &WaitHandler{waiter: waiter}
+	})
+	commands.InsertStreamHandler[RangeCommandReq, RangeCommandItem](handlerCatalog, func() commands.StreamHandler[RangeCommandReq, RangeCommandItem] {
+		return &RangeHandler{}
+	})
+	return mappingCatalog, decoderCatalog, handlerCatalog, waiter
+}
+
+// newTestServer serves a Server over httptest and returns the ws:// URL of it.
+func newTestServer(t *testing.T, options ...ServerOption) (url string, waiter *Waiter) {
+	mappingCatalog, decoderCatalog, handlerCatalog, waiter := newCatalogs()
+	httpServer := httptest.NewServer(NewServer(mappingCatalog, decoderCatalog, handlerCatalog, options...))
+	t.Cleanup(httpServer.Close)
+	return "ws" + strings.TrimPrefix(httpServer.URL, "http"), waiter
+}
+
+// dial opens a raw connection to a Server, closed when the test ends.
+func dial(t *testing.T, url string) *websocket.Conn {
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
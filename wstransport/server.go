@@ -0,0 +1,392 @@
+package wstransport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/dan-lugg/go-commands/commands"
+	"github.com/dan-lugg/go-commands/util"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// DefaultMaxConcurrency is the number of requests a Server runs at once on a connection,
+	// unless overridden with WithMaxConcurrency.
+	DefaultMaxConcurrency = 16
+
+	// DefaultPingInterval is the interval at which a Server pings a connection, unless
+	// overridden with WithPingInterval.
+	DefaultPingInterval = 30 * time.Second
+
+	// DefaultMaxMessageSize is the maximum size, in bytes, of a frame accepted by a Server,
+	// unless overridden with WithMaxMessageSize.
+	DefaultMaxMessageSize int64 = 1 << 20
+
+	// writeWait is how long a frame may take to be written before the connection is dropped.
+	writeWait = 10 * time.Second
+)
+
+// Server is an http.Handler that upgrades requests to WebSocket connections and serves the
+// cataloged commands over them.
+//
+// Each FrameRequest is dispatched by name through a commands.Dispatcher, concurrently with the
+// other requests of the connection, and answered with a FrameResult or a FrameError carrying
+// its ID. If the HandlerCatalog implements commands.StreamCatalog and streams the request type,
+// each item is sent as a FrameItem, followed by a FrameEnd. The Progress reported by a handler
+// is sent as FrameProgress frames while it runs.
+//
+// A FrameCancel cancels the context.Context of the request with its ID. Requests beyond the
+// concurrency limit of a connection, or reusing the ID of a request in flight, are answered
+// with a FrameError. The Server pings each connection and drops it if no pong arrives within
+// two intervals; closing a connection cancels its requests.
+//
+// Fields:
+//   - handlerCatalog: The HandlerCatalog the requests are dispatched through.
+//   - encoderCatalog: An optional EncoderCatalog used to encode results.
+//   - dispatcher: The commands.Dispatcher used to decode requests and encode results.
+//   - upgrader: The websocket.Upgrader used to upgrade requests.
+//   - maxConcurrency: The number of requests run at once on a connection.
+//   - pingInterval: The interval at which connections are pinged; a non-positive value disables pings.
+//   - maxMessageSize: The maximum size, in bytes, of a frame.
+type Server struct {
+	handlerCatalog commands.HandlerCatalog
+	encoderCatalog commands.EncoderCatalog
+	dispatcher     *commands.Dispatcher
+	upgrader       websocket.Upgrader
+	maxConcurrency int
+	pingInterval   time.Duration
+	maxMessageSize int64
+}
+
+type ServerOption = util.Option[*Server]
+
+// WithMaxConcurrency returns an option that sets the number of requests a Server runs at once
+// on a connection. Requests beyond it are answered with a FrameError wrapping ErrConcurrencyLimit.
+//
+// Parameters:
+//   - maxConcurrency: The number of requests run at once; values below 1 are treated as 1.
+func WithMaxConcurrency(maxConcurrency int) ServerOption {
+	return func(s *Server) {
+		s.maxConcurrency = max(maxConcurrency, 1)
+	}
+}
+
+// WithPingInterval returns an option that sets the interval at which a Server pings its connections.
+//
+// Parameters:
+//   - pingInterval: The interval between pings; a non-positive value disables pings.
+func WithPingInterval(pingInterval time.Duration) ServerOption {
+	return func(s *Server) {
+		s.pingInterval = pingInterval
+	}
+}
+
+// WithMaxMessageSize returns an option that sets the maximum size of a frame accepted by a Server.
+// A larger frame closes the connection.
+//
+// Parameters:
+//   - maxMessageSize: The maximum size, in bytes, of a frame.
+func WithMaxMessageSize(maxMessageSize int64) ServerOption {
+	return func(s *Server) {
+		s.maxMessageSize = maxMessageSize
+	}
+}
+
+// WithCheckOrigin returns an option that sets the function deciding whether a Server accepts
+// the Origin of an upgrade request. By default, cross-origin requests are rejected.
+//
+// Parameters:
+//   - checkOrigin: The function returning whether the request is accepted.
+func WithCheckOrigin(checkOrigin func(request *http.Request) bool) ServerOption {
+	return func(s *Server) {
+		s.upgrader.CheckOrigin = checkOrigin
+	}
+}
+
+// WithEncoderCatalog returns an option that sets the EncoderCatalog a Server encodes results
+// with. The encoders must produce JSON, as results are embedded in the frames. Without an
+// EncoderCatalog, results are encoded with json.Marshal.
+//
+// Parameters:
+//   - encoderCatalog: The EncoderCatalog used to encode results.
+func WithEncoderCatalog(encoderCatalog commands.EncoderCatalog) ServerOption {
+	return func(s *Server) {
+		s.encoderCatalog = encoderCatalog
+	}
+}
+
+// NewServer creates and returns a new instance of Server.
+//
+// By default the Server uses DefaultMaxConcurrency, DefaultPingInterval and DefaultMaxMessageSize.
+//
+// Parameters:
+//   - mappingCatalog: The MappingCatalog used to resolve request names to types.
+//   - decoderCatalog: The DecoderCatalog used to decode payloads.
+//   - handlerCatalog: The HandlerCatalog used to dispatch decoded requests.
+//   - options: Options applied to the Server.
+//
+// Returns:
+//   - A pointer to a Server instance.
+func NewServer(mappingCatalog commands.MappingCatalog, decoderCatalog commands.DecoderCatalog, handlerCatalog commands.HandlerCatalog, options ...ServerOption) (server *Server) {
+	server = &Server{
+		handlerCatalog: handlerCatalog,
+		encoderCatalog: nil,
+		upgrader:       websocket.Upgrader{},
+		maxConcurrency: DefaultMaxConcurrency,
+		pingInterval:   DefaultPingInterval,
+		maxMessageSize: DefaultMaxMessageSize,
+	}
+	for _, option := range options {
+		option(server)
+	}
+	server.dispatcher = commands.NewDispatcher(mappingCatalog, decoderCatalog, handlerCatalog,
+		commands.WithEncoderCatalog(server.encoderCatalog))
+	return server
+}
+
+// ServeHTTP upgrades a request to a WebSocket connection and serves it until it closes.
+// A request that cannot be upgraded is answered with an HTTP error by the websocket.Upgrader.
+func (s *Server) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	conn, err := s.upgrader.Upgrade(writer, request, nil)
+	if err != nil {
+		return
+	}
+	defer func() { _ = conn.Close() }()
+	_ = s.ServeConn(request.Context(), conn)
+}
+
+// ServeConn serves the frames of a WebSocket connection until it closes, then waits for its
+// requests to return. The connection is not closed.
+//
+// Parameters:
+//   - ctx: A context.Context providing context for the dispatches; once it ends, the requests are canceled.
+//   - conn: The connection the frames are read from and written to.
+//
+// Returns:
+//   - An error if the connection fails or a frame cannot be written; nil once the client closes
+//     the connection normally, or ctx ends.
+func (s *Server) ServeConn(ctx context.Context, conn *websocket.Conn) (err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	session := &session{
+		mutex:    sync.Mutex{},
+		writer:   sync.Mutex{},
+		conn:     conn,
+		cancel:   cancel,
+		inflight: make(map[string]context.CancelFunc),
+		err:      nil,
+	}
+
+	conn.SetReadLimit(s.maxMessageSize)
+	deadline := func() time.Time {
+		if ctx.Err() != nil {
+			return time.Now()
+		}
+		if s.pingInterval > 0 {
+			return time.Now().Add(2 * s.pingInterval)
+		}
+		return time.Time{}
+	}
+	_ = conn.SetReadDeadline(deadline())
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(deadline())
+	})
+	if s.pingInterval > 0 {
+		go session.ping(ctx, s.pingInterval)
+	}
+	// Ending ctx interrupts the pending read, without closing the connection.
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
+	wg := sync.WaitGroup{}
+	for ctx.Err() == nil {
+		var data []byte
+		if _, data, err = conn.ReadMessage(); err != nil {
+			if ctx.Err() != nil || websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
+				err = nil
+			}
+			break
+		}
+		frame := Frame{}
+		if err := json.Unmarshal(data, &frame); err != nil {
+			session.write(errorFrame("", fmt.Errorf("%w: %w", ErrInvalidFrame, err)))
+			continue
+		}
+		switch frame.Type {
+		case FrameRequest, "":
+			reqCtx, err := session.start(ctx, frame, s.maxConcurrency)
+			if err != nil {
+				session.write(errorFrame(frame.ID, err))
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				final, ok := s.dispatch(reqCtx, session, frame)
+				// The request leaves those in flight before its final frame is written, so the
+				// client may reuse its ID, or its slot, as soon as it reads that frame.
+				session.finish(frame.ID)
+				if ok {
+					session.write(final)
+				}
+			}()
+		case FrameCancel:
+			session.cancelRequest(frame.ID)
+		default:
+			session.write(errorFrame(frame.ID, fmt.Errorf("%w: unexpected type: %s", ErrInvalidFrame, frame.Type)))
+		}
+	}
+	cancel()
+	wg.Wait()
+	return errors.Join(err, session.err)
+}
+
+// dispatch decodes and dispatches a FrameRequest, writing its FrameProgress and FrameItem
+// frames and returning the final frame answering it, or false if a frame could not be written.
+func (s *Server) dispatch(ctx context.Context, session *session, frame Frame) (final Frame, ok bool) {
+	req, err := s.dispatcher.Decode(frame.Name, frame.Payload)
+	if err != nil {
+		return errorFrame(frame.ID, err), true
+	}
+
+	if streamCatalog, ok := s.handlerCatalog.(commands.StreamCatalog); ok && streamCatalog.IsStream(reflect.TypeOf(req)) {
+		for item, err := range streamCatalog.Stream(ctx, req) {
+			var itemData []byte
+			if err == nil {
+				itemData, err = s.dispatcher.Encode(item)
+			}
+			if err != nil {
+				return errorFrame(frame.ID, err), true
+			}
+			if !session.write(Frame{Type: FrameItem, ID: frame.ID, Result: itemData}) {
+				return Frame{}, false
+			}
+		}
+		return Frame{Type: FrameEnd, ID: frame.ID}, true
+	}
+
+	// Progress frames are written off the goroutine of the handler, and stale ones are dropped,
+	// so a slow connection never blocks a report.
+	observer, stop := commands.QueuedProgressObserver(func(progress commands.Progress) {
+		session.write(Frame{Type: FrameProgress, ID: frame.ID, Progress: &progress})
+	})
+	res, err := s.handlerCatalog.Handle(commands.ContextWithProgress(ctx, commands.NewProgressReporter(observer)), req)
+	stop()
+	var resData []byte
+	if err == nil {
+		resData, err = s.dispatcher.Encode(res)
+	}
+	if err != nil {
+		return errorFrame(frame.ID, err), true
+	}
+	return Frame{Type: FrameResult, ID: frame.ID, Result: resData}, true
+}
+
+// session is the state of a connection served by a Server.
+//
+// Fields:
+//   - conn: The connection.
+//   - cancel: The function canceling the context.Context of the connection.
+//   - inflight: A map that associates the IDs of the requests in flight with the functions canceling them.
+//   - writer: A mutex ensuring frames are written one at a time.
+//   - err: The error of the first frame that could not be written, ending the connection.
+type session struct {
+	mutex    sync.Mutex
+	writer   sync.Mutex
+	conn     *websocket.Conn
+	cancel   context.CancelFunc
+	inflight map[string]context.CancelFunc
+	err      error
+}
+
+// start registers the request of a FrameRequest in flight and returns its context.Context.
+func (s *session) start(ctx context.Context, frame Frame, maxConcurrency int) (context.Context, error) {
+	switch {
+	case frame.ID == "":
+		return nil, fmt.Errorf("%w: id is empty", ErrInvalidFrame)
+	case frame.Name == "":
+		return nil, fmt.Errorf("%w: name is empty", ErrInvalidFrame)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, found := s.inflight[frame.ID]; found {
+		return nil, fmt.Errorf("%w: %s", ErrDuplicateID, frame.ID)
+	}
+	if len(s.inflight) >= maxConcurrency {
+		return nil, fmt.Errorf("%w: %d requests in flight", ErrConcurrencyLimit, len(s.inflight))
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	s.inflight[frame.ID] = cancel
+	return ctx, nil
+}
+
+// finish removes a request from those in flight.
+func (s *session) finish(id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if cancel, found := s.inflight[id]; found {
+		cancel()
+		delete(s.inflight, id)
+	}
+}
+
+// cancelRequest cancels the context.Context of a request in flight, if any.
+func (s *session) cancelRequest(id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if cancel, found := s.inflight[id]; found {
+		cancel()
+	}
+}
+
+// write writes a frame, one at a time, and reports whether it was written. A failed write
+// cancels the connection.
+func (s *session) write(frame Frame) bool {
+	data, err := json.Marshal(frame)
+	if err != nil {
+		data, _ = json.Marshal(errorFrame(frame.ID, fmt.Errorf("failed to encode frame: %w", err)))
+	}
+	s.writer.Lock()
+	defer s.writer.Unlock()
+	if s.err != nil {
+		return false
+	}
+	_ = s.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	if err = s.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		s.err = fmt.Errorf("failed to write frame: %w", err)
+		s.cancel()
+		return false
+	}
+	return true
+}
+
+// ping pings the connection at an interval until ctx ends. A failed ping closes the connection,
+// ending its reads.
+func (s *session) ping(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				if !errors.Is(err, websocket.ErrCloseSent) {
+					_ = s.conn.Close()
+				}
+				return
+			}
+		}
+	}
+}
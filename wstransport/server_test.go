@@ -0,0 +1,215 @@
+package wstransport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dan-lugg/go-commands/commands"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_NewServer(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		mappingCatalog, decoderCatalog, handlerCatalog, _ := newCatalogs()
+		server := NewServer(mappingCatalog, decoderCatalog, handlerCatalog)
+		assert.NotNil(t, server)
+		assert.NotNil(t, server.dispatcher)
+		assert.Equal(t, DefaultMaxConcurrency, server.maxConcurrency)
+		assert.Equal(t, DefaultPingInterval, server.pingInterval)
+		assert.Equal(t, DefaultMaxMessageSize, server.maxMessageSize)
+	})
+
+	t.Run("with options", func(t *testing.T) {
+		mappingCatalog, decoderCatalog, handlerCatalog, _ := newCatalogs()
+		server := NewServer(mappingCatalog, decoderCatalog, handlerCatalog,
+			WithMaxConcurrency(0), WithPingInterval(time.Second), WithMaxMessageSize(64),
+			WithCheckOrigin(func(request *http.Request) bool { return true }))
+		assert.Equal(t, 1, server.maxConcurrency)
+		assert.Equal(t, time.Second, server.pingInterval)
+		assert.Equal(t, int64(64), server.maxMessageSize)
+		assert.NotNil(t, server.upgrader.CheckOrigin)
+	})
+}
+
+func Test_Server_ServeHTTP(t *testing.T) {
+	url, waiter := newTestServer(t, WithMaxConcurrency(2))
+
+	exchange := func(conn *websocket.Conn, frame any) Frame {
+		assert.NoError(t, conn.WriteJSON(frame))
+		reply := Frame{}
+		assert.NoError(t, conn.ReadJSON(&reply))
+		return reply
+	}
+
+	t.Run("result", func(t *testing.T) {
+		conn := dial(t, url)
+		reply := exchange(conn, Frame{ID: "1", Name: AddReqName, Payload: []byte(`{"argX": 3, "argY": 4}`)})
+		assert.Equal(t, Frame{Type: FrameProgress, ID: "1", Progress: &commands.Progress{Percent: 50, Stage: "add"}}, reply)
+		reply = Frame{}
+		assert.NoError(t, conn.ReadJSON(&reply))
+		assert.Equal(t, FrameResult, reply.Type)
+		assert.Equal(t, "1", reply.ID)
+		assert.JSONEq(t, `{"result": 7}`, string(reply.Result))
+	})
+
+	t.Run("out of order", func(t *testing.T) {
+		conn := dial(t, url)
+		assert.NoError(t, conn.WriteJSON(Frame{Type: FrameRequest, ID: "slow", Name: WaitReqName, Payload: []byte(`{"key": "slow"}`)}))
+		assert.Equal(t, "slow", <-waiter.started)
+		assert.NoError(t, conn.WriteJSON(Frame{ID: "fast", Name: AddReqName, Payload: []byte(`{"argX": 1, "argY": 1}`)}))
+		ids := make([]string, 0)
+		for len(ids) < 2 {
+			reply := Frame{}
+			assert.NoError(t, conn.ReadJSON(&reply))
+			if reply.Type == FrameResult {
+				ids = append(ids, reply.ID)
+			}
+			if reply.ID == "fast" && reply.Type == FrameResult {
+				waiter.release <- struct{}{}
+			}
+		}
+		assert.Equal(t, []string{"fast", "slow"}, ids)
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		conn := dial(t, url)
+		assert.NoError(t, conn.WriteJSON(Frame{ID: "1", Name: WaitReqName, Payload: []byte(`{"key": "cancel"}`)}))
+		assert.Equal(t, "cancel", <-waiter.started)
+		reply := exchange(conn, Frame{Type: FrameCancel, ID: "1"})
+		assert.Equal(t, "cancel", <-waiter.canceled)
+		assert.Equal(t, FrameError, reply.Type)
+		assert.Equal(t, "1", reply.ID)
+		assert.Equal(t, "context canceled", reply.Error)
+
+		// Canceling an unknown request is ignored
+		assert.NoError(t, conn.WriteJSON(Frame{Type: FrameCancel, ID: "unknown"}))
+		reply = exchange(conn, Frame{ID: "2", Name: AddReqName, Payload: []byte(`{}`)})
+		assert.Equal(t, "2", reply.ID)
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		conn := dial(t, url)
+		assert.NoError(t, conn.WriteJSON(Frame{ID: "1", Name: RangeReqName, Payload: []byte(`{"to": 2}`)}))
+		replies := make([]Frame, 3)
+		for i := range replies {
+			assert.NoError(t, conn.ReadJSON(&replies[i]))
+		}
+		assert.Equal(t, []Frame{
+			{Type: FrameItem, ID: "1", Result: []byte(`{"value":1}`)},
+			{Type: FrameItem, ID: "1", Result: []byte(`{"value":2}`)},
+			{Type: FrameEnd, ID: "1"},
+		}, replies)
+
+		reply := exchange(conn, Frame{ID: "2", Name: RangeReqName, Payload: []byte(`{"to": 2, "failAt": 1}`)})
+		assert.Equal(t, Frame{Type: FrameError, ID: "2", Status: http.StatusInternalServerError, Error: "failure"}, reply)
+	})
+
+	t.Run("failures", func(t *testing.T) {
+		conn := dial(t, url)
+		reply := exchange(conn, Frame{ID: "1", Name: "unknown"})
+		assert.Equal(t, http.StatusNotFound, reply.Status)
+		reply = exchange(conn, Frame{ID: "2", Name: FailReqName, Payload: []byte(`{}`)})
+		assert.Equal(t, Frame{Type: FrameError, ID: "2", Status: http.StatusInternalServerError, Error: "failure"}, reply)
+		reply = exchange(conn, Frame{ID: "3", Name: ValidReqName, Payload: []byte(`{}`)})
+		assert.Equal(t, http.StatusUnprocessableEntity, reply.Status)
+		assert.Len(t, reply.Fields, 1)
+	})
+
+	t.Run("invalid frames", func(t *testing.T) {
+		conn := dial(t, url)
+		assert.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{`)))
+		reply := Frame{}
+		assert.NoError(t, conn.ReadJSON(&reply))
+		assert.Equal(t, http.StatusBadRequest, reply.Status)
+
+		reply = exchange(conn, Frame{Name: AddReqName})
+		assert.Equal(t, Frame{Type: FrameError, Status: http.StatusBadRequest, Error: "invalid frame: id is empty", Kind: ErrInvalidFrame.Error()}, reply)
+		reply = exchange(conn, Frame{ID: "1"})
+		assert.Equal(t, Frame{Type: FrameError, ID: "1", Status: http.StatusBadRequest, Error: "invalid frame: name is empty", Kind: ErrInvalidFrame.Error()}, reply)
+		reply = exchange(conn, Frame{Type: FrameResult, ID: "1"})
+		assert.Equal(t, http.StatusBadRequest, reply.Status)
+
+		// The connection is still served
+		reply = exchange(conn, Frame{ID: "1", Name: FailReqName, Payload: []byte(`{}`)})
+		assert.Equal(t, "failure", reply.Error)
+	})
+
+	t.Run("duplicate id", func(t *testing.T) {
+		conn := dial(t, url)
+		assert.NoError(t, conn.WriteJSON(Frame{ID: "1", Name: WaitReqName, Payload: []byte(`{"key": "duplicate"}`)}))
+		<-waiter.started
+		reply := exchange(conn, Frame{ID: "1", Name: AddReqName})
+		assert.Equal(t, http.StatusConflict, reply.Status)
+		waiter.release <- struct{}{}
+		assert.NoError(t, conn.ReadJSON(&reply))
+		assert.Equal(t, FrameResult, reply.Type)
+	})
+
+	t.Run("id reused after final frame", func(t *testing.T) {
+		conn := dial(t, url)
+		for range 50 {
+			assert.NoError(t, conn.WriteJSON(Frame{ID: "1", Name: AddReqName, Payload: []byte(`{"argX": 1, "argY": 2}`)}))
+			reply := Frame{}
+			for reply.Type != FrameResult && reply.Type != FrameError {
+				assert.NoError(t, conn.ReadJSON(&reply))
+			}
+			assert.Equal(t, FrameResult, reply.Type)
+		}
+	})
+
+	t.Run("concurrency limit", func(t *testing.T) {
+		conn := dial(t, url)
+		assert.NoError(t, conn.WriteJSON(Frame{ID: "1", Name: WaitReqName, Payload: []byte(`{"key": "a"}`)}))
+		assert.NoError(t, conn.WriteJSON(Frame{ID: "2", Name: WaitReqName, Payload: []byte(`{"key": "b"}`)}))
+		<-waiter.started
+		<-waiter.started
+		reply := exchange(conn, Frame{ID: "3", Name: AddReqName, Payload: []byte(`{}`)})
+		assert.Equal(t, http.StatusTooManyRequests, reply.Status)
+		assert.Equal(t, "3", reply.ID)
+		assert.NoError(t, conn.Close())
+		<-waiter.canceled
+		<-waiter.canceled
+	})
+
+	t.Run("close cancels requests", func(t *testing.T) {
+		conn := dial(t, url)
+		assert.NoError(t, conn.WriteJSON(Frame{ID: "1", Name: WaitReqName, Payload: []byte(`{"key": "close"}`)}))
+		assert.Equal(t, "close", <-waiter.started)
+		assert.NoError(t, conn.Close())
+		assert.Equal(t, "close", <-waiter.canceled)
+	})
+}
+
+func Test_Server_ServeHTTP_Ping(t *testing.T) {
+	url, _ := newTestServer(t, WithPingInterval(10*time.Millisecond))
+	conn := dial(t, url)
+	pings := make(chan struct{}, 16)
+	conn.SetPingHandler(func(data string) error {
+		pings <- struct{}{}
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	for i := 0; i < 3; i++ {
+		select {
+		case <-pings:
+		case <-time.After(time.Second):
+			t.Fatal("no ping received")
+		}
+	}
+}
+
+func Test_Server_ServeHTTP_NotUpgraded(t *testing.T) {
+	mappingCatalog, decoderCatalog, handlerCatalog, _ := newCatalogs()
+	recorder := httptest.NewRecorder()
+	NewServer(mappingCatalog, decoderCatalog, handlerCatalog).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}